@@ -0,0 +1,386 @@
+// Package client is a Go client for the OSB /api/v1 routes.
+//
+// A Client authenticates with an API token or a user name and password, and
+// retries requests that fail temporarily with exponential backoff. Error
+// responses are returned as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Defaults of the retry options.
+const (
+	DefaultRetries    = 3
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// Client calls the OSB API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	username   string
+	password   string
+	userAgent  string
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates requests with an API token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithBasicAuth authenticates requests with a user name and password.
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.username, c.password = username, password
+	}
+}
+
+// WithHTTPClient sets the HTTP client requests are sent with,
+// http.DefaultClient by default.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithUserAgent sets the User-Agent header of requests.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
+
+// WithRetries sets how often a request that failed temporarily is retried,
+// and the bounds of the backoff between attempts. The backoff doubles with
+// every attempt and is jittered.
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.minBackoff, c.maxBackoff = retries, minBackoff, maxBackoff
+	}
+}
+
+// New returns a client for the OSB server at baseURL, such as
+// "https://osb.example.com".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("osb: base URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("osb: base URL: want http or https, got %q", baseURL)
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		userAgent:  "osb-go-client",
+		retries:    DefaultRetries,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request describes an API call.
+type request struct {
+	method string
+	path   string // path below /api/v1, or a full path from a Link header
+	query  url.Values
+	body   interface{} // encoded as JSON if not nil
+	header http.Header
+}
+
+// retryable reports whether a request may be sent again after a failure.
+// Submissions are only retried if the server can tell the attempts apart.
+func (req *request) retryable() bool {
+	switch req.method {
+	case http.MethodGet, http.MethodDelete:
+		return true
+	}
+	return req.header.Get("Idempotency-Key") != ""
+}
+
+// do sends req, retrying temporary failures, and decodes the JSON response
+// into v unless it is nil. It returns the response headers.
+func (c *Client) do(ctx context.Context, req *request, v interface{}) (http.Header, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		header, retryAfter, err := c.send(ctx, req, body, v)
+		if retryAfter < 0 || attempt >= c.retries || !req.retryable() {
+			return header, err
+		}
+		if backoff := c.backoff(attempt); retryAfter < backoff {
+			retryAfter = backoff
+		}
+		t := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// send makes one attempt at req. A non-negative retryAfter means the attempt
+// failed temporarily and may be retried after at least that long.
+func (c *Client) send(ctx context.Context, req *request, body []byte, v interface{}) (header http.Header, retryAfter time.Duration, err error) {
+	u := *c.baseURL
+	path := req.path
+	if !strings.HasPrefix(path, "/api/") {
+		path = "/api/v1" + path
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, -1, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + ref.Path
+	u.RawQuery = ref.RawQuery
+	if req.query != nil {
+		u.RawQuery = req.query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	hr, err := http.NewRequestWithContext(ctx, req.method, u.String(), r)
+	if err != nil {
+		return nil, -1, err
+	}
+	for k, vs := range req.header {
+		hr.Header[k] = vs
+	}
+	hr.Header.Set("Accept", "application/json")
+	hr.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		hr.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		hr.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		hr.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(hr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, -1, ctx.Err()
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := newError(resp)
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return resp.Header, parseRetryAfter(resp.Header.Get("Retry-After")), err
+		}
+		return resp.Header, -1, err
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return resp.Header, -1, fmt.Errorf("osb: decoding response: %v", err)
+		}
+	}
+	return resp.Header, -1, nil
+}
+
+// backoff returns the jittered delay before the retry following attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter returns the delay of a Retry-After header in seconds or as
+// an HTTP date, or 0 if there is none.
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// User is a user.
+type User struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Account is the authenticated user.
+type Account struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Admin bool   `json:"admin"`
+}
+
+// GetUser returns the user with the given id.
+func (c *Client) GetUser(ctx context.Context, id int64) (*User, error) {
+	var u User
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/users/%d", id)}, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Me returns the user the client authenticates as.
+func (c *Client) Me(ctx context.Context) (*Account, error) {
+	var a Account
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: "/me"}, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Token is an API token. Secret is only set by CreateToken.
+type Token struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"token"`
+}
+
+// ListTokens returns the API tokens of the authenticated user.
+func (c *Client) ListTokens(ctx context.Context) ([]*Token, error) {
+	var tokens []*Token
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: "/tokens"}, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// CreateToken creates an API token for the authenticated user. The returned
+// token's Secret cannot be retrieved again.
+func (c *Client) CreateToken(ctx context.Context, name string) (*Token, error) {
+	var t Token
+	req := &request{method: http.MethodPost, path: "/tokens", body: map[string]string{"name": name}}
+	if _, err := c.do(ctx, req, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteToken deletes an API token of the authenticated user.
+func (c *Client) DeleteToken(ctx context.Context, id int64) error {
+	_, err := c.do(ctx, &request{method: http.MethodDelete, path: fmt.Sprintf("/tokens/%d", id)}, nil)
+	return err
+}
+
+// LeaderboardEntry is a result ranked by its Total score.
+type LeaderboardEntry struct {
+	Rank       int               `json:"rank"`
+	ResultID   int64             `json:"result_id"`
+	UserID     int64             `json:"user_id"`
+	User       string            `json:"user"`
+	CreatedAt  time.Time         `json:"created_at"`
+	TotalScore float64           `json:"total_score"`
+	TotalTime  database.Duration `json:"total_time"`
+	Scores     database.Scores   `json:"scores"`
+	SysInfo    *database.SysInfo `json:"system"` // nil if the result has no specs
+}
+
+// leaderboardEntryJSON is a leaderboard entry as /api/v1 serves it.
+type leaderboardEntryJSON struct {
+	Rank        int          `json:"rank"`
+	ResultID    int64        `json:"result_id"`
+	UserID      int64        `json:"user_id"`
+	User        string       `json:"user"`
+	CreatedAt   time.Time    `json:"created_at"`
+	TotalScore  float64      `json:"total_score"`
+	TotalTimeMS float64      `json:"total_time_ms"`
+	Scores      []scoreJSON  `json:"scores"`
+	System      *sysInfoJSON `json:"system"`
+}
+
+func (e *leaderboardEntryJSON) entry() *LeaderboardEntry {
+	entry := &LeaderboardEntry{
+		Rank:       e.Rank,
+		ResultID:   e.ResultID,
+		UserID:     e.UserID,
+		User:       e.User,
+		CreatedAt:  e.CreatedAt,
+		TotalScore: e.TotalScore,
+		TotalTime:  durationJSON(e.TotalTimeMS),
+		Scores:     database.Scores{},
+		SysInfo:    e.System.sysInfo(),
+	}
+	for _, s := range e.Scores {
+		entry.Scores = append(entry.Scores, s.score())
+	}
+	return entry
+}
+
+// Leaderboard returns all results with a Total score, best first.
+func (c *Client) Leaderboard(ctx context.Context) ([]*LeaderboardEntry, error) {
+	var v []*leaderboardEntryJSON
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: "/leaderboard"}, &v); err != nil {
+		return nil, err
+	}
+	entries := make([]*LeaderboardEntry, len(v))
+	for i, e := range v {
+		entries[i] = e.entry()
+	}
+	return entries, nil
+}
+
+// Stats returns score statistics grouped by a specs field, "model", "vendor"
+// or "threads". An empty benchmark includes every benchmark.
+func (c *Client) Stats(ctx context.Context, groupBy, benchmark string) ([]*database.Stats, error) {
+	query := url.Values{}
+	if groupBy != "" {
+		query.Set("group_by", groupBy)
+	}
+	if benchmark != "" {
+		query.Set("benchmark", benchmark)
+	}
+	var stats []*database.Stats
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: "/stats", query: query}, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,235 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/client"
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// newServer returns a server with an admin (ID 1) and a test user (ID 2),
+// both with the password "password", and the test user's results.
+func newServer(t *testing.T, results int) *httptest.Server {
+	db := dbtest.New()
+	for _, u := range []*database.User{
+		{Name: "admin", Password: dbtest.HashPassword("password"), Admin: true},
+		{Name: "test", Email: "test@test.com", Password: dbtest.HashPassword("password")},
+	} {
+		if _, err := db.AddUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < results; i++ {
+		scores := database.Scores{{Name: "Total", Score: float64(100 + i), Time: database.Duration{Duration: time.Second}}}
+		if _, err := db.AddResult(&database.Result{UserID: 2, Scores: scores, CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(handlers.Handler(db))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newClient(t *testing.T, url string, opts ...client.Option) *client.Client {
+	c, err := client.New(url, append([]client.Option{client.WithRetries(2, time.Millisecond, 5*time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSubmit(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, 0)
+	c := newClient(t, srv.URL, client.WithBasicAuth("test", "password"))
+
+	sub := &client.Submission{
+		Scores: database.Scores{
+			{Name: "Mandelbrot", Score: 50, Time: database.Duration{Duration: 1500 * time.Millisecond}},
+			{Name: "Total", Score: 100, Time: database.Duration{Duration: 3 * time.Second}},
+		},
+		SysInfo:        database.SysInfo{Vendor: "GenuineIntel", Model: "Intel Core i7-8750H", Threads: "12"},
+		IdempotencyKey: "run-1",
+	}
+	res, err := c.Submit(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.Submit(ctx, sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ResultID != res.ResultID {
+		t.Errorf("replayed submission: want result %d, got %d", res.ResultID, again.ResultID)
+	}
+
+	got, err := c.GetResult(ctx, res.ResultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != 2 || len(got.Scores) != 2 || got.Scores[0].Time.Duration != 1500*time.Millisecond {
+		t.Errorf("unexpected result %+v", got.Result)
+	}
+	specs, err := c.ResultSpecs(ctx, res.ResultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 1 || specs[0].SysInfo.Model != "Intel Core i7-8750H" || specs[0].Normalized.Threads != 12 {
+		t.Errorf("unexpected specs %+v", specs)
+	}
+
+	entries, err := c.Leaderboard(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ResultID != res.ResultID || entries[0].TotalScore != 100 ||
+		entries[0].TotalTime.Duration != 3*time.Second || entries[0].SysInfo == nil || entries[0].SysInfo.Model != "Intel Core i7-8750H" {
+		t.Errorf("unexpected leaderboard %+v", entries)
+	}
+
+	cmp, err := c.Compare(ctx, 0, res.ResultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmp.Results) != 1 || cmp.Results[0].SysInfo == nil || cmp.Results[0].SysInfo.Threads != "12" ||
+		len(cmp.Benchmarks) != 2 || cmp.Benchmarks[0].Scores[0].Time.Duration != 1500*time.Millisecond {
+		t.Errorf("unexpected comparison %+v", cmp)
+	}
+	if _, err := c.Stats(ctx, "model", "Total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, 0)
+	c := newClient(t, srv.URL, client.WithBasicAuth("test", "password"))
+
+	token, err := c.CreateToken(ctx, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := newClient(t, srv.URL, client.WithToken(token.Secret))
+	me, err := tc.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.ID != 2 || me.Email != "test@test.com" {
+		t.Errorf("unexpected account %+v", me)
+	}
+
+	tokens, err := tc.ListTokens(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "ci" || tokens[0].Secret != "" {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+	if err := c.DeleteToken(ctx, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.Me(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("deleted token: want ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestResultIterator(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, 7)
+	c := newClient(t, srv.URL)
+
+	for _, it := range []*client.ResultIterator{c.Results(), c.UserResults(2)} {
+		it.SetPageSize(3)
+		var ids []int64
+		for it.Next(ctx) {
+			ids = append(ids, it.Result().ID)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 7 {
+			t.Fatalf("want 7 results, got %v", ids)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Errorf("results out of order: %v", ids)
+			}
+		}
+	}
+
+	it := c.UserResults(999)
+	if it.Next(ctx) || !errors.Is(it.Err(), database.ErrNotFound) {
+		t.Errorf("unknown user: want ErrNotFound, got %v", it.Err())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t, 0)
+
+	_, err := newClient(t, srv.URL).GetUser(ctx, 999)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("want *client.Error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "not_found" || apiErr.RequestID == "" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Error("want error to match database.ErrNotFound")
+	}
+
+	_, err = newClient(t, srv.URL, client.WithBasicAuth("test", "wrong")).Me(ctx)
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("wrong password: want ErrUnauthorized, got %v", err)
+	}
+	_, err = newClient(t, srv.URL, client.WithBasicAuth("test", "password")).CreateToken(ctx, "")
+	if !errors.Is(err, database.ErrInvalid) {
+		t.Errorf("empty token name: want ErrInvalid, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	api := newServer(t, 0)
+	var calls int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.Redirect(w, r, api.URL+r.URL.String(), http.StatusTemporaryRedirect)
+	}))
+	defer flaky.Close()
+
+	user, err := newClient(t, flaky.URL).GetUser(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "test" {
+		t.Errorf("want user test, got %+v", user)
+	}
+	if calls != 3 {
+		t.Errorf("want 3 attempts, got %d", calls)
+	}
+
+	atomic.StoreInt32(&calls, -10)
+	_, err = newClient(t, flaky.URL).GetUser(ctx, 2)
+	if !errors.As(err, new(*client.Error)) {
+		t.Errorf("retries exhausted: want *client.Error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := newClient(t, api.URL).GetUser(ctx, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: want context.Canceled, got %v", err)
+	}
+}
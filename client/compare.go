@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Comparison aligns the scores of several results by benchmark.
+type Comparison struct {
+	Baseline   int64                  `json:"baseline"`   // baseline result ID
+	Results    []*ComparedResult      `json:"results"`    // compared results in request order
+	Benchmarks []*BenchmarkComparison `json:"benchmarks"` // benchmarks in order of first appearance
+}
+
+// ComparedResult describes one of the compared results.
+type ComparedResult struct {
+	ID      int64             `json:"id"`
+	UserID  int64             `json:"user_id"`
+	SysInfo *database.SysInfo `json:"system"` // nil if the result has no specs
+}
+
+// BenchmarkComparison aligns the scores of one benchmark across results.
+type BenchmarkComparison struct {
+	Name   string           `json:"name"`
+	Scores []*ComparedScore `json:"scores"` // aligned with Comparison.Results, nil where missing
+}
+
+// ComparedScore is a benchmark score relative to the baseline's score.
+type ComparedScore struct {
+	Score        float64           `json:"score"`
+	Time         database.Duration `json:"time"`
+	Delta        *float64          `json:"delta"`         // nil if the baseline lacks the benchmark
+	DeltaPercent *float64          `json:"delta_percent"` // nil if the baseline lacks the benchmark or scored 0
+}
+
+// comparisonJSON is a comparison as /api/v1 serves it.
+type comparisonJSON struct {
+	Baseline int64 `json:"baseline"`
+	Results  []struct {
+		ID     int64        `json:"id"`
+		UserID int64        `json:"user_id"`
+		System *sysInfoJSON `json:"system"`
+	} `json:"results"`
+	Benchmarks []struct {
+		Name   string `json:"name"`
+		Scores []*struct {
+			Score        float64  `json:"score"`
+			TimeMS       float64  `json:"time_ms"`
+			Delta        *float64 `json:"delta"`
+			DeltaPercent *float64 `json:"delta_percent"`
+		} `json:"scores"`
+	} `json:"benchmarks"`
+}
+
+func (c *comparisonJSON) comparison() *Comparison {
+	cmp := &Comparison{Baseline: c.Baseline}
+	for _, r := range c.Results {
+		cmp.Results = append(cmp.Results, &ComparedResult{ID: r.ID, UserID: r.UserID, SysInfo: r.System.sysInfo()})
+	}
+	for _, b := range c.Benchmarks {
+		bc := &BenchmarkComparison{Name: b.Name, Scores: make([]*ComparedScore, len(b.Scores))}
+		for i, s := range b.Scores {
+			if s != nil {
+				bc.Scores[i] = &ComparedScore{Score: s.Score, Time: durationJSON(s.TimeMS), Delta: s.Delta, DeltaPercent: s.DeltaPercent}
+			}
+		}
+		cmp.Benchmarks = append(cmp.Benchmarks, bc)
+	}
+	return cmp
+}
+
+// Compare compares the results with the given ids against the baseline
+// result, or against the first of them if baseline is 0.
+func (c *Client) Compare(ctx context.Context, baseline int64, ids ...int64) (*Comparison, error) {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	query := url.Values{"ids": {strings.Join(s, ",")}}
+	if baseline != 0 {
+		query.Set("baseline", strconv.FormatInt(baseline, 10))
+	}
+	var cmp comparisonJSON
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: "/compare", query: query}, &cmp); err != nil {
+		return nil, err
+	}
+	return cmp.comparison(), nil
+}
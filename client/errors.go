@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Errors an *Error matches with errors.Is besides the database errors
+// database.ErrNotFound, database.ErrConflict and database.ErrInvalid, which
+// it matches for 404, 409 and 422 responses.
+var (
+	ErrUnauthorized = errors.New("unauthorized") // missing or invalid credentials
+	ErrForbidden    = errors.New("forbidden")    // the user is not allowed to do this
+)
+
+// Error is an error response of the API.
+type Error struct {
+	StatusCode int    // HTTP status code
+	Code       string // error code, such as "not_found"
+	Message    string // error message
+	RequestID  string // request ID to quote when reporting the error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("osb: %d %s: %s", e.StatusCode, e.Code, e.Message)
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Is reports whether target is the error matching e's status code.
+func (e *Error) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == database.ErrNotFound
+	case http.StatusConflict:
+		return target == database.ErrConflict
+	case http.StatusUnprocessableEntity:
+		return target == database.ErrInvalid
+	}
+	return false
+}
+
+// newError returns the *Error for an error response. Bodies that are not an
+// error envelope, say from a proxy, become its message.
+func newError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var env struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(body, &env) == nil && env.Code != "" {
+		e.Code, e.Message = env.Code, env.Message
+		if env.RequestID != "" {
+			e.RequestID = env.RequestID
+		}
+		return e
+	}
+	e.Code = "error"
+	e.Message = http.StatusText(resp.StatusCode)
+	if len(body) > 0 {
+		e.Message = string(body)
+	}
+	return e
+}
@@ -0,0 +1,265 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Queue is a file of runs waiting to be submitted, for machines that
+// benchmark without network access. Each run is a JSON line holding its
+// idempotency key and the time it was made, so submitting it later dates
+// the result correctly and retrying never adds it twice.
+//
+// A Queue is safe for concurrent use. Processes sharing a queue file lock it
+// while they change it, so runs can be added while another process syncs,
+// but only one process should sync a queue file at a time.
+type Queue struct {
+	path string
+	mu   sync.Mutex
+}
+
+// QueuedRun is a run in a Queue.
+type QueuedRun struct {
+	Key       string           `json:"key"`        // idempotency key
+	CreatedAt time.Time        `json:"created_at"` // time of the run
+	QueuedAt  time.Time        `json:"queued_at"`  // time the run was queued
+	Scores    database.Scores  `json:"scores"`
+	SysInfo   database.SysInfo `json:"specs"`
+}
+
+// SyncReport describes what Sync did.
+type SyncReport struct {
+	Submitted []*SubmitResult `json:"submitted"` // results of the submitted runs, in queue order
+	Rejected  []*QueuedRun    `json:"rejected"`  // runs the server refused, see Queue.RejectedPath
+	Remaining int             `json:"remaining"` // runs still queued
+}
+
+// NewQueue returns the queue stored in the file at path, which is created
+// when the first run is added.
+func NewQueue(path string) *Queue {
+	return &Queue{path: path}
+}
+
+// Path returns the path of the queue file.
+func (q *Queue) Path() string {
+	return q.path
+}
+
+// lockPath returns the path of the file locked while the queue file at path
+// is changed. The queue file itself cannot be locked, because removeRun
+// replaces it.
+func lockPath(path string) string {
+	return path + ".lock"
+}
+
+// RejectedPath returns the path of the file runs the server refused are
+// moved to, so they do not hold up the runs queued after them.
+func (q *Queue) RejectedPath() string {
+	return q.path + ".rejected"
+}
+
+// Add appends a run to the queue and flushes it to disk. The run is dated
+// now and given a random idempotency key unless s sets them.
+func (q *Queue) Add(s *Submission) (*QueuedRun, error) {
+	now := time.Now().UTC()
+	run := &QueuedRun{
+		Key:       s.IdempotencyKey,
+		CreatedAt: s.CreatedAt.UTC(),
+		QueuedAt:  now,
+		Scores:    s.Scores,
+		SysInfo:   s.SysInfo,
+	}
+	if run.Key == "" {
+		var err error
+		if run.Key, err = NewIdempotencyKey(); err != nil {
+			return nil, err
+		}
+	}
+	if s.CreatedAt.IsZero() {
+		run.CreatedAt = now
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := appendRun(q.path, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Runs returns the queued runs, oldest first.
+func (q *Queue) Runs() ([]*QueuedRun, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return readRuns(q.path)
+}
+
+// Sync submits the queued runs in order, removing each from the queue once
+// the server has it. It stops at the first run that fails for a reason that
+// may go away, like the server being unreachable, and returns that error.
+// Runs the server refuses as invalid or duplicates are moved to the file at
+// RejectedPath instead.
+func (q *Queue) Sync(ctx context.Context, c *Client) (*SyncReport, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	runs, err := readRuns(q.path)
+	if err != nil {
+		return nil, err
+	}
+	report := &SyncReport{Remaining: len(runs)}
+	for _, run := range runs {
+		sub := &Submission{Scores: run.Scores, SysInfo: run.SysInfo, CreatedAt: run.CreatedAt, IdempotencyKey: run.Key}
+		res, err := c.Submit(ctx, sub)
+		if rejected(err) {
+			if err := appendRun(q.RejectedPath(), run); err != nil {
+				return report, err
+			}
+			report.Rejected = append(report.Rejected, run)
+		} else if err != nil {
+			return report, err
+		} else {
+			report.Submitted = append(report.Submitted, res)
+		}
+		if err := removeRun(q.path, run.Key); err != nil {
+			return report, err
+		}
+		report.Remaining--
+	}
+	return report, nil
+}
+
+// rejected reports whether err means the server will never accept the run.
+func rejected(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// appendRun appends run to the queue file at path and flushes it to disk.
+func appendRun(path string, run *QueuedRun) (err error) {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(lockPath(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	// A write interrupted by a crash may have left a partial line, which
+	// must not swallow this one.
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readRuns returns the runs in the queue file at path. Lines that cannot be
+// parsed are skipped: they can only be left by an interrupted Add, which
+// reported an error, so the run was never queued.
+func readRuns(path string) ([]*QueuedRun, error) {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []*QueuedRun
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		var run QueuedRun
+		if json.Unmarshal(s.Bytes(), &run) == nil && run.Key != "" {
+			runs = append(runs, &run)
+		}
+	}
+	return runs, s.Err()
+}
+
+// removeRun removes the run with the given key from the queue file at path.
+// The file is replaced atomically, so a crash leaves either the old or the
+// new queue. The file is read again rather than reusing what Sync read, to
+// keep runs added since, and is locked until it is replaced so that no run
+// is added in between.
+func removeRun(path, key string) (err error) {
+	unlock, err := lockFile(lockPath(path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	runs, err := readRuns(path)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, run := range runs {
+		if run.Key == key {
+			continue
+		}
+		line, err := json.Marshal(run)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,147 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/client"
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func newRun(score float64, created time.Time) *client.Submission {
+	return &client.Submission{
+		Scores:    database.Scores{{Name: "Total", Score: score, Time: database.Duration{Duration: time.Second}}},
+		SysInfo:   database.SysInfo{Vendor: "GenuineIntel", Model: "Intel Core i7-8750H", Threads: "12"},
+		CreatedAt: created,
+	}
+}
+
+func TestQueueSync(t *testing.T) {
+	ctx := context.Background()
+	db := dbtest.New()
+	if _, err := db.AddUser(&database.User{Name: "test", Password: dbtest.HashPassword("password")}); err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.Handler(db)
+
+	// The server stores the first submission but the response is lost.
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && atomic.AddInt32(&calls, 1) == 1 {
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	q := client.NewQueue(filepath.Join(t.TempDir(), "queue.ndjson"))
+	created := time.Now().UTC().Add(-72 * time.Hour).Truncate(time.Second)
+	for i, run := range []*client.Submission{
+		newRun(100, created),
+		newRun(200, created.Add(time.Hour)),
+		newRun(300, created.Add(-200*24*time.Hour)), // too old to be accepted
+	} {
+		if _, err := q.Add(run); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	offline := newClient(t, "http://127.0.0.1:1", client.WithBasicAuth("test", "password"), client.WithRetries(0, 0, 0))
+	if _, err := q.Sync(ctx, offline); err == nil {
+		t.Fatal("sync without a server: want an error")
+	}
+	if runs, err := q.Runs(); err != nil || len(runs) != 3 {
+		t.Fatalf("after failed sync: want 3 queued runs, got %d: %v", len(runs), err)
+	}
+
+	report, err := q.Sync(ctx, newClient(t, srv.URL, client.WithBasicAuth("test", "password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Submitted) != 2 || len(report.Rejected) != 1 || report.Remaining != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.Rejected[0].Scores[0].Score != 300 {
+		t.Errorf("rejected the wrong run: %+v", report.Rejected[0])
+	}
+
+	results, err := db.ListResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("retried submission was duplicated: want 2 results, got %d", len(results))
+	}
+	for i, res := range results {
+		if want := created.Add(time.Duration(i) * time.Hour); !res.CreatedAt.Equal(want) {
+			t.Errorf("result %d: created at: want %v, got %v", i, want, res.CreatedAt)
+		}
+	}
+
+	if runs, err := q.Runs(); err != nil || len(runs) != 0 {
+		t.Errorf("after sync: want an empty queue, got %d runs: %v", len(runs), err)
+	}
+	rejected, err := client.NewQueue(q.RejectedPath()).Runs()
+	if err != nil || len(rejected) != 1 {
+		t.Errorf("want 1 rejected run, got %d: %v", len(rejected), err)
+	}
+}
+
+func TestQueueConcurrentProcesses(t *testing.T) {
+	ctx := context.Background()
+	db := dbtest.New()
+	if _, err := db.AddUser(&database.User{Name: "test", Password: dbtest.HashPassword("password")}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handlers.Handler(db))
+	defer srv.Close()
+	c := newClient(t, srv.URL, client.WithBasicAuth("test", "password"))
+
+	// Queues of the same file stand in for processes, which only share the
+	// file lock.
+	path := filepath.Join(t.TempDir(), "queue.ndjson")
+	const runs = 50
+	done := make(chan error)
+	go func() {
+		q := client.NewQueue(path)
+		for i := 0; i < runs; i++ {
+			if _, err := q.Add(newRun(float64(i+1), time.Now())); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	q := client.NewQueue(path)
+	for adding := true; adding; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			adding = false
+		default:
+		}
+		if _, err := q.Sync(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := db.ListResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != runs {
+		t.Errorf("want all %d runs submitted, got %d", runs, len(results))
+	}
+}
@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// DefaultPageSize is the number of results an iterator fetches per request.
+const DefaultPageSize = 100
+
+// Result is a benchmark result.
+type Result struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Scores    database.Scores `json:"scores"`
+}
+
+// ResultDetail is a result along with the percentile ranks of its scores.
+type ResultDetail struct {
+	Result
+	Ranks []*database.BenchmarkRanks `json:"ranks"`
+}
+
+// Specs is the system a result was run on.
+type Specs struct {
+	ID         int64                      `json:"id"`
+	ResultID   int64                      `json:"result_id"`
+	SysInfo    database.SysInfo           `json:"system"`
+	Normalized database.NormalizedSysInfo `json:"normalized"`
+}
+
+// resultJSON is a result as /api/v1 serves it.
+type resultJSON struct {
+	ID        int64                      `json:"id"`
+	UserID    int64                      `json:"user_id"`
+	CreatedAt time.Time                  `json:"created_at"`
+	Scores    []scoreJSON                `json:"scores"`
+	Ranks     []*database.BenchmarkRanks `json:"ranks"`
+}
+
+func (r *resultJSON) result() *Result {
+	res := &Result{ID: r.ID, UserID: r.UserID, CreatedAt: r.CreatedAt, Scores: database.Scores{}}
+	for _, s := range r.Scores {
+		res.Scores = append(res.Scores, s.score())
+	}
+	return res
+}
+
+// scoreJSON is a benchmark score as /api/v1 serves it.
+type scoreJSON struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	TimeMS float64 `json:"time_ms"`
+}
+
+func (s *scoreJSON) score() database.Score {
+	return database.Score{Name: s.Name, Score: s.Score, Time: durationJSON(s.TimeMS)}
+}
+
+// durationJSON converts a time in milliseconds as /api/v1 serves it.
+func durationJSON(ms float64) database.Duration {
+	return database.Duration{Duration: time.Duration(ms * float64(time.Millisecond))}
+}
+
+// sysInfoJSON is the system of a result as /api/v1 serves it.
+type sysInfoJSON struct {
+	Vendor      string `json:"vendor"`
+	Model       string `json:"model"`
+	ClockSpeed  string `json:"clock_speed"`
+	Threads     string `json:"threads"`
+	Overclocked bool   `json:"overclocked"`
+	ByteOrder   string `json:"byte_order"`
+	PhysicalMem string `json:"physical_mem"`
+	VirtualMem  string `json:"virtual_mem"`
+	SwapMem     string `json:"swap_mem"`
+}
+
+// sysInfo returns the system, or nil if s is nil.
+func (s *sysInfoJSON) sysInfo() *database.SysInfo {
+	if s == nil {
+		return nil
+	}
+	info := database.SysInfo(*s)
+	return &info
+}
+
+// specsJSON is specs as /api/v1 serves them.
+type specsJSON struct {
+	ID         int64       `json:"id"`
+	ResultID   int64       `json:"result_id"`
+	System     sysInfoJSON `json:"system"`
+	Normalized struct {
+		Model            string `json:"model"`
+		ClockSpeedHz     int64  `json:"clock_speed_hz"`
+		Threads          int    `json:"threads"`
+		Overclocked      bool   `json:"overclocked"`
+		PhysicalMemBytes int64  `json:"physical_mem_bytes"`
+		VirtualMemBytes  int64  `json:"virtual_mem_bytes"`
+		SwapMemBytes     int64  `json:"swap_mem_bytes"`
+	} `json:"normalized"`
+}
+
+func (s *specsJSON) specs() *Specs {
+	return &Specs{
+		ID:         s.ID,
+		ResultID:   s.ResultID,
+		SysInfo:    *s.System.sysInfo(),
+		Normalized: database.NormalizedSysInfo(s.Normalized),
+	}
+}
+
+// GetResult returns the result with the given id and the ranks of its scores.
+func (c *Client) GetResult(ctx context.Context, id int64) (*ResultDetail, error) {
+	var r resultJSON
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/results/%d", id)}, &r); err != nil {
+		return nil, err
+	}
+	return &ResultDetail{Result: *r.result(), Ranks: r.Ranks}, nil
+}
+
+// ResultSpecs returns the specs of the result with the given id.
+func (c *Client) ResultSpecs(ctx context.Context, id int64) ([]*Specs, error) {
+	var v []*specsJSON
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: fmt.Sprintf("/results/%d/specs", id)}, &v); err != nil {
+		return nil, err
+	}
+	specs := make([]*Specs, len(v))
+	for i, s := range v {
+		specs[i] = s.specs()
+	}
+	return specs, nil
+}
+
+// ListResults returns all results in a single request. Use Results to page
+// through them instead.
+func (c *Client) ListResults(ctx context.Context) ([]*Result, error) {
+	var v []*resultJSON
+	if _, err := c.do(ctx, &request{method: http.MethodGet, path: "/results"}, &v); err != nil {
+		return nil, err
+	}
+	results := make([]*Result, len(v))
+	for i, r := range v {
+		results[i] = r.result()
+	}
+	return results, nil
+}
+
+// Results returns an iterator over all results, ordered by id.
+func (c *Client) Results() *ResultIterator {
+	return c.newResultIterator("/results")
+}
+
+// UserResults returns an iterator over the results of the user with the
+// given id, ordered by id.
+func (c *Client) UserResults(userID int64) *ResultIterator {
+	return c.newResultIterator(fmt.Sprintf("/users/%d/results", userID))
+}
+
+func (c *Client) newResultIterator(path string) *ResultIterator {
+	query := url.Values{"limit": {strconv.Itoa(DefaultPageSize)}}
+	return &ResultIterator{c: c, next: &request{method: http.MethodGet, path: path, query: query}}
+}
+
+// ResultIterator pages through results:
+//
+//	it := c.Results()
+//	for it.Next(ctx) {
+//		res := it.Result()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type ResultIterator struct {
+	c    *Client
+	next *request // request for the next page, nil after the last one
+	page []*Result
+	cur  *Result
+	err  error
+}
+
+// Next advances to the next result, fetching the next page if needed. It
+// returns false when there are no more results or fetching failed.
+func (it *ResultIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.next == nil {
+			it.cur = nil
+			return false
+		}
+		var v []*resultJSON
+		header, err := it.c.do(ctx, it.next, &v)
+		if err != nil {
+			it.err = err
+			continue
+		}
+		it.next = nil
+		if path := nextLink(header.Get("Link")); path != "" {
+			it.next = &request{method: http.MethodGet, path: path}
+		}
+		for _, r := range v {
+			it.page = append(it.page, r.result())
+		}
+	}
+	it.cur, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Result returns the current result.
+func (it *ResultIterator) Result() *Result {
+	return it.cur
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ResultIterator) Err() error {
+	return it.err
+}
+
+// SetPageSize sets the number of results fetched per request. It must be
+// called before the first call to Next.
+func (it *ResultIterator) SetPageSize(n int) {
+	if it.next != nil && it.next.query != nil {
+		it.next.query.Set("limit", strconv.Itoa(n))
+	}
+}
+
+// nextLink returns the target of the rel="next" link in a Link header.
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, p := range parts[1:] {
+			if strings.TrimSpace(p) == `rel="next"` {
+				return target[1 : len(target)-1]
+			}
+		}
+	}
+	return ""
+}
+
+// Submission is a benchmark run to submit.
+type Submission struct {
+	Scores  database.Scores
+	SysInfo database.SysInfo
+
+	// CreatedAt is when the run was made. If zero, the result is dated when
+	// the server receives it.
+	CreatedAt time.Time
+
+	// IdempotencyKey lets the server recognize retries of the submission. If
+	// empty, Submit generates one, so its own retries are always safe.
+	IdempotencyKey string
+}
+
+// submissionJSON is the body of a submission.
+type submissionJSON struct {
+	Scores    database.Scores  `json:"scores"`
+	SysInfo   database.SysInfo `json:"specs"`
+	CreatedAt *time.Time       `json:"created_at,omitempty"`
+}
+
+// SubmitResult is the outcome of a submission.
+type SubmitResult struct {
+	ResultID int64                      `json:"result_id"`
+	Ranks    []*database.BenchmarkRanks `json:"ranks"` // nil if the server could not rank the result
+}
+
+// Submit submits a result as the authenticated user.
+func (c *Client) Submit(ctx context.Context, s *Submission) (*SubmitResult, error) {
+	key := s.IdempotencyKey
+	if key == "" {
+		var err error
+		if key, err = NewIdempotencyKey(); err != nil {
+			return nil, err
+		}
+	}
+	body := &submissionJSON{Scores: s.Scores, SysInfo: s.SysInfo}
+	if !s.CreatedAt.IsZero() {
+		t := s.CreatedAt.UTC()
+		body.CreatedAt = &t
+	}
+	req := &request{
+		method: http.MethodPost,
+		path:   "/results",
+		body:   body,
+		header: http.Header{"Idempotency-Key": {key}},
+	}
+	var res SubmitResult
+	if _, err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// NewIdempotencyKey returns a random idempotency key.
+func NewIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/mguid65/osb-website/client"
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// runFile is a benchmark run as the benchmark client writes it, like
+// test.json. The scores may be under "results" or "scores".
+type runFile struct {
+	Scores  database.Scores  `json:"scores"`
+	Results database.Scores  `json:"results"`
+	SysInfo database.SysInfo `json:"specs"`
+}
+
+// readRun reads a benchmark run from the named file, or from r if name is -.
+func readRun(name string, r io.Reader) (*client.Submission, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if name == "-" {
+		data, err = ioutil.ReadAll(r)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run runFile
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if run.Scores == nil {
+		run.Scores = run.Results
+	}
+	if len(run.Scores) == 0 {
+		return nil, fmt.Errorf("%s: no scores", name)
+	}
+	return &client.Submission{Scores: run.Scores, SysInfo: run.SysInfo}, nil
+}
+
+func submit(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("submit")
+	key := fs.String("key", "", "the idempotency key, random if empty")
+	offline := fs.Bool("offline", false, "queue the run without trying to submit it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("submit: want one run file")
+	}
+	sub, err := readRun(fs.Arg(0), a.stdin)
+	if err != nil {
+		return err
+	}
+	// Fix the key and date up front, so a queued run is recognized as a retry
+	// if the online attempt reached the server after all.
+	sub.IdempotencyKey = *key
+	if sub.IdempotencyKey == "" {
+		if sub.IdempotencyKey, err = client.NewIdempotencyKey(); err != nil {
+			return err
+		}
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now().UTC()
+	}
+
+	var res *client.SubmitResult
+	if !*offline {
+		c, err := a.client()
+		if err != nil {
+			return err
+		}
+		res, err = c.Submit(ctx, sub)
+		if err != nil && !unreachable(err) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(a.stderr, "could not reach the server:", err)
+		}
+	}
+	if res == nil {
+		run, err := a.queue.Add(sub)
+		if err != nil {
+			return fmt.Errorf("submit: queueing the run: %v", err)
+		}
+		fmt.Fprintf(a.stderr, "queued the run in %s, submit it later with osbctl sync\n", a.queue.Path())
+		return a.out.print(run, func() [][]string {
+			return [][]string{{"QUEUED", "KEY", "CREATED"}, {"yes", run.Key, run.CreatedAt.Format(time.RFC3339)}}
+		})
+	}
+	return a.out.print(res, func() [][]string {
+		return rankRows(res)
+	})
+}
+
+// unreachable reports whether a submission failed because the server could
+// not be reached, rather than because it refused the run or sent a response
+// that could not be read.
+func unreachable(err error) bool {
+	var e *client.Error
+	if errors.As(err, &e) {
+		switch e.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ue *url.Error // transport errors of the HTTP client
+	return errors.As(err, &ue)
+}
+
+// rankRows returns the table rows of a submitted result's ranks.
+func rankRows(res *client.SubmitResult) [][]string {
+	rows := [][]string{{"RESULT", "BENCHMARK", "PERCENTILE", "OF"}}
+	for _, r := range res.Ranks {
+		rows = append(rows, []string{strconv.FormatInt(res.ResultID, 10), r.Benchmark, fmt.Sprintf("%.1f", r.All.Percentile), strconv.Itoa(r.All.Count)})
+	}
+	if len(res.Ranks) == 0 {
+		rows = append(rows, []string{strconv.FormatInt(res.ResultID, 10), "", "", ""})
+	}
+	return rows
+}
+
+func syncQueue(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("sync")
+	list := fs.Bool("list", false, "list the queued runs instead of submitting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *list {
+		runs, err := a.queue.Runs()
+		if err != nil {
+			return err
+		}
+		if runs == nil {
+			runs = []*client.QueuedRun{}
+		}
+		return a.out.print(runs, func() [][]string {
+			rows := [][]string{{"KEY", "CREATED", "QUEUED", "TOTAL"}}
+			for _, r := range runs {
+				rows = append(rows, []string{r.Key, r.CreatedAt.Format(time.RFC3339), r.QueuedAt.Format(time.RFC3339), totalScore(r.Scores)})
+			}
+			return rows
+		})
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	report, err := a.queue.Sync(ctx, c)
+	if report != nil {
+		if len(report.Rejected) > 0 {
+			fmt.Fprintf(a.stderr, "the server rejected %d runs, moved to %s\n", len(report.Rejected), a.queue.RejectedPath())
+		}
+		if report.Remaining > 0 {
+			fmt.Fprintf(a.stderr, "%d runs are still queued\n", report.Remaining)
+		}
+		if perr := a.out.print(report, func() [][]string {
+			rows := [][]string{{"RESULT", "TOTAL PERCENTILE"}}
+			for _, res := range report.Submitted {
+				pct := ""
+				for _, r := range res.Ranks {
+					if r.Benchmark == "Total" {
+						pct = fmt.Sprintf("%.1f", r.All.Percentile)
+					}
+				}
+				rows = append(rows, []string{strconv.FormatInt(res.ResultID, 10), pct})
+			}
+			return rows
+		}); err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// totalScore formats the Total score among scores, if any.
+func totalScore(scores database.Scores) string {
+	for _, s := range scores {
+		if s.Name == "Total" {
+			return formatScore(s.Score)
+		}
+	}
+	return ""
+}
+
+func results(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("results: want list or show")
+	}
+	switch args[0] {
+	case "list":
+		return resultsList(ctx, a, args[1:])
+	case "show":
+		return resultsShow(ctx, a, args[1:])
+	}
+	return fmt.Errorf("results: unknown command %q", args[0])
+}
+
+func resultsList(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("results list")
+	user := fs.Int64("user", 0, "list the results of the user with this id")
+	n := fs.Int("n", 0, "the number of results to list, 0 for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	it := c.Results()
+	if *user != 0 {
+		it = c.UserResults(*user)
+	}
+	if *n > 0 && *n < client.DefaultPageSize {
+		it.SetPageSize(*n)
+	}
+	list := []*client.Result{}
+	for (*n <= 0 || len(list) < *n) && it.Next(ctx) {
+		list = append(list, it.Result())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return a.out.print(list, func() [][]string {
+		rows := [][]string{{"ID", "USER", "CREATED", "TOTAL"}}
+		for _, r := range list {
+			rows = append(rows, []string{strconv.FormatInt(r.ID, 10), strconv.FormatInt(r.UserID, 10), r.CreatedAt.Format(time.RFC3339), totalScore(r.Scores)})
+		}
+		return rows
+	})
+}
+
+func resultsShow(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errors.New("results show: want one result id")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("results show: invalid id %q", args[0])
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	res, err := c.GetResult(ctx, id)
+	if err != nil {
+		return err
+	}
+	specs, err := c.ResultSpecs(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	v := struct {
+		*client.ResultDetail
+		Specs []*client.Specs `json:"specs"`
+	}{res, specs}
+	return a.out.print(v, func() [][]string {
+		ranks := make(map[string]float64)
+		for _, r := range res.Ranks {
+			ranks[r.Benchmark] = r.All.Percentile
+		}
+		rows := [][]string{{"BENCHMARK", "SCORE", "TIME", "PERCENTILE"}}
+		for _, s := range res.Scores {
+			pct := ""
+			if p, ok := ranks[s.Name]; ok {
+				pct = fmt.Sprintf("%.1f", p)
+			}
+			rows = append(rows, []string{s.Name, formatScore(s.Score), s.Time.String(), pct})
+		}
+		for _, s := range specs {
+			rows = append(rows, []string{}, []string{"CPU", s.SysInfo.Vendor + " " + s.SysInfo.Model}, []string{"THREADS", s.SysInfo.Threads}, []string{"MEMORY", s.SysInfo.PhysicalMem})
+		}
+		return rows
+	})
+}
+
+func leaderboard(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("leaderboard")
+	n := fs.Int("n", 20, "the number of entries to show, 0 for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	entries, err := c.Leaderboard(ctx)
+	if err != nil {
+		return err
+	}
+	if *n > 0 && len(entries) > *n {
+		entries = entries[:*n]
+	}
+	return a.out.print(entries, func() [][]string {
+		rows := [][]string{{"RANK", "RESULT", "USER", "TOTAL", "TIME", "CPU"}}
+		for _, e := range entries {
+			cpu := ""
+			if e.SysInfo != nil {
+				cpu = e.SysInfo.Model
+			}
+			rows = append(rows, []string{strconv.Itoa(e.Rank), strconv.FormatInt(e.ResultID, 10), e.User, formatScore(e.TotalScore), e.TotalTime.String(), cpu})
+		}
+		return rows
+	})
+}
+
+func compare(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("compare")
+	baseline := fs.Int64("baseline", 0, "the result the deltas are relative to, the first id by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("compare: want result ids")
+	}
+	var ids []int64
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("compare: invalid id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	cmp, err := c.Compare(ctx, *baseline, ids...)
+	if err != nil {
+		return err
+	}
+	return a.out.print(cmp, func() [][]string {
+		header := []string{"BENCHMARK"}
+		for _, r := range cmp.Results {
+			header = append(header, "#"+strconv.FormatInt(r.ID, 10))
+		}
+		rows := [][]string{header}
+		for _, b := range cmp.Benchmarks {
+			row := []string{b.Name}
+			for _, s := range b.Scores {
+				cell := "-"
+				if s != nil {
+					cell = formatScore(s.Score)
+					if s.DeltaPercent != nil && *s.DeltaPercent != 0 {
+						cell += fmt.Sprintf(" (%+.1f%%)", *s.DeltaPercent)
+					}
+				}
+				row = append(row, cell)
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	})
+}
+
+func token(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errors.New("token: want create, list or delete")
+	}
+	switch args[0] {
+	case "create":
+		return tokenCreate(ctx, a, args[1:])
+	case "list":
+		return tokenList(ctx, a, args[1:])
+	case "delete":
+		return tokenDelete(ctx, a, args[1:])
+	}
+	return fmt.Errorf("token: unknown command %q", args[0])
+}
+
+func tokenCreate(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("token create")
+	user := fs.String("user", "", "authenticate as this user with a password instead of the configured token")
+	save := fs.Bool("save", true, "save the token and server URL to the configuration file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("token create: want a token name")
+	}
+
+	var (
+		c   *client.Client
+		err error
+	)
+	if *user != "" {
+		password, err := a.readPassword()
+		if err != nil {
+			return err
+		}
+		c, err = client.New(a.serverURL(), client.WithBasicAuth(*user, password), client.WithUserAgent("osbctl"))
+		if err != nil {
+			return err
+		}
+	} else if c, err = a.client(); err != nil {
+		return err
+	}
+	t, err := c.CreateToken(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *save {
+		a.cfg.URL = a.serverURL()
+		a.cfg.Token = t.Secret
+		if err := a.cfg.save(a.configPath); err != nil {
+			return fmt.Errorf("token create: saving the token: %v", err)
+		}
+		fmt.Fprintln(a.stderr, "saved the token to", a.configPath)
+	}
+	return a.out.print(t, func() [][]string {
+		return [][]string{{"ID", "NAME", "TOKEN"}, {strconv.FormatInt(t.ID, 10), t.Name, t.Secret}}
+	})
+}
+
+func tokenList(ctx context.Context, a *app, args []string) error {
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	tokens, err := c.ListTokens(ctx)
+	if err != nil {
+		return err
+	}
+	return a.out.print(tokens, func() [][]string {
+		rows := [][]string{{"ID", "NAME", "CREATED"}}
+		for _, t := range tokens {
+			rows = append(rows, []string{strconv.FormatInt(t.ID, 10), t.Name, t.CreatedAt.Format(time.RFC3339)})
+		}
+		return rows
+	})
+}
+
+func tokenDelete(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return errors.New("token delete: want one token id")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("token delete: invalid id %q", args[0])
+	}
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	return c.DeleteToken(ctx, id)
+}
+
+func whoami(ctx context.Context, a *app, args []string) error {
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	me, err := c.Me(ctx)
+	if err != nil {
+		return err
+	}
+	return a.out.print(me, func() [][]string {
+		return [][]string{{"ID", "NAME", "EMAIL", "ADMIN"}, {strconv.FormatInt(me.ID, 10), me.Name, me.Email, strconv.FormatBool(me.Admin)}}
+	})
+}
+
+// readPassword prompts for a password on a terminal, and otherwise reads the
+// first line of standard input.
+func (a *app) readPassword() (string, error) {
+	if f, ok := a.stdin.(*os.File); ok && terminal.IsTerminal(int(f.Fd())) {
+		fmt.Fprint(a.stderr, "Password: ")
+		passwd, err := terminal.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(a.stderr)
+		return string(passwd), err
+	}
+	line, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
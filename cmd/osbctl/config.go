@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// config is the osbctl configuration file.
+type config struct {
+	URL   string `json:"url"`             // server address
+	Token string `json:"token,omitempty"` // API token requests are authenticated with
+}
+
+// defaultURL is the server address used if none is configured.
+const defaultURL = "https://localhost"
+
+// defaultConfigPath returns the path of the configuration file in the user's
+// configuration directory, such as ~/.config/osb/config.json.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "osb.json"
+	}
+	return filepath.Join(dir, "osb", "config.json")
+}
+
+// loadConfig reads the configuration file at path. A missing file yields the
+// default configuration.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{URL: defaultURL}
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// save writes cfg to path. The file holds a credential, so only the user may
+// read it.
+func (cfg *config) save(path string) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
@@ -0,0 +1,144 @@
+// Command osbctl submits benchmark results to an OSB server and queries them.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mguid65/osb-website/client"
+)
+
+const usage = `usage: osbctl [flags] command [args]
+
+The commands are:
+
+	submit [-key key] [-offline] file       submit a benchmark run, - for standard input
+	sync [-list]                            submit the runs queued while offline
+	results list [-user id] [-n count]      list results
+	results show id                         show a result's scores, ranks and specs
+	leaderboard [-n count]                  rank results by their Total score
+	compare [-baseline id] id...            compare results by benchmark
+	token create [-user name] [-save] name  create an API token
+	token list                              list your API tokens
+	token delete id                         delete an API token
+	whoami                                  show the user you are authenticated as
+
+Requests are authenticated with the token in the configuration file. token
+create authenticates with -user and a password instead, and saves the new
+token along with the server URL unless -save=false.
+
+If the server cannot be reached, submit appends the run to the queue file
+instead, keeping the time it was run. sync submits the queued runs in order.
+
+Flags:
+`
+
+// errUsage is returned for invalid command lines, after printing the usage.
+var errUsage = errors.New("usage")
+
+func main() {
+	err := run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err == errUsage {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "osbctl:", err)
+		os.Exit(1)
+	}
+}
+
+// app holds the state shared by the commands.
+type app struct {
+	cfg        *config
+	configPath string
+	queue      *client.Queue
+	url        string // server URL, overriding the configured one
+	stdin      io.Reader
+	stderr     io.Writer
+	out        *printer
+}
+
+// command is a subcommand taking its own arguments.
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"submit":      submit,
+	"sync":        syncQueue,
+	"results":     results,
+	"leaderboard": leaderboard,
+	"compare":     compare,
+	"token":       token,
+	"whoami":      whoami,
+}
+
+// run runs the command line args.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("osbctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", defaultConfigPath(), "the configuration file")
+	url := fs.String("url", "", "the server URL, overriding the configured one")
+	queue := fs.String("queue", "", "the queue file of runs to submit later, next to the configuration file if empty")
+	output := fs.String("o", "table", "the output format, table or json")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok || (*output != "table" && *output != "json") {
+		fs.Usage()
+		return errUsage
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	if *queue == "" {
+		*queue = filepath.Join(filepath.Dir(*configPath), "queue.ndjson")
+	}
+	a := &app{
+		cfg:        cfg,
+		configPath: *configPath,
+		queue:      client.NewQueue(*queue),
+		url:        *url,
+		stdin:      stdin,
+		stderr:     stderr,
+		out:        &printer{w: stdout, json: *output == "json"},
+	}
+	err = cmd(ctx, a, fs.Args()[1:])
+	if err == flag.ErrHelp {
+		return errUsage
+	}
+	return err
+}
+
+// serverURL returns the URL of the server to talk to.
+func (a *app) serverURL() string {
+	if a.url != "" {
+		return a.url
+	}
+	return a.cfg.URL
+}
+
+// client returns a client authenticated with the configured token, if any.
+func (a *app) client(opts ...client.Option) (*client.Client, error) {
+	if a.cfg.Token != "" {
+		opts = append([]client.Option{client.WithToken(a.cfg.Token)}, opts...)
+	}
+	return client.New(a.serverURL(), append(opts, client.WithUserAgent("osbctl"))...)
+}
+
+// flagSet returns the flag set of a subcommand.
+func (a *app) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
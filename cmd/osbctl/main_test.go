@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+const testRun = `{
+  "results": [
+    {"name": "Mandelbrot", "time": 2137566859.000000, "score": 4678.2},
+    {"name": "Total", "time": "1000", "score": 9000.5}
+  ],
+  "specs": {"vendor": "GenuineIntel", "model": "Intel Core i7-8750H", "threads": "12", "physical": "16 GB"}
+}`
+
+// osbctl runs a command line with the given standard input against the
+// configuration file in dir, and returns its standard output.
+func osbctl(t *testing.T, dir, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", filepath.Join(dir, "config.json")}, args...)
+	err := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestOSBCtl(t *testing.T) {
+	db := dbtest.New()
+	if _, err := db.AddUser(&database.User{Name: "test", Email: "test@test.com", Password: dbtest.HashPassword("password")}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handlers.Handler(db))
+	defer srv.Close()
+	dir := t.TempDir()
+
+	if _, err := osbctl(t, dir, "", "-url", srv.URL, "whoami"); err == nil {
+		t.Error("whoami without a token: want an error")
+	}
+	if _, err := osbctl(t, dir, "password\n", "-url", srv.URL, "token", "create", "-user", "test", "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.URL != srv.URL || !strings.HasPrefix(cfg.Token, database.TokenPrefix) {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	out, err := osbctl(t, dir, "", "whoami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "test@test.com") {
+		t.Errorf("whoami: unexpected output %q", out)
+	}
+
+	out, err = osbctl(t, dir, testRun, "-o", "json", "submit", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct {
+		ResultID int64 `json:"result_id"`
+	}
+	if err := json.Unmarshal([]byte(out), &res); err != nil {
+		t.Fatalf("submit: %v: %s", err, out)
+	}
+
+	out, err = osbctl(t, dir, "", "results", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "9000.50") {
+		t.Errorf("results list: unexpected output %q", out)
+	}
+	out, err = osbctl(t, dir, "", "results", "show", strconv.FormatInt(res.ResultID, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Mandelbrot") || !strings.Contains(out, "Intel Core i7-8750H") {
+		t.Errorf("results show: unexpected output %q", out)
+	}
+
+	out, err = osbctl(t, dir, "", "leaderboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "test") || !strings.Contains(out, "9000.50") {
+		t.Errorf("leaderboard: unexpected output %q", out)
+	}
+	if _, err := osbctl(t, dir, "", "compare", strconv.FormatInt(res.ResultID, 10)); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := osbctl(t, dir, "", "bogus"); err != errUsage {
+		t.Errorf("unknown command: want errUsage, got %v", err)
+	}
+}
+
+func TestOfflineSubmit(t *testing.T) {
+	db := dbtest.New()
+	if _, err := db.AddUser(&database.User{Name: "test", Password: dbtest.HashPassword("password")}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handlers.Handler(db))
+	defer srv.Close()
+	dir := t.TempDir()
+	if _, err := osbctl(t, dir, "password\n", "-url", srv.URL, "token", "create", "-user", "test", "lab"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		run := strings.Replace(testRun, "9000.5", strconv.Itoa(9000+i), 1)
+		if _, err := osbctl(t, dir, run, "submit", "-offline", "-"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, err := osbctl(t, dir, "", "sync", "-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 3 {
+		t.Errorf("sync -list: want 2 queued runs, got %q", out)
+	}
+	if results, _ := db.ListResults(); len(results) != 0 {
+		t.Fatalf("offline submit: want no results, got %d", len(results))
+	}
+
+	if _, err := osbctl(t, dir, "", "sync"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := db.ListResults(); len(results) != 2 {
+		t.Errorf("sync: want 2 results, got %d", len(results))
+	}
+	if out, _ := osbctl(t, dir, "", "-o", "json", "sync", "-list"); strings.TrimSpace(out) != "[]" {
+		t.Errorf("sync: want an empty queue, got %q", out)
+	}
+}
+
+func TestSubmitQueuesRetries(t *testing.T) {
+	db := dbtest.New()
+	if _, err := db.AddUser(&database.User{Name: "test", Password: dbtest.HashPassword("password")}); err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.Handler(db)
+	var mode string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/results") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		switch mode {
+		case "lost": // the result is stored but the response never arrives
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			panic(http.ErrAbortHandler)
+		case "garbled":
+			w.Write([]byte("<html>"))
+		default:
+			h.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	if _, err := osbctl(t, dir, "password\n", "-url", srv.URL, "token", "create", "-user", "test", "lab"); err != nil {
+		t.Fatal(err)
+	}
+
+	mode = "garbled"
+	if _, err := osbctl(t, dir, testRun, "submit", "-"); err == nil {
+		t.Error("submit with an unreadable response: want an error")
+	}
+	if out, _ := osbctl(t, dir, "", "-o", "json", "sync", "-list"); strings.TrimSpace(out) != "[]" {
+		t.Errorf("submit with an unreadable response: want nothing queued, got %q", out)
+	}
+
+	mode = "lost"
+	if _, err := osbctl(t, dir, testRun, "submit", "-"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := db.ListResults(); len(results) != 1 {
+		t.Fatalf("lost response: want the result stored, got %d results", len(results))
+	}
+	mode = ""
+	if _, err := osbctl(t, dir, "", "sync"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := db.ListResults(); len(results) != 1 {
+		t.Errorf("sync: want the queued run recognized as a retry, got %d results", len(results))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes command output as aligned tables or as JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as indented JSON in JSON mode, and otherwise calls table to
+// write the table rows, the first of which is the header.
+func (p *printer) print(v interface{}, table func() [][]string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, row := range table() {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// formatScore formats a score for tables.
+func formatScore(score float64) string {
+	return fmt.Sprintf("%.2f", score)
+}
@@ -0,0 +1,362 @@
+// Package archive exports the users, results and specs of an OSB database to
+// a portable archive and imports such archives into any OSBDatabase.
+//
+// An archive is a gzip compressed tar file holding manifest.json followed by
+// users.ndjson, results.ndjson and specs.ndjson, each with one record per
+// line. The manifest records the format version, the number of records and
+// the SHA-256 checksum of every data file.
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Version is the archive format version written by Export. Import accepts
+// archives up to this version.
+const Version = 1
+
+// Names of the files within an archive.
+const (
+	manifestFile = "manifest.json"
+	usersFile    = "users.ndjson"
+	resultsFile  = "results.ndjson"
+	specsFile    = "specs.ndjson"
+)
+
+// dataFiles lists the data files in the order they are written and imported.
+var dataFiles = []string{usersFile, resultsFile, specsFile}
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Version   int                 `json:"version"`
+	CreatedAt time.Time           `json:"created_at"`
+	Passwords bool                `json:"passwords"` // users include their password hashes
+	Files     map[string]FileInfo `json:"files"`     // data files by name
+}
+
+// FileInfo describes a data file within an archive.
+type FileInfo struct {
+	Records int    `json:"records"` // number of records
+	SHA256  string `json:"sha256"`  // hex encoded checksum of the file
+}
+
+// user is a user record.
+type user struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	Admin        bool   `json:"admin"`
+}
+
+// result is a result record.
+type result struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Scores    database.Scores `json:"scores"`
+	Hidden    bool            `json:"hidden,omitempty"` // hidden by a moderator
+}
+
+// specs is a specs record.
+type specs struct {
+	ID       int64            `json:"id"`
+	ResultID int64            `json:"result_id"`
+	SysInfo  database.SysInfo `json:"sys_info"`
+	Raw      json.RawMessage  `json:"raw,omitempty"` // specs object as submitted
+}
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	Passwords bool // include password hashes, which are left out by default
+}
+
+// Export writes the users, results and specs of db to w as an archive.
+// Hidden results are exported along with their specs and stay hidden when
+// imported.
+func Export(w io.Writer, db database.OSBDatabase, opts ExportOptions) (*Manifest, error) {
+	users, err := db.ListUserAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("archive: list users: %v", err)
+	}
+	results, err := db.ExportResults()
+	if err != nil {
+		return nil, fmt.Errorf("archive: list results: %v", err)
+	}
+	allSpecs, err := db.ExportSpecs()
+	if err != nil {
+		return nil, fmt.Errorf("archive: list specs: %v", err)
+	}
+
+	files := make(map[string]*bytes.Buffer)
+	manifest := &Manifest{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Passwords: opts.Passwords,
+		Files:     make(map[string]FileInfo),
+	}
+	add := func(name string, records int, write func(enc *json.Encoder) error) error {
+		var buf bytes.Buffer
+		if err := write(json.NewEncoder(&buf)); err != nil {
+			return fmt.Errorf("archive: encode %s: %v", name, err)
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		files[name] = &buf
+		manifest.Files[name] = FileInfo{Records: records, SHA256: hex.EncodeToString(sum[:])}
+		return nil
+	}
+
+	err = add(usersFile, len(users), func(enc *json.Encoder) error {
+		for _, u := range users {
+			rec := user{ID: u.ID, Name: u.Name, Email: u.Email, Admin: u.Admin}
+			if opts.Passwords {
+				rec.PasswordHash = u.Password
+			}
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = add(resultsFile, len(results), func(enc *json.Encoder) error {
+		for _, r := range results {
+			if err := enc.Encode(result{ID: r.ID, UserID: r.UserID, CreatedAt: r.CreatedAt.UTC(), Scores: r.Scores, Hidden: r.Hidden}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = add(specsFile, len(allSpecs), func(enc *json.Encoder) error {
+		for _, s := range allSpecs {
+			if err := enc.Encode(specs{ID: s.ID, ResultID: s.ResultID, SysInfo: s.SysInfo, Raw: s.Raw}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("archive: encode manifest: %v", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	writeFile := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := writeFile(manifestFile, m); err != nil {
+		return nil, fmt.Errorf("archive: write %s: %v", manifestFile, err)
+	}
+	for _, name := range dataFiles {
+		if err := writeFile(name, files[name].Bytes()); err != nil {
+			return nil, fmt.Errorf("archive: write %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("archive: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("archive: %v", err)
+	}
+	return manifest, nil
+}
+
+// ImportStats reports what Import added.
+type ImportStats struct {
+	Users   int
+	Results int
+	Specs   int
+}
+
+// Import loads an archive from r into db. It verifies the archive's version,
+// checksums and record counts, and that every result belongs to an archived
+// user and every specs to an archived result, before writing anything, and
+// then writes all records in one transaction, so that a failed import leaves
+// db as it was. The records get new IDs in db, and references between them
+// are remapped. Users archived without password hashes cannot sign in until
+// their passwords are reset. Import fails if a user name already exists in db.
+func Import(r io.Reader, db database.OSBDatabase) (*ImportStats, error) {
+	a, err := read(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.check(db); err != nil {
+		return nil, err
+	}
+
+	users := make([]*database.User, len(a.users))
+	for i, u := range a.users {
+		users[i] = &database.User{ID: u.ID, Name: u.Name, Email: u.Email, Password: u.PasswordHash, Admin: u.Admin}
+	}
+	results := make([]*database.Result, len(a.results))
+	for i, res := range a.results {
+		results[i] = &database.Result{ID: res.ID, UserID: res.UserID, Scores: res.Scores, CreatedAt: res.CreatedAt, Hidden: res.Hidden}
+	}
+	allSpecs := make([]*database.Specs, len(a.specs))
+	for i, s := range a.specs {
+		allSpecs[i] = &database.Specs{ID: s.ID, ResultID: s.ResultID, SysInfo: s.SysInfo, Raw: s.Raw}
+	}
+	if err := db.Import(users, results, allSpecs); err != nil {
+		return nil, fmt.Errorf("archive: import: %w", err)
+	}
+	return &ImportStats{Users: len(users), Results: len(results), Specs: len(allSpecs)}, nil
+}
+
+// archive holds the decoded contents of an archive.
+type archive struct {
+	manifest Manifest
+	users    []*user
+	results  []*result
+	specs    []*specs
+}
+
+// read decodes an archive and verifies its version, checksums and record counts.
+func read(r io.Reader) (*archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %v", err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: %v", err)
+		}
+		if files[hdr.Name], err = ioutil.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("archive: read %s: %v", hdr.Name, err)
+		}
+	}
+
+	var a archive
+	m, ok := files[manifestFile]
+	if !ok {
+		return nil, errors.New("archive: missing " + manifestFile)
+	}
+	if err := json.Unmarshal(m, &a.manifest); err != nil {
+		return nil, fmt.Errorf("archive: decode %s: %v", manifestFile, err)
+	}
+	if a.manifest.Version < 1 || a.manifest.Version > Version {
+		return nil, fmt.Errorf("archive: unsupported version %d, want 1 to %d", a.manifest.Version, Version)
+	}
+
+	for _, name := range dataFiles {
+		data, ok := files[name]
+		if !ok {
+			return nil, errors.New("archive: missing " + name)
+		}
+		info := a.manifest.Files[name]
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != info.SHA256 {
+			return nil, fmt.Errorf("archive: %s does not match its checksum", name)
+		}
+
+		var n int
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var err error
+			switch name {
+			case usersFile:
+				u := new(user)
+				err = dec.Decode(u)
+				a.users = append(a.users, u)
+			case resultsFile:
+				res := new(result)
+				err = dec.Decode(res)
+				a.results = append(a.results, res)
+			case specsFile:
+				s := new(specs)
+				err = dec.Decode(s)
+				a.specs = append(a.specs, s)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("archive: decode %s record %d: %v", name, n+1, err)
+			}
+			n++
+		}
+		if n != info.Records {
+			return nil, fmt.Errorf("archive: %s has %d records, manifest says %d", name, n, info.Records)
+		}
+	}
+	return &a, nil
+}
+
+// check verifies that the IDs within the archive are unique, that every
+// reference points to an archived record and that no archived user name is
+// taken in db.
+func (a *archive) check(db database.UserDatabase) error {
+	existing, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("archive: list users: %v", err)
+	}
+	names := make(map[string]bool, len(existing))
+	for _, u := range existing {
+		names[u.Name] = true
+	}
+
+	users := make(map[int64]bool, len(a.users))
+	for _, u := range a.users {
+		if users[u.ID] {
+			return fmt.Errorf("archive: duplicate user id %d", u.ID)
+		}
+		if names[u.Name] {
+			return fmt.Errorf("archive: user name %q already exists", u.Name)
+		}
+		users[u.ID], names[u.Name] = true, true
+	}
+
+	results := make(map[int64]bool, len(a.results))
+	for _, res := range a.results {
+		if results[res.ID] {
+			return fmt.Errorf("archive: duplicate result id %d", res.ID)
+		}
+		if !users[res.UserID] {
+			return fmt.Errorf("archive: result %d refers to missing user %d", res.ID, res.UserID)
+		}
+		results[res.ID] = true
+	}
+
+	specs := make(map[int64]bool, len(a.specs))
+	for _, s := range a.specs {
+		if specs[s.ID] {
+			return fmt.Errorf("archive: duplicate specs id %d", s.ID)
+		}
+		if !results[s.ResultID] {
+			return fmt.Errorf("archive: specs %d refers to missing result %d", s.ID, s.ResultID)
+		}
+		specs[s.ID] = true
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/archive"
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+)
+
+func newSourceDB(t *testing.T) *dbtest.DB {
+	db := dbtest.New()
+	alice, err := db.AddUser(&database.User{Name: "alice", Email: "alice@example.com", Password: dbtest.HashPassword("secret"), Admin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddUser(&database.User{Name: "bob", Password: dbtest.HashPassword("hunter2")}); err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2018, time.November, 7, 21, 43, 49, 0, time.UTC)
+	id, err := db.AddResult(&database.Result{
+		UserID:    alice,
+		Scores:    database.Scores{{Name: "Total", Score: 1234.5, Time: database.Duration{Duration: 1500 * time.Millisecond}}},
+		CreatedAt: created,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := &database.Specs{
+		ResultID: id,
+		SysInfo:  database.SysInfo{Vendor: "GenuineIntel", Model: "Intel Core i7-8750H", Threads: "12", PhysicalMem: "15.51 GB"},
+		Raw:      json.RawMessage(`{"vendor":"GenuineIntel","model":"Intel Core i7-8750H","threads":12,"physical_mem":"15.51 GB"}`),
+	}
+	if _, err := db.AddSpecs(specs); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, passwords := range []bool{false, true} {
+		var buf bytes.Buffer
+		manifest, err := archive.Export(&buf, newSourceDB(t), archive.ExportOptions{Passwords: passwords})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manifest.Version != archive.Version || manifest.Files["results.ndjson"].Records != 1 {
+			t.Errorf("got manifest %+v", manifest)
+		}
+
+		// An existing user shifts the IDs of the imported records.
+		dst := dbtest.New()
+		if _, err := dst.AddUser(&database.User{Name: "carol"}); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := archive.Import(&buf, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *stats != (archive.ImportStats{Users: 2, Results: 1, Specs: 1}) {
+			t.Errorf("got stats %+v", *stats)
+		}
+
+		_, err = dst.GetUserByCredentials("alice", "secret")
+		if passwords && err != nil {
+			t.Errorf("password hash was not imported: %v", err)
+		}
+		if !passwords && err == nil {
+			t.Error("password hash was exported without being asked for")
+		}
+
+		accounts, err := dst.ListUserAccounts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var alice *database.User
+		for _, u := range accounts {
+			if u.Name == "alice" {
+				alice = u
+			}
+		}
+		if alice == nil || !alice.Admin || alice.Email != "alice@example.com" {
+			t.Fatalf("got imported alice %+v", alice)
+		}
+
+		results, err := dst.ListResultsCreatedBy(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Scores[0].Score != 1234.5 || results[0].Scores[0].Time.Duration != 1500*time.Millisecond ||
+			!results[0].CreatedAt.Equal(time.Date(2018, time.November, 7, 21, 43, 49, 0, time.UTC)) {
+			t.Fatalf("got imported results %+v", results)
+		}
+		specs, err := dst.ListSpecsWithResultID(results[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(specs) != 1 || specs[0].Model != "Intel Core i7-8750H" || specs[0].PhysicalMem != "15.51 GB" ||
+			!strings.Contains(string(specs[0].Raw), `"threads":12`) {
+			t.Errorf("got imported specs %+v", specs)
+		}
+	}
+}
+
+func TestRoundTripHidden(t *testing.T) {
+	src := newSourceDB(t)
+	id, err := src.AddResult(&database.Result{UserID: 1, Scores: database.Scores{{Name: "Total", Score: 99999}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.AddSpecs(&database.Specs{ResultID: id, SysInfo: database.SysInfo{Model: "Intel Core i9-9900K", Threads: "16"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.HideResult(id); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := archive.Export(&buf, src, archive.ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dst := dbtest.New()
+	stats, err := archive.Import(&buf, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (archive.ImportStats{Users: 2, Results: 2, Specs: 2}) {
+		t.Errorf("got stats %+v", *stats)
+	}
+
+	results, err := dst.ListResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Scores[0].Score != 1234.5 {
+		t.Errorf("got visible results %+v, want only the one that was not hidden", results)
+	}
+	specs, err := dst.ListSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(specs) != 1 || specs[0].Model != "Intel Core i7-8750H" {
+		t.Errorf("got visible specs %+v, want only those of the visible result", specs)
+	}
+
+	all, err := dst.ExportResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Hidden || !all[1].Hidden || all[1].Scores[0].Score != 99999 {
+		t.Errorf("got exported results %+v, want the second one hidden", all)
+	}
+}
+
+// rewrite returns a copy of the archive in data with edit applied to each file.
+func rewrite(t *testing.T, data []byte, edit func(name string, content []byte) []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = edit(hdr.Name, content)
+		hdr.Size = int64(len(content))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+	tw.Close()
+	gw.Close()
+	return out.Bytes()
+}
+
+func TestImportIntegrity(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := archive.Export(&buf, newSourceDB(t), archive.ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	tt := []struct {
+		Name  string
+		Edit  func(name string, content []byte) []byte
+		Error string
+	}{
+		{
+			Name: "Tampered data",
+			Edit: func(name string, content []byte) []byte {
+				if name == "results.ndjson" {
+					return bytes.Replace(content, []byte("1234.5"), []byte("9999.5"), 1)
+				}
+				return content
+			},
+			Error: "does not match its checksum",
+		},
+		{
+			Name: "Future version",
+			Edit: func(name string, content []byte) []byte {
+				if name == "manifest.json" {
+					return bytes.Replace(content, []byte(`"version": 1`), []byte(`"version": 99`), 1)
+				}
+				return content
+			},
+			Error: "unsupported version 99",
+		},
+		{
+			Name: "Missing users",
+			Edit: func(name string, content []byte) []byte {
+				if name == "users.ndjson" {
+					return nil
+				}
+				if name == "manifest.json" {
+					var m archive.Manifest
+					if err := json.Unmarshal(content, &m); err != nil {
+						t.Fatal(err)
+					}
+					sum := sha256.Sum256(nil)
+					m.Files["users.ndjson"] = archive.FileInfo{Records: 0, SHA256: hex.EncodeToString(sum[:])}
+					content, _ = json.Marshal(m)
+				}
+				return content
+			},
+			Error: "refers to missing user",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			db := dbtest.New()
+			_, err := archive.Import(bytes.NewReader(rewrite(t, data, tc.Edit)), db)
+			if err == nil || !strings.Contains(err.Error(), tc.Error) {
+				t.Fatalf("got error %v, want one containing %q", err, tc.Error)
+			}
+			if users, _ := db.ListUsers(); len(users) != 0 {
+				t.Errorf("imported %d users from an invalid archive", len(users))
+			}
+		})
+	}
+
+	t.Run("Existing user name", func(t *testing.T) {
+		db := dbtest.New()
+		if _, err := db.AddUser(&database.User{Name: "bob"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Import(bytes.NewReader(data), db); err == nil || !strings.Contains(err.Error(), `"bob" already exists`) {
+			t.Fatalf("got error %v, want user name conflict", err)
+		}
+	})
+
+	// Specs are imported last, so failing to save them must not leave the
+	// users and results imported before them.
+	t.Run("Invalid specs", func(t *testing.T) {
+		var specs []byte
+		invalid := rewrite(t, data, func(name string, content []byte) []byte {
+			if name == "specs.ndjson" {
+				specs = bytes.Replace(content, []byte(`"12"`), []byte(`"twelve"`), 1)
+				return specs
+			}
+			return content
+		})
+		invalid = rewrite(t, invalid, func(name string, content []byte) []byte {
+			if name == "manifest.json" {
+				var m archive.Manifest
+				if err := json.Unmarshal(content, &m); err != nil {
+					t.Fatal(err)
+				}
+				sum := sha256.Sum256(specs)
+				m.Files["specs.ndjson"] = archive.FileInfo{Records: 1, SHA256: hex.EncodeToString(sum[:])}
+				content, _ = json.Marshal(m)
+			}
+			return content
+		})
+
+		db := dbtest.New()
+		if _, err := archive.Import(bytes.NewReader(invalid), db); err == nil || strings.Contains(err.Error(), "checksum") {
+			t.Fatalf("got error %v, want invalid specs", err)
+		}
+		if users, _ := db.ListUsers(); len(users) != 0 {
+			t.Errorf("imported %d users from an archive with invalid specs", len(users))
+		}
+		if results, _ := db.ListResults(); len(results) != 0 {
+			t.Errorf("imported %d results from an archive with invalid specs", len(results))
+		}
+	})
+}
@@ -0,0 +1,129 @@
+package charts
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// badgePadding is the horizontal padding on each side of a badge's texts.
+const badgePadding = 5
+
+// Badge is a shields-style two-part badge with a label and a message.
+type Badge struct {
+	Label      string // left text
+	Message    string // right text
+	LabelColor string // label background, see ParseColor; grey if empty
+	Color      string // message background, see ParseColor; blue if empty
+}
+
+// namedColors maps the color names accepted by ParseColor to hex colors.
+var namedColors = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellowgreen": "#a4a61d",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"blue":        "#007ec6",
+	"lightgrey":   "#9f9f9f",
+	"grey":        "#555",
+}
+
+var hexColor = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// ParseColor returns the hex color for s, which is either one of brightgreen,
+// green, yellowgreen, yellow, orange, red, blue, lightgrey and grey or a 3 or
+// 6 digit hex color with an optional leading #.
+func ParseColor(s string) (string, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	if m := hexColor.FindStringSubmatch(s); m != nil {
+		return "#" + strings.ToLower(m[1]), nil
+	}
+	return "", fmt.Errorf("unsupported color %q", s)
+}
+
+// RenderBadge writes b as an SVG image.
+func RenderBadge(w io.Writer, b Badge) error {
+	labelColor, err := badgeColor(b.LabelColor, "grey")
+	if err != nil {
+		return err
+	}
+	color, err := badgeColor(b.Color, "blue")
+	if err != nil {
+		return err
+	}
+
+	lw := TextWidth(b.Label) + 2*badgePadding
+	mw := TextWidth(b.Message) + 2*badgePadding
+	width := lw + mw
+
+	var buf bytes.Buffer
+	escape := func(s string) string {
+		var e bytes.Buffer
+		xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+	label, message := escape(b.Label), escape(b.Message)
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="20" role="img" aria-label="%s: %s">`, coord(width), label, message)
+	fmt.Fprintf(&buf, `<title>%s: %s</title>`, label, message)
+	buf.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&buf, `<clipPath id="r"><rect width="%s" height="20" rx="3" fill="#fff"/></clipPath>`, coord(width))
+	fmt.Fprintf(&buf, `<g clip-path="url(#r)"><rect width="%s" height="20" fill="%s"/><rect x="%s" width="%s" height="20" fill="%s"/><rect width="%s" height="20" fill="url(#s)"/></g>`,
+		coord(lw), labelColor, coord(lw), coord(mw), color, coord(width))
+	buf.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	for _, t := range []struct {
+		x    float64
+		text string
+	}{{lw / 2, label}, {lw + mw/2, message}} {
+		fmt.Fprintf(&buf, `<text x="%s" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%s" y="14">%s</text>`, coord(t.x), t.text, coord(t.x), t.text)
+	}
+	buf.WriteString(`</g></svg>`)
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func badgeColor(s, def string) (string, error) {
+	if s == "" {
+		s = def
+	}
+	return ParseColor(s)
+}
+
+// TextWidth returns the width in pixels of s rendered in 11px Verdana, the
+// font badges are drawn with.
+func TextWidth(s string) float64 {
+	var w float64
+	for _, r := range s {
+		if r >= ' ' && int(r-' ') < len(verdanaWidths) {
+			w += verdanaWidths[r-' ']
+		} else {
+			w += verdanaWideWidth
+		}
+	}
+	return w
+}
+
+// verdanaWideWidth is the width assumed for characters outside printable ASCII.
+const verdanaWideWidth = 11
+
+// verdanaWidths holds the advance widths of the printable ASCII characters,
+// starting at the space, in 11px Verdana.
+var verdanaWidths = [...]float64{
+	3.87, 4.33, 5.05, 9.00, 7.00, 11.84, 7.99, 2.95, 4.99, 4.99, 7.00, 9.00, 4.00, 4.99, 4.00, 4.99, // space to /
+	7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, // 0 to 9
+	4.99, 4.99, 9.00, 9.00, 9.00, 6.00, 11.00, // : to @
+	7.52, 7.54, 7.68, 8.48, 6.96, 6.32, 8.53, 8.27, 4.61, 5.00, 7.62, 6.12, 9.27, // A to M
+	8.23, 8.66, 6.63, 8.66, 7.65, 7.52, 6.78, 8.05, 7.52, 10.88, 7.54, 6.77, 7.54, // N to Z
+	4.99, 4.99, 4.99, 9.00, 7.00, 7.00, // [ to `
+	6.61, 6.82, 5.73, 6.82, 6.55, 3.87, 6.82, 6.96, 3.01, 3.79, 6.51, 3.01, 10.69, // a to m
+	6.96, 6.67, 6.82, 6.82, 4.69, 5.73, 4.33, 6.96, 6.51, 8.98, 6.51, 6.51, 5.77, // n to z
+	6.98, 4.99, 6.98, 9.00, // { to ~
+}
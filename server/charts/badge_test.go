@@ -0,0 +1,60 @@
+package charts_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/charts"
+)
+
+func TestTextWidth(t *testing.T) {
+	if got := charts.TextWidth(""); got != 0 {
+		t.Errorf("empty text: got width %v, want 0", got)
+	}
+	if narrow, wide := charts.TextWidth("iiii"), charts.TextWidth("WWWW"); narrow >= wide {
+		t.Errorf("got width %v for iiii and %v for WWWW, want iiii narrower", narrow, wide)
+	}
+	if got, want := charts.TextWidth("OSB"), 8.66+7.52+7.54; got != want {
+		t.Errorf("OSB: got width %v, want %v", got, want)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tt := []struct {
+		In   string
+		Want string
+		Err  bool
+	}{
+		{In: "brightgreen", Want: "#4c1"},
+		{In: "Blue", Want: "#007ec6"},
+		{In: "#ABC", Want: "#abc"},
+		{In: "ff8800", Want: "#ff8800"},
+		{In: "#ff88", Err: true},
+		{In: `"/><script>`, Err: true},
+	}
+
+	for _, tc := range tt {
+		got, err := charts.ParseColor(tc.In)
+		if (err != nil) != tc.Err || got != tc.Want {
+			t.Errorf("ParseColor(%q) = %q, %v; want %q, error %t", tc.In, got, err, tc.Want, tc.Err)
+		}
+	}
+}
+
+func TestRenderBadge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := charts.RenderBadge(&buf, charts.Badge{Label: "OSB", Message: "1234 | top 5%", Color: "green"}); err != nil {
+		t.Fatal(err)
+	}
+	countElements(t, buf.Bytes())
+	for _, want := range []string{`aria-label="OSB: 1234 | top 5%"`, `fill="#97ca00"`, `fill="#555"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("badge does not contain %s:\n%s", want, buf.String())
+		}
+	}
+
+	if err := charts.RenderBadge(&buf, charts.Badge{Color: "invalid"}); err == nil {
+		t.Error("invalid color: got no error")
+	}
+}
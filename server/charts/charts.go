@@ -0,0 +1,188 @@
+// Package charts renders benchmark charts and badges as standalone SVG images.
+package charts
+
+import (
+	"io"
+	"math"
+	"time"
+)
+
+// Default chart dimensions in pixels.
+const (
+	DefaultWidth  = 640
+	DefaultHeight = 360
+)
+
+// yTicks is the approximate number of value axis ticks.
+const yTicks = 6
+
+// Options configures the appearance of a chart.
+type Options struct {
+	Title  string // chart title, omitted if empty
+	XLabel string // x axis label, omitted if empty
+	YLabel string // y axis label, omitted if empty
+	Width  int    // image width, DefaultWidth if 0
+	Height int    // image height, DefaultHeight if 0
+}
+
+func (o Options) withDefaults() Options {
+	if o.Width <= 0 {
+		o.Width = DefaultWidth
+	}
+	if o.Height <= 0 {
+		o.Height = DefaultHeight
+	}
+	return o
+}
+
+// Bar is a labeled value in a bar chart.
+type Bar struct {
+	Label string
+	Value float64
+}
+
+// Point is a timestamped value in a line chart.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is a named line in a line chart. Points must be ordered by time.
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// Histogram writes an SVG histogram of the distribution of values split into
+// the given number of equally wide bins.
+func Histogram(w io.Writer, values []float64, bins int, opts Options) error {
+	c := newCanvas(opts)
+	if len(values) == 0 || bins <= 0 {
+		c.empty()
+		return c.writeTo(w)
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	width := (hi - lo) / float64(bins)
+	if width == 0 {
+		bins, width = 1, 1
+	}
+	counts := make([]int, bins)
+	maxCount := 0
+	for _, v := range values {
+		i := int((v - lo) / width)
+		if i >= bins {
+			i = bins - 1 // the maximum belongs to the last bin
+		}
+		counts[i]++
+		if counts[i] > maxCount {
+			maxCount = counts[i]
+		}
+	}
+
+	y := c.yAxis(ticks(0, float64(maxCount), yTicks))
+	left, _, right, bottom := c.plot()
+	binWidth := (right - left) / float64(bins)
+	labelEvery := (bins + 9) / 10
+	for i, n := range counts {
+		x := left + float64(i)*binWidth
+		from, to := lo+float64(i)*width, lo+float64(i+1)*width
+		c.rect(x+1, y(float64(n)), binWidth-2, bottom-y(float64(n)), palette[0],
+			formatValue(from)+" to "+formatValue(to)+": "+formatValue(float64(n)))
+		if i%labelEvery == 0 {
+			c.text(x, bottom+16, "middle", `fill="#555555"`, formatValue(from))
+		}
+	}
+	c.text(right, bottom+16, "middle", `fill="#555555"`, formatValue(lo+float64(bins)*width))
+	return c.writeTo(w)
+}
+
+// BarChart writes an SVG chart with one vertical bar per value.
+func BarChart(w io.Writer, bars []Bar, opts Options) error {
+	c := newCanvas(opts)
+	if len(bars) == 0 {
+		c.empty()
+		return c.writeTo(w)
+	}
+
+	lo, hi := 0.0, 0.0
+	for _, b := range bars {
+		lo, hi = math.Min(lo, b.Value), math.Max(hi, b.Value)
+	}
+	y := c.yAxis(ticks(lo, hi, yTicks))
+	left, _, right, bottom := c.plot()
+	slot := (right - left) / float64(len(bars))
+	for i, b := range bars {
+		x := left + float64(i)*slot + slot*0.15
+		top, base := y(math.Max(b.Value, 0)), y(math.Min(b.Value, 0))
+		c.rect(x, top, slot*0.7, base-top, palette[i%len(palette)], b.Label+": "+formatValue(b.Value))
+		c.text(x+slot*0.35, top-4, "middle", `fill="#333333"`, formatValue(b.Value))
+		c.text(x+slot*0.35, bottom+16, "middle", `fill="#555555"`, b.Label)
+	}
+	return c.writeTo(w)
+}
+
+// LineChart writes an SVG chart with one line per series plotted over time.
+func LineChart(w io.Writer, series []Series, opts Options) error {
+	c := newCanvas(opts)
+
+	var t0, t1 time.Time
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range series {
+		for _, p := range s.Points {
+			if t0.IsZero() || p.Time.Before(t0) {
+				t0 = p.Time
+			}
+			if p.Time.After(t1) {
+				t1 = p.Time
+			}
+			lo, hi = math.Min(lo, p.Value), math.Max(hi, p.Value)
+		}
+	}
+	if math.IsInf(lo, 1) {
+		c.empty()
+		return c.writeTo(w)
+	}
+
+	y := c.yAxis(ticks(lo, hi, yTicks))
+	left, top, right, bottom := c.plot()
+	span := t1.Sub(t0)
+	x := func(t time.Time) float64 {
+		if span == 0 {
+			return (left + right) / 2
+		}
+		return left + float64(t.Sub(t0))/float64(span)*(right-left)
+	}
+	if span == 0 {
+		c.text(x(t0), bottom+16, "middle", `fill="#555555"`, t0.Format("2006-01-02"))
+	} else {
+		for i := 0; i <= 4; i++ {
+			t := t0.Add(span * time.Duration(i) / 4)
+			c.text(x(t), bottom+16, "middle", `fill="#555555"`, t.Format("2006-01-02"))
+		}
+	}
+
+	for i, s := range series {
+		color := palette[i%len(palette)]
+		xs := make([]float64, len(s.Points))
+		ys := make([]float64, len(s.Points))
+		for j, p := range s.Points {
+			xs[j], ys[j] = x(p.Time), y(p.Value)
+		}
+		if len(s.Points) > 1 {
+			c.polyline(xs, ys, color)
+		}
+		for j, p := range s.Points {
+			c.circle(xs[j], ys[j], 3, color, p.Time.Format("2006-01-02 15:04")+": "+formatValue(p.Value))
+		}
+		if s.Name != "" {
+			ly := top + 4 + float64(i)*16
+			c.rect(right-10, ly, 10, 10, color, "")
+			c.text(right-14, ly+9, "end", `fill="#333333"`, s.Name)
+		}
+	}
+	return c.writeTo(w)
+}
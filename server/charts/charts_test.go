@@ -0,0 +1,93 @@
+package charts_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/charts"
+)
+
+// countElements checks that svg is well-formed XML and counts its elements by name.
+func countElements(t *testing.T, svg []byte) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	dec := xml.NewDecoder(bytes.NewReader(svg))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return counts
+		}
+		if err != nil {
+			t.Fatalf("invalid svg: %v\n%s", err, svg)
+		}
+		if el, ok := tok.(xml.StartElement); ok {
+			counts[el.Name.Local]++
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Values []float64
+		Bins   int
+		Rects  int // bars plus the background
+	}{
+		{Name: "Spread", Values: []float64{1, 2, 2, 3, 10}, Bins: 3, Rects: 4},
+		{Name: "Single value", Values: []float64{5, 5}, Bins: 10, Rects: 2},
+		{Name: "Empty", Values: nil, Bins: 10, Rects: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := charts.Histogram(&buf, tc.Values, tc.Bins, charts.Options{Title: "Total <score>"}); err != nil {
+				t.Fatal(err)
+			}
+			counts := countElements(t, buf.Bytes())
+			if counts["rect"] != tc.Rects {
+				t.Errorf("got %d rects, want %d", counts["rect"], tc.Rects)
+			}
+			if !strings.Contains(buf.String(), "Total &lt;score&gt;") {
+				t.Error("title was not escaped")
+			}
+		})
+	}
+}
+
+func TestBarChart(t *testing.T) {
+	var buf bytes.Buffer
+	bars := []charts.Bar{{Label: "#1", Value: 1200}, {Label: "#2", Value: 950.5}, {Label: "#3", Value: -10}}
+	if err := charts.BarChart(&buf, bars, charts.Options{Width: 300, Height: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if got := countElements(t, buf.Bytes())["rect"]; got != 4 {
+		t.Errorf("got %d rects, want 4", got)
+	}
+	if !strings.Contains(buf.String(), `width="300" height="200"`) {
+		t.Error("size options were ignored")
+	}
+}
+
+func TestLineChart(t *testing.T) {
+	start := time.Date(2018, time.November, 7, 0, 0, 0, 0, time.UTC)
+	series := []charts.Series{
+		{Name: "Intel Core i7-8750H", Points: []charts.Point{{start, 100}, {start.Add(48 * time.Hour), 120}, {start.Add(96 * time.Hour), 90}}},
+		{Name: "AMD Ryzen 7 2700X", Points: []charts.Point{{start.Add(24 * time.Hour), 300}}},
+	}
+	var buf bytes.Buffer
+	if err := charts.LineChart(&buf, series, charts.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	counts := countElements(t, buf.Bytes())
+	if counts["polyline"] != 1 || counts["circle"] != 4 {
+		t.Errorf("got %d lines and %d points, want 1 and 4", counts["polyline"], counts["circle"])
+	}
+	if !strings.Contains(buf.String(), "2018-11-07") {
+		t.Error("missing date labels")
+	}
+}
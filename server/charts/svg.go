@@ -0,0 +1,176 @@
+package charts
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Margins around the plot area, leaving room for the title and axis labels.
+const (
+	marginTop    = 40
+	marginRight  = 20
+	marginBottom = 50
+	marginLeft   = 64
+)
+
+// palette holds the colors of successive bars and series.
+var palette = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7"}
+
+// canvas accumulates the elements of an SVG image.
+type canvas struct {
+	buf  bytes.Buffer
+	opts Options
+}
+
+func newCanvas(opts Options) *canvas {
+	c := &canvas{opts: opts.withDefaults()}
+	w, h := c.opts.Width, c.opts.Height
+	fmt.Fprintf(&c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`, w, h, w, h)
+	fmt.Fprintf(&c.buf, `<rect width="%d" height="%d" fill="#ffffff"/>`, w, h)
+	if c.opts.Title != "" {
+		c.text(float64(w)/2, 24, "middle", "font-size=\"14\" font-weight=\"bold\"", c.opts.Title)
+	}
+	return c
+}
+
+// plot returns the bounds of the plot area.
+func (c *canvas) plot() (left, top, right, bottom float64) {
+	return marginLeft, marginTop, float64(c.opts.Width - marginRight), float64(c.opts.Height - marginBottom)
+}
+
+func (c *canvas) text(x, y float64, anchor, attrs, s string) {
+	fmt.Fprintf(&c.buf, `<text x="%s" y="%s" text-anchor="%s" %s>`, coord(x), coord(y), anchor, attrs)
+	xml.EscapeText(&c.buf, []byte(s))
+	c.buf.WriteString(`</text>`)
+}
+
+func (c *canvas) line(x1, y1, x2, y2 float64, stroke string) {
+	fmt.Fprintf(&c.buf, `<line x1="%s" y1="%s" x2="%s" y2="%s" stroke="%s"/>`, coord(x1), coord(y1), coord(x2), coord(y2), stroke)
+}
+
+func (c *canvas) rect(x, y, w, h float64, fill, title string) {
+	fmt.Fprintf(&c.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s">`, coord(x), coord(y), coord(w), coord(h), fill)
+	c.title(title)
+	c.buf.WriteString(`</rect>`)
+}
+
+func (c *canvas) circle(x, y, r float64, fill, title string) {
+	fmt.Fprintf(&c.buf, `<circle cx="%s" cy="%s" r="%s" fill="%s">`, coord(x), coord(y), coord(r), fill)
+	c.title(title)
+	c.buf.WriteString(`</circle>`)
+}
+
+func (c *canvas) polyline(xs, ys []float64, stroke string) {
+	c.buf.WriteString(`<polyline fill="none" stroke-width="2" stroke="` + stroke + `" points="`)
+	for i := range xs {
+		if i > 0 {
+			c.buf.WriteByte(' ')
+		}
+		c.buf.WriteString(coord(xs[i]) + "," + coord(ys[i]))
+	}
+	c.buf.WriteString(`"/>`)
+}
+
+// title adds a tooltip to the enclosing element.
+func (c *canvas) title(s string) {
+	if s == "" {
+		return
+	}
+	c.buf.WriteString(`<title>`)
+	xml.EscapeText(&c.buf, []byte(s))
+	c.buf.WriteString(`</title>`)
+}
+
+// yAxis draws horizontal grid lines and labels for ticks followed by the x
+// axis, and returns a function mapping values to y coordinates.
+func (c *canvas) yAxis(ticks []float64) func(float64) float64 {
+	left, top, right, bottom := c.plot()
+	lo, hi := ticks[0], ticks[len(ticks)-1]
+	y := func(v float64) float64 {
+		return bottom - (v-lo)/(hi-lo)*(bottom-top)
+	}
+	for _, t := range ticks {
+		c.line(left, y(t), right, y(t), "#e0e0e0")
+		c.text(left-6, y(t)+4, "end", `fill="#555555"`, formatValue(t))
+	}
+	if c.opts.YLabel != "" {
+		fmt.Fprintf(&c.buf, `<text transform="translate(14 %s) rotate(-90)" text-anchor="middle" fill="#555555">`, coord((top+bottom)/2))
+		xml.EscapeText(&c.buf, []byte(c.opts.YLabel))
+		c.buf.WriteString(`</text>`)
+	}
+	c.xAxis()
+	return y
+}
+
+// xAxis draws the x axis line and its label over the grid.
+func (c *canvas) xAxis() {
+	left, _, right, bottom := c.plot()
+	c.line(left, bottom, right, bottom, "#555555")
+	if c.opts.XLabel != "" {
+		c.text((left+right)/2, float64(c.opts.Height)-8, "middle", `fill="#555555"`, c.opts.XLabel)
+	}
+}
+
+// empty draws a placeholder message for charts without data.
+func (c *canvas) empty() {
+	c.xAxis()
+	c.text(float64(c.opts.Width)/2, float64(c.opts.Height)/2, "middle", `fill="#888888"`, "No data")
+}
+
+func (c *canvas) writeTo(w io.Writer) error {
+	c.buf.WriteString(`</svg>`)
+	_, err := c.buf.WriteTo(w)
+	return err
+}
+
+// ticks returns about n evenly spaced round values covering lo to hi.
+func ticks(lo, hi float64, n int) []float64 {
+	if hi <= lo {
+		if lo == 0 {
+			return []float64{0, 1}
+		}
+		lo, hi = math.Min(0, lo), math.Max(0, hi)
+		if hi == lo {
+			hi = lo + 1
+		}
+	}
+	step := niceStep((hi - lo) / float64(n-1))
+	start := math.Floor(lo/step) * step
+	end := math.Ceil(hi/step) * step
+	var ts []float64
+	for i := 0; start+float64(i)*step <= end+step/2; i++ {
+		ts = append(ts, start+float64(i)*step)
+	}
+	return ts
+}
+
+// niceStep rounds step up to 1, 2 or 5 times a power of ten.
+func niceStep(step float64) float64 {
+	exp := math.Pow(10, math.Floor(math.Log10(step)))
+	switch f := step / exp; {
+	case f <= 1:
+		return exp
+	case f <= 2:
+		return 2 * exp
+	case f <= 5:
+		return 5 * exp
+	}
+	return 10 * exp
+}
+
+// formatValue formats an axis or tooltip value with up to four significant digits.
+func formatValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e7 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// coord formats a coordinate with at most two decimals.
+func coord(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,18 @@
+package database
+
+// ArchiveDatabase provides thread-safe bulk exports and imports of a database.
+type ArchiveDatabase interface {
+	// ExportResults returns all results, including hidden ones, which have
+	// Hidden set.
+	ExportResults() ([]*Result, error)
+
+	// ExportSpecs returns all specs, including those of hidden results.
+	ExportSpecs() ([]*Specs, error)
+
+	// Import saves users, results and specs in one transaction, so that
+	// none is saved unless all are. Their IDs only link them: results refer
+	// to users and specs to results by the IDs they are given, which must be
+	// among those given. Each is then set to the ID it is saved with, and the
+	// references to the new IDs. Results with Hidden set are saved hidden.
+	Import(users []*User, results []*Result, specs []*Specs) error
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CatalogDatabase provides thread-safe access to a catalog of canonical CPUs.
+type CatalogDatabase interface {
+	// ListCPUs returns a list of all catalogued CPUs.
+	ListCPUs() ([]*CPU, error)
+
+	// GetCPU retrieves a CPU by its id.
+	GetCPU(id int64) (*CPU, error)
+
+	// ResolveCPU returns the CPU whose canonical model or aliases match the
+	// given raw model string, or nil if there is none. Unless vendor is
+	// empty, the CPU must also be of that vendor, e.g. GenuineIntel.
+	ResolveCPU(vendor, model string) (*CPU, error)
+
+	// AddCPU saves a given CPU.
+	AddCPU(cpu *CPU) (int64, error)
+
+	// DeleteCPU deletes a CPU and its aliases with the given id. It returns
+	// ErrNotFound if there is no such CPU.
+	DeleteCPU(id int64) error
+
+	// ListCPUAliases returns a list of aliases for the CPU with the given id.
+	ListCPUAliases(cpuID int64) ([]*CPUAlias, error)
+
+	// AddCPUAlias saves a given alias.
+	AddCPUAlias(alias *CPUAlias) (int64, error)
+
+	// DeleteCPUAlias deletes an alias with the given id. It returns
+	// ErrNotFound if there is no such alias.
+	DeleteCPUAlias(id int64) error
+
+	// ListResultsByCPU returns a list of results whose specs resolve to the
+	// CPU with the given id, as ResolveCPU resolves their vendor and model.
+	ListResultsByCPU(cpuID int64) ([]*Result, error)
+}
+
+// specsCPUID is an SQL expression of the id of the catalogued CPU the Specs
+// row s resolves to, as ResolveCPU resolves its vendor and model, or NULL if
+// there is none.
+const specsCPUID = `(SELECT c.cpu_id FROM CPUs c LEFT JOIN CPUAliases a ON a.cpu_id = c.cpu_id
+	WHERE (c.model = s.cpu_model OR a.model = s.cpu_model)
+	AND (TRIM(COALESCE(JSON_UNQUOTE(JSON_EXTRACT(s.sys_info, '$.vendor')), '')) = ''
+		OR c.vendor = TRIM(JSON_UNQUOTE(JSON_EXTRACT(s.sys_info, '$.vendor'))))
+	ORDER BY c.model = s.cpu_model DESC, c.cpu_id LIMIT 1)`
+
+// CPU represents the CPUs MySQL table.
+type CPU struct {
+	ID          int64  // CPU ID
+	Vendor      string // CPU vendor, e.g. GenuineIntel
+	Family      string // product family, e.g. Core i7
+	Model       string // canonical model name, e.g. Intel Core i7-8750H
+	Cores       int    // number of physical cores
+	Threads     int    // number of hardware threads
+	BaseClockHz int64  // base clock speed in Hz
+}
+
+// CPUAlias represents the CPUAliases MySQL table. An alias maps another
+// spelling of a model name to a catalogued CPU.
+type CPUAlias struct {
+	ID    int64  // alias ID
+	CPUID int64  // aliased CPU ID
+	Model string // canonical form of the aliased model name
+}
+
+var (
+	// trademarkRe matches trademark markers in CPU model names.
+	trademarkRe = regexp.MustCompile(`(?i)\((r|tm|c)\)|®|™`)
+
+	// clockSuffixRe matches a trailing clock speed such as "@ 2.20GHz".
+	clockSuffixRe = regexp.MustCompile(`(?i)\s*@.*$`)
+
+	// noiseWordRe matches words that do not identify a CPU model.
+	noiseWordRe = regexp.MustCompile(`(?i)\b(cpu|processor)\b`)
+)
+
+// CanonicalCPUModel returns the canonical spelling of a raw CPU model name.
+// Trademark markers, a trailing clock speed and the words "CPU" and
+// "Processor" are removed and whitespace is collapsed, so
+// "Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz" becomes "Intel Core i7-8750H".
+func CanonicalCPUModel(model string) string {
+	model = trademarkRe.ReplaceAllString(model, " ")
+	model = clockSuffixRe.ReplaceAllString(model, "")
+	model = noiseWordRe.ReplaceAllString(model, " ")
+	return strings.Join(strings.Fields(model), " ")
+}
+
+// scanCPU returns a CPU from a database row.
+func scanCPU(s rowScanner) (*CPU, error) {
+	var cpu CPU
+	if err := s.Scan(&cpu.ID, &cpu.Vendor, &cpu.Family, &cpu.Model, &cpu.Cores, &cpu.Threads, &cpu.BaseClockHz); err != nil {
+		return nil, err
+	}
+	return &cpu, nil
+}
+
+// scanCPUAlias returns a CPU alias from a database row.
+func scanCPUAlias(s rowScanner) (*CPUAlias, error) {
+	var alias CPUAlias
+	if err := s.Scan(&alias.ID, &alias.CPUID, &alias.Model); err != nil {
+		return nil, err
+	}
+	return &alias, nil
+}
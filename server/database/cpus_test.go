@@ -0,0 +1,78 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+func TestCanonicalCPUModel(t *testing.T) {
+	tt := []struct {
+		Model string
+		Want  string
+	}{
+		{"Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz", "Intel Core i7-8750H"},
+		{"Intel(R) Core(TM) i7-8750H CPU", "Intel Core i7-8750H"},
+		{"Intel Core i7-8750H", "Intel Core i7-8750H"},
+		{"  Intel(r)  Core(tm)   i7-8750H  ", "Intel Core i7-8750H"},
+		{"AMD Ryzen 7 3700X 8-Core Processor", "AMD Ryzen 7 3700X 8-Core"},
+		{"Intel® Xeon® CPU E5-2680 v4 @ 2.40GHz", "Intel Xeon E5-2680 v4"},
+		{"", ""},
+	}
+
+	for _, tc := range tt {
+		if got := database.CanonicalCPUModel(tc.Model); got != tc.Want {
+			t.Errorf("CanonicalCPUModel(%q): got %q, want %q", tc.Model, got, tc.Want)
+		}
+	}
+}
+
+func testCatalogDB(t *testing.T, db database.OSBDatabase) {
+	cpu := &database.CPU{
+		Vendor:      "GenuineIntel",
+		Family:      "Core i7",
+		Model:       "Intel(R) Core(TM) i7-8750H CPU",
+		Cores:       6,
+		Threads:     12,
+		BaseClockHz: 2200000000,
+	}
+
+	id, err := db.AddCPU(cpu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DeleteCPU(id)
+
+	aliasID, err := db.AddCPUAlias(&database.CPUAlias{CPUID: id, Model: "i7-8750H"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range []string{"Intel Core i7-8750H CPU @ 2.20GHz", "i7-8750H"} {
+		got, err := db.ResolveCPU("GenuineIntel", model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.ID != id {
+			t.Errorf("Resolve cpu %q: got %+v, want id %d", model, got, id)
+		}
+	}
+
+	if got, err := db.ResolveCPU("AuthenticAMD", "i7-8750H"); err != nil || got != nil {
+		t.Errorf("Resolve cpu of another vendor: got %+v, %v, want nil", got, err)
+	}
+
+	if err := db.DeleteCPUAlias(aliasID); err != nil {
+		t.Error(err)
+	}
+	if got, err := db.ResolveCPU("", "i7-8750H"); err != nil || got != nil {
+		t.Errorf("Resolve deleted alias: got %+v, %v, want nil", got, err)
+	}
+	if err := db.DeleteCPUAlias(aliasID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Delete deleted alias: got %v, want ErrNotFound", err)
+	}
+	if err := db.DeleteCPU(id + 1000); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Delete missing cpu: got %v, want ErrNotFound", err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"crypto/sha512"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,9 +16,15 @@ import (
 
 // OSBDatabase provides thread-safe access to users, results, and specs.
 type OSBDatabase interface {
+	ArchiveDatabase
+	CatalogDatabase
 	ResultDatabase
 	SpecsDatabase
+	StatsDatabase
+	SubmissionDatabase
+	TokenDatabase
 	UserDatabase
+	WebhookDatabase
 
 	// Close closes the database connection.
 	Close() error
@@ -30,6 +38,7 @@ func Connect(user, passwd, addr, dbName string) (OSBDatabase, error) {
 	cfg.Net = "tcp"
 	cfg.Addr = addr
 	cfg.DBName = dbName
+	cfg.ParseTime = true
 
 	conn, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
@@ -39,12 +48,21 @@ func Connect(user, passwd, addr, dbName string) (OSBDatabase, error) {
 		conn.Close()
 		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
 	}
-	return &mysqlDB{conn: conn, statements: make(map[string]*sql.Stmt)}, nil
+	return &mysqlDB{
+		conn:       conn,
+		statements: make(map[string]*sql.Stmt),
+		stats:      newStatsCache(statsCacheTTL),
+	}, nil
 }
 
+// statsCacheTTL bounds how stale cached statistics may be when results are
+// written by another process.
+const statsCacheTTL = 5 * time.Minute
+
 type mysqlDB struct {
 	conn       *sql.DB
 	statements map[string]*sql.Stmt
+	stats      *statsCache
 }
 
 // Ensure mysqlDB implements the OSBDatabse interface.
@@ -80,7 +98,7 @@ func (db *mysqlDB) ListResults() ([]*Result, error) {
 		db,
 		&prepListResults,
 		"listResults",
-		`SELECT * FROM Results`,
+		`SELECT * FROM Results WHERE hidden = 0`,
 	)
 	if err != nil {
 		return nil, err
@@ -106,15 +124,16 @@ func (db *mysqlDB) ListResults() ([]*Result, error) {
 	return results, nil
 }
 
-var listResultsCreatedByOnce sync.Once
+var listResultsAfterOnce sync.Once
 
-// ListResultsCreatedBy returns a list of results created by a user with the given id.
-func (db *mysqlDB) ListResultsCreatedBy(id int64) ([]*Result, error) {
-	listResultsCreatedBy, err := newStmt(
+// ListResultsAfter returns up to limit results with ids after the given one,
+// ordered by id.
+func (db *mysqlDB) ListResultsAfter(after int64, limit int) ([]*Result, error) {
+	listResultsAfter, err := newStmt(
 		db,
-		&listResultsCreatedByOnce,
-		"listResultsCreatedBy",
-		`SELECT * FROM Results WHERE user_id = ?`,
+		&listResultsAfterOnce,
+		"listResultsAfter",
+		`SELECT * FROM Results WHERE result_id > ? AND hidden = 0 ORDER BY result_id LIMIT ?`,
 	)
 	if err != nil {
 		return nil, err
@@ -123,7 +142,7 @@ func (db *mysqlDB) ListResultsCreatedBy(id int64) ([]*Result, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	rows, err := listResultsCreatedBy.QueryContext(ctx, id)
+	rows, err := listResultsAfter.QueryContext(ctx, after, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -140,15 +159,16 @@ func (db *mysqlDB) ListResultsCreatedBy(id int64) ([]*Result, error) {
 	return results, nil
 }
 
-var getResultOnce sync.Once
+var listLatestResultsOnce sync.Once
 
-// GetResult retrieves a result by its id.
-func (db *mysqlDB) GetResult(id int64) (*Result, error) {
-	getResult, err := newStmt(
+// ListLatestResults returns up to limit visible results, newest first and by
+// descending id among results created at the same time.
+func (db *mysqlDB) ListLatestResults(limit int) ([]*Result, error) {
+	listLatestResults, err := newStmt(
 		db,
-		&getResultOnce,
-		"getResult",
-		`SELECT * FROM Results WHERE result_id = ?`,
+		&listLatestResultsOnce,
+		"listLatestResults",
+		`SELECT * FROM Results WHERE hidden = 0 ORDER BY created_at DESC, result_id DESC LIMIT ?`,
 	)
 	if err != nil {
 		return nil, err
@@ -157,88 +177,171 @@ func (db *mysqlDB) GetResult(id int64) (*Result, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result, err := scanResult(getResult.QueryRowContext(ctx, id))
+	rows, err := listLatestResults.QueryContext(ctx, limit)
 	if err != nil {
-		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		return nil, err
 	}
-	return result, nil
+	defer rows.Close()
+
+	var results []*Result
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
 
-var addResultOnce sync.Once
+// earlierResult is the SQL condition that visible result o was created before
+// result r, by creation time and then by id.
+const earlierResult = `o.hidden = 0 AND (o.created_at < r.created_at OR o.created_at = r.created_at AND o.result_id < r.result_id)`
 
-// AddResult saves a given result.
-func (db *mysqlDB) AddResult(result *Result) (int64, error) {
-	addResult, err := newStmt(
+var listLatestRecordsOnce sync.Once
+
+// ListLatestRecords returns up to limit of the latest records set by visible
+// results, newest first and by benchmark within a result. A score is a record
+// if no earlier result scored as much on its benchmark, and it beats the best
+// earlier score, first reached by the previous record.
+func (db *mysqlDB) ListLatestRecords(limit int) ([]*Record, error) {
+	listLatestRecords, err := newStmt(
 		db,
-		&addResultOnce,
-		"addResult",
-		`INSERT INTO Results(user_id, scores) VALUES(?, ?)`,
+		&listLatestRecordsOnce,
+		"listLatestRecords",
+		`SELECT rec.result_id, rec.user_id, rec.created_at, rec.benchmark, rec.score, p.result_id, p.user_id, pb.score
+		FROM (
+			SELECT r.result_id, r.user_id, r.created_at, b.benchmark, b.score, (
+				SELECT o.result_id FROM BenchmarkScores ob JOIN Results o ON o.result_id = ob.result_id
+				WHERE ob.benchmark = b.benchmark AND `+earlierResult+`
+				ORDER BY ob.score DESC, o.created_at, o.result_id LIMIT 1
+			) AS previous_id
+			FROM BenchmarkScores b JOIN Results r ON r.result_id = b.result_id
+			WHERE r.hidden = 0 AND NOT EXISTS (
+				SELECT 1 FROM BenchmarkScores ob JOIN Results o ON o.result_id = ob.result_id
+				WHERE ob.benchmark = b.benchmark AND ob.score >= b.score AND `+earlierResult+`
+			)
+			ORDER BY r.created_at DESC, r.result_id DESC, b.benchmark LIMIT ?
+		) rec
+		LEFT JOIN Results p ON p.result_id = rec.previous_id
+		LEFT JOIN BenchmarkScores pb ON pb.result_id = rec.previous_id AND pb.benchmark = rec.benchmark
+		ORDER BY rec.created_at DESC, rec.result_id DESC, rec.benchmark`,
 	)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	r, err := addResult.ExecContext(ctx, result.UserID, result.Scores)
+	rows, err := listLatestRecords.QueryContext(ctx, limit)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return r.LastInsertId()
+	defer rows.Close()
+
+	var records []*Record
+	for rows.Next() {
+		var (
+			rec          Record
+			prevResultID sql.NullInt64
+			prevUserID   sql.NullInt64
+			prevScore    sql.NullFloat64
+		)
+		if err := rows.Scan(&rec.ResultID, &rec.UserID, &rec.CreatedAt, &rec.Benchmark, &rec.Score, &prevResultID, &prevUserID, &prevScore); err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		if prevResultID.Valid {
+			rec.Previous = &Record{ResultID: prevResultID.Int64, UserID: prevUserID.Int64, Score: prevScore.Float64}
+		}
+		records = append(records, &rec)
+	}
+	return records, nil
 }
 
-var deleteResultOnce sync.Once
+var listRankedResultsAfterOnce sync.Once
 
-// DeleteResult deletes a result with the given id.
-func (db *mysqlDB) DeleteResult(id int64) error {
-	deleteResult, err := newStmt(
+// ListRankedResultsAfter returns up to limit visible results with a Total
+// score that rank after a result with the given Total score and id, best
+// first and by id among equal scores.
+func (db *mysqlDB) ListRankedResultsAfter(score float64, id int64, limit int) ([]*Result, error) {
+	listRankedResultsAfter, err := newStmt(
 		db,
-		&deleteResultOnce,
-		"deleteResult",
-		`DELETE FROM Results WHERE result_id = ?`,
+		&listRankedResultsAfterOnce,
+		"listRankedResultsAfter",
+		`SELECT r.* FROM BenchmarkScores b JOIN Results r ON r.result_id = b.result_id
+		WHERE b.benchmark = 'Total' AND (b.score < ? OR b.score = ? AND b.result_id > ?) AND r.hidden = 0
+		ORDER BY b.score DESC, b.result_id LIMIT ?`,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = deleteResult.ExecContext(ctx, id)
-	return err
+	rows, err := listRankedResultsAfter.QueryContext(ctx, score, score, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*Result
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
 
-var updateResultOnce sync.Once
+var listBenchmarksOnce sync.Once
 
-// UpdateResult updates a given result.
-func (db *mysqlDB) UpdateResult(result *Result) error {
-	updateResult, err := newStmt(
+// ListBenchmarks returns the names of the benchmarks scored by visible
+// results, in order of the first result scoring each, then by name.
+func (db *mysqlDB) ListBenchmarks() ([]string, error) {
+	listBenchmarks, err := newStmt(
 		db,
-		&updateResultOnce,
-		"updateResult",
-		`UPDATE Results SET user_id = ?, scores = ? WHERE result_id = ?`,
+		&listBenchmarksOnce,
+		"listBenchmarks",
+		`SELECT benchmark FROM BenchmarkScores GROUP BY benchmark ORDER BY MIN(result_id), benchmark`,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = updateResult.ExecContext(ctx, result.UserID, result.Scores, result.ID)
-	return err
+	rows, err := listBenchmarks.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
 }
 
-var listSpecsOnce sync.Once
+var listResultsCreatedByOnce sync.Once
 
-// ListSpecs returns a list of all specs.
-func (db *mysqlDB) ListSpecs() ([]*Specs, error) {
-	listSpecs, err := newStmt(
+// ListResultsCreatedBy returns a list of results created by a user with
+// the given id, oldest first.
+func (db *mysqlDB) ListResultsCreatedBy(id int64) ([]*Result, error) {
+	listResultsCreatedBy, err := newStmt(
 		db,
-		&listSpecsOnce,
-		"listSpecs",
-		`SELECT * FROM Specs`,
+		&listResultsCreatedByOnce,
+		"listResultsCreatedBy",
+		`SELECT * FROM Results WHERE user_id = ? AND hidden = 0 ORDER BY created_at, result_id`,
 	)
 	if err != nil {
 		return nil, err
@@ -247,32 +350,33 @@ func (db *mysqlDB) ListSpecs() ([]*Specs, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	rows, err := listSpecs.QueryContext(ctx)
+	rows, err := listResultsCreatedBy.QueryContext(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var specs []*Specs
+	var results []*Result
 	for rows.Next() {
-		spec, err := scanSpecs(rows)
+		result, err := scanResult(rows)
 		if err != nil {
 			return nil, fmt.Errorf("mysql: could not read row: %v", err)
 		}
-		specs = append(specs, spec)
+		results = append(results, result)
 	}
-	return specs, nil
+	return results, nil
 }
 
-var listSpecsWithResultIDOnce sync.Once
+var listResultsCreatedByAfterOnce sync.Once
 
-// ListSpecsWithResultID returns a list of specs created by a user with the given id.
-func (db *mysqlDB) ListSpecsWithResultID(id int64) ([]*Specs, error) {
-	listSpecsWithResultID, err := newStmt(
+// ListResultsCreatedByAfter returns up to limit results created by a user
+// with the given id, with ids after the given one, ordered by id.
+func (db *mysqlDB) ListResultsCreatedByAfter(id, after int64, limit int) ([]*Result, error) {
+	listResultsCreatedByAfter, err := newStmt(
 		db,
-		&listSpecsWithResultIDOnce,
-		"listSpecsWithResultID",
-		`SELECT * FROM Specs WHERE result_id = ?`,
+		&listResultsCreatedByAfterOnce,
+		"listResultsCreatedByAfter",
+		`SELECT * FROM Results WHERE user_id = ? AND result_id > ? AND hidden = 0 ORDER BY result_id LIMIT ?`,
 	)
 	if err != nil {
 		return nil, err
@@ -281,81 +385,141 @@ func (db *mysqlDB) ListSpecsWithResultID(id int64) ([]*Specs, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	rows, err := listSpecsWithResultID.QueryContext(ctx, id)
+	rows, err := listResultsCreatedByAfter.QueryContext(ctx, id, after, limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var specs []*Specs
+	var results []*Result
 	for rows.Next() {
-		spec, err := scanSpecs(rows)
+		result, err := scanResult(rows)
 		if err != nil {
 			return nil, fmt.Errorf("mysql: could not read row: %v", err)
 		}
-		specs = append(specs, spec)
+		results = append(results, result)
 	}
-	return specs, nil
+	return results, nil
 }
 
-var getSpecsOnce sync.Once
+// ListResultsCreatedByUsersAfter returns up to limit results of each of the
+// users with the given ids, with ids after the given one, ordered by id. Each
+// user's page is a limited query of its own, joined in one statement.
+func (db *mysqlDB) ListResultsCreatedByUsersAfter(ids []int64, after int64, limit int) ([]*Result, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
 
-// GetSpecs retrieves specs by its id.
-func (db *mysqlDB) GetSpecs(id int64) (*Specs, error) {
-	getSpecs, err := newStmt(
-		db,
-		&getSpecsOnce,
-		"getSpecs",
-		`SELECT * FROM Specs WHERE specs_id = ?`,
-	)
-	if err != nil {
-		return nil, err
+	pages := make([]string, len(ids))
+	args := make([]interface{}, 0, 3*len(ids))
+	for i, id := range ids {
+		pages[i] = `(SELECT * FROM Results WHERE user_id = ? AND result_id > ? AND hidden = 0 ORDER BY result_id LIMIT ?)`
+		args = append(args, id, after, limit)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	spec, err := scanSpecs(getSpecs.QueryRowContext(ctx, id))
+	rows, err := db.conn.QueryContext(ctx, strings.Join(pages, " UNION ALL ")+` ORDER BY result_id`, args...)
 	if err != nil {
-		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		return nil, err
 	}
-	return spec, nil
+	defer rows.Close()
 
+	var results []*Result
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
 }
 
-var addSpecsOnce sync.Once
+var getResultOnce sync.Once
 
-// AddSpecs saves the given specs.
-func (db *mysqlDB) AddSpecs(specs *Specs) (int64, error) {
-	addSpecs, err := newStmt(
+// GetResult retrieves a result by its id.
+func (db *mysqlDB) GetResult(id int64) (*Result, error) {
+	getResult, err := newStmt(
 		db,
-		&addSpecsOnce,
-		"addSpecs",
-		`INSERT INTO Specs(result_id, sys_info) VALUES(?, ?)`,
+		&getResultOnce,
+		"getResult",
+		`SELECT * FROM Results WHERE result_id = ? AND hidden = 0`,
 	)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := scanResult(getResult.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, notFound(err, "could not read row", fmt.Sprintf("result %d", id))
+	}
+	return result, nil
+}
+
+// AddResult saves a given result.
+func (db *mysqlDB) AddResult(result *Result) (int64, error) {
+	createdAt := result.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	r, err := addSpecs.ExecContext(ctx, specs.ResultID, specs.SysInfo)
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
-	return r.LastInsertId()
+	defer tx.Rollback()
+
+	defer db.stats.invalidate()
+
+	r, err := tx.ExecContext(ctx, `INSERT INTO Results(user_id, scores, created_at) VALUES(?, ?, ?)`,
+		result.UserID, result.Scores, createdAt)
+	if err != nil {
+		return 0, writeError(err, "add result", "result")
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := saveBenchmarkScores(ctx, tx, id, result.Scores); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
 }
 
-var deleteSpecsOnce sync.Once
+// saveBenchmarkScores replaces the rows of BenchmarkScores of the result with
+// the given id, which index its scores for ranking, with scores.
+func saveBenchmarkScores(ctx context.Context, tx *sql.Tx, resultID int64, scores Scores) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM BenchmarkScores WHERE result_id = ?`, resultID); err != nil {
+		return fmt.Errorf("mysql: delete benchmark scores: %v", err)
+	}
+	for _, score := range scores {
+		_, err := tx.ExecContext(ctx, `INSERT INTO BenchmarkScores(result_id, benchmark, score) VALUES(?, ?, ?)
+			ON DUPLICATE KEY UPDATE score = VALUES(score)`,
+			resultID, score.Name, score.Score)
+		if err != nil {
+			return writeError(err, "add benchmark score", fmt.Sprintf("score %q", score.Name))
+		}
+	}
+	return nil
+}
 
-// DeleteSpecs deletes the specs with the given id.
-func (db *mysqlDB) DeleteSpecs(id int64) error {
-	deleteSpecs, err := newStmt(
+var deleteResultOnce sync.Once
+
+// DeleteResult deletes a result with the given id.
+func (db *mysqlDB) DeleteResult(id int64) error {
+	deleteResult, err := newStmt(
 		db,
-		&deleteSpecsOnce,
-		"deleteSpecs",
-		`DELETE FROM Specs WHERE specs_id = ?`,
+		&deleteResultOnce,
+		"deleteResult",
+		`DELETE FROM Results WHERE result_id = ?`,
 	)
 	if err != nil {
 		return err
@@ -364,40 +528,81 @@ func (db *mysqlDB) DeleteSpecs(id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = deleteSpecs.ExecContext(ctx, id)
-	return err
+	defer db.stats.invalidate()
+
+	if _, err = deleteResult.ExecContext(ctx, id); err != nil {
+		return writeError(err, "delete result", fmt.Sprintf("result %d", id))
+	}
+	return nil
 }
 
-var updateSpecsOnce sync.Once
+// UpdateResult updates a given result.
+func (db *mysqlDB) UpdateResult(result *Result) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-// UpdateSpecs updates the given specs.
-func (db *mysqlDB) UpdateSpecs(specs *Specs) error {
-	updateSpecs, err := newStmt(
-		db,
-		&updateSpecsOnce,
-		"updateSpecs",
-		`UPDATE Specs SET sys_info = ? WHERE specs_id = ?`,
-	)
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	defer db.stats.invalidate()
+
+	_, err = tx.ExecContext(ctx, `UPDATE Results SET user_id = ?, scores = ? WHERE result_id = ?`,
+		result.UserID, result.Scores, result.ID)
+	if err != nil {
+		return writeError(err, "update result", fmt.Sprintf("result %d", result.ID))
+	}
+	// Hidden results are not ranked, so their scores are not indexed.
+	var hidden bool
+	if err := tx.QueryRowContext(ctx, `SELECT hidden FROM Results WHERE result_id = ?`, result.ID).Scan(&hidden); err != nil {
+		return notFound(err, "update result", fmt.Sprintf("result %d", result.ID))
+	}
+	if !hidden {
+		if err := saveBenchmarkScores(ctx, tx, result.ID, result.Scores); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
+// HideResult hides the result with the given id, and drops its scores from
+// the ranked ones.
+func (db *mysqlDB) HideResult(id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = updateSpecs.ExecContext(ctx, specs.SysInfo, specs.ID)
-	return err
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	defer db.stats.invalidate()
+
+	r, err := tx.ExecContext(ctx, `UPDATE Results SET hidden = 1 WHERE result_id = ? AND hidden = 0`, id)
+	if err != nil {
+		return writeError(err, "hide result", fmt.Sprintf("result %d", id))
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("result %d %w", id, ErrNotFound)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM BenchmarkScores WHERE result_id = ?`, id); err != nil {
+		return fmt.Errorf("mysql: delete benchmark scores: %v", err)
+	}
+	return tx.Commit()
 }
 
-var listUsersOnce sync.Once
+var listSpecsOnce sync.Once
 
-// ListUsers returns a list of all users.
-func (db *mysqlDB) ListUsers() ([]*UserExternal, error) {
-	listUsers, err := newStmt(
+// ListSpecs returns a list of the specs of all visible results.
+func (db *mysqlDB) ListSpecs() ([]*Specs, error) {
+	listSpecs, err := newStmt(
 		db,
-		&listUsersOnce,
-		"listUsers",
-		`SELECT user_id, username FROM Users`,
+		&listSpecsOnce,
+		"listSpecs",
+		`SELECT s.* FROM Specs s JOIN Results r ON r.result_id = s.result_id WHERE r.hidden = 0`,
 	)
 	if err != nil {
 		return nil, err
@@ -406,30 +611,368 @@ func (db *mysqlDB) ListUsers() ([]*UserExternal, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	rows, err := listUsers.QueryContext(ctx)
+	rows, err := listSpecs.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var usersExt []*UserExternal
+	var specs []*Specs
 	for rows.Next() {
-		userExt, err := scanUserExternal(rows)
+		spec, err := scanSpecs(rows)
 		if err != nil {
 			return nil, fmt.Errorf("mysql: could not read row: %v", err)
 		}
-		usersExt = append(usersExt, userExt)
+		specs = append(specs, spec)
 	}
-	return usersExt, nil
+	return specs, nil
 }
 
-var getUserOnce sync.Once
+var listSpecsAfterOnce sync.Once
 
-// GetUser retrieves a user by its id.
-func (db *mysqlDB) GetUser(id int64) (*UserExternal, error) {
-	getUserExt, err := newStmt(
+// ListSpecsAfter returns up to limit specs of visible results with ids
+// after the given one, ordered by id.
+func (db *mysqlDB) ListSpecsAfter(after int64, limit int) ([]*Specs, error) {
+	listSpecsAfter, err := newStmt(
 		db,
-		&getUserOnce,
+		&listSpecsAfterOnce,
+		"listSpecsAfter",
+		`SELECT s.* FROM Specs s JOIN Results r ON r.result_id = s.result_id
+		WHERE s.specs_id > ? AND r.hidden = 0 ORDER BY s.specs_id LIMIT ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listSpecsAfter.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var specs []*Specs
+	for rows.Next() {
+		spec, err := scanSpecs(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+var listSpecsWithResultIDOnce sync.Once
+
+// ListSpecsWithResultID returns the specs related to a result, unless it is hidden.
+func (db *mysqlDB) ListSpecsWithResultID(id int64) ([]*Specs, error) {
+	listSpecsWithResultID, err := newStmt(
+		db,
+		&listSpecsWithResultIDOnce,
+		"listSpecsWithResultID",
+		`SELECT s.* FROM Specs s JOIN Results r ON r.result_id = s.result_id WHERE s.result_id = ? AND r.hidden = 0`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listSpecsWithResultID.QueryContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var specs []*Specs
+	for rows.Next() {
+		spec, err := scanSpecs(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// ListSpecsWithResultIDs returns the specs related to any of the visible
+// results with the given ids.
+func (db *mysqlDB) ListSpecsWithResultIDs(ids []int64) ([]*Specs, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT s.* FROM Specs s JOIN Results r ON r.result_id = s.result_id
+		WHERE s.result_id IN (`+placeholders(len(ids))+`) AND r.hidden = 0`, int64Args(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var specs []*Specs
+	for rows.Next() {
+		spec, err := scanSpecs(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// placeholders returns n comma separated query placeholders for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// int64Args returns ids as query arguments.
+func int64Args(ids []int64) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+var getSpecsOnce sync.Once
+
+// GetSpecs retrieves specs by its id, unless their result is hidden.
+func (db *mysqlDB) GetSpecs(id int64) (*Specs, error) {
+	getSpecs, err := newStmt(
+		db,
+		&getSpecsOnce,
+		"getSpecs",
+		`SELECT s.* FROM Specs s JOIN Results r ON r.result_id = s.result_id WHERE s.specs_id = ? AND r.hidden = 0`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	spec, err := scanSpecs(getSpecs.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, notFound(err, "could not read row", fmt.Sprintf("specs %d", id))
+	}
+	return spec, nil
+
+}
+
+var addSpecsOnce sync.Once
+
+// AddSpecs saves the given specs.
+func (db *mysqlDB) AddSpecs(specs *Specs) (int64, error) {
+	addSpecs, err := newStmt(
+		db,
+		&addSpecsOnce,
+		"addSpecs",
+		`INSERT INTO Specs(result_id, sys_info, cpu_model, clock_hz, threads, physical_mem_bytes, virtual_mem_bytes, swap_mem_bytes, overclocked, raw_sys_info)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := specs.SysInfo.Normalize()
+	if err != nil {
+		return 0, fmt.Errorf("%w specs: %v", ErrInvalid, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	defer db.stats.invalidate()
+
+	r, err := addSpecs.ExecContext(ctx, specs.ResultID, specs.SysInfo,
+		nullString(n.Model),
+		nullInt64(n.ClockSpeedHz), nullInt64(int64(n.Threads)),
+		nullInt64(n.PhysicalMemBytes), nullInt64(n.VirtualMemBytes), nullInt64(n.SwapMemBytes),
+		n.Overclocked, nullString(string(specs.Raw)))
+	if err != nil {
+		return 0, writeError(err, "add specs", "specs")
+	}
+	return r.LastInsertId()
+}
+
+var deleteSpecsOnce sync.Once
+
+// DeleteSpecs deletes the specs with the given id.
+func (db *mysqlDB) DeleteSpecs(id int64) error {
+	deleteSpecs, err := newStmt(
+		db,
+		&deleteSpecsOnce,
+		"deleteSpecs",
+		`DELETE FROM Specs WHERE specs_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	defer db.stats.invalidate()
+
+	if _, err = deleteSpecs.ExecContext(ctx, id); err != nil {
+		return writeError(err, "delete specs", fmt.Sprintf("specs %d", id))
+	}
+	return nil
+}
+
+var updateSpecsOnce sync.Once
+
+// UpdateSpecs updates the given specs.
+func (db *mysqlDB) UpdateSpecs(specs *Specs) error {
+	updateSpecs, err := newStmt(
+		db,
+		&updateSpecsOnce,
+		"updateSpecs",
+		`UPDATE Specs SET sys_info = ?, cpu_model = ?, clock_hz = ?, threads = ?, physical_mem_bytes = ?,
+		virtual_mem_bytes = ?, swap_mem_bytes = ?, overclocked = ? WHERE specs_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := specs.SysInfo.Normalize()
+	if err != nil {
+		return fmt.Errorf("%w specs: %v", ErrInvalid, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	defer db.stats.invalidate()
+
+	_, err = updateSpecs.ExecContext(ctx, specs.SysInfo,
+		nullString(n.Model),
+		nullInt64(n.ClockSpeedHz), nullInt64(int64(n.Threads)),
+		nullInt64(n.PhysicalMemBytes), nullInt64(n.VirtualMemBytes), nullInt64(n.SwapMemBytes),
+		n.Overclocked, specs.ID)
+	if err != nil {
+		return writeError(err, "update specs", fmt.Sprintf("specs %d", specs.ID))
+	}
+	return nil
+}
+
+var listUsersOnce sync.Once
+
+// ListUsers returns a list of all users.
+func (db *mysqlDB) ListUsers() ([]*UserExternal, error) {
+	listUsers, err := newStmt(
+		db,
+		&listUsersOnce,
+		"listUsers",
+		`SELECT user_id, username FROM Users`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listUsers.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usersExt []*UserExternal
+	for rows.Next() {
+		userExt, err := scanUserExternal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		usersExt = append(usersExt, userExt)
+	}
+	return usersExt, nil
+}
+
+var listUsersAfterOnce sync.Once
+
+// ListUsersAfter returns up to limit users with ids after the given one,
+// ordered by id.
+func (db *mysqlDB) ListUsersAfter(after int64, limit int) ([]*UserExternal, error) {
+	listUsersAfter, err := newStmt(
+		db,
+		&listUsersAfterOnce,
+		"listUsersAfter",
+		`SELECT user_id, username FROM Users WHERE user_id > ? ORDER BY user_id LIMIT ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listUsersAfter.QueryContext(ctx, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usersExt []*UserExternal
+	for rows.Next() {
+		userExt, err := scanUserExternal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		usersExt = append(usersExt, userExt)
+	}
+	return usersExt, nil
+}
+
+var listUserAccountsOnce sync.Once
+
+// ListUserAccounts returns all users including their email, password hash
+// and admin flag, ordered by id.
+func (db *mysqlDB) ListUserAccounts() ([]*User, error) {
+	listUserAccounts, err := newStmt(
+		db,
+		&listUserAccountsOnce,
+		"listUserAccounts",
+		`SELECT * FROM Users ORDER BY user_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listUserAccounts.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+var getUserOnce sync.Once
+
+// GetUser retrieves a user by its id.
+func (db *mysqlDB) GetUser(id int64) (*UserExternal, error) {
+	getUserExt, err := newStmt(
+		db,
+		&getUserOnce,
 		"getUser",
 		`SELECT user_id, username from Users WHERE user_id = ?`,
 	)
@@ -440,22 +983,984 @@ func (db *mysqlDB) GetUser(id int64) (*UserExternal, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	userExt, err := scanUserExternal(getUserExt.QueryRowContext(ctx, id))
+	userExt, err := scanUserExternal(getUserExt.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, notFound(err, "could not read row", fmt.Sprintf("user %d", id))
+	}
+	return userExt, nil
+}
+
+// GetUsers retrieves the users with the given ids, ordered by id.
+func (db *mysqlDB) GetUsers(ids []int64) ([]*UserExternal, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT user_id, username FROM Users WHERE user_id IN (`+placeholders(len(ids))+`) ORDER BY user_id`, int64Args(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usersExt []*UserExternal
+	for rows.Next() {
+		userExt, err := scanUserExternal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		usersExt = append(usersExt, userExt)
+	}
+	return usersExt, nil
+}
+
+var getUserByCredentialsOnce sync.Once
+
+// GetUserByCredentials returns a user with the matching username and password.
+func (db *mysqlDB) GetUserByCredentials(username, password string) (*User, error) {
+	getUserByCredentials, err := newStmt(
+		db,
+		&getUserByCredentialsOnce,
+		"getUserByCredentials",
+		`SELECT * FROM Users WHERE username = ? AND passwd = ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := sha512.New()
+	hash.Write([]byte(password))
+
+	user, err := scanUser(getUserByCredentials.QueryRowContext(ctx, username, hex.EncodeToString(hash.Sum(nil))))
+	if err != nil {
+		return nil, notFound(err, "could not read row", "user with these credentials")
+	}
+	return user, nil
+}
+
+var addUserOnce sync.Once
+
+// AddUser saves a given user.
+func (db *mysqlDB) AddUser(user *User) (int64, error) {
+	addUser, err := newStmt(
+		db,
+		&addUserOnce,
+		"addUser",
+		`INSERT INTO Users(username, email, passwd, is_admin) VALUES(?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := addUser.ExecContext(ctx, user.Name, user.Email, user.Password, user.Admin)
+	if err != nil {
+		return 0, writeError(err, "add user", fmt.Sprintf("user %q", user.Name))
+	}
+	return r.LastInsertId()
+}
+
+var deleteUserOnce sync.Once
+
+// DeleteUser deletes a user with the given id.
+func (db *mysqlDB) DeleteUser(id int64) error {
+	deleteUser, err := newStmt(
+		db,
+		&deleteUserOnce,
+		"deleteUser",
+		`DELETE FROM Users WHERE user_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err = deleteUser.ExecContext(ctx, id); err != nil {
+		return writeError(err, "delete user", fmt.Sprintf("user %d", id))
+	}
+	return nil
+}
+
+var updateUserOnce sync.Once
+
+// UpdateUser updates a given user.
+func (db *mysqlDB) UpdateUser(user *User) error {
+	updateUser, err := newStmt(
+		db,
+		&updateUserOnce,
+		"updateUser",
+		`UPDATE Users SET username = ?, email = ?, passwd = ? WHERE user_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err = updateUser.ExecContext(ctx, user.Name, user.Email, user.Password, user.ID); err != nil {
+		return writeError(err, "update user", fmt.Sprintf("user %q", user.Name))
+	}
+	return nil
+}
+
+var getSubmissionByKeyOnce sync.Once
+
+// GetSubmissionByKey returns the submission a user made with the given
+// idempotency key, or nil if there is none.
+func (db *mysqlDB) GetSubmissionByKey(userID int64, key string) (*Submission, error) {
+	getSubmissionByKey, err := newStmt(
+		db,
+		&getSubmissionByKeyOnce,
+		"getSubmissionByKey",
+		`SELECT * FROM Submissions WHERE user_id = ? AND idem_key = ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := scanSubmission(getSubmissionByKey.QueryRowContext(ctx, userID, key))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+	}
+	return sub, nil
+}
+
+var getSubmissionByFingerprintOnce sync.Once
+
+// GetSubmissionByFingerprint returns the latest submission a user made with
+// the given fingerprint after since, or nil if there is none.
+func (db *mysqlDB) GetSubmissionByFingerprint(userID int64, fingerprint string, since time.Time) (*Submission, error) {
+	getSubmissionByFingerprint, err := newStmt(
+		db,
+		&getSubmissionByFingerprintOnce,
+		"getSubmissionByFingerprint",
+		`SELECT * FROM Submissions WHERE user_id = ? AND fingerprint = ? AND created_at >= ?
+		ORDER BY created_at DESC LIMIT 1`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := scanSubmission(getSubmissionByFingerprint.QueryRowContext(ctx, userID, fingerprint, since))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+	}
+	return sub, nil
+}
+
+var addSubmissionOnce sync.Once
+
+// AddSubmission saves a given submission.
+func (db *mysqlDB) AddSubmission(sub *Submission) (int64, error) {
+	addSubmission, err := newStmt(
+		db,
+		&addSubmissionOnce,
+		"addSubmission",
+		`INSERT INTO Submissions(user_id, result_id, idem_key, fingerprint, created_at) VALUES(?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := sql.NullString{String: sub.Key, Valid: sub.Key != ""}
+	r, err := addSubmission.ExecContext(ctx, sub.UserID, sub.ResultID, key, sub.Fingerprint, sub.CreatedAt)
+	if err != nil {
+		return 0, writeError(err, "add submission", "submission")
+	}
+	return r.LastInsertId()
+}
+
+// AddSubmittedResult saves a submitted result, its specs and the submission
+// in one transaction.
+func (db *mysqlDB) AddSubmittedResult(res *Result, specs *Specs, sub *Submission) error {
+	n, err := specs.SysInfo.Normalize()
+	if err != nil {
+		return fmt.Errorf("%w specs: %v", ErrInvalid, err)
+	}
+	createdAt := res.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	defer db.stats.invalidate()
+
+	r, err := tx.ExecContext(ctx, `INSERT INTO Results(user_id, scores, created_at) VALUES(?, ?, ?)`,
+		res.UserID, res.Scores, createdAt)
+	if err != nil {
+		return writeError(err, "add result", "result")
+	}
+	resultID, err := r.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := saveBenchmarkScores(ctx, tx, resultID, res.Scores); err != nil {
+		return err
+	}
+
+	r, err = tx.ExecContext(ctx, `INSERT INTO Specs(result_id, sys_info, cpu_model, clock_hz, threads, physical_mem_bytes, virtual_mem_bytes, swap_mem_bytes, overclocked, raw_sys_info)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		resultID, specs.SysInfo,
+		nullString(n.Model),
+		nullInt64(n.ClockSpeedHz), nullInt64(int64(n.Threads)),
+		nullInt64(n.PhysicalMemBytes), nullInt64(n.VirtualMemBytes), nullInt64(n.SwapMemBytes),
+		n.Overclocked, nullString(string(specs.Raw)))
+	if err != nil {
+		return writeError(err, "add specs", "specs")
+	}
+	specsID, err := r.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	key := sql.NullString{String: sub.Key, Valid: sub.Key != ""}
+	r, err = tx.ExecContext(ctx, `INSERT INTO Submissions(user_id, result_id, idem_key, fingerprint, created_at) VALUES(?, ?, ?, ?, ?)`,
+		sub.UserID, resultID, key, sub.Fingerprint, sub.CreatedAt)
+	if err != nil {
+		return writeError(err, "add submission", "submission")
+	}
+	subID, err := r.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	res.ID, res.CreatedAt = resultID, createdAt
+	specs.ID, specs.ResultID, specs.Normalized = specsID, resultID, n
+	sub.ID, sub.ResultID = subID, resultID
+	return nil
+}
+
+var setSubmissionResponseOnce sync.Once
+
+// SetSubmissionResponse saves the response sent for the submission with the
+// given ID.
+func (db *mysqlDB) SetSubmissionResponse(id int64, response []byte) error {
+	setSubmissionResponse, err := newStmt(
+		db,
+		&setSubmissionResponseOnce,
+		"setSubmissionResponse",
+		`UPDATE Submissions SET response = ? WHERE submission_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := setSubmissionResponse.ExecContext(ctx, response, id)
+	if err != nil {
+		return writeError(err, "set submission response", fmt.Sprintf("submission %d", id))
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("submission %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+var listCPUsOnce sync.Once
+
+// ListCPUs returns a list of all catalogued CPUs.
+func (db *mysqlDB) ListCPUs() ([]*CPU, error) {
+	listCPUs, err := newStmt(
+		db,
+		&listCPUsOnce,
+		"listCPUs",
+		`SELECT * FROM CPUs ORDER BY vendor, model`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listCPUs.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cpus []*CPU
+	for rows.Next() {
+		cpu, err := scanCPU(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		cpus = append(cpus, cpu)
+	}
+	return cpus, nil
+}
+
+var getCPUOnce sync.Once
+
+// GetCPU retrieves a CPU by its id.
+func (db *mysqlDB) GetCPU(id int64) (*CPU, error) {
+	getCPU, err := newStmt(
+		db,
+		&getCPUOnce,
+		"getCPU",
+		`SELECT * FROM CPUs WHERE cpu_id = ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cpu, err := scanCPU(getCPU.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, notFound(err, "could not read row", fmt.Sprintf("cpu %d", id))
+	}
+	return cpu, nil
+}
+
+var resolveCPUOnce sync.Once
+
+// ResolveCPU returns the CPU of vendor, unless it is empty, whose canonical
+// model or aliases match the given raw model string, or nil if there is none.
+// A CPU whose model matches is preferred to one whose alias does.
+func (db *mysqlDB) ResolveCPU(vendor, model string) (*CPU, error) {
+	resolveCPU, err := newStmt(
+		db,
+		&resolveCPUOnce,
+		"resolveCPU",
+		`SELECT c.* FROM CPUs c LEFT JOIN CPUAliases a ON a.cpu_id = c.cpu_id
+		WHERE (c.model = ? OR a.model = ?) AND (? = '' OR c.vendor = ?)
+		ORDER BY c.model = ? DESC, c.cpu_id LIMIT 1`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	canonical, vendor := CanonicalCPUModel(model), strings.TrimSpace(vendor)
+	cpu, err := scanCPU(resolveCPU.QueryRowContext(ctx, canonical, canonical, vendor, vendor, canonical))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+	}
+	return cpu, nil
+}
+
+var addCPUOnce sync.Once
+
+// AddCPU saves a given CPU.
+func (db *mysqlDB) AddCPU(cpu *CPU) (int64, error) {
+	addCPU, err := newStmt(
+		db,
+		&addCPUOnce,
+		"addCPU",
+		`INSERT INTO CPUs(vendor, family, model, cores, threads, base_clock_hz) VALUES(?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	defer db.stats.invalidate()
+
+	r, err := addCPU.ExecContext(ctx, cpu.Vendor, cpu.Family, CanonicalCPUModel(cpu.Model), cpu.Cores, cpu.Threads, cpu.BaseClockHz)
+	if err != nil {
+		return 0, writeError(err, "add cpu", fmt.Sprintf("cpu %q", CanonicalCPUModel(cpu.Model)))
+	}
+	return r.LastInsertId()
+}
+
+// DeleteCPU deletes a CPU and its aliases with the given id. It returns
+// ErrNotFound if there is no such CPU.
+func (db *mysqlDB) DeleteCPU(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	defer db.stats.invalidate()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM CPUAliases WHERE cpu_id = ?`, id); err != nil {
+		return fmt.Errorf("mysql: delete cpu aliases: %v", err)
+	}
+	r, err := tx.ExecContext(ctx, `DELETE FROM CPUs WHERE cpu_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("mysql: delete cpu: %v", err)
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("cpu %d %w", id, ErrNotFound)
+	}
+	return tx.Commit()
+}
+
+var listCPUAliasesOnce sync.Once
+
+// ListCPUAliases returns a list of aliases for the CPU with the given id.
+func (db *mysqlDB) ListCPUAliases(cpuID int64) ([]*CPUAlias, error) {
+	listCPUAliases, err := newStmt(
+		db,
+		&listCPUAliasesOnce,
+		"listCPUAliases",
+		`SELECT * FROM CPUAliases WHERE cpu_id = ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listCPUAliases.QueryContext(ctx, cpuID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []*CPUAlias
+	for rows.Next() {
+		alias, err := scanCPUAlias(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, nil
+}
+
+var addCPUAliasOnce sync.Once
+
+// AddCPUAlias saves a given alias.
+func (db *mysqlDB) AddCPUAlias(alias *CPUAlias) (int64, error) {
+	addCPUAlias, err := newStmt(
+		db,
+		&addCPUAliasOnce,
+		"addCPUAlias",
+		`INSERT INTO CPUAliases(cpu_id, model) VALUES(?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	defer db.stats.invalidate()
+
+	r, err := addCPUAlias.ExecContext(ctx, alias.CPUID, CanonicalCPUModel(alias.Model))
+	if err != nil {
+		return 0, writeError(err, "add cpu alias", fmt.Sprintf("cpu alias %q", CanonicalCPUModel(alias.Model)))
+	}
+	return r.LastInsertId()
+}
+
+var deleteCPUAliasOnce sync.Once
+
+// DeleteCPUAlias deletes an alias with the given id. It returns ErrNotFound
+// if there is no such alias.
+func (db *mysqlDB) DeleteCPUAlias(id int64) error {
+	deleteCPUAlias, err := newStmt(
+		db,
+		&deleteCPUAliasOnce,
+		"deleteCPUAlias",
+		`DELETE FROM CPUAliases WHERE alias_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	defer db.stats.invalidate()
+
+	r, err := deleteCPUAlias.ExecContext(ctx, id)
+	if err != nil {
+		return fmt.Errorf("mysql: delete cpu alias: %v", err)
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("cpu alias %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+var listResultsByCPUOnce sync.Once
+
+// ListResultsByCPU returns a list of results whose specs resolve to the
+// CPU with the given id, as ResolveCPU resolves their vendor and model. The
+// specs are narrowed down by the indexed model before they are resolved.
+func (db *mysqlDB) ListResultsByCPU(cpuID int64) ([]*Result, error) {
+	listResultsByCPU, err := newStmt(
+		db,
+		&listResultsByCPUOnce,
+		"listResultsByCPU",
+		`SELECT DISTINCT r.* FROM Results r
+		JOIN Specs s ON s.result_id = r.result_id
+		WHERE r.hidden = 0 AND s.cpu_model IN (
+			SELECT model FROM CPUs WHERE cpu_id = ?
+			UNION SELECT model FROM CPUAliases WHERE cpu_id = ?
+		) AND `+specsCPUID+` = ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listResultsByCPU.QueryContext(ctx, cpuID, cpuID, cpuID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*Result
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+var listStatsSamplesOnce sync.Once
+
+// statsSamples returns the scores and grouping specs of every result, taking
+// the first specs of results that have several and resolving their model
+// through the CPU catalog.
+func (db *mysqlDB) statsSamples() ([]StatsSample, error) {
+	gen := db.stats.generation()
+	if samples, ok := db.stats.getSamples(); ok {
+		return samples, nil
+	}
+
+	listStatsSamples, err := newStmt(
+		db,
+		&listStatsSamplesOnce,
+		"listStatsSamples",
+		`SELECT r.result_id, r.scores, c.cpu_id, COALESCE(c.model, s.cpu_model),
+			JSON_UNQUOTE(JSON_EXTRACT(s.sys_info, '$.vendor')), s.threads
+		FROM Results r
+		LEFT JOIN Specs s ON s.specs_id = (SELECT MIN(specs_id) FROM Specs WHERE result_id = r.result_id)
+		LEFT JOIN CPUs c ON c.cpu_id = `+specsCPUID+`
+		WHERE r.hidden = 0`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := listStatsSamples.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []StatsSample
+	for rows.Next() {
+		var (
+			resultID int64
+			scores   string
+			cpuID    sql.NullInt64
+			model    sql.NullString
+			vendor   sql.NullString
+			threads  sql.NullInt64
+		)
+		if err := rows.Scan(&resultID, &scores, &cpuID, &model, &vendor, &threads); err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		sample := StatsSample{
+			ResultID: resultID,
+			CPUID:    cpuID.Int64,
+			Model:    model.String,
+			Vendor:   vendor.String,
+			Threads:  int(threads.Int64),
+		}
+		if err := json.Unmarshal([]byte(scores), &sample.Scores); err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	db.stats.putSamples(gen, samples)
+	return samples, nil
+}
+
+// BenchmarkStats returns score statistics for a benchmark grouped by the
+// given specs field. An empty benchmark returns statistics for every benchmark.
+func (db *mysqlDB) BenchmarkStats(groupBy GroupBy, benchmark string) ([]*Stats, error) {
+	key := statsCacheKey(groupBy, benchmark)
+	gen := db.stats.generation()
+	if stats, ok := db.stats.get(key); ok {
+		return stats, nil
+	}
+
+	samples, err := db.statsSamples()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := ComputeStats(samples, groupBy, benchmark)
+	db.stats.put(gen, key, stats)
+	return stats, nil
+}
+
+var (
+	getRankedResultOnce sync.Once
+	rankAllOnce         sync.Once
+	rankCPUOnce         sync.Once
+	rankModelOnce       sync.Once
+	rankThreadsOnce     sync.Once
+)
+
+// firstSpecs is an SQL condition selecting only the first Specs row s of each
+// result, which ranks take as the specs of the result, as statistics do.
+const firstSpecs = `s.specs_id = (SELECT MIN(specs_id) FROM Specs WHERE result_id = s.result_id)`
+
+// ResultRanks returns the percentile ranks of each benchmark score of the
+// result with the given id, or nil if it is hidden. The scores below and
+// equal to each are counted on the indexes of BenchmarkScores, rather than
+// ranking the result among all scores read from Results. Results are
+// compared by the catalog CPU their specs resolve to, or by canonical model
+// if they resolve to none, and each result counts once.
+func (db *mysqlDB) ResultRanks(resultID int64) ([]*BenchmarkRanks, error) {
+	getRankedResult, err := newStmt(
+		db,
+		&getRankedResultOnce,
+		"getRankedResult",
+		`SELECT r.scores, `+specsCPUID+`, s.cpu_model, s.threads FROM Results r
+		LEFT JOIN Specs s ON s.result_id = r.result_id AND `+firstSpecs+`
+		WHERE r.result_id = ? AND r.hidden = 0`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rankAll, err := newStmt(
+		db,
+		&rankAllOnce,
+		"rankAll",
+		`SELECT
+			(SELECT COUNT(*) FROM BenchmarkScores WHERE benchmark = ? AND score < ?),
+			(SELECT COUNT(*) FROM BenchmarkScores WHERE benchmark = ? AND score = ?),
+			(SELECT COUNT(*) FROM BenchmarkScores WHERE benchmark = ?)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rankCPU, err := newStmt(
+		db,
+		&rankCPUOnce,
+		"rankCPU",
+		`SELECT COALESCE(SUM(b.score < ?), 0), COALESCE(SUM(b.score = ?), 0), COUNT(*)
+		FROM BenchmarkScores b
+		WHERE b.benchmark = ? AND b.result_id IN (
+			SELECT s.result_id FROM Specs s WHERE `+firstSpecs+` AND `+specsCPUID+` = ?
+		)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rankModel, err := newStmt(
+		db,
+		&rankModelOnce,
+		"rankModel",
+		`SELECT COALESCE(SUM(b.score < ?), 0), COALESCE(SUM(b.score = ?), 0), COUNT(*)
+		FROM BenchmarkScores b
+		WHERE b.benchmark = ? AND b.result_id IN (
+			SELECT s.result_id FROM Specs s WHERE `+firstSpecs+` AND s.cpu_model = ? AND `+specsCPUID+` IS NULL
+		)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	rankThreads, err := newStmt(
+		db,
+		&rankThreadsOnce,
+		"rankThreads",
+		`SELECT COALESCE(SUM(b.score < ?), 0), COALESCE(SUM(b.score = ?), 0), COUNT(*)
+		FROM BenchmarkScores b
+		WHERE b.benchmark = ? AND b.result_id IN (
+			SELECT s.result_id FROM Specs s WHERE `+firstSpecs+` AND s.threads = ?
+		)`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		scores  Scores
+		cpuID   sql.NullInt64
+		model   sql.NullString
+		threads sql.NullInt64
+	)
+	err = getRankedResult.QueryRowContext(ctx, resultID).Scan(&scores, &cpuID, &model, &threads)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+	}
+
+	rank := func(stmt *sql.Stmt, args ...interface{}) (Rank, error) {
+		var c rankCounter
+		if err := stmt.QueryRowContext(ctx, args...).Scan(&c.below, &c.equal, &c.total); err != nil {
+			return Rank{}, fmt.Errorf("mysql: rank score: %v", err)
+		}
+		return c.rank(), nil
+	}
+
+	var ranks []*BenchmarkRanks
+	for _, score := range scores {
+		r := &BenchmarkRanks{Benchmark: score.Name}
+		if r.All, err = rank(rankAll, score.Name, score.Score, score.Name, score.Score, score.Name); err != nil {
+			return nil, err
+		}
+		if cpuID.Valid {
+			m, err := rank(rankCPU, score.Score, score.Score, score.Name, cpuID.Int64)
+			if err != nil {
+				return nil, err
+			}
+			r.Model = &m
+		} else if model.String != "" {
+			m, err := rank(rankModel, score.Score, score.Score, score.Name, model.String)
+			if err != nil {
+				return nil, err
+			}
+			r.Model = &m
+		}
+		if threads.Int64 > 0 {
+			t, err := rank(rankThreads, score.Score, score.Score, score.Name, threads.Int64)
+			if err != nil {
+				return nil, err
+			}
+			r.Threads = &t
+		}
+		ranks = append(ranks, r)
+	}
+	return ranks, nil
+}
+
+var (
+	getTotalScoreOnce sync.Once
+	rankTotalOnce     sync.Once
+)
+
+// TotalRank returns the leaderboard rank of the result with the given id, or
+// 0 if it is hidden or has no Total score. The scores above it are counted
+// on the indexes of BenchmarkScores.
+func (db *mysqlDB) TotalRank(resultID int64) (int, error) {
+	getTotalScore, err := newStmt(
+		db,
+		&getTotalScoreOnce,
+		"getTotalScore",
+		`SELECT score FROM BenchmarkScores WHERE result_id = ? AND benchmark = 'Total'`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	rankTotal, err := newStmt(
+		db,
+		&rankTotalOnce,
+		"rankTotal",
+		`SELECT COUNT(*) FROM BenchmarkScores
+		WHERE benchmark = 'Total' AND (score > ? OR score = ? AND result_id < ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var score float64
+	err = getTotalScore.QueryRowContext(ctx, resultID).Scan(&score)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("mysql: could not read row: %v", err)
+	}
+	var above int
+	if err := rankTotal.QueryRowContext(ctx, score, score, resultID).Scan(&above); err != nil {
+		return 0, fmt.Errorf("mysql: rank score: %v", err)
+	}
+	return above + 1, nil
+}
+
+var listTokensOnce sync.Once
+
+// ListTokens returns the tokens of the user with the given id, oldest first.
+func (db *mysqlDB) ListTokens(userID int64) ([]*Token, error) {
+	listTokens, err := newStmt(
+		db,
+		&listTokensOnce,
+		"listTokens",
+		`SELECT * FROM Tokens WHERE user_id = ? ORDER BY token_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listTokens.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*Token
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+var getUserByTokenOnce sync.Once
+
+// GetUserByToken returns the user owning the token with the given hash of its
+// secret.
+func (db *mysqlDB) GetUserByToken(hash string) (*User, error) {
+	getUserByToken, err := newStmt(
+		db,
+		&getUserByTokenOnce,
+		"getUserByToken",
+		`SELECT Users.* FROM Users JOIN Tokens ON Tokens.user_id = Users.user_id WHERE Tokens.hash = ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := scanUser(getUserByToken.QueryRowContext(ctx, hash))
 	if err != nil {
-		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		return nil, notFound(err, "could not read row", "token")
 	}
-	return userExt, nil
+	return user, nil
 }
 
-var getUserByCredentialsOnce sync.Once
+var addTokenOnce sync.Once
 
-// GetUserByCredentials returns a user with the matching username and password.
-func (db *mysqlDB) GetUserByCredentials(username, password string) (*User, error) {
-	getUserByCredentials, err := newStmt(
+// AddToken saves a given token.
+func (db *mysqlDB) AddToken(token *Token) (int64, error) {
+	addToken, err := newStmt(
 		db,
-		&getUserByCredentialsOnce,
-		"getUserByCredentials",
-		`SELECT * FROM Users WHERE username = ? AND passwd = ?`,
+		&addTokenOnce,
+		"addToken",
+		`INSERT INTO Tokens(user_id, name, hash, created_at) VALUES(?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := addToken.ExecContext(ctx, token.UserID, token.Name, token.Hash, token.CreatedAt)
+	if err != nil {
+		return 0, writeError(err, "add token", "token")
+	}
+	return r.LastInsertId()
+}
+
+var deleteTokenOnce sync.Once
+
+// DeleteToken deletes the token with the given id if it belongs to the user
+// with the given id.
+func (db *mysqlDB) DeleteToken(userID, id int64) error {
+	deleteToken, err := newStmt(
+		db,
+		&deleteTokenOnce,
+		"deleteToken",
+		`DELETE FROM Tokens WHERE user_id = ? AND token_id = ?`,
+	)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := deleteToken.ExecContext(ctx, userID, id)
+	if err != nil {
+		return writeError(err, "delete token", fmt.Sprintf("token %d", id))
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("token %d %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+var listWebhooksOnce sync.Once
+
+// ListWebhooks returns the webhooks of the user with the given id, or of all
+// users if it is 0, oldest first.
+func (db *mysqlDB) ListWebhooks(userID int64) ([]*Webhook, error) {
+	listWebhooks, err := newStmt(
+		db,
+		&listWebhooksOnce,
+		"listWebhooks",
+		`SELECT * FROM Webhooks WHERE ? = 0 OR user_id = ? ORDER BY webhook_id`,
 	)
 	if err != nil {
 		return nil, err
@@ -464,25 +1969,56 @@ func (db *mysqlDB) GetUserByCredentials(username, password string) (*User, error
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	hash := sha512.New()
-	hash.Write([]byte(password))
+	rows, err := listWebhooks.QueryContext(ctx, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	user, err := scanUser(getUserByCredentials.QueryRowContext(ctx, username, hex.EncodeToString(hash.Sum(nil))))
+	var hooks []*Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+var getWebhookOnce sync.Once
+
+// GetWebhook returns the webhook with the given id.
+func (db *mysqlDB) GetWebhook(id int64) (*Webhook, error) {
+	getWebhook, err := newStmt(
+		db,
+		&getWebhookOnce,
+		"getWebhook",
+		`SELECT * FROM Webhooks WHERE webhook_id = ?`,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		return nil, err
 	}
-	return user, nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hook, err := scanWebhook(getWebhook.QueryRowContext(ctx, id))
+	if err != nil {
+		return nil, notFound(err, "could not read row", fmt.Sprintf("webhook %d", id))
+	}
+	return hook, nil
 }
 
-var addUserOnce sync.Once
+var addWebhookOnce sync.Once
 
-// AddUser saves a given user.
-func (db *mysqlDB) AddUser(user *User) (int64, error) {
-	addUser, err := newStmt(
+// AddWebhook saves a given webhook.
+func (db *mysqlDB) AddWebhook(hook *Webhook) (int64, error) {
+	addWebhook, err := newStmt(
 		db,
-		&addUserOnce,
-		"addUser",
-		`INSERT INTO Users(username, email, passwd) VALUES(?, ?, ?)`,
+		&addWebhookOnce,
+		"addWebhook",
+		`INSERT INTO Webhooks(user_id, url, secret, events, created_at) VALUES(?, ?, ?, ?, ?)`,
 	)
 	if err != nil {
 		return 0, err
@@ -491,22 +2027,22 @@ func (db *mysqlDB) AddUser(user *User) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	r, err := addUser.ExecContext(ctx, user.Name, user.Email, user.Password)
+	r, err := addWebhook.ExecContext(ctx, hook.UserID, hook.URL, hook.Secret, strings.Join(hook.Events, ","), hook.CreatedAt)
 	if err != nil {
-		return 0, fmt.Errorf("mysql: add user: %v", err)
+		return 0, writeError(err, "add webhook", "webhook")
 	}
 	return r.LastInsertId()
 }
 
-var deleteUserOnce sync.Once
+var deleteWebhookOnce sync.Once
 
-// DeleteUser deletes a user with the given id.
-func (db *mysqlDB) DeleteUser(id int64) error {
-	deleteUser, err := newStmt(
+// DeleteWebhook deletes the webhook with the given id and its deliveries.
+func (db *mysqlDB) DeleteWebhook(id int64) error {
+	deleteWebhook, err := newStmt(
 		db,
-		&deleteUserOnce,
-		"deleteUser",
-		`DELETE FROM Users WHERE user_id = ?`,
+		&deleteWebhookOnce,
+		"deleteWebhook",
+		`DELETE FROM Webhooks WHERE webhook_id = ?`,
 	)
 	if err != nil {
 		return err
@@ -515,21 +2051,118 @@ func (db *mysqlDB) DeleteUser(id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if _, err = deleteUser.ExecContext(ctx, id); err != nil {
-		return fmt.Errorf("mysql: delete user: %v", err)
+	r, err := deleteWebhook.ExecContext(ctx, id)
+	if err != nil {
+		return writeError(err, "delete webhook", fmt.Sprintf("webhook %d", id))
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("webhook %d %w", id, ErrNotFound)
 	}
 	return nil
 }
 
-var updateUserOnce sync.Once
+var listDeliveriesOnce sync.Once
 
-// UpdateUser updates a given user.
-func (db *mysqlDB) UpdateUser(user *User) error {
-	updateUser, err := newStmt(
+// ListDeliveries returns the latest deliveries of the webhook with the given
+// id, newest first, at most limit of them.
+func (db *mysqlDB) ListDeliveries(webhookID int64, limit int) ([]*Delivery, error) {
+	listDeliveries, err := newStmt(
 		db,
-		&updateUserOnce,
-		"updateUser",
-		`UPDATE Users SET username = ?, email = ?, passwd = ? WHERE user_id = ?`,
+		&listDeliveriesOnce,
+		"listDeliveries",
+		`SELECT * FROM WebhookDeliveries WHERE webhook_id = ? ORDER BY delivery_id DESC LIMIT ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listDeliveries.QueryContext(ctx, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanDeliveries(rows)
+}
+
+var listDueDeliveriesOnce sync.Once
+
+// ListDueDeliveries returns the pending deliveries whose next attempt is due
+// at now, oldest first, at most limit of them.
+func (db *mysqlDB) ListDueDeliveries(now time.Time, limit int) ([]*Delivery, error) {
+	listDueDeliveries, err := newStmt(
+		db,
+		&listDueDeliveriesOnce,
+		"listDueDeliveries",
+		`SELECT * FROM WebhookDeliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at, delivery_id LIMIT ?`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := listDueDeliveries.QueryContext(ctx, DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanDeliveries(rows)
+}
+
+// scanDeliveries returns the deliveries in rows.
+func scanDeliveries(rows *sql.Rows) ([]*Delivery, error) {
+	var deliveries []*Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+var addDeliveryOnce sync.Once
+
+// AddDelivery saves a given delivery.
+func (db *mysqlDB) AddDelivery(d *Delivery) (int64, error) {
+	addDelivery, err := newStmt(
+		db,
+		&addDeliveryOnce,
+		"addDelivery",
+		`INSERT INTO WebhookDeliveries(webhook_id, event_type, payload, status, attempts, response_code, error, created_at, last_attempt_at, next_attempt_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	r, err := addDelivery.ExecContext(ctx, d.WebhookID, d.EventType, d.Payload, d.Status, d.Attempts,
+		d.ResponseCode, d.Error, d.CreatedAt, nullTime(d.LastAttemptAt), d.NextAttemptAt)
+	if err != nil {
+		return 0, writeError(err, "add delivery", "delivery")
+	}
+	return r.LastInsertId()
+}
+
+var updateDeliveryOnce sync.Once
+
+// UpdateDelivery saves the outcome of an attempt of the given delivery: its
+// status, attempts, response code, error and attempt times.
+func (db *mysqlDB) UpdateDelivery(d *Delivery) error {
+	updateDelivery, err := newStmt(
+		db,
+		&updateDeliveryOnce,
+		"updateDelivery",
+		`UPDATE WebhookDeliveries SET status = ?, attempts = ?, response_code = ?, error = ?, last_attempt_at = ?, next_attempt_at = ?
+		WHERE delivery_id = ?`,
 	)
 	if err != nil {
 		return err
@@ -538,8 +2171,176 @@ func (db *mysqlDB) UpdateUser(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if _, err = updateUser.ExecContext(ctx, user.Name, user.Email, user.Password, user.ID); err != nil {
-		return fmt.Errorf("mysql: update user: %v", err)
+	r, err := updateDelivery.ExecContext(ctx, d.Status, d.Attempts, d.ResponseCode, d.Error,
+		nullTime(d.LastAttemptAt), d.NextAttemptAt, d.ID)
+	if err != nil {
+		return writeError(err, "update delivery", fmt.Sprintf("delivery %d", d.ID))
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("delivery %d %w", d.ID, ErrNotFound)
+	}
+	return nil
+}
+
+var exportResultsOnce sync.Once
+
+// ExportResults returns all results, including hidden ones.
+func (db *mysqlDB) ExportResults() ([]*Result, error) {
+	exportResults, err := newStmt(
+		db,
+		&exportResultsOnce,
+		"exportResults",
+		`SELECT * FROM Results`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := exportResults.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*Result
+	for rows.Next() {
+		result, err := scanResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+var exportSpecsOnce sync.Once
+
+// ExportSpecs returns all specs, including those of hidden results.
+func (db *mysqlDB) ExportSpecs() ([]*Specs, error) {
+	exportSpecs, err := newStmt(
+		db,
+		&exportSpecsOnce,
+		"exportSpecs",
+		`SELECT * FROM Specs`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := exportSpecs.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var specs []*Specs
+	for rows.Next() {
+		spec, err := scanSpecs(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Import saves users, results and specs in one transaction.
+func (db *mysqlDB) Import(users []*User, results []*Result, specs []*Specs) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	defer db.stats.invalidate()
+
+	userIDs := make(map[int64]int64, len(users))
+	for _, u := range users {
+		r, err := tx.ExecContext(ctx, `INSERT INTO Users(username, email, passwd, is_admin) VALUES(?, ?, ?, ?)`,
+			u.Name, u.Email, u.Password, u.Admin)
+		if err != nil {
+			return writeError(err, "add user", fmt.Sprintf("user %q", u.Name))
+		}
+		if userIDs[u.ID], err = r.LastInsertId(); err != nil {
+			return err
+		}
+	}
+
+	resultIDs := make(map[int64]int64, len(results))
+	for _, res := range results {
+		userID, ok := userIDs[res.UserID]
+		if !ok {
+			return fmt.Errorf("%w result %d: it refers to a missing user", ErrInvalid, res.ID)
+		}
+		createdAt := res.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now().UTC()
+		}
+		r, err := tx.ExecContext(ctx, `INSERT INTO Results(user_id, scores, created_at, hidden) VALUES(?, ?, ?, ?)`,
+			userID, res.Scores, createdAt, res.Hidden)
+		if err != nil {
+			return writeError(err, "add result", fmt.Sprintf("result %d", res.ID))
+		}
+		id, err := r.LastInsertId()
+		if err != nil {
+			return err
+		}
+		// Hidden results are not ranked, so their scores are not indexed.
+		if !res.Hidden {
+			if err := saveBenchmarkScores(ctx, tx, id, res.Scores); err != nil {
+				return err
+			}
+		}
+		resultIDs[res.ID] = id
+	}
+
+	specsIDs := make([]int64, len(specs))
+	normalized := make([]NormalizedSysInfo, len(specs))
+	for i, s := range specs {
+		resultID, ok := resultIDs[s.ResultID]
+		if !ok {
+			return fmt.Errorf("%w specs %d: it refers to a missing result", ErrInvalid, s.ID)
+		}
+		n, err := s.SysInfo.Normalize()
+		if err != nil {
+			return fmt.Errorf("%w specs %d: %v", ErrInvalid, s.ID, err)
+		}
+		r, err := tx.ExecContext(ctx, `INSERT INTO Specs(result_id, sys_info, cpu_model, clock_hz, threads, physical_mem_bytes, virtual_mem_bytes, swap_mem_bytes, overclocked, raw_sys_info)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			resultID, s.SysInfo,
+			nullString(n.Model),
+			nullInt64(n.ClockSpeedHz), nullInt64(int64(n.Threads)),
+			nullInt64(n.PhysicalMemBytes), nullInt64(n.VirtualMemBytes), nullInt64(n.SwapMemBytes),
+			n.Overclocked, nullString(string(s.Raw)))
+		if err != nil {
+			return writeError(err, "add specs", fmt.Sprintf("specs %d", s.ID))
+		}
+		if specsIDs[i], err = r.LastInsertId(); err != nil {
+			return err
+		}
+		normalized[i] = n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, u := range users {
+		u.ID = userIDs[u.ID]
+	}
+	for _, res := range results {
+		res.ID, res.UserID = resultIDs[res.ID], userIDs[res.UserID]
+	}
+	for i, s := range specs {
+		s.ID, s.ResultID, s.Normalized = specsIDs[i], resultIDs[s.ResultID], normalized[i]
 	}
 	return nil
 }
@@ -38,4 +38,6 @@ func TestMySQLDB(t *testing.T) {
 	testUserDB(t, db)
 	testResultsDB(t, db)
 	testSpecsDB(t, db)
+	testSubmissionDB(t, db)
+	testCatalogDB(t, db)
 }
@@ -0,0 +1,1195 @@
+// Package dbtest provides an in-memory database.OSBDatabase for tests.
+package dbtest
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// DB is an in-memory implementation of database.OSBDatabase.
+type DB struct {
+	mu          sync.Mutex
+	lastID      int64
+	users       map[int64]*database.User
+	results     map[int64]*database.Result
+	hidden      map[int64]*database.Result // hidden results, which are kept like MySQL keeps their rows
+	specs       map[int64]*database.Specs
+	submissions map[int64]*database.Submission
+	tokens      map[int64]*database.Token
+	cpus        map[int64]*database.CPU
+	cpuAliases  map[int64]*database.CPUAlias
+	webhooks    map[int64]*database.Webhook
+	deliveries  map[int64]*database.Delivery
+}
+
+// Ensure DB implements the OSBDatabase interface.
+var _ database.OSBDatabase = &DB{}
+
+// New returns an empty in-memory database.
+func New() *DB {
+	return &DB{
+		users:       make(map[int64]*database.User),
+		results:     make(map[int64]*database.Result),
+		hidden:      make(map[int64]*database.Result),
+		specs:       make(map[int64]*database.Specs),
+		submissions: make(map[int64]*database.Submission),
+		tokens:      make(map[int64]*database.Token),
+		cpus:        make(map[int64]*database.CPU),
+		cpuAliases:  make(map[int64]*database.CPUAlias),
+		webhooks:    make(map[int64]*database.Webhook),
+		deliveries:  make(map[int64]*database.Delivery),
+	}
+}
+
+// nextID returns a new unique row ID. The caller must hold db.mu.
+func (db *DB) nextID() int64 {
+	db.lastID++
+	return db.lastID
+}
+
+// sortIDs sorts ids in ascending order so listings are returned in insertion order.
+func sortIDs(ids []int64) []int64 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// HashPassword returns the password hash stored for a user, matching
+// database.UserDatabase.GetUserByCredentials.
+func HashPassword(password string) string {
+	hash := sha512.New()
+	hash.Write([]byte(password))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ListUsers returns a list of all users.
+func (db *DB) ListUsers() ([]*database.UserExternal, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var users []*database.UserExternal
+	ids := make([]int64, 0, len(db.users))
+	for id := range db.users {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		u := db.users[id]
+		users = append(users, &database.UserExternal{ID: u.ID, Name: u.Name})
+	}
+	return users, nil
+}
+
+// ListUsersAfter returns up to limit users with ids after the given one,
+// ordered by id.
+func (db *DB) ListUsersAfter(after int64, limit int) ([]*database.UserExternal, error) {
+	users, err := db.ListUsers()
+	start := sort.Search(len(users), func(i int) bool { return users[i].ID > after })
+	users = users[start:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, err
+}
+
+// ListUserAccounts returns all users including their email, password hash
+// and admin flag, ordered by id.
+func (db *DB) ListUserAccounts() ([]*database.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var users []*database.User
+	ids := make([]int64, 0, len(db.users))
+	for id := range db.users {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		u := *db.users[id]
+		users = append(users, &u)
+	}
+	return users, nil
+}
+
+// GetUser retrieves a user by its id.
+func (db *DB) GetUser(id int64) (*database.UserExternal, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %d %w", id, database.ErrNotFound)
+	}
+	return &database.UserExternal{ID: u.ID, Name: u.Name}, nil
+}
+
+// GetUsers retrieves the users with the given ids, ordered by id.
+func (db *DB) GetUsers(ids []int64) ([]*database.UserExternal, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var users []*database.UserExternal
+	for _, id := range sortIDs(append([]int64(nil), ids...)) {
+		if u, ok := db.users[id]; ok && (len(users) == 0 || users[len(users)-1].ID != id) {
+			users = append(users, &database.UserExternal{ID: u.ID, Name: u.Name})
+		}
+	}
+	return users, nil
+}
+
+// GetUserByCredentials returns a user with the matching username and password.
+func (db *DB) GetUserByCredentials(username, password string) (*database.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	hash := HashPassword(password)
+	for _, u := range db.users {
+		if u.Name == username && u.Password == hash {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("user with these credentials %w", database.ErrNotFound)
+}
+
+// AddUser saves a given user. The password is expected to be hashed already.
+func (db *DB) AddUser(user *database.User) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, other := range db.users {
+		if other.Name == user.Name {
+			return 0, fmt.Errorf("user %q %w", user.Name, database.ErrConflict)
+		}
+	}
+	u := *user
+	u.ID = db.nextID()
+	db.users[u.ID] = &u
+	return u.ID, nil
+}
+
+// DeleteUser deletes a user with the given id.
+func (db *DB) DeleteUser(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.users, id)
+	for tid, t := range db.tokens {
+		if t.UserID == id {
+			delete(db.tokens, tid) // like ON DELETE CASCADE
+		}
+	}
+	for wid, h := range db.webhooks {
+		if h.UserID == id {
+			db.deleteWebhook(wid)
+		}
+	}
+	return nil
+}
+
+// UpdateUser updates a given user.
+func (db *DB) UpdateUser(user *database.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[user.ID]; !ok {
+		return fmt.Errorf("user %d %w", user.ID, database.ErrNotFound)
+	}
+	u := *user
+	db.users[u.ID] = &u
+	return nil
+}
+
+// ListResults returns a list of all results.
+func (db *DB) ListResults() ([]*database.Result, error) {
+	return db.filterResults(func(*database.Result) bool { return true }), nil
+}
+
+// ListResultsAfter returns up to limit results with ids after the given one,
+// ordered by id.
+func (db *DB) ListResultsAfter(after int64, limit int) ([]*database.Result, error) {
+	results := db.filterResults(func(r *database.Result) bool { return r.ID > after })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// ListLatestResults returns up to limit visible results, newest first and by
+// descending id among results created at the same time.
+func (db *DB) ListLatestResults(limit int) ([]*database.Result, error) {
+	results := db.filterResults(func(*database.Result) bool { return true })
+	sort.SliceStable(results, func(i, j int) bool {
+		if !results[i].CreatedAt.Equal(results[j].CreatedAt) {
+			return results[i].CreatedAt.After(results[j].CreatedAt)
+		}
+		return results[i].ID > results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// ListLatestRecords returns up to limit of the latest records set by visible
+// results, newest first and by benchmark within a result.
+func (db *DB) ListLatestRecords(limit int) ([]*database.Record, error) {
+	results := db.filterResults(func(*database.Result) bool { return true })
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreatedAt.Before(results[j].CreatedAt)
+	})
+
+	var records []*database.Record
+	best := make(map[string]*database.Record)
+	order := make(map[int64]int, len(results))
+	for i, res := range results {
+		order[res.ID] = i
+		for _, score := range res.Scores {
+			prev, ok := best[score.Name]
+			if ok && score.Score <= prev.Score {
+				continue
+			}
+			rec := &database.Record{ResultID: res.ID, UserID: res.UserID, CreatedAt: res.CreatedAt, Benchmark: score.Name, Score: score.Score}
+			if ok {
+				rec.Previous = &database.Record{ResultID: prev.ResultID, UserID: prev.UserID, Score: prev.Score}
+			}
+			best[score.Name] = rec
+			records = append(records, rec)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if a, b := order[records[i].ResultID], order[records[j].ResultID]; a != b {
+			return a > b
+		}
+		return records[i].Benchmark < records[j].Benchmark
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// ListRankedResultsAfter returns up to limit visible results with a Total
+// score that rank after a result with the given Total score and id, best
+// first and by id among equal scores.
+func (db *DB) ListRankedResultsAfter(score float64, id int64, limit int) ([]*database.Result, error) {
+	totals := make(map[int64]float64)
+	results := db.filterResults(func(r *database.Result) bool {
+		for _, s := range r.Scores {
+			if s.Name == "Total" {
+				totals[r.ID] = s.Score
+				return s.Score < score || s.Score == score && r.ID > id
+			}
+		}
+		return false
+	})
+	sort.SliceStable(results, func(i, j int) bool {
+		return totals[results[i].ID] > totals[results[j].ID]
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// ListBenchmarks returns the names of the benchmarks scored by visible
+// results, in order of the first result scoring each, then by name.
+func (db *DB) ListBenchmarks() ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range db.filterResults(func(*database.Result) bool { return true }) {
+		var added []string
+		for _, s := range r.Scores {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				added = append(added, s.Name)
+			}
+		}
+		sort.Strings(added)
+		names = append(names, added...)
+	}
+	return names, nil
+}
+
+// ListResultsCreatedBy returns a list of results created by a user with
+// the given id, oldest first.
+func (db *DB) ListResultsCreatedBy(id int64) ([]*database.Result, error) {
+	results := db.filterResults(func(r *database.Result) bool { return r.UserID == id })
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreatedAt.Before(results[j].CreatedAt)
+	})
+	return results, nil
+}
+
+// ListResultsCreatedByAfter returns up to limit results created by a user
+// with the given id, with ids after the given one, ordered by id.
+func (db *DB) ListResultsCreatedByAfter(id, after int64, limit int) ([]*database.Result, error) {
+	results := db.filterResults(func(r *database.Result) bool { return r.UserID == id && r.ID > after })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// ListResultsCreatedByUsersAfter returns up to limit results of each of the
+// users with the given ids, with ids after the given one, ordered by id.
+func (db *DB) ListResultsCreatedByUsersAfter(ids []int64, after int64, limit int) ([]*database.Result, error) {
+	want := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	counts := make(map[int64]int, len(ids))
+	return db.filterResults(func(r *database.Result) bool {
+		if !want[r.UserID] || r.ID <= after || counts[r.UserID] >= limit {
+			return false
+		}
+		counts[r.UserID]++
+		return true
+	}), nil
+}
+
+func (db *DB) filterResults(keep func(*database.Result) bool) []*database.Result {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var results []*database.Result
+	ids := make([]int64, 0, len(db.results))
+	for id := range db.results {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		if r := db.results[id]; keep(r) {
+			result := *r
+			results = append(results, &result)
+		}
+	}
+	return results
+}
+
+// GetResult retrieves a result by its id.
+func (db *DB) GetResult(id int64) (*database.Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, ok := db.results[id]
+	if !ok {
+		return nil, fmt.Errorf("result %d %w", id, database.ErrNotFound)
+	}
+	result := *r
+	return &result, nil
+}
+
+// AddResult saves a given result.
+func (db *DB) AddResult(res *database.Result) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r := *res
+	r.ID = db.nextID()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	db.results[r.ID] = &r
+	return r.ID, nil
+}
+
+// DeleteResult deletes a result with the given id.
+func (db *DB) DeleteResult(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.results, id)
+	return nil
+}
+
+// UpdateResult updates a given result.
+func (db *DB) UpdateResult(res *database.Result) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.results[res.ID]; !ok {
+		return fmt.Errorf("result %d %w", res.ID, database.ErrNotFound)
+	}
+	r := *res
+	db.results[r.ID] = &r
+	return nil
+}
+
+// HideResult hides the result with the given id.
+func (db *DB) HideResult(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, ok := db.results[id]
+	if !ok {
+		return fmt.Errorf("result %d %w", id, database.ErrNotFound)
+	}
+	delete(db.results, id)
+	db.hidden[id] = r
+	return nil
+}
+
+// ListSpecs returns a list of the specs of all visible results.
+func (db *DB) ListSpecs() ([]*database.Specs, error) {
+	return db.filterSpecs(func(*database.Specs) bool { return true }), nil
+}
+
+// ListSpecsAfter returns up to limit specs of visible results with ids
+// after the given one, ordered by id.
+func (db *DB) ListSpecsAfter(after int64, limit int) ([]*database.Specs, error) {
+	specs := db.filterSpecs(func(s *database.Specs) bool { return s.ID > after })
+	if len(specs) > limit {
+		specs = specs[:limit]
+	}
+	return specs, nil
+}
+
+// ListSpecsWithResultID returns the specs related to a result, unless it is
+// hidden.
+func (db *DB) ListSpecsWithResultID(id int64) ([]*database.Specs, error) {
+	return db.filterSpecs(func(s *database.Specs) bool { return s.ResultID == id }), nil
+}
+
+// ListSpecsWithResultIDs returns the specs related to any of the visible
+// results with the given ids.
+func (db *DB) ListSpecsWithResultIDs(ids []int64) ([]*database.Specs, error) {
+	want := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	return db.filterSpecs(func(s *database.Specs) bool { return want[s.ResultID] }), nil
+}
+
+// filterSpecs returns the specs of visible results that keep returns true for.
+func (db *DB) filterSpecs(keep func(*database.Specs) bool) []*database.Specs {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var specs []*database.Specs
+	ids := make([]int64, 0, len(db.specs))
+	for id := range db.specs {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		if s := db.specs[id]; db.hidden[s.ResultID] == nil && keep(s) {
+			spec := *s
+			specs = append(specs, &spec)
+		}
+	}
+	return specs
+}
+
+// GetSpecs retrieves specs by its id, unless their result is hidden.
+func (db *DB) GetSpecs(id int64) (*database.Specs, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, ok := db.specs[id]
+	if !ok || db.hidden[s.ResultID] != nil {
+		return nil, fmt.Errorf("specs %d %w", id, database.ErrNotFound)
+	}
+	spec := *s
+	return &spec, nil
+}
+
+// AddSpecs saves the given specs.
+func (db *DB) AddSpecs(specs *database.Specs) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n, err := specs.SysInfo.Normalize()
+	if err != nil {
+		return 0, fmt.Errorf("%w specs: %v", database.ErrInvalid, err)
+	}
+
+	s := *specs
+	s.ID = db.nextID()
+	s.Normalized = n
+	db.specs[s.ID] = &s
+	return s.ID, nil
+}
+
+// DeleteSpecs deletes the specs with the given id.
+func (db *DB) DeleteSpecs(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.specs, id)
+	return nil
+}
+
+// UpdateSpecs updates the given specs.
+func (db *DB) UpdateSpecs(specs *database.Specs) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, ok := db.specs[specs.ID]
+	if !ok {
+		return fmt.Errorf("specs %d %w", specs.ID, database.ErrNotFound)
+	}
+	n, err := specs.SysInfo.Normalize()
+	if err != nil {
+		return fmt.Errorf("%w specs: %v", database.ErrInvalid, err)
+	}
+	s := *specs
+	s.Normalized = n
+	s.Raw = old.Raw // the specs as submitted are never updated
+	db.specs[s.ID] = &s
+	return nil
+}
+
+// GetSubmissionByKey returns the submission a user made with the given
+// idempotency key, or nil if there is none.
+func (db *DB) GetSubmissionByKey(userID int64, key string) (*database.Submission, error) {
+	return db.findSubmission(func(s *database.Submission) bool {
+		return s.UserID == userID && s.Key == key
+	}), nil
+}
+
+// GetSubmissionByFingerprint returns the latest submission a user made with
+// the given fingerprint after since, or nil if there is none.
+func (db *DB) GetSubmissionByFingerprint(userID int64, fingerprint string, since time.Time) (*database.Submission, error) {
+	return db.findSubmission(func(s *database.Submission) bool {
+		return s.UserID == userID && s.Fingerprint == fingerprint && !s.CreatedAt.Before(since)
+	}), nil
+}
+
+// findSubmission returns a copy of the latest matching submission.
+func (db *DB) findSubmission(match func(*database.Submission) bool) *database.Submission {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var found *database.Submission
+	for _, s := range db.submissions {
+		if match(s) && (found == nil || s.CreatedAt.After(found.CreatedAt)) {
+			found = s
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	sub := *found
+	return &sub
+}
+
+// AddSubmission saves a given submission.
+func (db *DB) AddSubmission(sub *database.Submission) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if sub.Key != "" {
+		for _, s := range db.submissions {
+			if s.UserID == sub.UserID && s.Key == sub.Key {
+				return 0, fmt.Errorf("submission %w", database.ErrConflict)
+			}
+		}
+	}
+	s := *sub
+	s.ID = db.nextID()
+	db.submissions[s.ID] = &s
+	return s.ID, nil
+}
+
+// AddSubmittedResult saves a submitted result, its specs and the submission
+// at once.
+func (db *DB) AddSubmittedResult(res *database.Result, specs *database.Specs, sub *database.Submission) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n, err := specs.SysInfo.Normalize()
+	if err != nil {
+		return fmt.Errorf("%w specs: %v", database.ErrInvalid, err)
+	}
+	if sub.Key != "" {
+		for _, s := range db.submissions {
+			if s.UserID == sub.UserID && s.Key == sub.Key {
+				return fmt.Errorf("submission %w", database.ErrConflict)
+			}
+		}
+	}
+
+	res.ID = db.nextID()
+	if res.CreatedAt.IsZero() {
+		res.CreatedAt = time.Now().UTC()
+	}
+	specs.ID, specs.ResultID, specs.Normalized = db.nextID(), res.ID, n
+	sub.ID, sub.ResultID = db.nextID(), res.ID
+
+	r, sp, su := *res, *specs, *sub
+	db.results[r.ID] = &r
+	db.specs[sp.ID] = &sp
+	db.submissions[su.ID] = &su
+	return nil
+}
+
+// SetSubmissionResponse saves the response sent for the submission with the
+// given ID.
+func (db *DB) SetSubmissionResponse(id int64, response []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	sub, ok := db.submissions[id]
+	if !ok {
+		return fmt.Errorf("submission %d %w", id, database.ErrNotFound)
+	}
+	sub.Response = append([]byte(nil), response...)
+	return nil
+}
+
+// ListCPUs returns a list of all catalogued CPUs.
+func (db *DB) ListCPUs() ([]*database.CPU, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var cpus []*database.CPU
+	ids := make([]int64, 0, len(db.cpus))
+	for id := range db.cpus {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		cpu := *db.cpus[id]
+		cpus = append(cpus, &cpu)
+	}
+	return cpus, nil
+}
+
+// GetCPU retrieves a CPU by its id.
+func (db *DB) GetCPU(id int64) (*database.CPU, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.cpus[id]
+	if !ok {
+		return nil, fmt.Errorf("cpu %d %w", id, database.ErrNotFound)
+	}
+	cpu := *c
+	return &cpu, nil
+}
+
+// ResolveCPU returns the CPU of vendor, unless it is empty, whose canonical
+// model or aliases match the given raw model string, or nil if there is none.
+func (db *DB) ResolveCPU(vendor, model string) (*database.CPU, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	id, ok := db.resolveCPU(vendor, database.CanonicalCPUModel(model))
+	if !ok {
+		return nil, nil
+	}
+	cpu := *db.cpus[id]
+	return &cpu, nil
+}
+
+// resolveCPU returns the id of the CPU of vendor, unless it is empty,
+// matching a canonical model, preferring a match of its model to one of its
+// aliases. The caller must hold db.mu.
+func (db *DB) resolveCPU(vendor, canonical string) (int64, bool) {
+	if canonical == "" {
+		return 0, false
+	}
+	vendor = strings.TrimSpace(vendor)
+	ofVendor := func(id int64) bool {
+		return vendor == "" || strings.EqualFold(db.cpus[id].Vendor, vendor)
+	}
+	for id, c := range db.cpus {
+		if strings.EqualFold(c.Model, canonical) && ofVendor(id) {
+			return id, true
+		}
+	}
+	for _, a := range db.cpuAliases {
+		if strings.EqualFold(a.Model, canonical) && ofVendor(a.CPUID) {
+			return a.CPUID, true
+		}
+	}
+	return 0, false
+}
+
+// AddCPU saves a given CPU.
+func (db *DB) AddCPU(cpu *database.CPU) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c := *cpu
+	c.Model = database.CanonicalCPUModel(c.Model)
+	if _, ok := db.resolveCPU("", c.Model); ok {
+		return 0, fmt.Errorf("cpu %q %w", c.Model, database.ErrConflict)
+	}
+	c.ID = db.nextID()
+	db.cpus[c.ID] = &c
+	return c.ID, nil
+}
+
+// DeleteCPU deletes a CPU and its aliases with the given id. It returns
+// ErrNotFound if there is no such CPU.
+func (db *DB) DeleteCPU(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.cpus[id]; !ok {
+		return fmt.Errorf("cpu %d %w", id, database.ErrNotFound)
+	}
+	for aliasID, a := range db.cpuAliases {
+		if a.CPUID == id {
+			delete(db.cpuAliases, aliasID)
+		}
+	}
+	delete(db.cpus, id)
+	return nil
+}
+
+// ListCPUAliases returns a list of aliases for the CPU with the given id.
+func (db *DB) ListCPUAliases(cpuID int64) ([]*database.CPUAlias, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var aliases []*database.CPUAlias
+	ids := make([]int64, 0, len(db.cpuAliases))
+	for id := range db.cpuAliases {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		if a := db.cpuAliases[id]; a.CPUID == cpuID {
+			alias := *a
+			aliases = append(aliases, &alias)
+		}
+	}
+	return aliases, nil
+}
+
+// AddCPUAlias saves a given alias.
+func (db *DB) AddCPUAlias(alias *database.CPUAlias) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.cpus[alias.CPUID]; !ok {
+		return 0, fmt.Errorf("%w cpu alias: it refers to a missing row", database.ErrInvalid)
+	}
+	a := *alias
+	a.Model = database.CanonicalCPUModel(a.Model)
+	for _, other := range db.cpuAliases {
+		if strings.EqualFold(other.Model, a.Model) {
+			return 0, fmt.Errorf("cpu alias %q %w", a.Model, database.ErrConflict)
+		}
+	}
+	a.ID = db.nextID()
+	db.cpuAliases[a.ID] = &a
+	return a.ID, nil
+}
+
+// DeleteCPUAlias deletes an alias with the given id. It returns ErrNotFound
+// if there is no such alias.
+func (db *DB) DeleteCPUAlias(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.cpuAliases[id]; !ok {
+		return fmt.Errorf("cpu alias %d %w", id, database.ErrNotFound)
+	}
+	delete(db.cpuAliases, id)
+	return nil
+}
+
+// ListResultsByCPU returns a list of results whose specs resolve to the
+// CPU with the given id, as ResolveCPU resolves their vendor and model.
+func (db *DB) ListResultsByCPU(cpuID int64) ([]*database.Result, error) {
+	db.mu.Lock()
+	resultIDs := make(map[int64]bool)
+	for _, s := range db.specs {
+		if id, ok := db.resolveCPU(s.Vendor, s.Normalized.Model); ok && id == cpuID {
+			resultIDs[s.ResultID] = true
+		}
+	}
+	db.mu.Unlock()
+
+	return db.filterResults(func(r *database.Result) bool { return resultIDs[r.ID] }), nil
+}
+
+// BenchmarkStats returns score statistics for a benchmark grouped by the
+// given specs field. An empty benchmark returns statistics for every benchmark.
+func (db *DB) BenchmarkStats(groupBy database.GroupBy, benchmark string) ([]*database.Stats, error) {
+	return database.ComputeStats(db.statsSamples(), groupBy, benchmark), nil
+}
+
+// ResultRanks returns the percentile ranks of each benchmark score of the
+// result with the given id.
+func (db *DB) ResultRanks(resultID int64) ([]*database.BenchmarkRanks, error) {
+	return database.ComputeRanks(db.statsSamples(), resultID), nil
+}
+
+// TotalRank returns the leaderboard rank of the result with the given id, or
+// 0 if it is hidden or has no Total score.
+func (db *DB) TotalRank(resultID int64) (int, error) {
+	results, err := db.ListResults()
+	if err != nil {
+		return 0, err
+	}
+	return database.ComputeTotalRank(results, resultID), nil
+}
+
+// statsSamples returns the scores and grouping specs of every result, taking
+// the first specs of results that have several and resolving their model
+// through the CPU catalog.
+func (db *DB) statsSamples() []database.StatsSample {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	specsByResult := make(map[int64]*database.Specs)
+	for _, s := range db.specs {
+		if first, ok := specsByResult[s.ResultID]; !ok || s.ID < first.ID {
+			specsByResult[s.ResultID] = s
+		}
+	}
+
+	var samples []database.StatsSample
+	for _, r := range db.results {
+		sample := database.StatsSample{ResultID: r.ID, Scores: r.Scores}
+		if s, ok := specsByResult[r.ID]; ok {
+			sample.Model = s.Normalized.Model
+			if id, ok := db.resolveCPU(s.Vendor, s.Normalized.Model); ok {
+				sample.CPUID = id
+				sample.Model = db.cpus[id].Model
+			}
+			sample.Vendor = s.Vendor
+			sample.Threads = s.Normalized.Threads
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// ListTokens returns the tokens of the user with the given id, oldest first.
+func (db *DB) ListTokens(userID int64) ([]*database.Token, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var ids []int64
+	for id, t := range db.tokens {
+		if t.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	var tokens []*database.Token
+	for _, id := range sortIDs(ids) {
+		t := *db.tokens[id]
+		tokens = append(tokens, &t)
+	}
+	return tokens, nil
+}
+
+// GetUserByToken returns the user owning the token with the given hash of
+// its secret.
+func (db *DB) GetUserByToken(hash string) (*database.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, t := range db.tokens {
+		if t.Hash == hash {
+			if u, ok := db.users[t.UserID]; ok {
+				user := *u
+				return &user, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("token %w", database.ErrNotFound)
+}
+
+// AddToken saves a given token.
+func (db *DB) AddToken(token *database.Token) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[token.UserID]; !ok {
+		return 0, fmt.Errorf("%w token: it refers to a missing row", database.ErrInvalid)
+	}
+	for _, t := range db.tokens {
+		if t.Hash == token.Hash {
+			return 0, fmt.Errorf("token %w", database.ErrConflict)
+		}
+	}
+	t := *token
+	t.ID = db.nextID()
+	db.tokens[t.ID] = &t
+	return t.ID, nil
+}
+
+// DeleteToken deletes the token with the given id if it belongs to the user
+// with the given id.
+func (db *DB) DeleteToken(userID, id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if t, ok := db.tokens[id]; !ok || t.UserID != userID {
+		return fmt.Errorf("token %d %w", id, database.ErrNotFound)
+	}
+	delete(db.tokens, id)
+	return nil
+}
+
+// copyWebhook returns a copy of h that shares no memory with it.
+func copyWebhook(h *database.Webhook) *database.Webhook {
+	c := *h
+	c.Events = append([]string(nil), h.Events...)
+	return &c
+}
+
+// ListWebhooks returns the webhooks of the user with the given id, or of all
+// users if it is 0, oldest first.
+func (db *DB) ListWebhooks(userID int64) ([]*database.Webhook, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var ids []int64
+	for id, h := range db.webhooks {
+		if userID == 0 || h.UserID == userID {
+			ids = append(ids, id)
+		}
+	}
+	var hooks []*database.Webhook
+	for _, id := range sortIDs(ids) {
+		hooks = append(hooks, copyWebhook(db.webhooks[id]))
+	}
+	return hooks, nil
+}
+
+// GetWebhook returns the webhook with the given id.
+func (db *DB) GetWebhook(id int64) (*database.Webhook, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	h, ok := db.webhooks[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook %d %w", id, database.ErrNotFound)
+	}
+	return copyWebhook(h), nil
+}
+
+// AddWebhook saves a given webhook.
+func (db *DB) AddWebhook(hook *database.Webhook) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[hook.UserID]; !ok {
+		return 0, fmt.Errorf("%w webhook: it refers to a missing row", database.ErrInvalid)
+	}
+	h := copyWebhook(hook)
+	h.ID = db.nextID()
+	db.webhooks[h.ID] = h
+	return h.ID, nil
+}
+
+// DeleteWebhook deletes the webhook with the given id and its deliveries.
+func (db *DB) DeleteWebhook(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.webhooks[id]; !ok {
+		return fmt.Errorf("webhook %d %w", id, database.ErrNotFound)
+	}
+	db.deleteWebhook(id)
+	return nil
+}
+
+// deleteWebhook deletes a webhook and its deliveries, like ON DELETE
+// CASCADE. The caller must hold db.mu.
+func (db *DB) deleteWebhook(id int64) {
+	delete(db.webhooks, id)
+	for did, d := range db.deliveries {
+		if d.WebhookID == id {
+			delete(db.deliveries, did)
+		}
+	}
+}
+
+// ListDeliveries returns the latest deliveries of the webhook with the given
+// id, newest first, at most limit of them.
+func (db *DB) ListDeliveries(webhookID int64, limit int) ([]*database.Delivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var ids []int64
+	for id, d := range db.deliveries {
+		if d.WebhookID == webhookID {
+			ids = append(ids, id)
+		}
+	}
+	sortIDs(ids)
+	var deliveries []*database.Delivery
+	for i := len(ids) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		d := *db.deliveries[ids[i]]
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, nil
+}
+
+// ListDueDeliveries returns the pending deliveries whose next attempt is due
+// at now, oldest first, at most limit of them.
+func (db *DB) ListDueDeliveries(now time.Time, limit int) ([]*database.Delivery, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var due []*database.Delivery
+	for _, d := range db.deliveries {
+		if d.Status == database.DeliveryPending && !d.NextAttemptAt.After(now) {
+			c := *d
+			due = append(due, &c)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// AddDelivery saves a given delivery.
+func (db *DB) AddDelivery(d *database.Delivery) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.webhooks[d.WebhookID]; !ok {
+		return 0, fmt.Errorf("%w delivery: it refers to a missing row", database.ErrInvalid)
+	}
+	c := *d
+	c.ID = db.nextID()
+	db.deliveries[c.ID] = &c
+	return c.ID, nil
+}
+
+// UpdateDelivery saves the outcome of an attempt of the given delivery: its
+// status, attempts, response code, error and attempt times.
+func (db *DB) UpdateDelivery(d *database.Delivery) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.deliveries[d.ID]
+	if !ok {
+		return fmt.Errorf("delivery %d %w", d.ID, database.ErrNotFound)
+	}
+	stored.Status = d.Status
+	stored.Attempts = d.Attempts
+	stored.ResponseCode = d.ResponseCode
+	stored.Error = d.Error
+	stored.LastAttemptAt = d.LastAttemptAt
+	stored.NextAttemptAt = d.NextAttemptAt
+	return nil
+}
+
+// ExportResults returns all results, including hidden ones.
+func (db *DB) ExportResults() ([]*database.Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ids := make([]int64, 0, len(db.results)+len(db.hidden))
+	for id := range db.results {
+		ids = append(ids, id)
+	}
+	for id := range db.hidden {
+		ids = append(ids, id)
+	}
+	results := make([]*database.Result, 0, len(ids))
+	for _, id := range sortIDs(ids) {
+		r, ok := db.results[id]
+		if !ok {
+			r = db.hidden[id]
+		}
+		result := *r
+		result.Hidden = !ok
+		results = append(results, &result)
+	}
+	return results, nil
+}
+
+// ExportSpecs returns all specs, including those of hidden results.
+func (db *DB) ExportSpecs() ([]*database.Specs, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ids := make([]int64, 0, len(db.specs))
+	for id := range db.specs {
+		ids = append(ids, id)
+	}
+	specs := make([]*database.Specs, 0, len(ids))
+	for _, id := range sortIDs(ids) {
+		spec := *db.specs[id]
+		specs = append(specs, &spec)
+	}
+	return specs, nil
+}
+
+// Import saves users, results and specs at once, after checking that all
+// of them can be saved.
+func (db *DB) Import(users []*database.User, results []*database.Result, specs []*database.Specs) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names := make(map[string]bool, len(db.users)+len(users))
+	for _, u := range db.users {
+		names[u.Name] = true
+	}
+	userIDs := make(map[int64]int64, len(users))
+	for _, u := range users {
+		if names[u.Name] {
+			return fmt.Errorf("user %q %w", u.Name, database.ErrConflict)
+		}
+		names[u.Name], userIDs[u.ID] = true, 0
+	}
+	resultIDs := make(map[int64]int64, len(results))
+	for _, res := range results {
+		if _, ok := userIDs[res.UserID]; !ok {
+			return fmt.Errorf("%w result %d: it refers to a missing user", database.ErrInvalid, res.ID)
+		}
+		resultIDs[res.ID] = 0
+	}
+	normalized := make([]database.NormalizedSysInfo, len(specs))
+	for i, s := range specs {
+		if _, ok := resultIDs[s.ResultID]; !ok {
+			return fmt.Errorf("%w specs %d: it refers to a missing result", database.ErrInvalid, s.ID)
+		}
+		n, err := s.SysInfo.Normalize()
+		if err != nil {
+			return fmt.Errorf("%w specs %d: %v", database.ErrInvalid, s.ID, err)
+		}
+		normalized[i] = n
+	}
+
+	for _, u := range users {
+		id := db.nextID()
+		userIDs[u.ID], u.ID = id, id
+		stored := *u
+		db.users[id] = &stored
+	}
+	for _, res := range results {
+		id := db.nextID()
+		resultIDs[res.ID], res.ID, res.UserID = id, id, userIDs[res.UserID]
+		if res.CreatedAt.IsZero() {
+			res.CreatedAt = time.Now().UTC()
+		}
+		stored := *res
+		stored.Hidden = false
+		if res.Hidden {
+			db.hidden[id] = &stored
+		} else {
+			db.results[id] = &stored
+		}
+	}
+	for i, s := range specs {
+		s.ID, s.ResultID, s.Normalized = db.nextID(), resultIDs[s.ResultID], normalized[i]
+		stored := *s
+		db.specs[s.ID] = &stored
+	}
+	return nil
+}
+
+// Close is a no-op.
+func (db *DB) Close() error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Errors returned, possibly wrapped, by OSBDatabase implementations. Their
+// messages are safe to show to clients.
+var (
+	ErrNotFound = errors.New("not found")      // the requested row does not exist
+	ErrConflict = errors.New("already exists") // a unique value is already taken
+	ErrInvalid  = errors.New("invalid")        // the row refers to a missing row or has invalid values
+)
+
+// MySQL error numbers mapped to typed errors.
+const (
+	mysqlDuplicateEntry    = 1062 // ER_DUP_ENTRY
+	mysqlNoReferencedRow   = 1452 // ER_NO_REFERENCED_ROW_2
+	mysqlRowIsReferenced   = 1451 // ER_ROW_IS_REFERENCED_2
+	mysqlDataTooLong       = 1406 // ER_DATA_TOO_LONG
+	mysqlTruncatedWrongVal = 1366 // ER_TRUNCATED_WRONG_VALUE_FOR_FIELD
+)
+
+// notFound returns ErrNotFound wrapped with a description of the row if err
+// is sql.ErrNoRows, or err prefixed with op otherwise.
+func notFound(err error, op, row string) error {
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%s %w", row, ErrNotFound)
+	}
+	return fmt.Errorf("mysql: %s: %v", op, err)
+}
+
+// writeError maps MySQL constraint violations in err to typed errors
+// describing row, and prefixes other errors with op.
+func writeError(err error, op, row string) error {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		switch me.Number {
+		case mysqlDuplicateEntry:
+			return fmt.Errorf("%s %w", row, ErrConflict)
+		case mysqlNoReferencedRow:
+			return fmt.Errorf("%w %s: it refers to a missing row", ErrInvalid, row)
+		case mysqlRowIsReferenced:
+			return fmt.Errorf("%w %s: other rows refer to it", ErrConflict, row)
+		case mysqlDataTooLong, mysqlTruncatedWrongVal:
+			return fmt.Errorf("%w %s: a value is too long or has the wrong type", ErrInvalid, row)
+		}
+	}
+	return fmt.Errorf("mysql: %s: %v", op, err)
+}
@@ -0,0 +1,25 @@
+package database
+
+import "time"
+
+// StatsCache exposes the cache of statistics to tests.
+type StatsCache struct{ c *statsCache }
+
+// NewStatsCache returns an empty cache of statistics.
+func NewStatsCache(ttl time.Duration) StatsCache {
+	return StatsCache{newStatsCache(ttl)}
+}
+
+func (c StatsCache) Generation() uint64 { return c.c.generation() }
+func (c StatsCache) Invalidate()        { c.c.invalidate() }
+
+func (c StatsCache) Get(groupBy GroupBy, benchmark string) ([]*Stats, bool) {
+	return c.c.get(statsCacheKey(groupBy, benchmark))
+}
+
+func (c StatsCache) Put(gen uint64, groupBy GroupBy, benchmark string, stats []*Stats) {
+	c.c.put(gen, statsCacheKey(groupBy, benchmark), stats)
+}
+
+func (c StatsCache) GetSamples() ([]StatsSample, bool)            { return c.c.getSamples() }
+func (c StatsCache) PutSamples(gen uint64, samples []StatsSample) { c.c.putSamples(gen, samples) }
@@ -0,0 +1,213 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// NormalizedSysInfo holds typed values parsed from the free-form SysInfo
+// strings reported by the benchmark client. Zero values mean the
+// corresponding SysInfo field was empty.
+type NormalizedSysInfo struct {
+	Model            string `json:"model"`              // canonical CPU model name
+	ClockSpeedHz     int64  `json:"clock_hz"`           // CPU clock speed in Hz
+	Threads          int    `json:"threads"`            // number of CPU threads
+	Overclocked      bool   `json:"overclocked"`        // specifies if the CPU is overclocked
+	PhysicalMemBytes int64  `json:"physical_mem_bytes"` // physical memory in bytes
+	VirtualMemBytes  int64  `json:"virtual_mem_bytes"`  // virtual memory in bytes
+	SwapMemBytes     int64  `json:"swap_mem_bytes"`     // swap memory in bytes
+}
+
+// Normalize parses the free-form fields of s into typed values.
+func (s SysInfo) Normalize() (NormalizedSysInfo, error) {
+	var (
+		n   NormalizedSysInfo
+		err error
+	)
+	n.Model = CanonicalCPUModel(s.Model)
+	if n.ClockSpeedHz, err = ParseClockSpeed(s.ClockSpeed); err != nil {
+		return n, err
+	}
+	if n.Threads, err = ParseThreads(s.Threads); err != nil {
+		return n, err
+	}
+	n.Overclocked = s.Overclocked
+	if n.PhysicalMemBytes, err = ParseMemory(s.PhysicalMem); err != nil {
+		return n, err
+	}
+	if n.VirtualMemBytes, err = ParseMemory(s.VirtualMem); err != nil {
+		return n, err
+	}
+	if n.SwapMemBytes, err = ParseMemory(s.SwapMem); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// clockUnits maps clock speed units to their value in Hz.
+var clockUnits = map[string]float64{
+	"hz":  1,
+	"khz": 1e3,
+	"mhz": 1e6,
+	"ghz": 1e9,
+}
+
+// ParseClockSpeed parses a clock speed such as "2.20GHz" or "2200 MHz" into Hz.
+// A number without a unit is interpreted as MHz, as reported by /proc/cpuinfo.
+// An empty string parses as 0.
+func ParseClockSpeed(s string) (int64, error) {
+	num, unit, err := splitQuantity(s)
+	if err != nil || num == "" {
+		return 0, wrapParseErr("clock speed", s, err)
+	}
+	if unit == "" {
+		unit = "mhz"
+	}
+	mult, ok := clockUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("parse clock speed %q: unknown unit", s)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, wrapParseErr("clock speed", s, err)
+	}
+	return int64(f*mult + 0.5), nil
+}
+
+// ParseThreads parses a thread count such as "4". An empty string parses as 0.
+func ParseThreads(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("parse threads %q: not a thread count", s)
+	}
+	return n, nil
+}
+
+// memoryUnits maps memory units to their size in bytes. The client reports
+// memory in powers of 1024 regardless of the unit's spelling, so "Gb", "GB"
+// and "GiB" are all treated as gibibytes.
+var memoryUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// ParseMemory parses a memory size such as "15.513 Gb" into bytes.
+// A number without a unit is interpreted as bytes. An empty string parses as 0.
+func ParseMemory(s string) (int64, error) {
+	num, unit, err := splitQuantity(s)
+	if err != nil || num == "" {
+		return 0, wrapParseErr("memory", s, err)
+	}
+	mult, ok := memoryUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("parse memory %q: unknown unit", s)
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, wrapParseErr("memory", s, err)
+	}
+	return int64(f*mult + 0.5), nil
+}
+
+// ParseBool parses a boolean reported as a string, such as "false" or "yes".
+// An empty string parses as false.
+func ParseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "false", "no", "n", "off":
+		return false, nil
+	case "1", "true", "yes", "y", "on":
+		return true, nil
+	}
+	return false, fmt.Errorf("parse bool %q: not a boolean", s)
+}
+
+// splitQuantity splits a string such as "2.20GHz" into its number and
+// lowercased unit. Both are empty for a blank string.
+func splitQuantity(s string) (num, unit string, err error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		return s, "", nil
+	}
+	num, unit = s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	if num == "" {
+		return "", "", fmt.Errorf("missing number")
+	}
+	return num, unit, nil
+}
+
+func wrapParseErr(what, s string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("parse %s %q: %v", what, s, err)
+}
+
+// flexString decodes a JSON string or number into a string.
+type flexString string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case nil:
+		*f = ""
+	case string:
+		*f = flexString(val)
+	case float64:
+		*f = flexString(strconv.FormatFloat(val, 'f', -1, 64))
+	default:
+		return fmt.Errorf("could not unmarshal %v: unsupported type %T", v, v)
+	}
+	return nil
+}
+
+// flexBool decodes a JSON boolean or a string such as "false" into a bool.
+type flexBool bool
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *flexBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case nil:
+		*f = false
+	case bool:
+		*f = flexBool(val)
+	case string:
+		b, err := ParseBool(val)
+		if err != nil {
+			return err
+		}
+		*f = flexBool(b)
+	default:
+		return fmt.Errorf("could not unmarshal %v: unsupported type %T", v, v)
+	}
+	return nil
+}
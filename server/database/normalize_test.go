@@ -0,0 +1,142 @@
+package database_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+func TestNormalize(t *testing.T) {
+	tt := []struct {
+		Name    string
+		SysInfo database.SysInfo
+		Want    database.NormalizedSysInfo
+		WantErr bool
+	}{
+		{
+			Name: "Client format",
+			SysInfo: database.SysInfo{
+				ClockSpeed:  "2.20GHz",
+				Threads:     "4",
+				Overclocked: true,
+				PhysicalMem: "15.513 Gb",
+				VirtualMem:  "17.513 Gb",
+				SwapMem:     "1.9999 Gb",
+			},
+			Want: database.NormalizedSysInfo{
+				ClockSpeedHz:     2200000000,
+				Threads:          4,
+				Overclocked:      true,
+				PhysicalMemBytes: 16656956916,
+				VirtualMemBytes:  18804440564,
+				SwapMemBytes:     2147376274,
+			},
+		},
+		{
+			Name:    "Clock speed in MHz without unit",
+			SysInfo: database.SysInfo{ClockSpeed: "3600.000"},
+			Want:    database.NormalizedSysInfo{ClockSpeedHz: 3600000000},
+		},
+		{
+			Name:    "Clock speed with spaced unit",
+			SysInfo: database.SysInfo{ClockSpeed: " 800 MHz "},
+			Want:    database.NormalizedSysInfo{ClockSpeedHz: 800000000},
+		},
+		{
+			Name:    "Memory in bytes",
+			SysInfo: database.SysInfo{PhysicalMem: "1024"},
+			Want:    database.NormalizedSysInfo{PhysicalMemBytes: 1024},
+		},
+		{
+			Name: "Empty values",
+		},
+		{
+			Name:    "Unknown clock unit",
+			SysInfo: database.SysInfo{ClockSpeed: "2.2 furlongs"},
+			WantErr: true,
+		},
+		{
+			Name:    "Invalid threads",
+			SysInfo: database.SysInfo{Threads: "four"},
+			WantErr: true,
+		},
+		{
+			Name:    "Missing memory number",
+			SysInfo: database.SysInfo{SwapMem: "Gb"},
+			WantErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			got, err := tc.SysInfo.Normalize()
+			if tc.WantErr {
+				if err == nil {
+					t.Errorf("want non-nil error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.Want {
+				t.Errorf("got %+v, want %+v", got, tc.Want)
+			}
+		})
+	}
+}
+
+func TestSysInfoUnmarshalJSON(t *testing.T) {
+	tt := []struct {
+		Name string
+		JSON string
+		Want database.SysInfo
+	}{
+		{
+			Name: "String values",
+			JSON: `{"speed": "2.20GHz", "threads": "4", "overclocked": "false"}`,
+			Want: database.SysInfo{ClockSpeed: "2.20GHz", Threads: "4"},
+		},
+		{
+			Name: "Typed values",
+			JSON: `{"speed": 2200, "threads": 8, "overclocked": true}`,
+			Want: database.SysInfo{ClockSpeed: "2200", Threads: "8", Overclocked: true},
+		},
+		{
+			Name: "Client memory names",
+			JSON: `{"physical_mem": "15.513 Gb", "virtual_mem": "17.513 Gb", "swap_mem": "1.9999 Gb"}`,
+			Want: database.SysInfo{PhysicalMem: "15.513 Gb", VirtualMem: "17.513 Gb", SwapMem: "1.9999 Gb"},
+		},
+		{
+			Name: "Legacy memory names",
+			JSON: `{"physical": "15.513 Gb", "virtual": "17.513 Gb", "swap": "1.9999 Gb"}`,
+			Want: database.SysInfo{PhysicalMem: "15.513 Gb", VirtualMem: "17.513 Gb", SwapMem: "1.9999 Gb"},
+		},
+		{
+			Name: "String true",
+			JSON: `{"vendor": "GenuineIntel", "overclocked": "yes"}`,
+			Want: database.SysInfo{Vendor: "GenuineIntel", Overclocked: true},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var got database.SysInfo
+			if err := json.Unmarshal([]byte(tc.JSON), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.Want {
+				t.Errorf("got %+v, want %+v", got, tc.Want)
+			}
+		})
+	}
+
+	var specs database.Specs
+	if err := json.Unmarshal([]byte(`{"ID": 3, "ResultID": 4, "specs": {"threads": "2"}}`), &specs); err != nil {
+		t.Fatal(err)
+	}
+	if specs.ID != 3 || specs.ResultID != 4 || specs.Threads != "2" {
+		t.Errorf("Unmarshal specs: got %+v", specs)
+	}
+}
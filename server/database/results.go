@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,9 +14,41 @@ type ResultDatabase interface {
 	// ListResults returns a list of all results.
 	ListResults() ([]*Result, error)
 
-	// ListResultsCreatedBy returns a list of results created by a user with the given id.
+	// ListResultsAfter returns up to limit results with ids after the given
+	// one, ordered by id.
+	ListResultsAfter(after int64, limit int) ([]*Result, error)
+
+	// ListLatestResults returns up to limit visible results, newest first
+	// and by descending id among results created at the same time.
+	ListLatestResults(limit int) ([]*Result, error)
+
+	// ListLatestRecords returns up to limit of the latest records set by
+	// visible results, newest first and by benchmark within a result.
+	ListLatestRecords(limit int) ([]*Record, error)
+
+	// ListRankedResultsAfter returns up to limit visible results with a
+	// Total score that rank after a result with the given Total score and
+	// id, best first and by id among equal scores, as TotalRank ranks them.
+	// Pass math.MaxFloat64 and 0 for the first page.
+	ListRankedResultsAfter(score float64, id int64, limit int) ([]*Result, error)
+
+	// ListBenchmarks returns the names of the benchmarks scored by visible
+	// results, in order of the first result scoring each, then by name.
+	ListBenchmarks() ([]string, error)
+
+	// ListResultsCreatedBy returns a list of results created by a user with
+	// the given id, oldest first.
 	ListResultsCreatedBy(id int64) ([]*Result, error)
 
+	// ListResultsCreatedByAfter returns up to limit results created by a user
+	// with the given id, with ids after the given one, ordered by id.
+	ListResultsCreatedByAfter(id, after int64, limit int) ([]*Result, error)
+
+	// ListResultsCreatedByUsersAfter returns up to limit results of each of
+	// the users with the given ids, with ids after the given one, in one
+	// query ordered by id.
+	ListResultsCreatedByUsersAfter(ids []int64, after int64, limit int) ([]*Result, error)
+
 	// GetResult retrieves a result by its id.
 	GetResult(id int64) (*Result, error)
 
@@ -27,13 +60,20 @@ type ResultDatabase interface {
 
 	// UpdateResult updates a given result.
 	UpdateResult(res *Result) error
+
+	// HideResult hides the result with the given id, as moderation. Hidden
+	// results and their specs are left out of every listing and cannot be
+	// retrieved, except by exports.
+	HideResult(id int64) error
 }
 
 // Result holds the metadata about a result.
 type Result struct {
-	ID     int64
-	UserID int64
-	Scores `json:"scores"`
+	ID        int64
+	UserID    int64
+	Scores    `json:"scores"`
+	CreatedAt time.Time // time the result was submitted
+	Hidden    bool      `json:"-"` // hidden by a moderator, only set by ExportResults and read by Import
 }
 
 // Score holds the metadata for a benchmark algorithm run.
@@ -43,6 +83,17 @@ type Score struct {
 	Score float64  `json:"score"` // total score
 }
 
+// Record is a score that beat every earlier score of its benchmark when its
+// result was created, by creation time and then by result id.
+type Record struct {
+	ResultID  int64
+	UserID    int64
+	CreatedAt time.Time
+	Benchmark string
+	Score     float64
+	Previous  *Record // record beaten, with only ResultID, UserID and Score set, nil if none
+}
+
 // Scores implements driver.Valuer and sql.Scanner.
 type Scores []Score
 
@@ -53,22 +104,26 @@ func (s Scores) Value() (driver.Value, error) {
 
 // Scan scans a slice of scores from the database.
 func (s *Scores) Scan(value interface{}) error {
-	return json.Unmarshal(value.([]byte), *s)
+	return json.Unmarshal(value.([]byte), s)
 }
 
 // scanResult returns a result from a database row.
 func scanResult(s rowScanner) (*Result, error) {
 	var (
-		id     int64
-		userID int64
-		scores string
+		id        int64
+		userID    int64
+		scores    string
+		createdAt time.Time
+		hidden    bool
 	)
-	if err := s.Scan(&id, &userID, &scores); err != nil {
+	if err := s.Scan(&id, &userID, &scores, &createdAt, &hidden); err != nil {
 		return nil, err
 	}
 	result := &Result{
-		ID:     id,
-		UserID: userID,
+		ID:        id,
+		UserID:    userID,
+		CreatedAt: createdAt,
+		Hidden:    hidden,
 	}
 	err := json.NewDecoder(strings.NewReader(scores)).Decode(&result.Scores)
 	if err != nil {
@@ -105,6 +160,11 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 		}
 		d.Duration = duration
 	case string:
+		// Some clients send a number of nanoseconds as a string.
+		if ns, err := strconv.ParseFloat(val, 64); err == nil {
+			d.Duration = time.Duration(ns) * time.Nanosecond
+			break
+		}
 		parsed, err := time.ParseDuration(val)
 		if err != nil {
 			return err
@@ -1,13 +1,14 @@
 package database_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/mguid65/osb-website/server/database"
 )
 
-func testResultsDB(t *testing.T, db database.ResultDatabase) {
+func testResultsDB(t *testing.T, db database.OSBDatabase) {
 	result := &database.Result{
 		UserID: 2,
 		Scores: make(database.Scores, 0),
@@ -39,6 +40,102 @@ func testResultsDB(t *testing.T, db database.ResultDatabase) {
 		}
 	}
 
+	if page, err := db.ListResultsAfter(result.ID-1, 1); err != nil || len(page) != 1 || page[0].ID != result.ID {
+		t.Errorf("List results after: got %+v, %v, want result %d", page, err, result.ID)
+	}
+	if page, err := db.ListResultsCreatedByAfter(2, result.ID, 10); err != nil || len(page) != 0 {
+		t.Errorf("List results by user after the last: got %+v, %v, want none", page, err)
+	}
+
+	byUsers, err := db.ListResultsCreatedByUsersAfter([]int64{2, -1}, result.ID-1, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	var listed bool
+	for _, res := range byUsers {
+		listed = listed || res.ID == result.ID
+		if res.UserID != 2 {
+			t.Errorf("List results by users: got result %d of user %d", res.ID, res.UserID)
+		}
+	}
+	if !listed || len(byUsers) != 1 {
+		t.Errorf("List results by users: got %+v, want only result %d", byUsers, result.ID)
+	}
+
+	slower, err := db.AddResult(&database.Result{UserID: 2, Scores: database.Scores{{Name: "Total", Score: 500}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranks, err := db.ResultRanks(result.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(ranks) != 1 || ranks[0].All.Count < 2 || ranks[0].All.Percentile <= 50 {
+		t.Errorf("Rank result: got %+v, want it above the slower result", ranks)
+	}
+	rank, err := db.TotalRank(result.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if slowerRank, err := db.TotalRank(slower); err != nil || rank < 1 || slowerRank <= rank {
+		t.Errorf("Total rank: got %d for the slower result, %v, want it below %d", slowerRank, err, rank)
+	}
+	specsID, err := db.AddSpecs(&database.Specs{ResultID: slower, SysInfo: database.SysInfo{Threads: "8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page, err := db.ListRankedResultsAfter(1000, result.ID-1, 1); err != nil || len(page) != 1 || page[0].ID != result.ID {
+		t.Errorf("List ranked results after: got %+v, %v, want result %d", page, err, result.ID)
+	}
+	if page, err := db.ListSpecsAfter(specsID-1, 1); err != nil || len(page) != 1 || page[0].ID != specsID {
+		t.Errorf("List specs after: got %+v, %v, want specs %d", page, err, specsID)
+	}
+	benchmarks, err := db.ListBenchmarks()
+	var total bool
+	for _, name := range benchmarks {
+		total = total || name == "Total"
+	}
+	if err != nil || !total {
+		t.Errorf("List benchmarks: got %q, %v, want Total among them", benchmarks, err)
+	}
+	var record [2]int64
+	for i := range record {
+		if record[i], err = db.AddResult(&database.Result{UserID: 2, Scores: database.Scores{{Name: "Record", Score: float64(i + 1)}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if latest, err := db.ListLatestResults(1); err != nil || len(latest) != 1 || latest[0].ID != record[1] {
+		t.Errorf("List latest results: got %+v, %v, want result %d", latest, err, record[1])
+	}
+	recs, err := db.ListLatestRecords(1)
+	if err != nil || len(recs) != 1 || recs[0].ResultID != record[1] || recs[0].Benchmark != "Record" || recs[0].Score != 2 {
+		t.Fatalf("List latest records: got %+v, %v, want the Record score of result %d", recs, err, record[1])
+	}
+	if prev := recs[0].Previous; prev == nil || prev.ResultID != record[0] || prev.UserID != 2 || prev.Score != 1 {
+		t.Errorf("List latest records: got previous record %+v, want result %d", prev, record[0])
+	}
+	if err := db.HideResult(slower); err != nil {
+		t.Error(err)
+	}
+	if ranks, err := db.ResultRanks(slower); err != nil || ranks != nil {
+		t.Errorf("Rank hidden result: got %+v, %v, want nil", ranks, err)
+	}
+	if rank, err := db.TotalRank(slower); err != nil || rank != 0 {
+		t.Errorf("Total rank of hidden result: got %d, %v, want 0", rank, err)
+	}
+	if specs, err := db.ListSpecsWithResultIDs([]int64{result.ID, slower}); err != nil || len(specs) != 0 {
+		t.Errorf("List specs of hidden result: got %d specs, %v, want none", len(specs), err)
+	}
+	if _, err := db.GetSpecs(specsID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Get specs of hidden result: got %v, want ErrNotFound", err)
+	}
+	if err := db.DeleteSpecs(specsID); err != nil {
+		t.Error(err)
+	}
+	if err := db.DeleteResult(slower); err != nil {
+		t.Error(err)
+	}
+
 	if err := db.DeleteResult(result.ID); err != nil {
 		t.Error(err)
 	}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"strings"
@@ -8,13 +9,22 @@ import (
 
 // SpecsDatabase provides thread-safe access to a database of specs.
 type SpecsDatabase interface {
-	// ListSpecs returns a list of all specs.
+	// ListSpecs returns a list of the specs of all visible results.
 	ListSpecs() ([]*Specs, error)
 
-	// ListSpecsWithResultID returns a spec related to a result.
+	// ListSpecsAfter returns up to limit specs of visible results with ids
+	// after the given one, ordered by id.
+	ListSpecsAfter(after int64, limit int) ([]*Specs, error)
+
+	// ListSpecsWithResultID returns a spec related to a result, unless it is
+	// hidden.
 	ListSpecsWithResultID(id int64) ([]*Specs, error)
 
-	// GetSpecs retrieves specs by its id.
+	// ListSpecsWithResultIDs returns the specs related to any of the visible
+	// results with the given ids, in one query.
+	ListSpecsWithResultIDs(ids []int64) ([]*Specs, error)
+
+	// GetSpecs retrieves specs by its id, unless their result is hidden.
 	GetSpecs(id int64) (*Specs, error)
 
 	// AddSpecs saves the given specs.
@@ -23,28 +33,83 @@ type SpecsDatabase interface {
 	// DeleteSpecs deletes the specs with the given id.
 	DeleteSpecs(id int64) error
 
-	// UpdateSpecs updates the given specs.
+	// UpdateSpecs updates the given specs. Their Raw value, the specs as
+	// submitted, is left as it is.
 	UpdateSpecs(specs *Specs) error
 }
 
 // Specs represents the Specs MySQL table.
 type Specs struct {
-	ID       int64          // specs ID
-	ResultID int64          // connected result ID
-	SysInfo  `json:"specs"` // system information
+	ID         int64             // specs ID
+	ResultID   int64             // connected result ID
+	SysInfo    `json:"specs"`    // system information as reported by the client
+	Normalized NormalizedSysInfo `json:"normalized"` // typed values parsed from SysInfo
+	Raw        json.RawMessage   `json:"-"`          // specs object exactly as submitted, if known
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It is needed because Specs
+// would otherwise inherit the UnmarshalJSON method of the embedded SysInfo.
+func (s *Specs) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		ID         int64
+		ResultID   int64
+		SysInfo    SysInfo           `json:"specs"`
+		Normalized NormalizedSysInfo `json:"normalized"`
+	}{ID: s.ID, ResultID: s.ResultID, SysInfo: s.SysInfo, Normalized: s.Normalized}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	s.ID = aux.ID
+	s.ResultID = aux.ResultID
+	s.SysInfo = aux.SysInfo
+	s.Normalized = aux.Normalized
+	return nil
 }
 
 // SysInfo represents the `specs` JSON object stored in the Specs table.
 type SysInfo struct {
-	Vendor      string `json:"vendor"`       // CPU vendor
-	Model       string `json:"model"`        // CPU model
-	ClockSpeed  string `json:"speed"`        // CPU clock speed
-	Threads     string `json:"threads"`      // number of physical CPU cores
-	Overclocked bool   `json:"overclocked"`  // specifies if the CPU is overclocked
-	ByteOrder   string `json:"byte_order"`   // CPU byte order
-	PhysicalMem string `json:"physical"` // physical memory
-	VirtualMem  string `json:"virtual"`  // virtual memory
-	SwapMem     string `json:"swap"`     // swap memory
+	Vendor      string `json:"vendor"`      // CPU vendor
+	Model       string `json:"model"`       // CPU model
+	ClockSpeed  string `json:"speed"`       // CPU clock speed
+	Threads     string `json:"threads"`     // number of physical CPU cores
+	Overclocked bool   `json:"overclocked"` // specifies if the CPU is overclocked
+	ByteOrder   string `json:"byte_order"`  // CPU byte order
+	PhysicalMem string `json:"physical"`    // physical memory
+	VirtualMem  string `json:"virtual"`     // virtual memory
+	SwapMem     string `json:"swap"`        // swap memory
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It tolerates the client sending
+// numbers for the speed and thread count and a string for overclocked, and
+// accepts the memory fields under both the names used by the benchmark
+// client (physical_mem, virtual_mem, swap_mem) and the legacy names.
+func (s *SysInfo) UnmarshalJSON(data []byte) error {
+	type sysInfo SysInfo // prevent recursion
+	aux := struct {
+		*sysInfo
+		ClockSpeed  flexString `json:"speed"`
+		Threads     flexString `json:"threads"`
+		Overclocked flexBool   `json:"overclocked"`
+		PhysicalMem *string    `json:"physical_mem"`
+		VirtualMem  *string    `json:"virtual_mem"`
+		SwapMem     *string    `json:"swap_mem"`
+	}{sysInfo: (*sysInfo)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	s.ClockSpeed = string(aux.ClockSpeed)
+	s.Threads = string(aux.Threads)
+	s.Overclocked = bool(aux.Overclocked)
+	if aux.PhysicalMem != nil {
+		s.PhysicalMem = *aux.PhysicalMem
+	}
+	if aux.VirtualMem != nil {
+		s.VirtualMem = *aux.VirtualMem
+	}
+	if aux.SwapMem != nil {
+		s.SwapMem = *aux.SwapMem
+	}
+	return nil
 }
 
 // Value implements driver.Valuer.
@@ -54,22 +119,42 @@ func (s SysInfo) Value() (driver.Value, error) {
 
 // Scan implements sql.Scanner.
 func (s *SysInfo) Scan(value interface{}) error {
-	return json.Unmarshal(value.([]byte), *s)
+	return json.Unmarshal(value.([]byte), s)
 }
 
 // scanSpecs returns specs from a database row.
 func scanSpecs(s rowScanner) (*Specs, error) {
 	var (
-		id       int64
-		resultID int64
-		sysInfo  string
+		id          int64
+		resultID    int64
+		sysInfo     string
+		clockHz     sql.NullInt64
+		threads     sql.NullInt64
+		physicalMem sql.NullInt64
+		virtualMem  sql.NullInt64
+		swapMem     sql.NullInt64
+		overclocked sql.NullBool
+		cpuModel    sql.NullString
+		raw         sql.NullString
 	)
-	if err := s.Scan(&id, &resultID, &sysInfo); err != nil {
+	if err := s.Scan(&id, &resultID, &sysInfo, &clockHz, &threads, &physicalMem, &virtualMem, &swapMem, &overclocked, &cpuModel, &raw); err != nil {
 		return nil, err
 	}
 	specs := &Specs{
 		ID:       id,
 		ResultID: resultID,
+		Normalized: NormalizedSysInfo{
+			Model:            cpuModel.String,
+			ClockSpeedHz:     clockHz.Int64,
+			Threads:          int(threads.Int64),
+			Overclocked:      overclocked.Bool,
+			PhysicalMemBytes: physicalMem.Int64,
+			VirtualMemBytes:  virtualMem.Int64,
+			SwapMemBytes:     swapMem.Int64,
+		},
+	}
+	if raw.Valid {
+		specs.Raw = json.RawMessage(raw.String)
 	}
 	err := json.NewDecoder(strings.NewReader(sysInfo)).Decode(&specs.SysInfo)
 	if err != nil {
@@ -77,3 +162,13 @@ func scanSpecs(s rowScanner) (*Specs, error) {
 	}
 	return specs, nil
 }
+
+// nullString returns a NULL value for an empty string.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt64 returns a NULL value for zero, which the Normalized fields use for unknown.
+func nullInt64(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
@@ -19,6 +19,7 @@ func testSpecsDB(t *testing.T, db database.SpecsDatabase) {
 
 	specs.ID = id
 	specs.SysInfo.Vendor = "GenuineIntel"
+	specs.SysInfo.ClockSpeed = "2.20GHz"
 	if err := db.UpdateSpecs(specs); err != nil {
 		t.Error(err)
 	}
@@ -30,6 +31,9 @@ func testSpecsDB(t *testing.T, db database.SpecsDatabase) {
 	if got, want := gotSpecs.Vendor, specs.Vendor; got != want {
 		t.Errorf("Update specs: got %q, want %q", got, want)
 	}
+	if got, want := gotSpecs.Normalized.ClockSpeedHz, int64(2200000000); got != want {
+		t.Errorf("Normalized clock speed: got %d, want %d", got, want)
+	}
 
 	if err := db.DeleteSpecs(specs.ID); err != nil {
 		t.Error(err)
@@ -0,0 +1,407 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatsDatabase provides thread-safe access to aggregate statistics over results.
+type StatsDatabase interface {
+	// BenchmarkStats returns score statistics for a benchmark grouped by the
+	// given specs field. An empty benchmark returns statistics for every benchmark.
+	BenchmarkStats(groupBy GroupBy, benchmark string) ([]*Stats, error)
+
+	// ResultRanks returns the percentile ranks of each benchmark score of the
+	// result with the given id.
+	ResultRanks(resultID int64) ([]*BenchmarkRanks, error)
+
+	// TotalRank returns the leaderboard rank of the result with the given id,
+	// or 0 if it is hidden or has no Total score.
+	TotalRank(resultID int64) (int, error)
+}
+
+// GroupBy names the specs field results are grouped by.
+type GroupBy string
+
+// Supported GroupBy values.
+const (
+	GroupByModel   GroupBy = "model"   // canonical CPU model
+	GroupByVendor  GroupBy = "vendor"  // CPU vendor
+	GroupByThreads GroupBy = "threads" // number of CPU threads
+)
+
+// ParseGroupBy returns the GroupBy named by s.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(s); g {
+	case GroupByModel, GroupByVendor, GroupByThreads:
+		return g, nil
+	}
+	return "", fmt.Errorf("unsupported group_by %q: want model, vendor or threads", s)
+}
+
+// unknownGroup labels results whose specs lack the grouped field.
+const unknownGroup = "unknown"
+
+// Stats holds score statistics of a benchmark within a group of results.
+type Stats struct {
+	Group     string  `json:"group"`            // value of the grouped field
+	CPUID     int64   `json:"cpu_id,omitempty"` // catalog CPU of a model group, 0 if the model is not catalogued
+	Benchmark string  `json:"benchmark"`        // benchmark name
+	Count     int     `json:"count"`            // number of scores
+	Mean      float64 `json:"mean"`             // average score
+	Median    float64 `json:"median"`           // median score
+	P10       float64 `json:"p10"`              // 10th percentile score
+	P50       float64 `json:"p50"`              // 50th percentile score
+	P90       float64 `json:"p90"`              // 90th percentile score
+	StdDev    float64 `json:"stddev"`           // sample standard deviation
+}
+
+// Rank is a score's percentile rank among comparable results.
+type Rank struct {
+	Percentile float64 `json:"percentile"` // percentage of comparable scores below this one, counting ties as half
+	Count      int     `json:"count"`      // number of comparable scores, including this one
+}
+
+// BenchmarkRanks holds the ranks of a result's score for one benchmark.
+type BenchmarkRanks struct {
+	Benchmark string `json:"benchmark"` // benchmark name
+	All       Rank   `json:"all"`       // rank among all results
+	Model     *Rank  `json:"model"`     // rank among results with the same catalog CPU, or canonical CPU model if not catalogued, nil if unknown
+	Threads   *Rank  `json:"threads"`   // rank among results with the same thread count, nil if unknown
+}
+
+// StatsSample holds the scores of one result along with the specs it can be grouped by.
+type StatsSample struct {
+	ResultID int64  // result ID
+	CPUID    int64  // catalog CPU the specs resolve to, 0 if none
+	Model    string // model of the catalog CPU, or canonical CPU model if none
+	Vendor   string // CPU vendor
+	Threads  int    // number of CPU threads
+	Scores   Scores // benchmark scores
+}
+
+// group returns the value of the field s is grouped by.
+func (s StatsSample) group(groupBy GroupBy) string {
+	var g string
+	switch groupBy {
+	case GroupByModel:
+		g = s.Model
+	case GroupByVendor:
+		g = s.Vendor
+	case GroupByThreads:
+		if s.Threads > 0 {
+			g = strconv.Itoa(s.Threads)
+		}
+	}
+	if g == "" {
+		return unknownGroup
+	}
+	return g
+}
+
+// sameModel reports whether s and other resolve to the same catalog CPU or,
+// if neither is catalogued, have the same canonical CPU model.
+func (s StatsSample) sameModel(other *StatsSample) bool {
+	if s.CPUID != 0 || other.CPUID != 0 {
+		return s.CPUID == other.CPUID
+	}
+	return s.Model == other.Model
+}
+
+// ComputeStats computes score statistics for a benchmark over samples grouped
+// by the given field. Models are grouped by the catalog CPU they resolve to,
+// so aliases of a CPU share its group. An empty benchmark computes statistics
+// for every benchmark. The result is sorted by group and benchmark.
+func ComputeStats(samples []StatsSample, groupBy GroupBy, benchmark string) []*Stats {
+	type key struct {
+		group     string
+		cpuID     int64
+		benchmark string
+	}
+	scores := make(map[key][]float64)
+	for _, sample := range samples {
+		group := sample.group(groupBy)
+		var cpuID int64
+		if groupBy == GroupByModel {
+			cpuID = sample.CPUID
+		}
+		for _, score := range sample.Scores {
+			if benchmark != "" && score.Name != benchmark {
+				continue
+			}
+			k := key{group, cpuID, score.Name}
+			scores[k] = append(scores[k], score.Score)
+		}
+	}
+
+	stats := make([]*Stats, 0, len(scores))
+	for k, values := range scores {
+		sort.Float64s(values)
+		s := &Stats{
+			Group:     k.group,
+			CPUID:     k.cpuID,
+			Benchmark: k.benchmark,
+			Count:     len(values),
+			Mean:      mean(values),
+			Median:    percentile(values, 50),
+			P10:       percentile(values, 10),
+			P50:       percentile(values, 50),
+			P90:       percentile(values, 90),
+			StdDev:    stdDev(values),
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Group != stats[j].Group {
+			return stats[i].Group < stats[j].Group
+		}
+		if stats[i].CPUID != stats[j].CPUID {
+			return stats[i].CPUID < stats[j].CPUID
+		}
+		return stats[i].Benchmark < stats[j].Benchmark
+	})
+	return stats
+}
+
+// ComputeRanks computes the percentile ranks of each benchmark score of the
+// result with the given id among samples. It returns nil if samples does not
+// contain the result.
+func ComputeRanks(samples []StatsSample, resultID int64) []*BenchmarkRanks {
+	var target *StatsSample
+	for i := range samples {
+		if samples[i].ResultID == resultID {
+			target = &samples[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil
+	}
+
+	var ranks []*BenchmarkRanks
+	for _, score := range target.Scores {
+		var all, model, threads rankCounter
+		for _, sample := range samples {
+			for _, other := range sample.Scores {
+				if other.Name != score.Name {
+					continue
+				}
+				all.add(score.Score, other.Score)
+				if target.Model != "" && sample.sameModel(target) {
+					model.add(score.Score, other.Score)
+				}
+				if target.Threads > 0 && sample.Threads == target.Threads {
+					threads.add(score.Score, other.Score)
+				}
+			}
+		}
+
+		r := &BenchmarkRanks{Benchmark: score.Name, All: all.rank()}
+		if target.Model != "" {
+			rank := model.rank()
+			r.Model = &rank
+		}
+		if target.Threads > 0 {
+			rank := threads.rank()
+			r.Threads = &rank
+		}
+		ranks = append(ranks, r)
+	}
+	return ranks
+}
+
+// ComputeTotalRank returns the leaderboard rank of the result with the given
+// id among results, or 0 if results does not contain it or it has no Total
+// score. Results with the same Total score are ranked by ID, as the
+// leaderboard lists them.
+func ComputeTotalRank(results []*Result, id int64) int {
+	total := func(res *Result) (float64, bool) {
+		for _, score := range res.Scores {
+			if score.Name == "Total" {
+				return score.Score, true
+			}
+		}
+		return 0, false
+	}
+
+	var (
+		score float64
+		found bool
+	)
+	for _, res := range results {
+		if res.ID == id {
+			score, found = total(res)
+			break
+		}
+	}
+	if !found {
+		return 0
+	}
+
+	rank := 1
+	for _, res := range results {
+		if s, ok := total(res); ok && res.ID != id && (s > score || s == score && res.ID < id) {
+			rank++
+		}
+	}
+	return rank
+}
+
+// rankCounter counts the scores below and equal to a score.
+type rankCounter struct {
+	below, equal, total int
+}
+
+func (c *rankCounter) add(score, other float64) {
+	c.total++
+	switch {
+	case other < score:
+		c.below++
+	case other == score:
+		c.equal++
+	}
+}
+
+// rank returns the percentile rank counting ties as half, which gives a lone
+// score a percentile of 50.
+func (c *rankCounter) rank() Rank {
+	return Rank{
+		Percentile: (float64(c.below) + float64(c.equal)/2) / float64(c.total) * 100,
+		Count:      c.total,
+	}
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating
+// linearly between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// stdDev returns the sample standard deviation of values.
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	var sum float64
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+// statsCache caches stats samples and the statistics computed from them
+// until they expire or are invalidated by a write to results or specs.
+// Cached slices must not be modified.
+//
+// Each invalidation starts a new generation. Values computed from reads made
+// in an earlier generation may predate a write and are not cached, so the
+// generation must be taken before reading the values to cache.
+type statsCache struct {
+	mu             sync.Mutex
+	ttl            time.Duration
+	gen            uint64
+	samples        []StatsSample
+	samplesExpires time.Time
+	entries        map[string]statsCacheEntry
+}
+
+type statsCacheEntry struct {
+	stats   []*Stats
+	expires time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, entries: make(map[string]statsCacheEntry)}
+}
+
+func statsCacheKey(groupBy GroupBy, benchmark string) string {
+	return string(groupBy) + "\x00" + benchmark
+}
+
+// get returns the cached statistics for key if they have not expired.
+func (c *statsCache) get(key string) ([]*Stats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.stats, true
+}
+
+// generation returns the current generation of the cache.
+func (c *statsCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// put caches stats under key, unless they were computed in an earlier
+// generation than the current one.
+func (c *statsCache) put(gen uint64, key string, stats []*Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	c.entries[key] = statsCacheEntry{stats: stats, expires: time.Now().Add(c.ttl)}
+}
+
+// getSamples returns the cached samples if they have not expired.
+func (c *statsCache) getSamples() ([]StatsSample, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.samples == nil || time.Now().After(c.samplesExpires) {
+		return nil, false
+	}
+	return c.samples, true
+}
+
+// putSamples caches samples, unless they were read in an earlier generation
+// than the current one.
+func (c *statsCache) putSamples(gen uint64, samples []StatsSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	if samples == nil {
+		samples = []StatsSample{}
+	}
+	c.samples = samples
+	c.samplesExpires = time.Now().Add(c.ttl)
+}
+
+// invalidate drops all cached samples and statistics and starts a new
+// generation.
+func (c *statsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.samples = nil
+	c.entries = make(map[string]statsCacheEntry)
+}
@@ -0,0 +1,181 @@
+package database_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+func TestComputeStats(t *testing.T) {
+	sample := func(model, vendor string, threads int, scores ...float64) database.StatsSample {
+		s := database.StatsSample{Model: model, Vendor: vendor, Threads: threads}
+		for _, score := range scores {
+			s.Scores = append(s.Scores, database.Score{Name: "Mandelbrot", Score: score})
+		}
+		s.Scores = append(s.Scores, database.Score{Name: "Total", Score: 1})
+		return s
+	}
+	samples := []database.StatsSample{
+		sample("Intel Core i7-8750H", "GenuineIntel", 12, 10),
+		sample("Intel Core i7-8750H", "GenuineIntel", 12, 20),
+		sample("Intel Core i7-8750H", "GenuineIntel", 12, 30),
+		sample("Intel Core i7-8750H", "GenuineIntel", 12, 40),
+		sample("AMD Ryzen 7 2700X", "AuthenticAMD", 16, 100),
+		sample("", "", 0, 5),
+	}
+
+	got := database.ComputeStats(samples, database.GroupByModel, "Mandelbrot")
+	want := []*database.Stats{
+		{Group: "AMD Ryzen 7 2700X", Benchmark: "Mandelbrot", Count: 1, Mean: 100, Median: 100, P10: 100, P50: 100, P90: 100},
+		{Group: "Intel Core i7-8750H", Benchmark: "Mandelbrot", Count: 4, Mean: 25, Median: 25, P10: 13, P50: 25, P90: 37, StdDev: 12.909944487358056},
+		{Group: "unknown", Benchmark: "Mandelbrot", Count: 1, Mean: 5, Median: 5, P10: 5, P50: 5, P90: 5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := *got[i], *want[i]
+		if g.Group != w.Group || g.Benchmark != w.Benchmark || g.Count != w.Count ||
+			!approx(g.Mean, w.Mean) || !approx(g.Median, w.Median) || !approx(g.P10, w.P10) ||
+			!approx(g.P50, w.P50) || !approx(g.P90, w.P90) || !approx(g.StdDev, w.StdDev) {
+			t.Errorf("group %d: got %+v, want %+v", i, g, w)
+		}
+	}
+
+	got = database.ComputeStats(samples, database.GroupByThreads, "")
+	if len(got) != 6 {
+		t.Errorf("all benchmarks by threads: got %d stats, want 6", len(got))
+	}
+
+	catalogued := sample("Intel Core i7-8750H", "GenuineIntel", 12, 50)
+	catalogued.CPUID = 7
+	got = database.ComputeStats(append(samples, catalogued), database.GroupByModel, "Mandelbrot")
+	if len(got) != 4 {
+		t.Fatalf("catalogued model: got %d groups, want 4", len(got))
+	}
+	if g := *got[2]; g.Group != "Intel Core i7-8750H" || g.CPUID != 7 || g.Count != 1 {
+		t.Errorf("catalogued model: got %+v, want its own group of CPU 7", g)
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	for _, s := range []string{"model", "vendor", "threads"} {
+		if _, err := database.ParseGroupBy(s); err != nil {
+			t.Errorf("ParseGroupBy(%q): %v", s, err)
+		}
+	}
+	if _, err := database.ParseGroupBy("user"); err == nil {
+		t.Error("ParseGroupBy(\"user\"): want non-nil error")
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestComputeRanks(t *testing.T) {
+	sample := func(id int64, model string, threads int, total float64) database.StatsSample {
+		return database.StatsSample{
+			ResultID: id,
+			Model:    model,
+			Threads:  threads,
+			Scores:   database.Scores{{Name: "Total", Score: total}},
+		}
+	}
+	samples := []database.StatsSample{
+		sample(1, "Intel Core i7-8750H", 12, 100),
+		sample(2, "Intel Core i7-8750H", 12, 200),
+		sample(3, "Intel Core i7-8750H", 8, 300),
+		sample(4, "AMD Ryzen 7 2700X", 16, 400),
+		sample(5, "", 0, 200),
+	}
+
+	got := database.ComputeRanks(samples, 2)
+	if len(got) != 1 {
+		t.Fatalf("got %d benchmark ranks, want 1", len(got))
+	}
+	r := got[0]
+	if r.Benchmark != "Total" {
+		t.Errorf("benchmark: got %q, want %q", r.Benchmark, "Total")
+	}
+	if want := (database.Rank{Percentile: 40, Count: 5}); r.All != want {
+		t.Errorf("all: got %+v, want %+v", r.All, want)
+	}
+	if want := (database.Rank{Percentile: 50, Count: 3}); r.Model == nil || *r.Model != want {
+		t.Errorf("model: got %+v, want %+v", r.Model, want)
+	}
+	if want := (database.Rank{Percentile: 75, Count: 2}); r.Threads == nil || *r.Threads != want {
+		t.Errorf("threads: got %+v, want %+v", r.Threads, want)
+	}
+
+	unknown := database.ComputeRanks(samples, 5)
+	if len(unknown) != 1 || unknown[0].Model != nil || unknown[0].Threads != nil {
+		t.Errorf("unknown specs: want no model or thread ranks, got %+v", unknown[0])
+	}
+
+	samples[0].CPUID, samples[1].CPUID = 7, 7
+	catalogued := database.ComputeRanks(samples, 2)
+	if want := (database.Rank{Percentile: 75, Count: 2}); catalogued[0].Model == nil || *catalogued[0].Model != want {
+		t.Errorf("catalogued model: got %+v, want %+v", catalogued[0].Model, want)
+	}
+
+	if got := database.ComputeRanks(samples, 42); got != nil {
+		t.Errorf("missing result: got %+v, want nil", got)
+	}
+}
+
+func TestComputeTotalRank(t *testing.T) {
+	result := func(id int64, scores ...database.Score) *database.Result {
+		return &database.Result{ID: id, Scores: scores}
+	}
+	total := func(score float64) database.Score { return database.Score{Name: "Total", Score: score} }
+	results := []*database.Result{
+		result(1, total(200)),
+		result(2, total(300)),
+		result(3, total(200)),
+		result(4, database.Score{Name: "Primes", Score: 900}),
+	}
+
+	for id, want := range map[int64]int{1: 2, 2: 1, 3: 3, 4: 0, 42: 0} {
+		if got := database.ComputeTotalRank(results, id); got != want {
+			t.Errorf("result %d: got rank %d, want %d", id, got, want)
+		}
+	}
+}
+
+func TestStatsCacheInvalidation(t *testing.T) {
+	c := database.NewStatsCache(time.Minute)
+	stats := []*database.Stats{{Group: "unknown", Benchmark: "Total", Count: 1}}
+	samples := []database.StatsSample{{ResultID: 1}}
+
+	gen := c.Generation()
+	c.Put(gen, database.GroupByModel, "Total", stats)
+	c.PutSamples(gen, samples)
+	if _, ok := c.Get(database.GroupByModel, "Total"); !ok {
+		t.Error("stats were not cached")
+	}
+	if _, ok := c.GetSamples(); !ok {
+		t.Error("samples were not cached")
+	}
+
+	// A write invalidates the cache while statistics read before it are
+	// computed, so they must not be cached when done.
+	gen = c.Generation()
+	c.Invalidate()
+	c.Put(gen, database.GroupByModel, "Total", stats)
+	c.PutSamples(gen, samples)
+	if got, ok := c.Get(database.GroupByModel, "Total"); ok {
+		t.Errorf("stale stats were cached: %+v", got)
+	}
+	if got, ok := c.GetSamples(); ok {
+		t.Errorf("stale samples were cached: %+v", got)
+	}
+
+	gen = c.Generation()
+	c.Put(gen, database.GroupByModel, "Total", stats)
+	if _, ok := c.Get(database.GroupByModel, "Total"); !ok {
+		t.Error("stats computed after the write were not cached")
+	}
+}
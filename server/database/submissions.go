@@ -0,0 +1,84 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// SubmissionDatabase provides thread-safe access to a database of result submissions.
+type SubmissionDatabase interface {
+	// GetSubmissionByKey returns the submission a user made with the given
+	// idempotency key, or nil if there is none. Keys are unique per user and
+	// never expire.
+	GetSubmissionByKey(userID int64, key string) (*Submission, error)
+
+	// GetSubmissionByFingerprint returns the latest submission a user made with
+	// the given fingerprint after since, or nil if there is none.
+	GetSubmissionByFingerprint(userID int64, fingerprint string, since time.Time) (*Submission, error)
+
+	// AddSubmission saves a given submission.
+	AddSubmission(sub *Submission) (int64, error)
+
+	// AddSubmittedResult saves a submitted result, its specs and the
+	// submission in one transaction, so that none is saved unless all are.
+	// It sets the IDs of the three, and the result ID of specs and sub.
+	AddSubmittedResult(res *Result, specs *Specs, sub *Submission) error
+
+	// SetSubmissionResponse saves the response sent for the submission with
+	// the given ID, so that replays of it can be sent the same.
+	SetSubmissionResponse(id int64, response []byte) error
+}
+
+// Submission records a result submitted through the API.
+type Submission struct {
+	ID          int64     // submission ID
+	UserID      int64     // submitting user's ID
+	ResultID    int64     // created result ID
+	Key         string    // client supplied idempotency key, may be empty
+	Fingerprint string    // hash of the submitted scores and specs
+	CreatedAt   time.Time // time of submission
+	Response    []byte    // response sent for the submission, nil if not saved
+}
+
+// Fingerprint returns a hex encoded SHA-256 hash of the given scores and
+// system information. Identical submissions have identical fingerprints.
+func Fingerprint(scores Scores, sysInfo SysInfo) (string, error) {
+	b, err := json.Marshal(struct {
+		Scores  Scores  `json:"scores"`
+		SysInfo SysInfo `json:"specs"`
+	}{scores, sysInfo})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// scanSubmission returns a submission from a database row.
+func scanSubmission(s rowScanner) (*Submission, error) {
+	var (
+		id          int64
+		userID      int64
+		resultID    int64
+		key         sql.NullString
+		fingerprint string
+		createdAt   time.Time
+		response    []byte
+	)
+	if err := s.Scan(&id, &userID, &resultID, &key, &fingerprint, &createdAt, &response); err != nil {
+		return nil, err
+	}
+	sub := &Submission{
+		ID:          id,
+		UserID:      userID,
+		ResultID:    resultID,
+		Key:         key.String,
+		Fingerprint: fingerprint,
+		CreatedAt:   createdAt,
+		Response:    response,
+	}
+	return sub, nil
+}
@@ -0,0 +1,71 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+func testSubmissionDB(t *testing.T, db database.OSBDatabase) {
+	resultID, err := db.AddResult(&database.Result{UserID: 2, Scores: make(database.Scores, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint, err := database.Fingerprint(database.Scores{}, database.SysInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	sub := &database.Submission{
+		UserID:      2,
+		ResultID:    resultID,
+		Key:         "test-key",
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+	}
+	if sub.ID, err = db.AddSubmission(sub); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetSubmissionByKey(sub.UserID, sub.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ResultID != resultID {
+		t.Errorf("Get submission by key: got %+v, want result id %d", got, resultID)
+	}
+
+	got, err = db.GetSubmissionByFingerprint(sub.UserID, fingerprint, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ResultID != resultID {
+		t.Errorf("Get submission by fingerprint: got %+v, want result id %d", got, resultID)
+	}
+
+	got, err = db.GetSubmissionByFingerprint(sub.UserID, fingerprint, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("Get submission by fingerprint before since: got %+v, want nil", got)
+	}
+
+	if err := db.SetSubmissionResponse(sub.ID, []byte(`{"result_id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	got, err = db.GetSubmissionByKey(sub.UserID, sub.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || string(got.Response) != `{"result_id":1}` {
+		t.Errorf("Get submission response: got %+v", got)
+	}
+
+	if _, err := db.AddSubmission(sub); err == nil {
+		t.Error("want non-nil error for duplicate idempotency key")
+	}
+}
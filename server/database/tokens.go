@@ -0,0 +1,76 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// TokenDatabase provides thread-safe access to a database of API tokens.
+type TokenDatabase interface {
+	// ListTokens returns the tokens of the user with the given id, oldest first.
+	ListTokens(userID int64) ([]*Token, error)
+
+	// GetUserByToken returns the user owning the token with the given hash of
+	// its secret.
+	GetUserByToken(hash string) (*User, error)
+
+	// AddToken saves a given token.
+	AddToken(token *Token) (int64, error)
+
+	// DeleteToken deletes the token with the given id if it belongs to the
+	// user with the given id.
+	DeleteToken(userID, id int64) error
+}
+
+// Token is an API token a user authenticates with instead of a password. Only
+// the hash of its secret is stored.
+type Token struct {
+	ID        int64     // token ID
+	UserID    int64     // owning user's ID
+	Name      string    // user supplied description
+	Hash      string    // hex encoded SHA-256 hash of the secret
+	CreatedAt time.Time // time the token was created
+}
+
+// TokenPrefix starts every token secret, which tells them apart from passwords.
+const TokenPrefix = "osb_"
+
+// NewTokenSecret returns a random token secret and its hash.
+func NewTokenSecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = TokenPrefix + hex.EncodeToString(b)
+	return secret, HashTokenSecret(secret), nil
+}
+
+// HashTokenSecret returns the hash stored for a token secret.
+func HashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// scanToken returns a token from a database row.
+func scanToken(s rowScanner) (*Token, error) {
+	var (
+		id        int64
+		userID    int64
+		name      string
+		hash      string
+		createdAt time.Time
+	)
+	if err := s.Scan(&id, &userID, &name, &hash, &createdAt); err != nil {
+		return nil, err
+	}
+	token := &Token{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      hash,
+		CreatedAt: createdAt,
+	}
+	return token, nil
+}
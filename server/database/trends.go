@@ -0,0 +1,136 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MachineID returns an identifier for the machine described by specs. It is
+// derived from the CPU vendor, canonical model, thread count, clock speed and
+// physical memory rounded to the nearest GiB, so runs on the same hardware
+// share a machine ID even if their reported memory differs slightly.
+func MachineID(specs *Specs) string {
+	n, _ := specs.SysInfo.Normalize() // partially parsed values still identify the machine
+	gib := (n.PhysicalMemBytes + 1<<29) >> 30
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d\x00%d\x00%d",
+		strings.ToLower(strings.TrimSpace(specs.Vendor)), strings.ToLower(n.Model),
+		n.Threads, n.ClockSpeedHz, gib)
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// TrendOptions configures ComputeTrends.
+type TrendOptions struct {
+	Benchmark string  // benchmark name
+	Window    int     // number of runs in the rolling average, 0 disables it
+	Threshold float64 // percentage drop flagged as a regression, 0 disables detection
+}
+
+// Trend is the time series of a benchmark's scores on one machine.
+type Trend struct {
+	MachineID string        `json:"machine_id"` // empty for results without specs
+	Vendor    string        `json:"vendor"`     // CPU vendor
+	Model     string        `json:"model"`      // canonical CPU model
+	Threads   int           `json:"threads"`    // number of CPU threads
+	Points    []*TrendPoint `json:"points"`     // runs, oldest first
+}
+
+// TrendPoint is a single run within a trend.
+type TrendPoint struct {
+	ResultID       int64     `json:"result_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Score          float64   `json:"score"`
+	RollingAverage *float64  `json:"rolling_average,omitempty"` // average of this and up to Window-1 previous runs
+	ChangePercent  *float64  `json:"change_percent"`            // change relative to the previous runs, nil for the first run
+	Regression     bool      `json:"regression"`                // score dropped by at least Threshold percent
+}
+
+// ComputeTrends groups a user's results by machine and returns the time
+// series of the benchmark's scores on each machine. Results must be ordered
+// oldest first; specs maps result IDs to their specs. A run's change is
+// measured against the rolling average of the previous Window runs, or
+// against the previous run if Window is 0.
+func ComputeTrends(results []*Result, specs map[int64]*Specs, opts TrendOptions) []*Trend {
+	var trends []*Trend
+	byMachine := make(map[string]*Trend)
+	for _, res := range results {
+		score, ok := findScore(res.Scores, opts.Benchmark)
+		if !ok {
+			continue
+		}
+
+		var machineID string
+		s, hasSpecs := specs[res.ID]
+		if hasSpecs {
+			machineID = MachineID(s)
+		}
+		trend, ok := byMachine[machineID]
+		if !ok {
+			trend = &Trend{MachineID: machineID}
+			if hasSpecs {
+				n, _ := s.SysInfo.Normalize()
+				trend.Vendor, trend.Model, trend.Threads = s.Vendor, n.Model, n.Threads
+			}
+			byMachine[machineID] = trend
+			trends = append(trends, trend)
+		}
+		trend.Points = append(trend.Points, &TrendPoint{
+			ResultID:  res.ID,
+			CreatedAt: res.CreatedAt,
+			Score:     score.Score,
+		})
+	}
+
+	for _, trend := range trends {
+		for i, p := range trend.Points {
+			if opts.Window > 0 {
+				avg := averageScore(trend.Points[maxInt(0, i-opts.Window+1) : i+1])
+				p.RollingAverage = &avg
+			}
+			if i == 0 {
+				continue
+			}
+
+			ref := trend.Points[i-1].Score
+			if opts.Window > 0 {
+				ref = averageScore(trend.Points[maxInt(0, i-opts.Window):i])
+			}
+			if ref == 0 {
+				continue
+			}
+			change := (p.Score - ref) / ref * 100
+			p.ChangePercent = &change
+			p.Regression = opts.Threshold > 0 && change <= -opts.Threshold
+		}
+	}
+	return trends
+}
+
+// findScore returns the score of the named benchmark.
+func findScore(scores Scores, name string) (Score, bool) {
+	for _, s := range scores {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Score{}, false
+}
+
+func averageScore(points []*TrendPoint) float64 {
+	var sum float64
+	for _, p := range points {
+		sum += p.Score
+	}
+	return sum / float64(len(points))
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+func TestMachineID(t *testing.T) {
+	a := &database.Specs{SysInfo: database.SysInfo{
+		Vendor: "GenuineIntel", Model: "Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz",
+		Threads: "12", ClockSpeed: "2208", PhysicalMem: "15.51 GB",
+	}}
+	b := &database.Specs{SysInfo: database.SysInfo{
+		Vendor: "genuineintel", Model: "Intel Core i7-8750H",
+		Threads: "12", ClockSpeed: "2208 MHz", PhysicalMem: "15.6 GB",
+	}}
+	c := &database.Specs{SysInfo: database.SysInfo{
+		Vendor: "GenuineIntel", Model: "Intel Core i7-8750H",
+		Threads: "12", ClockSpeed: "2208", PhysicalMem: "32 GB",
+	}}
+
+	if idA, idB := database.MachineID(a), database.MachineID(b); idA != idB {
+		t.Errorf("same machine: got IDs %q and %q", idA, idB)
+	}
+	if database.MachineID(a) == database.MachineID(c) {
+		t.Error("different memory: got the same ID")
+	}
+}
+
+func TestComputeTrends(t *testing.T) {
+	start := time.Date(2018, time.November, 7, 0, 0, 0, 0, time.UTC)
+	var results []*database.Result
+	specs := make(map[int64]*database.Specs)
+	for i, run := range []struct {
+		model string
+		score float64
+	}{
+		{"Intel Core i7-8750H", 100},
+		{"AMD Ryzen 7 2700X", 300},
+		{"Intel Core i7-8750H", 100},
+		{"Intel Core i7-8750H", 70},
+	} {
+		id := int64(i + 1)
+		results = append(results, &database.Result{
+			ID:        id,
+			Scores:    database.Scores{{Name: "Total", Score: run.score}},
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+		})
+		specs[id] = &database.Specs{ResultID: id, SysInfo: database.SysInfo{Model: run.model, Threads: "12"}}
+	}
+	results = append(results, &database.Result{ID: 5, Scores: database.Scores{{Name: "Mandelbrot", Score: 1}}})
+
+	trends := database.ComputeTrends(results, specs, database.TrendOptions{Benchmark: "Total", Window: 2, Threshold: 10})
+	if len(trends) != 2 {
+		t.Fatalf("got %d machines, want 2", len(trends))
+	}
+	intel := trends[0]
+	if intel.Model != "Intel Core i7-8750H" || intel.Threads != 12 || len(intel.Points) != 3 {
+		t.Fatalf("got %+v, want 3 runs on the Intel Core i7-8750H", intel)
+	}
+
+	want := []struct {
+		avg        float64
+		change     float64
+		regression bool
+	}{
+		{100, 0, false},
+		{100, 0, false},
+		{85, -30, true},
+	}
+	for i, w := range want {
+		p := intel.Points[i]
+		if p.RollingAverage == nil || *p.RollingAverage != w.avg {
+			t.Errorf("point %d: rolling average: got %v, want %v", i, p.RollingAverage, w.avg)
+		}
+		if i == 0 {
+			if p.ChangePercent != nil {
+				t.Errorf("point 0: got change %v, want none", *p.ChangePercent)
+			}
+			continue
+		}
+		if p.ChangePercent == nil || *p.ChangePercent != w.change || p.Regression != w.regression {
+			t.Errorf("point %d: got change %v regression %t, want %v %t", i, p.ChangePercent, p.Regression, w.change, w.regression)
+		}
+	}
+}
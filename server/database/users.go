@@ -5,9 +5,21 @@ type UserDatabase interface {
 	// ListUsers returns a list of all users.
 	ListUsers() ([]*UserExternal, error)
 
+	// ListUsersAfter returns up to limit users with ids after the given one,
+	// ordered by id.
+	ListUsersAfter(after int64, limit int) ([]*UserExternal, error)
+
+	// ListUserAccounts returns all users including their email, password
+	// hash and admin flag, ordered by id.
+	ListUserAccounts() ([]*User, error)
+
 	// GetUser retrieves a user by its id.
 	GetUser(id int64) (*UserExternal, error)
 
+	// GetUsers retrieves the users with the given ids in one query, ordered
+	// by id. Ids of missing users are skipped.
+	GetUsers(ids []int64) ([]*UserExternal, error)
+
 	// GetUserByCredentials returns a user with the matching username and password.
 	GetUserByCredentials(user, pass string) (*User, error)
 
@@ -27,6 +39,7 @@ type User struct {
 	Name     string // user's username
 	Email    string // user's email
 	Password string // user's hashed password
+	Admin    bool   // user may manage the site
 }
 
 // UserExternal represents a public view of a user.
@@ -57,8 +70,9 @@ func scanUser(s rowScanner) (*User, error) {
 		name     string
 		email    string
 		password string
+		admin    bool
 	)
-	if err := s.Scan(&id, &name, &email, &password); err != nil {
+	if err := s.Scan(&id, &name, &email, &password, &admin); err != nil {
 		return nil, err
 	}
 	user := &User{
@@ -66,6 +80,7 @@ func scanUser(s rowScanner) (*User, error) {
 		Name:     name,
 		Email:    email,
 		Password: password,
+		Admin:    admin,
 	}
 	return user, nil
 }
@@ -1,6 +1,7 @@
 package database_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/mguid65/osb-website/server/database"
@@ -18,6 +19,10 @@ func testUserDB(t *testing.T, db database.UserDatabase) {
 		t.Fatal(err)
 	}
 
+	if _, err := db.AddUser(&database.User{Name: user.Name, Email: "other@test.com"}); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Add user with taken name: got error %v, want %v", err, database.ErrConflict)
+	}
+
 	user.ID = id
 	user.Name = "updated"
 	if err := db.UpdateUser(user); err != nil {
@@ -33,6 +38,17 @@ func testUserDB(t *testing.T, db database.UserDatabase) {
 		t.Errorf("Update user: got %q, want %q", got, want)
 	}
 
+	users, err := db.GetUsers([]int64{user.ID, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != user.Name {
+		t.Errorf("Get users: got %+v, want only %q", users, user.Name)
+	}
+	if page, err := db.ListUsersAfter(user.ID-1, 1); err != nil || len(page) != 1 || page[0].ID != user.ID {
+		t.Errorf("List users after: got %+v, %v, want user %d", page, err, user.ID)
+	}
+
 	gotUserCred, err := db.GetUserByCredentials(user.Name, user.Password)
 	if err != nil {
 		t.Fatal(err)
@@ -41,14 +57,31 @@ func testUserDB(t *testing.T, db database.UserDatabase) {
 		t.Errorf("Get user by credentials: got %d, want %d", got, want)
 	}
 
+	accounts, err := db.ListUserAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, u := range accounts {
+		if u.ID == user.ID {
+			found = true
+			if u.Email != user.Email || u.Password == "" {
+				t.Errorf("List user accounts: got %+v, want email and password hash", u)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("List user accounts: user %d missing", user.ID)
+	}
+
 	if err := db.DeleteUser(user.ID); err != nil {
 		t.Fatal(err)
 	}
 
-	if _, err := db.GetUser(user.ID); err == nil {
-		t.Fatal("want non-nil error")
+	if _, err := db.GetUser(user.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("Get deleted user: got error %v, want %v", err, database.ErrNotFound)
 	}
-	if _, err := db.GetUserByCredentials(user.Name, user.Password); err == nil {
-		t.Fatal("want non-nil error")
+	if _, err := db.GetUserByCredentials(user.Name, user.Password); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("Get deleted user by credentials: got error %v, want %v", err, database.ErrNotFound)
 	}
 }
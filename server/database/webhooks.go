@@ -0,0 +1,166 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// WebhookDatabase provides thread-safe access to a database of webhooks and
+// their deliveries.
+type WebhookDatabase interface {
+	// ListWebhooks returns the webhooks of the user with the given id, or of
+	// all users if it is 0, oldest first.
+	ListWebhooks(userID int64) ([]*Webhook, error)
+
+	// GetWebhook returns the webhook with the given id.
+	GetWebhook(id int64) (*Webhook, error)
+
+	// AddWebhook saves a given webhook.
+	AddWebhook(hook *Webhook) (int64, error)
+
+	// DeleteWebhook deletes the webhook with the given id and its deliveries.
+	DeleteWebhook(id int64) error
+
+	// ListDeliveries returns the latest deliveries of the webhook with the
+	// given id, newest first, at most limit of them.
+	ListDeliveries(webhookID int64, limit int) ([]*Delivery, error)
+
+	// ListDueDeliveries returns the pending deliveries whose next attempt is
+	// due at now, oldest first, at most limit of them.
+	ListDueDeliveries(now time.Time, limit int) ([]*Delivery, error)
+
+	// AddDelivery saves a given delivery.
+	AddDelivery(d *Delivery) (int64, error)
+
+	// UpdateDelivery saves the outcome of an attempt of the given delivery:
+	// its status, attempts, response code, error and attempt times.
+	UpdateDelivery(d *Delivery) error
+}
+
+// Webhook is a URL events are posted to. The secret is stored as is, since
+// it signs every delivery.
+type Webhook struct {
+	ID        int64     // webhook ID
+	UserID    int64     // owning user's ID
+	URL       string    // URL the events are posted to
+	Secret    string    // key of the HMAC-SHA256 signatures of the deliveries
+	Events    []string  // event types to deliver, all if empty
+	CreatedAt time.Time // time the webhook was created
+}
+
+// Wants reports whether events of the given type are delivered to h.
+func (h *Webhook) Wants(typ string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSecretPrefix starts every webhook secret.
+const WebhookSecretPrefix = "whsec_"
+
+// NewWebhookSecret returns a random webhook secret.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return WebhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// Delivery statuses.
+const (
+	DeliveryPending   = "pending"   // waiting for its next attempt
+	DeliveryDelivered = "delivered" // the receiver responded with a 2xx status
+	DeliveryFailed    = "failed"    // every attempt failed, given up
+)
+
+// Delivery is an event posted, or to be posted, to a webhook.
+type Delivery struct {
+	ID            int64     // delivery ID
+	WebhookID     int64     // ID of the webhook delivered to
+	EventType     string    // type of the delivered event
+	Payload       []byte    // JSON request body
+	Status        string    // one of the delivery statuses
+	Attempts      int       // number of attempts made
+	ResponseCode  int       // status code of the last response, 0 if there was none
+	Error         string    // why the last attempt failed, empty if it did not
+	CreatedAt     time.Time // time the delivery was queued
+	LastAttemptAt time.Time // time of the last attempt, zero if there was none
+	NextAttemptAt time.Time // time of the next attempt while pending
+}
+
+// scanWebhook returns a webhook from a database row.
+func scanWebhook(s rowScanner) (*Webhook, error) {
+	var (
+		id        int64
+		userID    int64
+		url       string
+		secret    string
+		events    string
+		createdAt time.Time
+	)
+	if err := s.Scan(&id, &userID, &url, &secret, &events, &createdAt); err != nil {
+		return nil, err
+	}
+	hook := &Webhook{
+		ID:        id,
+		UserID:    userID,
+		URL:       url,
+		Secret:    secret,
+		CreatedAt: createdAt,
+	}
+	if events != "" {
+		hook.Events = strings.Split(events, ",")
+	}
+	return hook, nil
+}
+
+// scanDelivery returns a delivery from a database row.
+func scanDelivery(s rowScanner) (*Delivery, error) {
+	var (
+		id            int64
+		webhookID     int64
+		eventType     string
+		payload       []byte
+		status        string
+		attempts      int
+		responseCode  int
+		errMsg        string
+		createdAt     time.Time
+		lastAttemptAt sql.NullTime
+		nextAttemptAt time.Time
+	)
+	err := s.Scan(&id, &webhookID, &eventType, &payload, &status, &attempts,
+		&responseCode, &errMsg, &createdAt, &lastAttemptAt, &nextAttemptAt)
+	if err != nil {
+		return nil, err
+	}
+	d := &Delivery{
+		ID:            id,
+		WebhookID:     webhookID,
+		EventType:     eventType,
+		Payload:       payload,
+		Status:        status,
+		Attempts:      attempts,
+		ResponseCode:  responseCode,
+		Error:         errMsg,
+		CreatedAt:     createdAt,
+		LastAttemptAt: lastAttemptAt.Time,
+		NextAttemptAt: nextAttemptAt,
+	}
+	return d, nil
+}
+
+// nullTime returns a NULL value for the zero time.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
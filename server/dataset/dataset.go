@@ -0,0 +1,301 @@
+// Package dataset produces anonymized open-data snapshots of all results and
+// specs and keeps them on disk according to a retention policy.
+//
+// A snapshot is a gzip compressed NDJSON file with one record per result,
+// described by a JSON manifest holding its record count and SHA-256 checksum.
+// Emails and result IDs are never included, and users appear only as keyed
+// hashes of their IDs, or not at all if no key is configured.
+package dataset
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Version is the snapshot format version.
+const Version = 1
+
+// idLayout formats snapshot IDs, which sort chronologically.
+const idLayout = "20060102T150405Z"
+
+// File name suffixes of snapshot data and manifests.
+const (
+	dataSuffix     = ".ndjson.gz"
+	manifestSuffix = ".manifest.json"
+)
+
+// Manifest describes a snapshot.
+type Manifest struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	File      string    `json:"file"`    // data file name
+	Records   int       `json:"records"` // number of results
+	Bytes     int64     `json:"bytes"`   // size of the data file
+	SHA256    string    `json:"sha256"`  // hex encoded checksum of the data file
+	Users     string    `json:"users"`   // "hashed" or "dropped"
+}
+
+// Record is a result in a snapshot. Records are numbered in the order they
+// are written rather than by result ID, so that they cannot be joined with
+// results served by the API.
+type Record struct {
+	Seq        int                         `json:"seq"`            // 1-based position of the record in the snapshot
+	User       string                      `json:"user,omitempty"` // keyed hash of the user ID, empty if users are dropped
+	CreatedAt  time.Time                   `json:"created_at"`
+	Scores     database.Scores             `json:"scores"`
+	SysInfo    *database.SysInfo           `json:"specs,omitempty"`
+	Normalized *database.NormalizedSysInfo `json:"normalized,omitempty"`
+}
+
+// Retention decides which snapshots are kept. The latest snapshot is always kept.
+type Retention struct {
+	Keep   int           // number of most recent snapshots to keep, 0 for no limit
+	MaxAge time.Duration // age after which snapshots are deleted, 0 for no limit
+}
+
+// Store creates snapshots in a directory and prunes them according to its
+// retention policy.
+type Store struct {
+	dir       string
+	userKey   []byte
+	retention Retention
+	now       func() time.Time
+
+	mu sync.Mutex // serializes snapshots and pruning
+}
+
+// NewStore returns a store keeping snapshots in dir, which is created if
+// needed. Users are hashed with userKey, or dropped if it is empty.
+func NewStore(dir string, userKey []byte, retention Retention) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+	return &Store{dir: dir, userKey: userKey, retention: retention, now: time.Now}, nil
+}
+
+// Create writes a new snapshot of db and prunes old snapshots.
+func (s *Store) Create(db database.OSBDatabase) (*Manifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	m := &Manifest{
+		ID:        now.Format(idLayout),
+		Version:   Version,
+		CreatedAt: now,
+		Users:     "dropped",
+	}
+	m.File = "osb-" + m.ID + dataSuffix
+	if len(s.userKey) > 0 {
+		m.Users = "hashed"
+	}
+
+	tmp, err := ioutil.TempFile(s.dir, ".snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, hash)}
+	m.Records, err = s.write(counter, db)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+	m.Bytes = counter.n
+	m.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, m.File)); err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.dir, "osb-"+m.ID+manifestSuffix), data, 0644); err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+
+	if err := s.prune(now); err != nil {
+		log.Printf("dataset: could not prune snapshots: %v", err)
+	}
+	return m, nil
+}
+
+// write writes the gzipped records of all results in db to w and returns
+// their number.
+func (s *Store) write(w io.Writer, db database.OSBDatabase) (int, error) {
+	results, err := db.ListResults()
+	if err != nil {
+		return 0, err
+	}
+	specs, err := db.ListSpecs()
+	if err != nil {
+		return 0, err
+	}
+	byResult := make(map[int64]*database.Specs, len(specs))
+	for _, sp := range specs {
+		byResult[sp.ResultID] = sp
+	}
+
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	for i, res := range results {
+		rec := Record{
+			Seq:       i + 1,
+			User:      s.hashUser(res.UserID),
+			CreatedAt: res.CreatedAt.UTC(),
+			Scores:    res.Scores,
+		}
+		if sp, ok := byResult[res.ID]; ok {
+			rec.SysInfo = &sp.SysInfo
+			rec.Normalized = &sp.Normalized
+		}
+		if err := enc.Encode(rec); err != nil {
+			return 0, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return 0, err
+	}
+	return len(results), nil
+}
+
+// hashUser returns the pseudonym of a user, or "" if users are dropped.
+func (s *Store) hashUser(id int64) string {
+	if len(s.userKey) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.userKey)
+	mac.Write([]byte(strconv.FormatInt(id, 10)))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// List returns the manifests of the stored snapshots, newest first.
+func (s *Store) List() ([]*Manifest, error) {
+	names, err := filepath.Glob(filepath.Join(s.dir, "osb-*"+manifestSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("dataset: %v", err)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	manifests := make([]*Manifest, 0, len(names))
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("dataset: %v", err)
+		}
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("dataset: decode %s: %v", filepath.Base(name), err)
+		}
+		manifests = append(manifests, &m)
+	}
+	return manifests, nil
+}
+
+// Get returns the manifest of the snapshot with the given id, or nil if there
+// is none.
+func (s *Store) Get(id string) (*Manifest, error) {
+	manifests, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range manifests {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// Latest returns the manifest of the newest snapshot, or nil if there is none.
+func (s *Store) Latest() (*Manifest, error) {
+	manifests, err := s.List()
+	if err != nil || len(manifests) == 0 {
+		return nil, err
+	}
+	return manifests[0], nil
+}
+
+// Open opens the data file of a snapshot.
+func (s *Store) Open(m *Manifest) (*os.File, error) {
+	return os.Open(filepath.Join(s.dir, m.File))
+}
+
+// prune deletes the snapshots that fall outside the retention policy.
+func (s *Store) prune(now time.Time) error {
+	manifests, err := s.List()
+	if err != nil {
+		return err
+	}
+	for i, m := range manifests {
+		if i == 0 {
+			continue
+		}
+		expired := s.retention.MaxAge > 0 && now.Sub(m.CreatedAt) > s.retention.MaxAge
+		if (s.retention.Keep > 0 && i >= s.retention.Keep) || expired {
+			base := filepath.Join(s.dir, strings.TrimSuffix(m.File, dataSuffix))
+			if err := os.Remove(base + manifestSuffix); err != nil {
+				return err
+			}
+			if err := os.Remove(base + dataSuffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run creates a snapshot of db immediately and then every interval until ctx
+// is done. Failures are logged.
+func (s *Store) Run(ctx context.Context, db database.OSBDatabase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if m, err := s.Create(db); err != nil {
+			log.Println(err)
+		} else {
+			log.Printf("created dataset snapshot %s with %d results", m.ID, m.Records)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,195 @@
+package dataset_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/dataset"
+)
+
+func newDB(t *testing.T) *dbtest.DB {
+	db := dbtest.New()
+	user, err := db.AddUser(&database.User{Name: "alice", Email: "alice@example.com", Password: dbtest.HashPassword("secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, score := range []float64{100, 200} {
+		id, err := db.AddResult(&database.Result{UserID: user, Scores: database.Scores{{Name: "Total", Score: score}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if score == 100 {
+			if _, err := db.AddSpecs(&database.Specs{ResultID: id, SysInfo: database.SysInfo{Model: "Intel Core i7-8750H", Threads: "12"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return db
+}
+
+// readRecords verifies the checksum of a snapshot and returns its raw records.
+func readRecords(t *testing.T, dir string, m *dataset.Manifest) []string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, m.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != m.SHA256 || int64(len(data)) != m.Bytes {
+		t.Errorf("got checksum %s of %d bytes, manifest says %s of %d", got, len(data), m.SHA256, m.Bytes)
+	}
+
+	gz, err := gzip.NewReader(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestCreate(t *testing.T) {
+	for _, key := range []string{"", "secret key"} {
+		dir, err := ioutil.TempDir("", "dataset")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		store, err := dataset.NewStore(dir, []byte(key), dataset.Retention{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := store.Create(newDB(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Records != 2 || m.Version != dataset.Version {
+			t.Errorf("got manifest %+v, want 2 records", m)
+		}
+
+		lines := readRecords(t, dir, m)
+		if len(lines) != 2 {
+			t.Fatalf("got %d records, want 2", len(lines))
+		}
+		for _, line := range lines {
+			if strings.Contains(line, "alice") {
+				t.Errorf("record contains user details: %s", line)
+			}
+		}
+
+		var rec dataset.Record
+		if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.SysInfo == nil || rec.Normalized == nil || rec.Normalized.Threads != 12 {
+			t.Errorf("got record %+v, want specs with 12 threads", rec)
+		}
+		if hashed := rec.User != ""; hashed != (key != "") || (key != "" && m.Users != "hashed") {
+			t.Errorf("key %q: got user %q in a snapshot with %s users", key, rec.User, m.Users)
+		}
+
+		latest, err := store.Latest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latest == nil || *latest != *m {
+			t.Errorf("latest: got %+v, want %+v", latest, m)
+		}
+	}
+}
+
+func TestRecordsOmitResultIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Results 2 and 3 remain after deleting result 1, so no seq matches a result ID.
+	db := newDB(t)
+	if err := db.DeleteResult(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddResult(&database.Result{UserID: 1, Scores: database.Scores{{Name: "Total", Score: 300}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := dataset.NewStore(dir, nil, dataset.Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := store.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, line := range readRecords(t, dir, m) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fields["result_id"]; ok {
+			t.Errorf("record contains a result ID: %s", line)
+		}
+		var rec dataset.Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Seq != i+1 {
+			t.Errorf("record %d: got seq %d, want %d", i, rec.Seq, i+1)
+		}
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dataset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := dataset.NewStore(dir, nil, dataset.Retention{Keep: 3, MaxAge: 72 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2018, time.November, 1, 0, 0, 0, 0, time.UTC)
+	dataset.SetNow(store, func() time.Time { return now })
+
+	db := newDB(t)
+	for i := 0; i < 5; i++ {
+		if _, err := store.Create(db); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(24 * time.Hour)
+	}
+	manifests, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifests) != 3 || manifests[0].ID != "20181105T000000Z" {
+		t.Fatalf("got %d snapshots, newest %+v; want the 3 newest", len(manifests), manifests[0])
+	}
+
+	// Only the latest snapshot survives a long gap.
+	now = now.Add(30 * 24 * time.Hour)
+	if _, err := store.Create(db); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Errorf("got files %v, want one snapshot and its manifest", files)
+	}
+}
@@ -0,0 +1,165 @@
+// Package events is an in-process publish/subscribe bus for changes to the
+// results, which the handlers stream to clients.
+//
+// Events are numbered in publishing order. A bus keeps the most recent ones in
+// a bounded replay buffer, so a client that reconnects with the ID of the last
+// event it saw receives the ones it missed. Subscribers that fall behind are
+// disconnected rather than slowing down publishers, and can resume the same
+// way.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	ResultCreated = "result.created" // a result was submitted
+	ResultHidden  = "result.hidden"  // a result was hidden by a moderator
+	RankChanged   = "rank.changed"   // the leaderboard order changed
+	RecordSet     = "record.set"     // a result took the top of the leaderboard
+)
+
+// Event is a published change.
+type Event struct {
+	ID   uint64      // sequence number, starting at 1
+	Type string      // one of the event types
+	Time time.Time   // time the event was published
+	Data interface{} // JSON encodable payload, which must not be modified after publishing
+}
+
+// Bus delivers published events to subscribers. The zero value is not
+// usable, use NewBus. A nil *Bus discards published events.
+type Bus struct {
+	mu     sync.Mutex
+	lastID uint64
+	replay []*Event // ring buffer of the latest events
+	next   int      // index in replay the next event is stored at
+	subs   map[*Subscription]struct{}
+}
+
+// NewBus returns a bus that keeps the given number of recent events for
+// subscribers resuming after a disconnect.
+func NewBus(replay int) *Bus {
+	if replay < 1 {
+		replay = 1
+	}
+	return &Bus{
+		replay: make([]*Event, 0, replay),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish publishes an event of the given type to all subscribers and
+// returns it. Subscribers whose buffers are full are disconnected.
+func (b *Bus) Publish(typ string, data interface{}) *Event {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := &Event{ID: b.lastID, Type: typ, Time: time.Now().UTC(), Data: data}
+	if len(b.replay) < cap(b.replay) {
+		b.replay = append(b.replay, e)
+	} else {
+		b.replay[b.next] = e
+	}
+	b.next = (b.next + 1) % cap(b.replay)
+
+	for s := range b.subs {
+		select {
+		case s.c <- e:
+		default:
+			s.lagged = true
+			b.remove(s)
+		}
+	}
+	return e
+}
+
+// buffered returns the events in the replay buffer, oldest first. The caller
+// must hold b.mu.
+func (b *Bus) buffered() []*Event {
+	if len(b.replay) < cap(b.replay) {
+		return b.replay
+	}
+	return append(append([]*Event(nil), b.replay[b.next:]...), b.replay[:b.next]...)
+}
+
+// Subscribe returns a subscription to the events published after the one
+// with the given ID, 0 for only new events. Buffered events following lastID
+// are delivered first. The subscription's channel holds up to buffer events
+// besides those; if it is full when an event is published, the subscriber is
+// disconnected.
+//
+// complete is false if events following lastID are no longer buffered, or
+// lastID is unknown because the bus was restarted. Then the subscriber
+// should assume it missed events.
+func (b *Bus) Subscribe(lastID uint64, buffer int) (s *Subscription, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []*Event
+	complete = true
+	if lastID > 0 {
+		buffered := b.buffered()
+		switch {
+		case lastID > b.lastID:
+			complete = false
+			missed = buffered
+		case len(buffered) > 0 && buffered[0].ID > lastID+1:
+			complete = false
+			missed = buffered
+		default:
+			for _, e := range buffered {
+				if e.ID > lastID {
+					missed = append(missed, e)
+				}
+			}
+		}
+	}
+
+	c := make(chan *Event, buffer+len(missed))
+	for _, e := range missed {
+		c <- e
+	}
+	s = &Subscription{C: c, c: c, bus: b}
+	b.subs[s] = struct{}{}
+	return s, complete
+}
+
+// remove ends the subscription s. The caller must hold b.mu.
+func (b *Bus) remove(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
+
+// Subscription receives published events.
+type Subscription struct {
+	// C delivers the events. It is closed when the subscription ends.
+	C <-chan *Event
+
+	c      chan *Event
+	bus    *Bus
+	lagged bool // guarded by bus.mu
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Lagged reports whether the subscription was ended because the subscriber
+// did not keep up with the published events.
+func (s *Subscription) Lagged() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.lagged
+}
@@ -0,0 +1,109 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/mguid65/osb-website/server/events"
+)
+
+// receive returns the IDs of the events buffered in s, and whether s is
+// still open.
+func receive(s *events.Subscription) ([]uint64, bool) {
+	var ids []uint64
+	for {
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				return ids, false
+			}
+			ids = append(ids, e.ID)
+		default:
+			return ids, true
+		}
+	}
+}
+
+func equal(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBus(t *testing.T) {
+	bus := events.NewBus(3)
+	s, complete := bus.Subscribe(0, 10)
+	if !complete {
+		t.Error("new subscription: incomplete")
+	}
+	for i := 0; i < 5; i++ {
+		bus.Publish(events.ResultCreated, i)
+	}
+	if ids, open := receive(s); !equal(ids, []uint64{1, 2, 3, 4, 5}) || !open {
+		t.Errorf("subscriber: want events [1 2 3 4 5], got %v, open %v", ids, open)
+	}
+	s.Close()
+	if _, open := receive(s); open {
+		t.Error("closed subscription is open")
+	}
+	s.Close()
+
+	tests := []struct {
+		lastID   uint64
+		want     []uint64
+		complete bool
+	}{
+		{lastID: 0, want: nil, complete: true},
+		{lastID: 3, want: []uint64{4, 5}, complete: true},
+		{lastID: 2, want: []uint64{3, 4, 5}, complete: true},
+		{lastID: 5, want: nil, complete: true},
+		{lastID: 1, want: []uint64{3, 4, 5}, complete: false},  // 2 was dropped
+		{lastID: 10, want: []uint64{3, 4, 5}, complete: false}, // from before a restart
+	}
+	for _, tt := range tests {
+		s, complete := bus.Subscribe(tt.lastID, 0)
+		ids, _ := receive(s)
+		if !equal(ids, tt.want) || complete != tt.complete {
+			t.Errorf("resume after %d: want %v, complete %v, got %v, complete %v", tt.lastID, tt.want, tt.complete, ids, complete)
+		}
+		s.Close()
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	bus := events.NewBus(10)
+	slow, _ := bus.Subscribe(0, 2)
+	fast, _ := bus.Subscribe(0, 10)
+	for i := 0; i < 3; i++ {
+		bus.Publish(events.RankChanged, i)
+	}
+
+	ids, open := receive(slow)
+	if !equal(ids, []uint64{1, 2}) || open {
+		t.Errorf("slow subscriber: want events [1 2] and closed, got %v, open %v", ids, open)
+	}
+	if !slow.Lagged() {
+		t.Error("slow subscriber did not lag")
+	}
+	if ids, open := receive(fast); !equal(ids, []uint64{1, 2, 3}) || !open || fast.Lagged() {
+		t.Errorf("fast subscriber: want events [1 2 3] and open, got %v, open %v", ids, open)
+	}
+
+	// The slow subscriber resumes where it was cut off.
+	resumed, complete := bus.Subscribe(2, 2)
+	if ids, _ := receive(resumed); !equal(ids, []uint64{3}) || !complete {
+		t.Errorf("resumed: want events [3], got %v, complete %v", ids, complete)
+	}
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *events.Bus
+	if e := bus.Publish(events.ResultHidden, nil); e != nil {
+		t.Errorf("nil bus published %+v", e)
+	}
+}
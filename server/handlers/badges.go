@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mguid65/osb-website/server/charts"
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// defaultBadgeLabel is the badge label when the label query parameter is absent.
+const defaultBadgeLabel = "OSB"
+
+// maxBadgeLabel is the number of characters of the label query parameter
+// shown on a badge; longer labels are cut.
+const maxBadgeLabel = 32
+
+// GetResultBadge returns an SVG badge with the total score of a result and
+// its leaderboard rank. The label, color and label_color query
+// parameters customize the badge.
+func GetResultBadge(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resultID, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		result, err := db.GetResult(resultID)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		badge, err := scoreBadge(db, result)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendBadge(w, r, badge)
+	}
+}
+
+// GetUserBestBadge returns an SVG badge with the best total score of a user
+// and its leaderboard rank. It accepts the same query parameters as
+// GetResultBadge.
+func GetUserBestBadge(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if _, err := db.GetUser(userID); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		results, err := db.ListResultsCreatedBy(userID)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		var best *database.Result
+		var bestScore float64
+		for _, res := range results {
+			for _, score := range res.Scores {
+				if score.Name == "Total" && (best == nil || score.Score > bestScore) {
+					best, bestScore = res, score.Score
+				}
+			}
+		}
+
+		badge := charts.Badge{Message: "no results", Color: "lightgrey"}
+		if best != nil {
+			if badge, err = scoreBadge(db, best); err != nil {
+				sendError(w, r, err)
+				return
+			}
+		}
+		sendBadge(w, r, badge)
+	}
+}
+
+// scoreBadge returns a badge with the total score of result and its
+// leaderboard rank among all results with a total score, colored by the
+// share of results ranked above it.
+func scoreBadge(db database.StatsDatabase, result *database.Result) (charts.Badge, error) {
+	var total *database.Score
+	for i := range result.Scores {
+		if result.Scores[i].Name == "Total" {
+			total = &result.Scores[i]
+		}
+	}
+	if total == nil {
+		return charts.Badge{Message: "no score", Color: "lightgrey"}, nil
+	}
+
+	message := strconv.FormatFloat(math.Round(total.Score*100)/100, 'f', -1, 64)
+	rank, err := db.TotalRank(result.ID)
+	if err != nil {
+		return charts.Badge{}, err
+	}
+	if rank == 0 {
+		return charts.Badge{Message: message}, nil
+	}
+	ranks, err := db.ResultRanks(result.ID)
+	if err != nil {
+		return charts.Badge{}, err
+	}
+	for _, r := range ranks {
+		if r.Benchmark != "Total" {
+			continue
+		}
+		top := math.Ceil(100 * float64(rank) / float64(r.All.Count))
+		return charts.Badge{
+			Message: message + " | #" + strconv.Itoa(rank) + " of " + strconv.Itoa(r.All.Count),
+			Color:   rankColor(top),
+		}, nil
+	}
+	return charts.Badge{Message: message + " | #" + strconv.Itoa(rank)}, nil
+}
+
+// rankColor returns the badge color for a score in the top percentage of results.
+func rankColor(top float64) string {
+	switch {
+	case top <= 10:
+		return "brightgreen"
+	case top <= 25:
+		return "green"
+	case top <= 50:
+		return "yellowgreen"
+	case top <= 75:
+		return "yellow"
+	}
+	return "orange"
+}
+
+// sendBadge applies the label, color and label_color query parameters to
+// badge and writes it as an SVG image with an ETag, answering conditional
+// requests for an unchanged badge with 304 Not Modified.
+func sendBadge(w http.ResponseWriter, r *http.Request, badge charts.Badge) {
+	query := r.URL.Query()
+	badge.Label = defaultBadgeLabel
+	if label, ok := query["label"]; ok {
+		badge.Label = label[0]
+		if runes := []rune(badge.Label); len(runes) > maxBadgeLabel {
+			badge.Label = string(runes[:maxBadgeLabel])
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *string
+	}{{"color", &badge.Color}, {"label_color", &badge.LabelColor}} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		if _, err := charts.ParseColor(s); err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, p.name+": "+err.Error())
+			return
+		}
+		*p.dst = s
+	}
+
+	var buf bytes.Buffer
+	if err := charts.RenderBadge(&buf, badge); err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("Cache-Control", chartCacheControl)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	sendSVG(w, buf.Bytes())
+}
+
+// etagMatches reports whether an If-None-Match header matches etag.
+func etagMatches(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestBadges(t *testing.T) {
+	f := catalogFixture()
+	for _, score := range []float64{100, 300, 200} {
+		f.Results = append(f.Results, fixtureResult{UserID: 2, Scores: database.Scores{{Name: "Total", Score: score}}})
+	}
+	h := handlers.Handler(newFixtureDB(t, f))
+	const best = "10" // after the catalog fixture's users, results and specs
+
+	tt := []struct {
+		Name       string
+		Path       string
+		StatusCode int
+		Contains   string
+	}{
+		{Name: "Result", Path: "/badge/result/" + best + ".svg", StatusCode: http.StatusOK, Contains: "OSB: 300 | #1 of 3"},
+		{Name: "User best", Path: "/badge/user/2/best.svg", StatusCode: http.StatusOK, Contains: "OSB: 300 | #1 of 3"},
+		{Name: "User without results", Path: "/badge/user/1/best.svg", StatusCode: http.StatusOK, Contains: "no results"},
+		{Name: "Custom label", Path: "/badge/user/2/best.svg?label=my+laptop&color=ff8800", StatusCode: http.StatusOK, Contains: `my laptop: 300`},
+		{Name: "Third result", Path: "/badge/result/11.svg", StatusCode: http.StatusOK, Contains: "OSB: 200 | #2 of 3"},
+		{Name: "Long label", Path: "/badge/user/2/best.svg?label=" + strings.Repeat("a", 100), StatusCode: http.StatusOK, Contains: strings.Repeat("a", 32) + ": 300"},
+		{Name: "Invalid color", Path: "/badge/user/2/best.svg?label_color=nope", StatusCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tc.Path, nil))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d: %s", want, got, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tc.Contains) {
+				t.Errorf("badge does not contain %q:\n%s", tc.Contains, rec.Body)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/badge/user/2/best.svg", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag header")
+	}
+	req := httptest.NewRequest("GET", "/badge/user/2/best.svg", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("conditional request: got status %d with %d bytes, want %d and no body", rec.Code, rec.Body.Len(), http.StatusNotModified)
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mguid65/osb-website/server/charts"
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// Chart limits.
+const (
+	defaultHistogramBins = 20
+	maxHistogramBins     = 100
+	maxChartSize         = 2000 // maximum width or height in pixels
+)
+
+// chartCacheControl lets browsers and proxies cache rendered charts.
+const chartCacheControl = "public, max-age=300"
+
+// GetHistogramChart returns an SVG histogram of the scores of a benchmark
+// across all results. The benchmark query parameter defaults to Total and
+// bins to 20.
+func GetHistogramChart(db database.ResultDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := chartOptions(r)
+		if err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		benchmark := chartBenchmark(r)
+
+		bins := defaultHistogramBins
+		if s := r.URL.Query().Get("bins"); s != "" {
+			if bins, err = strconv.Atoi(s); err != nil || bins < 1 || bins > maxHistogramBins {
+				sendErrorStatus(w, r, http.StatusBadRequest, fmt.Sprintf("bins: want 1 to %d", maxHistogramBins))
+				return
+			}
+		}
+
+		results, err := db.ListResults()
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		var values []float64
+		for _, res := range results {
+			for _, score := range res.Scores {
+				if score.Name == benchmark {
+					values = append(values, score.Score)
+				}
+			}
+		}
+
+		if opts.Title == "" {
+			opts.Title = benchmark + " score distribution"
+		}
+		opts.XLabel, opts.YLabel = "Score", "Results"
+		var buf bytes.Buffer
+		if err := charts.Histogram(&buf, values, bins, opts); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendSVG(w, buf.Bytes())
+	}
+}
+
+// GetCompareChart returns an SVG bar chart of a benchmark's scores for the
+// results listed in the ids query parameter. The benchmark query parameter
+// defaults to Total.
+func GetCompareChart(db database.ResultDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := chartOptions(r)
+		if err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		benchmark := chartBenchmark(r)
+
+		ids, err := parseIDList(r.URL.Query().Get("ids"))
+		if err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(ids) == 0 || len(ids) > maxCompareResults {
+			sendErrorStatus(w, r, http.StatusBadRequest, fmt.Sprintf("ids: want 1 to %d result ids", maxCompareResults))
+			return
+		}
+
+		var bars []charts.Bar
+		for _, id := range ids {
+			res, err := db.GetResult(id)
+			if err != nil {
+				sendError(w, r, err)
+				return
+			}
+			for _, score := range res.Scores {
+				if score.Name == benchmark {
+					bars = append(bars, charts.Bar{Label: "#" + strconv.FormatInt(id, 10), Value: score.Score})
+					break
+				}
+			}
+		}
+
+		if opts.Title == "" {
+			opts.Title = benchmark + " scores"
+		}
+		opts.XLabel, opts.YLabel = "Result", "Score"
+		var buf bytes.Buffer
+		if err := charts.BarChart(&buf, bars, opts); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendSVG(w, buf.Bytes())
+	}
+}
+
+// GetTrendChart returns an SVG line chart of a user's scores for a benchmark
+// over time, with one line per machine. The benchmark query parameter
+// defaults to Total.
+func GetTrendChart(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		opts, err := chartOptions(r)
+		if err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		benchmark := chartBenchmark(r)
+
+		user, err := db.GetUser(userID)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		trends, err := userTrends(db, userID, database.TrendOptions{Benchmark: benchmark})
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		series := make([]charts.Series, len(trends))
+		for i, trend := range trends {
+			series[i].Name = trend.Model
+			if series[i].Name == "" {
+				series[i].Name = "Unknown machine"
+			}
+			for _, p := range trend.Points {
+				series[i].Points = append(series[i].Points, charts.Point{Time: p.CreatedAt, Value: p.Score})
+			}
+		}
+
+		if opts.Title == "" {
+			opts.Title = user.Name + " " + benchmark + " scores"
+		}
+		opts.XLabel, opts.YLabel = "Date", "Score"
+		var buf bytes.Buffer
+		if err := charts.LineChart(&buf, series, opts); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendSVG(w, buf.Bytes())
+	}
+}
+
+// chartBenchmark returns the benchmark query parameter, defaulting to Total.
+func chartBenchmark(r *http.Request) string {
+	if b := r.URL.Query().Get("benchmark"); b != "" {
+		return b
+	}
+	return "Total"
+}
+
+// chartOptions parses the title, width and height query parameters.
+func chartOptions(r *http.Request) (charts.Options, error) {
+	query := r.URL.Query()
+	opts := charts.Options{Title: query.Get("title")}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"width", &opts.Width}, {"height", &opts.Height}} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 100 || n > maxChartSize {
+			return opts, fmt.Errorf("%s: want 100 to %d pixels", p.name, maxChartSize)
+		}
+		*p.dst = n
+	}
+	return opts, nil
+}
+
+// sendSVG writes a cacheable SVG image.
+func sendSVG(w http.ResponseWriter, svg []byte) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", chartCacheControl)
+	w.Write(svg)
+}
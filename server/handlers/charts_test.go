@@ -0,0 +1,52 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestCharts(t *testing.T) {
+	f := catalogFixture()
+	for _, score := range []float64{100, 150, 90} {
+		f.Results = append(f.Results, fixtureResult{UserID: 2, Scores: database.Scores{{Name: "Total", Score: score}}})
+	}
+	h := handlers.Handler(newFixtureDB(t, f))
+	ids := "9,10,11" // after the catalog fixture's users, results and specs
+
+	tt := []struct {
+		Name       string
+		Path       string
+		StatusCode int
+	}{
+		{Name: "Histogram", Path: "/api/charts/histogram?bins=5", StatusCode: http.StatusOK},
+		{Name: "Histogram sized", Path: "/api/charts/histogram?width=800&height=400", StatusCode: http.StatusOK},
+		{Name: "Invalid bins", Path: "/api/charts/histogram?bins=0", StatusCode: http.StatusBadRequest},
+		{Name: "Invalid width", Path: "/api/charts/histogram?width=99999", StatusCode: http.StatusBadRequest},
+		{Name: "Compare", Path: "/api/charts/compare?ids=" + ids, StatusCode: http.StatusOK},
+		{Name: "Compare without ids", Path: "/api/charts/compare", StatusCode: http.StatusBadRequest},
+		{Name: "Trend", Path: "/api/charts/users/2/trend", StatusCode: http.StatusOK},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tc.Path, nil))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d: %s", want, got, rec.Body)
+			}
+			if tc.StatusCode != http.StatusOK {
+				return
+			}
+			if got, want := rec.Header().Get("Content-Type"), "image/svg+xml"; got != want {
+				t.Errorf("content type: want %q, got %q", want, got)
+			}
+			if rec.Header().Get("Cache-Control") == "" {
+				t.Error("missing Cache-Control header")
+			}
+		})
+	}
+}
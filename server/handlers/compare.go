@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// maxCompareResults limits how many results can be compared at once.
+const maxCompareResults = 10
+
+// comparison is the response of CompareResults.
+type comparison struct {
+	Baseline   int64                  `json:"baseline"`   // baseline result ID
+	Results    []*comparedResult      `json:"results"`    // compared results in request order
+	Benchmarks []*benchmarkComparison `json:"benchmarks"` // benchmarks in order of first appearance
+}
+
+// comparedResult describes one of the compared results.
+type comparedResult struct {
+	ID      int64             `json:"id"`
+	UserID  int64             `json:"user_id"`
+	SysInfo *database.SysInfo `json:"specs"` // nil if the result has no specs
+}
+
+// benchmarkComparison aligns the scores of one benchmark across results.
+type benchmarkComparison struct {
+	Name   string           `json:"name"`
+	Scores []*comparedScore `json:"scores"` // aligned with comparison.Results, nil where missing
+}
+
+// comparedScore is a benchmark score relative to the baseline's score.
+type comparedScore struct {
+	Score        float64           `json:"score"`
+	Time         database.Duration `json:"time"`
+	Delta        *float64          `json:"delta"`         // nil if the baseline lacks the benchmark
+	DeltaPercent *float64          `json:"delta_percent"` // nil if the baseline lacks the benchmark or scored 0
+}
+
+// CompareResults returns the results listed in the ids query parameter
+// aligned by benchmark, with deltas against the baseline result. The baseline
+// query parameter defaults to the first id.
+func CompareResults(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cmp, err := queryComparison(db, r)
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			sendErrorStatus(w, r, rejected.status, rejected.msg)
+			return
+		}
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := sendJSONResponse(w, cmp); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// queryComparison returns the comparison requested by the ids and baseline
+// query parameters. Invalid parameters are rejected with a *rejectedError.
+func queryComparison(db database.OSBDatabase, r *http.Request) (*comparison, error) {
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil {
+		return nil, &rejectedError{http.StatusBadRequest, err.Error()}
+	}
+	if len(ids) == 0 || len(ids) > maxCompareResults {
+		return nil, &rejectedError{http.StatusBadRequest, fmt.Sprintf("ids: want 1 to %d result ids", maxCompareResults)}
+	}
+
+	baseline := ids[0]
+	if b := r.URL.Query().Get("baseline"); b != "" {
+		if baseline, err = strconv.ParseInt(b, 10, 64); err != nil {
+			return nil, &rejectedError{http.StatusBadRequest, "baseline: " + err.Error()}
+		}
+	}
+
+	results := make([]*database.Result, len(ids))
+	baselineIndex := -1
+	for i, id := range ids {
+		if results[i], err = db.GetResult(id); err != nil {
+			return nil, err
+		}
+		if id == baseline {
+			baselineIndex = i
+		}
+	}
+	if baselineIndex < 0 {
+		return nil, &rejectedError{http.StatusBadRequest, "baseline must be one of ids"}
+	}
+
+	cmp := compareResults(results, baselineIndex)
+	specs, err := specsOfResults(db, results)
+	if err != nil {
+		return nil, err
+	}
+	for i, res := range results {
+		if s, ok := specs[res.ID]; ok {
+			cmp.Results[i].SysInfo = &s.SysInfo
+		}
+	}
+	return cmp, nil
+}
+
+// compareResults aligns the scores of results by benchmark name.
+func compareResults(results []*database.Result, baselineIndex int) *comparison {
+	cmp := &comparison{Baseline: results[baselineIndex].ID}
+
+	byName := make(map[string]*benchmarkComparison)
+	for i, res := range results {
+		cmp.Results = append(cmp.Results, &comparedResult{ID: res.ID, UserID: res.UserID})
+		for _, score := range res.Scores {
+			b, ok := byName[score.Name]
+			if !ok {
+				b = &benchmarkComparison{Name: score.Name, Scores: make([]*comparedScore, len(results))}
+				byName[score.Name] = b
+				cmp.Benchmarks = append(cmp.Benchmarks, b)
+			}
+			b.Scores[i] = &comparedScore{Score: score.Score, Time: score.Time}
+		}
+	}
+
+	for _, b := range cmp.Benchmarks {
+		base := b.Scores[baselineIndex]
+		if base == nil {
+			continue
+		}
+		for _, s := range b.Scores {
+			if s == nil {
+				continue
+			}
+			delta := s.Score - base.Score
+			s.Delta = &delta
+			if base.Score != 0 {
+				pct := delta / base.Score * 100
+				s.DeltaPercent = &pct
+			}
+		}
+	}
+	return cmp
+}
+
+// parseIDList parses a comma separated list of ids, dropping duplicates.
+func parseIDList(s string) ([]int64, error) {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ids: %q is not a result id", f)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestCompareResults(t *testing.T) {
+	// The results get IDs 1 and 3.
+	var f fixture
+	for _, scores := range []database.Scores{
+		{{Name: "Mandelbrot", Score: 100}, {Name: "Total", Score: 200}},
+		{{Name: "Mandelbrot", Score: 150}, {Name: "Total", Score: 100}, {Name: "N-Body", Score: 50}},
+	} {
+		f.Results = append(f.Results, fixtureResult{UserID: 1, Scores: scores, Specs: &database.SysInfo{Vendor: "GenuineIntel"}})
+	}
+	h := handlers.Handler(newFixtureDB(t, f))
+
+	tt := []struct {
+		Name       string
+		Query      string
+		StatusCode int
+	}{
+		{Name: "Missing ids", Query: "", StatusCode: http.StatusBadRequest},
+		{Name: "Invalid id", Query: "?ids=1,x", StatusCode: http.StatusBadRequest},
+		{Name: "Baseline not compared", Query: "?ids=1,3&baseline=5", StatusCode: http.StatusBadRequest},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/compare"+tc.Query, nil))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Errorf("status code: want %d, got %d", want, got)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/compare?ids=1,3", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+
+	var cmp struct {
+		Baseline int64
+		Results  []struct {
+			ID    int64
+			Specs *database.SysInfo
+		}
+		Benchmarks []struct {
+			Name   string
+			Scores []*struct {
+				Score        float64
+				Delta        *float64
+				DeltaPercent *float64 `json:"delta_percent"`
+			}
+		}
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&cmp); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmp.Baseline != 1 || len(cmp.Results) != 2 || cmp.Results[1].Specs == nil {
+		t.Fatalf("got baseline %d and results %+v", cmp.Baseline, cmp.Results)
+	}
+	if got, want := len(cmp.Benchmarks), 3; got != want {
+		t.Fatalf("benchmarks: got %d, want %d", got, want)
+	}
+
+	mandelbrot := cmp.Benchmarks[0].Scores[1]
+	if mandelbrot.Delta == nil || *mandelbrot.Delta != 50 || *mandelbrot.DeltaPercent != 50 {
+		t.Errorf("Mandelbrot delta: got %+v, want 50 (50%%)", mandelbrot)
+	}
+
+	nbody := cmp.Benchmarks[2]
+	if nbody.Name != "N-Body" || nbody.Scores[0] != nil || nbody.Scores[1].Delta != nil {
+		t.Errorf("N-Body: want missing baseline score and no delta, got %+v", nbody)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestSubmitCompat feeds every client payload in testdata/submit through
+// AddResult and compares the stored result and specs to the payload's golden
+// file. Run with -update to regenerate the golden files.
+func TestSubmitCompat(t *testing.T) {
+	payloads, err := filepath.Glob(filepath.Join("testdata", "submit", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) == 0 {
+		t.Fatal("no client payloads in testdata/submit")
+	}
+
+	for _, payload := range payloads {
+		name := strings.TrimSuffix(filepath.Base(payload), ".json")
+		t.Run(name, func(t *testing.T) {
+			body, err := ioutil.ReadFile(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db := newFixtureDB(t, submitFixture)
+			r := mux.NewRouter()
+			r.HandleFunc("/results/submit", handlers.AddResult(db, nil)).Methods("POST")
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newSubmitRequest(t, string(body), ""))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+			}
+
+			results, err := db.ListResults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			specs, err := db.ListSpecs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || len(specs) != 1 {
+				t.Fatalf("stored %d results and %d specs, want 1 of each", len(results), len(specs))
+			}
+			if len(results[0].Scores) == 0 {
+				t.Error("scores were dropped")
+			}
+			if specs[0].PhysicalMem == "" || specs[0].VirtualMem == "" || specs[0].SwapMem == "" {
+				t.Errorf("memory info was dropped: %+v", specs[0].SysInfo)
+			}
+
+			results[0].CreatedAt = time.Time{} // not part of the payload
+			got, err := json.MarshalIndent(map[string]interface{}{
+				"result": results[0],
+				"specs":  specs[0],
+			}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "submit", name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("stored submission does not match %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// contractFixture returns contents that are fully deterministic, so
+// responses can be compared byte for byte: the user test (ID 1), two results
+// with IDs 2 and 4 and specs with IDs 3 and 5, and the CPU they ran on (ID 6).
+func contractFixture() fixture {
+	f := fixture{
+		Users: []database.User{{Name: "test", Email: "test@test.com"}},
+		CPUs: []fixtureCPU{{
+			CPU:     database.CPU{Vendor: "GenuineIntel", Family: "Core i7", Model: "Intel Core i7-8750H", Cores: 6, Threads: 12, BaseClockHz: 2200000000},
+			Aliases: []string{"i7-8750H"},
+		}},
+	}
+	created := time.Date(2018, time.November, 7, 21, 43, 49, 0, time.UTC)
+	for i, threads := range []string{"12", "8"} {
+		f.Results = append(f.Results, fixtureResult{
+			UserID: 1,
+			Scores: database.Scores{
+				{Name: "Mandelbrot", Score: float64(50 + i), Time: database.Duration{Duration: 1500 * time.Millisecond}},
+				{Name: "Total", Score: float64(100 + i), Time: database.Duration{Duration: 3 * time.Second}},
+			},
+			CreatedAt: created.Add(time.Duration(i) * time.Hour),
+			Specs: &database.SysInfo{
+				Vendor:      "GenuineIntel",
+				Model:       "Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz",
+				ClockSpeed:  "2.2 GHz",
+				Threads:     threads,
+				ByteOrder:   "Little Endian",
+				PhysicalMem: "16 GB",
+				VirtualMem:  "32 GB",
+				SwapMem:     "2 GB",
+			},
+		})
+	}
+	return f
+}
+
+// TestAPIContract pins the JSON responses of the legacy /api routes, which
+// the website depends on, and of /api/v1 to the golden files in
+// testdata/contract. A failure means a response changed shape; only /api/v1
+// may change, and only deliberately. Run with -update to regenerate them.
+func TestAPIContract(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, contractFixture()))
+	const res, specs, cpu = 2, 3, 6
+
+	tt := []struct {
+		Name string
+		Path string
+	}{
+		{Name: "legacy_users", Path: "/api/users"},
+		{Name: "legacy_user", Path: "/api/users/1"},
+		{Name: "legacy_results", Path: "/api/results"},
+		{Name: "legacy_user_results", Path: "/api/results/user/1"},
+		{Name: "legacy_result", Path: fmt.Sprintf("/api/results/%d", res)},
+		{Name: "legacy_specs", Path: "/api/specs"},
+		{Name: "legacy_specs_by_id", Path: fmt.Sprintf("/api/specs/%d", specs)},
+		{Name: "legacy_result_specs", Path: fmt.Sprintf("/api/specs/result/%d", res)},
+		{Name: "legacy_cpus", Path: "/api/cpus"},
+		{Name: "legacy_cpu", Path: fmt.Sprintf("/api/cpus/%d", cpu)},
+		{Name: "legacy_cpu_aliases", Path: fmt.Sprintf("/api/cpus/%d/aliases", cpu)},
+		{Name: "legacy_cpu_results", Path: fmt.Sprintf("/api/cpus/%d/results", cpu)},
+		{Name: "v1_users", Path: "/api/v1/users"},
+		{Name: "v1_user", Path: "/api/v1/users/1"},
+		{Name: "v1_user_results", Path: "/api/v1/users/1/results"},
+		{Name: "v1_results", Path: "/api/v1/results"},
+		{Name: "v1_result", Path: fmt.Sprintf("/api/v1/results/%d", res)},
+		{Name: "v1_result_specs", Path: fmt.Sprintf("/api/v1/results/%d/specs", res)},
+		{Name: "v1_specs", Path: fmt.Sprintf("/api/v1/specs/%d", specs)},
+		{Name: "v1_cpus", Path: "/api/v1/cpus"},
+		{Name: "v1_cpu", Path: fmt.Sprintf("/api/v1/cpus/%d", cpu)},
+		{Name: "v1_cpu_aliases", Path: fmt.Sprintf("/api/v1/cpus/%d/aliases", cpu)},
+		{Name: "v1_cpu_results", Path: fmt.Sprintf("/api/v1/cpus/%d/results", cpu)},
+		{Name: "v1_leaderboard", Path: "/api/v1/leaderboard"},
+		{Name: "v1_compare", Path: fmt.Sprintf("/api/v1/compare?ids=%d,%d", res, res+2)},
+		{Name: "v1_stats", Path: "/api/v1/stats?group_by=threads"},
+		{Name: "v1_not_found", Path: "/api/v1/results/999"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.Path, nil)
+			req.Header.Set("X-Request-ID", "contract-test")
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("content type: want application/json, got %q: %s", ct, rec.Body)
+			}
+
+			var got bytes.Buffer
+			fmt.Fprintf(&got, "%d\n", rec.Code)
+			if err := json.Indent(&got, bytes.TrimSpace(rec.Body.Bytes()), "", "  "); err != nil {
+				t.Fatal(err)
+			}
+			got.WriteByte('\n')
+
+			golden := filepath.Join("testdata", "contract", tc.Name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("response to %s does not match %s:\ngot:\n%s\nwant:\n%s", tc.Path, golden, got.Bytes(), want)
+			}
+		})
+	}
+}
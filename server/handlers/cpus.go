@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// ListCPUs returns a list of all catalogued CPUs, or of the one that a raw
+// model string resolves to, see listCPUs.
+func ListCPUs(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cpus, err := listCPUs(db, r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := sendJSONResponse(w, cpus); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// listCPUs returns all catalogued CPUs, unless the request has a model query
+// parameter. Then it returns the CPU that the raw model, as reported in
+// SysInfo, and the vendor parameter, if given, resolve to, or none.
+func listCPUs(db database.CatalogDatabase, r *http.Request) ([]*database.CPU, error) {
+	q := r.URL.Query()
+	if q.Get("model") == "" {
+		return db.ListCPUs()
+	}
+	cpu, err := db.ResolveCPU(q.Get("vendor"), q.Get("model"))
+	if err != nil || cpu == nil {
+		return nil, err
+	}
+	return []*database.CPU{cpu}, nil
+}
+
+// GetCPU retrieves a CPU by its id.
+func GetCPU(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		cpu, err := db.GetCPU(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := sendJSONResponse(w, cpu); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// ListResultsByCPU returns all results whose specs resolve to the CPU with the given id.
+func ListResultsByCPU(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		results, err := db.ListResultsByCPU(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := sendJSONResponse(w, results); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// ListCPUAliases returns all aliases of the CPU with the given id.
+func ListCPUAliases(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		aliases, err := db.ListCPUAliases(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := sendJSONResponse(w, aliases); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// AddCPU adds a CPU to the catalog. Only admins may add CPUs.
+func AddCPU(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authenticateAdmin(w, r, db); !ok {
+			return
+		}
+
+		var cpu database.CPU
+		if err := json.NewDecoder(r.Body).Decode(&cpu); err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if strings.TrimSpace(cpu.Model) == "" {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, "cpu model is required")
+			return
+		}
+
+		id, err := db.AddCPU(&cpu)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		log.Println("successfully added cpu id", id)
+
+		cpu.ID = id
+		cpu.Model = database.CanonicalCPUModel(cpu.Model)
+		if err := sendJSONResponse(w, cpu); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// DeleteCPU removes a CPU and its aliases from the catalog. Only admins may delete CPUs.
+func DeleteCPU(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authenticateAdmin(w, r, db); !ok {
+			return
+		}
+
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := db.DeleteCPU(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// AddCPUAlias maps another model name to the CPU with the given id. Only
+// admins may add aliases.
+func AddCPUAlias(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authenticateAdmin(w, r, db); !ok {
+			return
+		}
+
+		cpuID, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		var alias database.CPUAlias
+		if err := json.NewDecoder(r.Body).Decode(&alias); err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if database.CanonicalCPUModel(alias.Model) == "" {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, "alias model is required")
+			return
+		}
+		alias.CPUID = cpuID
+
+		id, err := db.AddCPUAlias(&alias)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		log.Println("successfully added cpu alias id", id)
+
+		alias.ID = id
+		alias.Model = database.CanonicalCPUModel(alias.Model)
+		if err := sendJSONResponse(w, alias); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// DeleteCPUAlias deletes the alias with the given id. Only admins may delete aliases.
+func DeleteCPUAlias(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authenticateAdmin(w, r, db); !ok {
+			return
+		}
+
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		if err := db.DeleteCPUAlias(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestCPUCatalog(t *testing.T) {
+	// A result of another vendor's CPU with the same model name.
+	f := catalogFixture()
+	f.Results = append(f.Results, fixtureResult{UserID: 2, Specs: &database.SysInfo{Vendor: "AuthenticAMD", Model: "Intel Core i7-8750H"}})
+	h := handlers.Handler(newFixtureDB(t, f))
+
+	do := func(method, path, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if user != "" {
+			req.SetBasicAuth(user, "password")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("POST", "/api/cpus/add", "test", `{"Model": "i7-8750H"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("add cpu as non-admin: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec := do("POST", "/api/cpus/add", "admin", `{"Vendor": "GenuineIntel", "Family": "Core i7", "Model": "Intel(R) Core(TM) i7-8750H CPU", "Cores": 6}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("add cpu: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var cpu database.CPU
+	if err := json.NewDecoder(rec.Body).Decode(&cpu); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cpu.Model, "Intel Core i7-8750H"; got != want {
+		t.Errorf("cpu model: got %q, want %q", got, want)
+	}
+
+	for query, want := range map[string]int{
+		"?vendor=GenuineIntel&model=Intel%28R%29+Core%28TM%29+i7-8750H+CPU+%40+2.20GHz": 1,
+		"?vendor=AuthenticAMD&model=Intel+Core+i7-8750H":                                0,
+		"?model=i5-8250U": 0,
+	} {
+		var cpus []*database.CPU
+		if err := json.NewDecoder(do("GET", "/api/cpus"+query, "", "").Body).Decode(&cpus); err != nil {
+			t.Fatal(err)
+		}
+		if len(cpus) != want || want == 1 && cpus[0].ID != cpu.ID {
+			t.Errorf("resolve cpu %s: got %+v, want %d", query, cpus, want)
+		}
+	}
+
+	rec = do("GET", "/api/cpus/"+strconv.FormatInt(cpu.ID, 10)+"/results", "", "")
+	var results []*database.Result
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(results), 2; got != want {
+		t.Errorf("results by cpu: got %d, want %d", got, want)
+	}
+
+	rec = do("POST", "/api/cpus/"+strconv.FormatInt(cpu.ID, 10)+"/aliases/add", "admin", `{"Model": "Intel(R) Core(TM) i5-8250U CPU"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("add alias: got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	rec = do("GET", "/api/cpus/"+strconv.FormatInt(cpu.ID, 10)+"/results", "", "")
+	results = nil
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(results), 3; got != want {
+		t.Errorf("results by cpu with alias: got %d, want %d", got, want)
+	}
+
+	for _, path := range []string{"/api/cpus/delete/999", "/api/cpus/aliases/delete/999"} {
+		if rec := do("POST", path, "admin", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/dataset"
+)
+
+// ListDatasets returns the manifests of the available open-data snapshots,
+// newest first.
+func ListDatasets(store *dataset.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		manifests := []*dataset.Manifest{}
+		if store != nil {
+			var err error
+			if manifests, err = store.List(); err != nil {
+				sendError(w, r, err)
+				return
+			}
+		}
+
+		if err := sendJSONResponse(w, manifests); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// GetDataset returns the gzipped NDJSON data of the snapshot with the "id"
+// route variable, or of the latest snapshot if there is none. The checksum
+// from the manifest is sent in the X-Checksum-SHA256 header and as the ETag.
+func GetDataset(store *dataset.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, ok := datasetManifest(w, r, store)
+		if !ok {
+			return
+		}
+
+		f, err := store.Open(m)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+m.File+`"`)
+		w.Header().Set("X-Checksum-SHA256", m.SHA256)
+		w.Header().Set("ETag", `"`+m.SHA256+`"`)
+		http.ServeContent(w, r, m.File, m.CreatedAt, f)
+	}
+}
+
+// GetDatasetManifest returns the manifest of the snapshot with the "id" route
+// variable, or of the latest snapshot if there is none.
+func GetDatasetManifest(store *dataset.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, ok := datasetManifest(w, r, store)
+		if !ok {
+			return
+		}
+
+		if err := sendJSONResponse(w, m); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// datasetManifest returns the manifest of the requested snapshot. If there is
+// none, it responds with 404 and returns false.
+func datasetManifest(w http.ResponseWriter, r *http.Request, store *dataset.Store) (*dataset.Manifest, bool) {
+	if store == nil {
+		sendErrorStatus(w, r, http.StatusNotFound, "no dataset snapshots")
+		return nil, false
+	}
+
+	var (
+		m   *dataset.Manifest
+		err error
+	)
+	if id, ok := mux.Vars(r)["id"]; ok {
+		m, err = store.Get(id)
+	} else {
+		m, err = store.Latest()
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return nil, false
+	}
+	if m == nil {
+		sendErrorStatus(w, r, http.StatusNotFound, "no such dataset snapshot")
+		return nil, false
+	}
+	return m, true
+}
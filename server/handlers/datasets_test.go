@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/dataset"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestDatasets(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlers.Handler(newFixtureDB(t, catalogFixture())).ServeHTTP(rec, httptest.NewRequest("GET", "/api/datasets/latest", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without snapshots: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	dir, err := ioutil.TempDir("", "datasets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := dataset.NewStore(dir, nil, dataset.Retention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newFixtureDB(t, catalogFixture())
+	m, err := store.Create(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.Handler(db, handlers.WithDatasets(store))
+
+	tt := []struct {
+		Name       string
+		Path       string
+		StatusCode int
+	}{
+		{Name: "List", Path: "/api/datasets", StatusCode: http.StatusOK},
+		{Name: "Latest", Path: "/api/datasets/latest", StatusCode: http.StatusOK},
+		{Name: "Latest manifest", Path: "/api/datasets/latest/manifest", StatusCode: http.StatusOK},
+		{Name: "By id", Path: "/api/datasets/" + m.ID, StatusCode: http.StatusOK},
+		{Name: "Unknown id", Path: "/api/datasets/20000101T000000Z", StatusCode: http.StatusNotFound},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tc.Path, nil))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d: %s", want, got, rec.Body)
+			}
+		})
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/datasets/latest", nil))
+	if got := rec.Header().Get("X-Checksum-SHA256"); got != m.SHA256 {
+		t.Errorf("checksum header: got %q, want %q", got, m.SHA256)
+	}
+	if got, want := int64(rec.Body.Len()), m.Bytes; got != want {
+		t.Errorf("got %d bytes, want %d", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/datasets/latest/manifest", nil))
+	var got dataset.Manifest
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != m.ID || got.Records != 3 {
+		t.Errorf("got manifest %+v, want %s with 3 records", got, m.ID)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// apiError is the body of every error response.
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorCodes are the error codes of the HTTP statuses handlers respond with.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "invalid",
+	http.StatusInternalServerError: "internal",
+}
+
+// sendError responds with the status matching the typed database error
+// wrapped by err, using err's message. Any other error is logged along with
+// the request ID and reported as an internal error without details.
+func sendError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		sendErrorStatus(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, database.ErrConflict):
+		sendErrorStatus(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, database.ErrInvalid):
+		sendErrorStatus(w, r, http.StatusUnprocessableEntity, err.Error())
+	default:
+		sendErrorStatus(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// sendErrorStatus responds with the given status and message. The messages
+// of server errors are logged rather than sent.
+func sendErrorStatus(w http.ResponseWriter, r *http.Request, status int, message string) {
+	body := apiError{
+		Code:      errorCodes[status],
+		Message:   message,
+		RequestID: requestIDFrom(r.Context()),
+	}
+	if body.Code == "" {
+		body.Code = "error"
+	}
+	if status >= http.StatusInternalServerError {
+		log.Printf("request %s: %s %s: %s", body.RequestID, r.Method, r.URL.Path, message)
+		body.Message = "internal server error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// validRequestID matches the client supplied request IDs that are kept.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// withRequestID gives every request an ID, taken from a well-formed
+// X-Request-ID header or generated, which is echoed in the response header
+// and in error bodies.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("could not generate request id: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDFrom returns the request ID in ctx, or "" if there is none.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
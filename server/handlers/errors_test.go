@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestErrorResponses(t *testing.T) {
+	f := catalogFixture()
+	f.CPUs = []fixtureCPU{{CPU: database.CPU{Model: "Intel Core i7-8750H"}}}
+	h := handlers.Handler(newFixtureDB(t, f))
+
+	tt := []struct {
+		Name       string
+		Method     string
+		Path       string
+		User       string
+		Password   string
+		Body       string
+		StatusCode int
+		Code       string
+	}{
+		{Name: "Unknown result", Method: "GET", Path: "/api/results/999", StatusCode: http.StatusNotFound, Code: "not_found"},
+		{Name: "Unknown user", Method: "GET", Path: "/api/users/999", StatusCode: http.StatusNotFound, Code: "not_found"},
+		{Name: "Unknown specs", Method: "GET", Path: "/api/specs/999", StatusCode: http.StatusNotFound, Code: "not_found"},
+		{Name: "Id out of range", Method: "GET", Path: "/api/results/99999999999999999999", StatusCode: http.StatusNotFound, Code: "not_found"},
+		{Name: "Bad format", Method: "GET", Path: "/api/results?format=xml", StatusCode: http.StatusBadRequest, Code: "bad_request"},
+		{Name: "No credentials", Method: "POST", Path: "/api/results/submit", Body: "{}", StatusCode: http.StatusUnauthorized, Code: "unauthorized"},
+		{Name: "Wrong password", Method: "POST", Path: "/api/results/submit", User: "test", Password: "wrong", Body: "{}", StatusCode: http.StatusUnauthorized, Code: "unauthorized"},
+		{Name: "Not an admin", Method: "POST", Path: "/api/cpus/add", User: "test", Password: "password", Body: `{"Model": "i7-8750H"}`, StatusCode: http.StatusForbidden, Code: "forbidden"},
+		{Name: "Malformed body", Method: "POST", Path: "/api/results/submit", User: "test", Password: "password", Body: "{", StatusCode: http.StatusBadRequest, Code: "bad_request"},
+		{Name: "Duplicate cpu", Method: "POST", Path: "/api/cpus/add", User: "admin", Password: "password", Body: `{"Model": "Intel Core i7-8750H"}`, StatusCode: http.StatusConflict, Code: "conflict"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.Method, tc.Path, strings.NewReader(tc.Body))
+			if tc.User != "" {
+				req.SetBasicAuth(tc.User, tc.Password)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d: %s", want, got, rec.Body)
+			}
+			if got, want := rec.Header().Get("Content-Type"), "application/json"; got != want {
+				t.Errorf("content type: want %q, got %q", want, got)
+			}
+
+			var body struct {
+				Code      string `json:"code"`
+				Message   string `json:"message"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := body.Code, tc.Code; got != want {
+				t.Errorf("code: want %q, got %q", want, got)
+			}
+			if body.Message == "" {
+				t.Error("empty message")
+			}
+			if body.RequestID == "" || body.RequestID != rec.Header().Get("X-Request-ID") {
+				t.Errorf("request id: body has %q, header has %q", body.RequestID, rec.Header().Get("X-Request-ID"))
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, catalogFixture()))
+
+	tt := []struct {
+		Name string
+		ID   string
+		Keep bool
+	}{
+		{Name: "Well-formed", ID: "abc-123", Keep: true},
+		{Name: "Too long", ID: strings.Repeat("a", 65)},
+		{Name: "Bad characters", ID: "<script>"},
+		{Name: "Missing"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/results/999", nil)
+			if tc.ID != "" {
+				req.Header.Set("X-Request-ID", tc.ID)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			got := rec.Header().Get("X-Request-ID")
+			if tc.Keep && got != tc.ID {
+				t.Errorf("want request id %q, got %q", tc.ID, got)
+			}
+			if !tc.Keep && (got == "" || got == tc.ID) {
+				t.Errorf("want a generated request id, got %q", got)
+			}
+		})
+	}
+}
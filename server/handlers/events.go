@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/events"
+)
+
+const (
+	// defaultEventReplay is the number of events kept for clients resuming
+	// the event stream, unless WithEvents provides a bus.
+	defaultEventReplay = 1024
+	// eventBuffer is the number of events a stream may fall behind by before
+	// it is disconnected.
+	eventBuffer = 64
+	// eventHeartbeat is the interval of the comments keeping idle streams
+	// from being closed by proxies.
+	eventHeartbeat = 15 * time.Second
+)
+
+// eventReset is sent to a stream that resumed after events it missed were
+// dropped from the replay buffer. The client should reload what it shows.
+const eventReset = "reset"
+
+// resultEventV1 is the data of a result.created event.
+type resultEventV1 struct {
+	Result resultV1 `json:"result"`
+	Specs  *specsV1 `json:"specs"` // nil if the result has no specs
+}
+
+// hiddenEventV1 is the data of a result.hidden event.
+type hiddenEventV1 struct {
+	ResultID int64 `json:"result_id"`
+}
+
+// rankEventV1 is the data of a rank.changed event. A created result entered
+// the leaderboard at Rank, moving the results from there on down by one. A
+// hidden result left Rank, moving the results below it up by one.
+type rankEventV1 struct {
+	ResultID int64  `json:"result_id"`
+	Rank     int    `json:"rank"`
+	Reason   string `json:"reason"` // the type of the event that changed the ranks
+}
+
+// recordEventV1 is the data of a record.set event.
+type recordEventV1 struct {
+	ResultID int64   `json:"result_id"`
+	UserID   int64   `json:"user_id"`
+	Score    float64 `json:"score"` // the Total score
+}
+
+// WithEvents publishes result changes on bus, which is also streamed under
+// /api/events. Without it, the handler uses a bus of its own.
+func WithEvents(bus *events.Bus) Option {
+	return func(o *options) { o.events = bus }
+}
+
+func addEventHandlers(r *mux.Router, bus *events.Bus) {
+	r.HandleFunc("/events", GetEvents(bus)).Methods(http.MethodGet)
+}
+
+// GetEvents streams the events published on bus as Server-Sent Events. The
+// types query parameter selects the event types to stream, separated by
+// commas. A client reconnecting with the Last-Event-ID header, or the
+// last_event_id query parameter, first receives the events it missed. If
+// they are no longer buffered, a reset event is sent instead.
+//
+// A client that does not keep up is disconnected, and can resume the same
+// way.
+func GetEvents(bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			sendErrorStatus(w, r, http.StatusInternalServerError, "streaming is not supported")
+			return
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("last_event_id")
+		}
+		var after uint64
+		if lastID != "" {
+			var err error
+			if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+				sendErrorStatus(w, r, http.StatusBadRequest, "Last-Event-ID: want an event id")
+				return
+			}
+		}
+		var types map[string]bool
+		if s := r.URL.Query().Get("types"); s != "" {
+			types = make(map[string]bool)
+			for _, typ := range strings.Split(s, ",") {
+				types[strings.TrimSpace(typ)] = true
+			}
+		}
+
+		sub, complete := bus.Subscribe(after, eventBuffer)
+		defer sub.Close()
+
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if !complete {
+			fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case e, ok := <-sub.C:
+				if !ok {
+					if sub.Lagged() {
+						log.Printf("disconnected event stream of %s, which fell behind", r.RemoteAddr)
+					}
+					return
+				}
+				if types != nil && !types[e.Type] {
+					continue
+				}
+				data, err := json.Marshal(e.Data)
+				if err != nil {
+					log.Printf("could not encode event %d: %v", e.ID, err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// publishResultCreated publishes the events of a new result on bus, unless
+// it is nil: always result.created, then rank.changed if it has a Total score
+// and record.set if that is the best one.
+func publishResultCreated(bus *events.Bus, db database.StatsDatabase, result *database.Result, specs *database.Specs) {
+	if bus == nil {
+		return
+	}
+	v := resultEventV1{Result: newResultV1(result)}
+	if specs != nil {
+		s := newSpecsV1(specs)
+		v.Specs = &s
+	}
+	bus.Publish(events.ResultCreated, v)
+
+	rank, err := db.TotalRank(result.ID)
+	if err != nil {
+		log.Printf("could not rank result %d: %v", result.ID, err)
+		return
+	}
+	if rank > 0 {
+		bus.Publish(events.RankChanged, rankEventV1{ResultID: result.ID, Rank: rank, Reason: events.ResultCreated})
+	}
+	if rank == 1 {
+		score, _ := totalScore(result)
+		bus.Publish(events.RecordSet, recordEventV1{ResultID: result.ID, UserID: result.UserID, Score: score})
+	}
+}
+
+// totalScore returns the Total score of res, and whether it has one.
+func totalScore(res *database.Result) (float64, bool) {
+	for _, score := range res.Scores {
+		if score.Name == "Total" {
+			return score.Score, true
+		}
+	}
+	return 0, false
+}
+
+// HideResult hides the result with the given id, as moderation by an admin.
+// It publishes the result.hidden event, and rank.changed if the result was
+// on the leaderboard.
+func HideResult(db database.OSBDatabase, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := authenticateAdmin(w, r, db); !ok {
+			return
+		}
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		rank, err := db.TotalRank(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if err := db.HideResult(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		log.Println("hid result id", id)
+
+		bus.Publish(events.ResultHidden, hiddenEventV1{ResultID: id})
+		if rank > 0 {
+			bus.Publish(events.RankChanged, rankEventV1{ResultID: id, Rank: rank, Reason: events.ResultHidden})
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
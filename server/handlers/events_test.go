@@ -0,0 +1,155 @@
+package handlers_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// sseEvent is an event read from a Server-Sent Events stream.
+type sseEvent struct {
+	ID, Type, Data string
+}
+
+// openEvents connects to the event stream of srv with the given Last-Event-ID
+// and returns its events. The stream is closed when the test ends.
+func openEvents(t *testing.T, srv *httptest.Server, lastID string) <-chan sseEvent {
+	t.Helper()
+	req, err := http.NewRequest("GET", srv.URL+"/api/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type: want text/event-stream, got %q", ct)
+	}
+
+	c := make(chan sseEvent, 16)
+	go func() {
+		defer close(c)
+		var e sseEvent
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			line := s.Text()
+			switch {
+			case line == "":
+				if e.Type != "" {
+					c <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.ID = line[len("id: "):]
+			case strings.HasPrefix(line, "event: "):
+				e.Type = line[len("event: "):]
+			case strings.HasPrefix(line, "data: "):
+				e.Data = line[len("data: "):]
+			}
+		}
+	}()
+	return c
+}
+
+// next returns the next event of c.
+func next(t *testing.T, c <-chan sseEvent) sseEvent {
+	t.Helper()
+	e, ok := <-c
+	if !ok {
+		t.Fatal("event stream ended")
+	}
+	return e
+}
+
+func TestEvents(t *testing.T) {
+	f := catalogFixture()
+	f.Results = append(f.Results, fixtureResult{UserID: 2, Scores: database.Scores{{Name: "Total", Score: 3000}}})
+	db := newFixtureDB(t, f)
+	srv := httptest.NewServer(handlers.Handler(db))
+	t.Cleanup(srv.Close) // after the streams are closed
+	stream := openEvents(t, srv, "")
+
+	do := func(method, path, user, body string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(user, "password")
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s: status code: want %d, got %d", method, path, http.StatusOK, resp.StatusCode)
+		}
+	}
+	do("POST", "/api/v1/results", "test", `{
+		"scores": [{"name": "Total", "time": 1000, "score": 2000}],
+		"specs": {"vendor": "GenuineIntel", "model": "Intel(R) Core(TM) i7-8750H CPU", "threads": "12"}
+	}`)
+
+	e := next(t, stream)
+	if e.ID != "1" || e.Type != "result.created" {
+		t.Fatalf("want event 1 result.created, got %+v", e)
+	}
+	for _, want := range []string{`"scores":[{"name":"Total","score":2000,"time_ms":0.001}]`, `"model":"Intel(R) Core(TM) i7-8750H CPU"`, `"threads":12`} {
+		if !strings.Contains(e.Data, want) {
+			t.Errorf("result.created: data %s does not contain %s", e.Data, want)
+		}
+	}
+	created := e.Data[strings.Index(e.Data, `"id":`):]
+	var id int64
+	if _, err := fmt.Sscanf(created, `"id":%d`, &id); err != nil {
+		t.Fatal(err)
+	}
+	e = next(t, stream)
+	if want := fmt.Sprintf(`{"result_id":%d,"rank":2,"reason":"result.created"}`, id); e.Type != "rank.changed" || e.Data != want {
+		t.Errorf("want rank.changed %s, got %+v", want, e)
+	}
+
+	path := fmt.Sprintf("/api/v1/results/%d/hide", id)
+	req := httptest.NewRequest("POST", path, nil)
+	req.SetBasicAuth("test", "password")
+	rec := httptest.NewRecorder()
+	handlers.Handler(db).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("hide as user: status code: want %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	do("POST", path, "admin", "")
+
+	e = next(t, stream)
+	if want := fmt.Sprintf(`{"result_id":%d}`, id); e.ID != "3" || e.Type != "result.hidden" || e.Data != want {
+		t.Errorf("want event 3 result.hidden %s, got %+v", want, e)
+	}
+	e = next(t, stream)
+	if want := fmt.Sprintf(`{"result_id":%d,"rank":2,"reason":"result.hidden"}`, id); e.Type != "rank.changed" || e.Data != want {
+		t.Errorf("want rank.changed %s, got %+v", want, e)
+	}
+	if _, err := db.GetResult(id); err == nil {
+		t.Error("hidden result can be retrieved")
+	}
+
+	// Resuming replays the events after the last one received.
+	resumed := openEvents(t, srv, "2")
+	for _, want := range []string{"3", "4"} {
+		if e := next(t, resumed); e.ID != want {
+			t.Errorf("resumed: want event %s, got %+v", want, e)
+		}
+	}
+	if e := next(t, openEvents(t, srv, "99")); e.Type != "reset" {
+		t.Errorf("unknown Last-Event-ID: want reset event, got %+v", e)
+	}
+}
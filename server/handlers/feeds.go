@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// maxFeedEntries is the number of latest entries in a feed.
+const maxFeedEntries = 50
+
+// feedTagYear is the year in the tag URIs identifying feed entries, which
+// must never change so feed readers keep recognizing them.
+const feedTagYear = "2018"
+
+func addFeedHandlers(r *mux.Router, db database.OSBDatabase, siteURL *url.URL) {
+	r.HandleFunc("/feeds/results.atom", GetResultsFeed(db, siteURL)).Methods(http.MethodGet)
+	r.HandleFunc("/feeds/records.atom", GetRecordsFeed(db, siteURL)).Methods(http.MethodGet)
+	r.HandleFunc("/feeds/users/{id:[0-9]+}.atom", GetUserFeed(db, siteURL)).Methods(http.MethodGet)
+}
+
+// feedSite holds the URLs of the site feeds are served from. They come from
+// the configured site URL rather than the request, whose Host header the
+// client chooses, so that entries keep their IDs however the site is reached.
+type feedSite struct {
+	base string // scheme, host and path prefix
+	host string // host name for tag URIs
+}
+
+func newFeedSite(site *url.URL) feedSite {
+	return feedSite{
+		base: site.Scheme + "://" + site.Host + strings.TrimSuffix(site.Path, "/"),
+		host: site.Hostname(),
+	}
+}
+
+// tag returns the tag URI identifying an entry, see RFC 4151.
+func (s feedSite) tag(specific string) string {
+	return "tag:" + s.host + "," + feedTagYear + ":" + specific
+}
+
+// resultURL returns the URL of the result with the given id.
+func (s feedSite) resultURL(id int64) string {
+	return fmt.Sprintf("%s/api/v1/results/%d", s.base, id)
+}
+
+// newFeed returns a feed of the given title served at path.
+func (s feedSite) newFeed(title, description, path string) *feeds.Feed {
+	return &feeds.Feed{
+		Title:       title,
+		Description: description,
+		// The Atom feed ID is the URL of this link.
+		Link: &feeds.Link{Href: s.base + path, Rel: "self"},
+	}
+}
+
+// resultItem returns the feed entry of a result.
+func (s feedSite) resultItem(res *database.Result, user string) *feeds.Item {
+	var scores []string
+	for _, score := range res.Scores {
+		scores = append(scores, fmt.Sprintf("%s: %g (%v)", score.Name, score.Score, score.Time.Duration))
+	}
+	title := fmt.Sprintf("Result %d by %s", res.ID, user)
+	if total, ok := totalScore(res); ok {
+		title += fmt.Sprintf(": Total %g", total)
+	}
+	return &feeds.Item{
+		Title:       title,
+		Link:        &feeds.Link{Href: s.resultURL(res.ID), Type: "application/json"},
+		Author:      &feeds.Author{Name: user},
+		Description: strings.Join(scores, ", "),
+		Id:          s.tag(fmt.Sprintf("result/%d", res.ID)),
+		Created:     res.CreatedAt.UTC(),
+		Updated:     res.CreatedAt.UTC(),
+	}
+}
+
+// sendFeed responds with feed as Atom. The feed is updated when its newest
+// entry is.
+func sendFeed(w http.ResponseWriter, r *http.Request, feed *feeds.Feed) {
+	for _, item := range feed.Items {
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+	}
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Now().UTC()
+	}
+	atom, err := feed.ToAtom()
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(atom))
+}
+
+// userNames returns the names of the users with the given ids by id.
+func userNames(db database.UserDatabase, ids []int64) (map[int64]string, error) {
+	users, err := db.GetUsers(ids)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}
+
+// newestFirst sorts results by their creation time, newest first, and
+// returns at most maxFeedEntries of them.
+func newestFirst(results []*database.Result) []*database.Result {
+	sorted := make([]*database.Result, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+		}
+		return sorted[i].ID > sorted[j].ID
+	})
+	if len(sorted) > maxFeedEntries {
+		sorted = sorted[:maxFeedEntries]
+	}
+	return sorted
+}
+
+// GetResultsFeed returns an Atom feed of the latest results, linking to them
+// under siteURL.
+func GetResultsFeed(db database.OSBDatabase, siteURL *url.URL) http.HandlerFunc {
+	site := newFeedSite(siteURL)
+	return func(w http.ResponseWriter, r *http.Request) {
+		results, err := db.ListLatestResults(maxFeedEntries)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		var userIDs []int64
+		for _, res := range results {
+			userIDs = append(userIDs, res.UserID)
+		}
+		names, err := userNames(db, userIDs)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		feed := site.newFeed("OSB results", "The latest results submitted to Open System Benchmark", r.URL.Path)
+		for _, res := range results {
+			feed.Add(site.resultItem(res, names[res.UserID]))
+		}
+		sendFeed(w, r, feed)
+	}
+}
+
+// GetUserFeed returns an Atom feed of the latest results of a user, linking
+// to them under siteURL.
+func GetUserFeed(db database.OSBDatabase, siteURL *url.URL) http.HandlerFunc {
+	site := newFeedSite(siteURL)
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		user, err := db.GetUser(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		results, err := db.ListResultsCreatedBy(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		feed := site.newFeed("OSB results of "+user.Name, "The latest results "+user.Name+" submitted to Open System Benchmark", r.URL.Path)
+		for _, res := range newestFirst(results) {
+			feed.Add(site.resultItem(res, user.Name))
+		}
+		sendFeed(w, r, feed)
+	}
+}
+
+// GetRecordsFeed returns an Atom feed of the latest new top scores for a
+// benchmark, linking to their results under siteURL.
+func GetRecordsFeed(db database.OSBDatabase, siteURL *url.URL) http.HandlerFunc {
+	site := newFeedSite(siteURL)
+	return func(w http.ResponseWriter, r *http.Request) {
+		recs, err := db.ListLatestRecords(maxFeedEntries)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		var userIDs []int64
+		for _, rec := range recs {
+			userIDs = append(userIDs, rec.UserID)
+			if rec.Previous != nil {
+				userIDs = append(userIDs, rec.Previous.UserID)
+			}
+		}
+		names, err := userNames(db, userIDs)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		feed := site.newFeed("OSB records", "New top scores for the Open System Benchmark benchmarks", r.URL.Path)
+		for _, rec := range recs {
+			user := names[rec.UserID]
+			description := fmt.Sprintf("%s scored %g on %s in result %d", user, rec.Score, rec.Benchmark, rec.ResultID)
+			if prev := rec.Previous; prev != nil {
+				description += fmt.Sprintf(", beating %g by %s in result %d", prev.Score, names[prev.UserID], prev.ResultID)
+			}
+			created := rec.CreatedAt.UTC()
+			feed.Add(&feeds.Item{
+				Title:       fmt.Sprintf("New %s record: %g by %s", rec.Benchmark, rec.Score, user),
+				Link:        &feeds.Link{Href: site.resultURL(rec.ResultID), Type: "application/json"},
+				Author:      &feeds.Author{Name: user},
+				Description: description,
+				Id:          site.tag(fmt.Sprintf("record/%d/%s", rec.ResultID, rec.Benchmark)),
+				Created:     created,
+				Updated:     created,
+			})
+		}
+		sendFeed(w, r, feed)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// atomFeed is the part of an Atom feed the tests check.
+type atomFeed struct {
+	ID      string `xml:"id"`
+	Updated string `xml:"updated"`
+	Entries []struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Link    struct {
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func getFeed(t *testing.T, h http.Handler, path string) (*httptest.ResponseRecorder, *atomFeed) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	// Feeds are built from the site URL, never from the Host header.
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "http://attacker.example"+path, nil))
+	if rec.Code != http.StatusOK {
+		return rec, nil
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("%s: content type: want Atom, got %q", path, ct)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("%s: %v: %s", path, err, rec.Body)
+	}
+	return rec, &feed
+}
+
+func TestFeeds(t *testing.T) {
+	f := fixture{Users: []database.User{{Name: "alice"}, {Name: "bob"}}}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, res := range []struct {
+		user  int64
+		total float64
+	}{
+		{1, 100}, // record
+		{2, 90},
+		{2, 120}, // record
+		{1, 110},
+	} {
+		f.Results = append(f.Results, fixtureResult{
+			UserID:    res.user,
+			Scores:    database.Scores{{Name: "Total", Score: res.total}},
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	db := &pagedDB{newFixtureDB(t, f), t}
+	h := handlers.Handler(db, handlers.WithSiteURL(&url.URL{Scheme: "http", Host: "osb.example.com:8080"}))
+
+	_, feed := getFeed(t, h, "/feeds/results.atom")
+	if feed.ID != "http://osb.example.com:8080/feeds/results.atom" {
+		t.Errorf("results: feed ID: got %q", feed.ID)
+	}
+	if len(feed.Entries) != 4 {
+		t.Fatalf("results: want 4 entries, got %d", len(feed.Entries))
+	}
+	newest := feed.Entries[0]
+	if newest.ID != "tag:osb.example.com,2018:result/6" || newest.Title != "Result 6 by alice: Total 110" {
+		t.Errorf("results: unexpected newest entry %+v", newest)
+	}
+	if newest.Link.Href != "http://osb.example.com:8080/api/v1/results/6" {
+		t.Errorf("results: entry links to %q", newest.Link.Href)
+	}
+	if want := start.Add(3 * time.Hour).Format(time.RFC3339); newest.Updated != want || feed.Updated != want {
+		t.Errorf("results: updated: want %s, got entry %s and feed %s", want, newest.Updated, feed.Updated)
+	}
+
+	_, feed = getFeed(t, h, "/feeds/records.atom")
+	if len(feed.Entries) != 2 {
+		t.Fatalf("records: want 2 entries, got %+v", feed.Entries)
+	}
+	if e := feed.Entries[0]; e.ID != "tag:osb.example.com,2018:record/5/Total" || e.Title != "New Total record: 120 by bob" {
+		t.Errorf("records: unexpected newest entry %+v", e)
+	}
+	if e := feed.Entries[1]; e.Link.Href != "http://osb.example.com:8080/api/v1/results/3" {
+		t.Errorf("records: first record links to %q", e.Link.Href)
+	}
+
+	_, feed = getFeed(t, h, "/feeds/users/2.atom")
+	if len(feed.Entries) != 2 || feed.Entries[0].ID != "tag:osb.example.com,2018:result/5" {
+		t.Errorf("user: want the 2 results of bob, got %+v", feed.Entries)
+	}
+	if rec, _ := getFeed(t, h, "/feeds/users/9.atom"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user: status code: want %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
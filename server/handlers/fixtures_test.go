@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+)
+
+// fixture describes the contents of a test database. dbtest uses one ID
+// sequence for all tables, so newFixtureDB gives the users the first IDs,
+// then each result followed by its specs, then each CPU followed by its
+// aliases.
+type fixture struct {
+	Users   []database.User // all sign in with the password "password"
+	Results []fixtureResult
+	CPUs    []fixtureCPU
+}
+
+// fixtureResult is a result with its specs, if any.
+type fixtureResult struct {
+	UserID    int64
+	Scores    database.Scores
+	CreatedAt time.Time
+	Specs     *database.SysInfo
+}
+
+// fixtureCPU is a catalog CPU with the models that are aliases of it.
+type fixtureCPU struct {
+	database.CPU
+	Aliases []string
+}
+
+// newFixtureDB returns a database holding the contents of f.
+func newFixtureDB(t *testing.T, f fixture) *dbtest.DB {
+	t.Helper()
+	db := dbtest.New()
+	for _, u := range f.Users {
+		u.Password = dbtest.HashPassword("password")
+		if _, err := db.AddUser(&u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, res := range f.Results {
+		id, err := db.AddResult(&database.Result{UserID: res.UserID, Scores: res.Scores, CreatedAt: res.CreatedAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Specs == nil {
+			continue
+		}
+		if _, err := db.AddSpecs(&database.Specs{ResultID: id, SysInfo: *res.Specs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range f.CPUs {
+		cpu := c.CPU
+		id, err := db.AddCPU(&cpu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, model := range c.Aliases {
+			if _, err := db.AddCPUAlias(&database.CPUAlias{CPUID: id, Model: model}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return db
+}
+
+// catalogFixture returns the contents most handler tests start from: the
+// users admin (ID 1), an admin, and test (ID 2), and three results of test
+// with IDs 3, 5 and 7, whose specs name two CPUs in different ways.
+func catalogFixture() fixture {
+	f := fixture{Users: []database.User{{Name: "admin", Admin: true}, {Name: "test"}}}
+	for _, model := range []string{
+		"Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz",
+		"Intel Core i7-8750H",
+		"Intel(R) Core(TM) i5-8250U CPU",
+	} {
+		f.Results = append(f.Results, fixtureResult{UserID: 2, Specs: &database.SysInfo{Model: model}})
+	}
+	return f
+}
@@ -0,0 +1,632 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+const (
+	// maxGraphQLRequest is the size limit of GraphQL request bodies.
+	maxGraphQLRequest = 64 << 10
+	// maxGraphQLDepth is the deepest accepted field nesting, see queryCost.
+	maxGraphQLDepth = 7
+	// maxGraphQLComplexity is the highest accepted query complexity, see
+	// queryCost.
+	maxGraphQLComplexity = 10000
+	// defaultGraphQLLimit is the page size of lists when no limit is given.
+	defaultGraphQLLimit = 50
+)
+
+// graphQLRequest is a GraphQL request, the JSON body of a POST request or
+// the query parameters of a GET request.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// graphQLResponse is the response to a GraphQL request.
+type graphQLResponse struct {
+	Data   interface{}                `json:"data,omitempty"`
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty"`
+}
+
+func addGraphQLHandlers(r *mux.Router, db database.OSBDatabase) {
+	r.HandleFunc("/graphql", GraphQL(db)).Methods(http.MethodGet, http.MethodPost)
+}
+
+// GraphQL executes GraphQL queries over the users, results and specs, see
+// graphQLSchema. Queries deeper than maxGraphQLDepth or more complex than
+// maxGraphQLComplexity are rejected before they are executed.
+func GraphQL(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if r.Method == http.MethodGet {
+			query := r.URL.Query()
+			req.Query = query.Get("query")
+			req.OperationName = query.Get("operationName")
+			if v := query.Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					sendErrorStatus(w, r, http.StatusBadRequest, "variables: "+err.Error())
+					return
+				}
+			}
+		} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLRequest)).Decode(&req); err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Query == "" {
+			sendErrorStatus(w, r, http.StatusBadRequest, "query is required")
+			return
+		}
+		sendV1(w, r, executeGraphQL(r.Context(), db, req), nil)
+	}
+}
+
+// executeGraphQL validates and executes req.
+func executeGraphQL(ctx context.Context, db database.OSBDatabase, req graphQLRequest) graphQLResponse {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return graphQLResponse{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if v := graphql.ValidateDocument(&graphQLSchema, doc, nil); !v.IsValid {
+		return graphQLResponse{Errors: v.Errors}
+	}
+	if err := checkQueryCost(doc, req.OperationName, req.Variables); err != nil {
+		return graphQLResponse{Errors: gqlerrors.FormatErrors(err)}
+	}
+
+	res := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphQLSchema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx, graphQLLoadersKey{}, newGraphQLLoaders(db)),
+	})
+	return graphQLResponse{Data: res.Data, Errors: res.Errors}
+}
+
+// queryCost measures a GraphQL query. The depth of a field is the number of
+// fields it is nested in plus one. The complexity of a field is one plus the
+// complexity of its selections, times the limit argument for paged lists.
+// Introspection fields count as one each, whatever they select.
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	depth     int // deepest field seen
+}
+
+// checkQueryCost returns an error if the operation of doc to be executed is
+// too deep or complex.
+func checkQueryCost(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	c := &queryCost{fragments: make(map[string]*ast.FragmentDefinition), variables: variables}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			c.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				op = def
+			}
+		}
+	}
+	if op == nil {
+		return nil // left to Execute to report
+	}
+	complexity := c.selections(op.SelectionSet, 1)
+	switch {
+	case c.depth > maxGraphQLDepth:
+		return fmt.Errorf("query depth %d exceeds the limit of %d", c.depth, maxGraphQLDepth)
+	case complexity > maxGraphQLComplexity:
+		return fmt.Errorf("query complexity exceeds the limit of %d", maxGraphQLComplexity)
+	}
+	return nil
+}
+
+// selections returns the complexity of set, whose fields are at the given
+// depth. It stops counting past maxGraphQLComplexity, so that queries
+// spreading fragments exponentially many times are rejected quickly.
+func (c *queryCost) selections(set *ast.SelectionSet, depth int) int {
+	if set == nil {
+		return 0
+	}
+	complexity := 0
+	for _, sel := range set.Selections {
+		if complexity > maxGraphQLComplexity {
+			break
+		}
+		switch sel := sel.(type) {
+		case *ast.Field:
+			complexity++
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+			if depth > c.depth {
+				c.depth = depth
+			}
+			if sel.SelectionSet != nil && depth <= maxGraphQLDepth {
+				complexity += c.limit(sel) * c.selections(sel.SelectionSet, depth+1)
+			}
+		case *ast.InlineFragment:
+			complexity += c.selections(sel.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if frag, ok := c.fragments[sel.Name.Value]; ok {
+				complexity += c.selections(frag.SelectionSet, depth)
+			}
+		}
+	}
+	if complexity > maxGraphQLComplexity {
+		complexity = maxGraphQLComplexity + 1
+	}
+	return complexity
+}
+
+// limit returns the number of items field may return per item of its
+// parent: the limit argument of paged lists, and 1 for other fields.
+func (c *queryCost) limit(field *ast.Field) int {
+	n := c.pageSize(field)
+	if n < 1 || n > maxPageSize {
+		return maxPageSize // rejected when executed
+	}
+	return n
+}
+
+// pageSize returns the page size field requests, 1 unless it is a paged
+// list.
+func (c *queryCost) pageSize(field *ast.Field) int {
+	if _, ok := pagedFields[field.Name.Value]; !ok {
+		return 1
+	}
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		var v interface{} = arg.Value.GetValue()
+		if variable, ok := arg.Value.(*ast.Variable); ok {
+			v = c.variables[variable.Name.Value]
+		}
+		switch v := v.(type) {
+		case string: // literal
+			if n, err := strconv.Atoi(v); err == nil {
+				return n
+			}
+		case float64: // variable decoded from JSON
+			return int(v)
+		}
+		return maxPageSize
+	}
+	return defaultGraphQLLimit
+}
+
+// pagedFields are the names of the fields taking page arguments.
+var pagedFields = map[string]struct{}{"users": {}, "results": {}}
+
+// pageArgs returns the arguments of paged lists, which are ordered by id.
+func pageArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"limit": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: defaultGraphQLLimit,
+			Description:  fmt.Sprintf("page size, 1 to %d", maxPageSize),
+		},
+		"after": &graphql.ArgumentConfig{
+			Type:        graphql.ID,
+			Description: "id after which the page starts",
+		},
+	}
+}
+
+// graphQLPage returns the limit and after arguments of a paged list.
+func graphQLPage(args map[string]interface{}) (limit int, after int64, err error) {
+	limit, _ = args["limit"].(int)
+	if limit < 1 || limit > maxPageSize {
+		return 0, 0, fmt.Errorf("limit: want 1 to %d", maxPageSize)
+	}
+	if s, ok := args["after"].(string); ok {
+		if after, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, errors.New("after: want an id")
+		}
+	}
+	return limit, after, nil
+}
+
+// idArg returns the id argument of a field.
+func idArg(args map[string]interface{}, name string) (int64, error) {
+	s, _ := args[name].(string)
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: want an id", name)
+	}
+	return id, nil
+}
+
+// loader batches the loads of values by id made while a query executes, in
+// the manner of a dataloader: the ids requested before any of the values is
+// used are fetched at once.
+type loader struct {
+	// fetch returns the values with the given ids, missing if not found.
+	fetch func(ids []int64) (map[int64]interface{}, error)
+
+	mu      sync.Mutex
+	pending map[int64]bool
+	values  map[int64]interface{}
+	errs    map[int64]error
+}
+
+func newLoader(fetch func(ids []int64) (map[int64]interface{}, error)) *loader {
+	return &loader{
+		fetch:   fetch,
+		pending: make(map[int64]bool),
+		values:  make(map[int64]interface{}),
+		errs:    make(map[int64]error),
+	}
+}
+
+// load returns a thunk returning the value with the given id, nil if it is
+// not found. The executor calls the thunks after resolving the fields
+// requesting them, so all the ids of a page of results are fetched together.
+func (l *loader) load(id int64) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.values[id]; !ok {
+		l.pending[id] = true
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if len(l.pending) > 0 {
+			l.fetchPending()
+		}
+		return l.values[id], l.errs[id]
+	}
+}
+
+// fetchPending fetches the pending ids. l.mu must be held.
+func (l *loader) fetchPending() {
+	ids := make([]int64, 0, len(l.pending))
+	for id := range l.pending {
+		ids = append(ids, id)
+	}
+	l.pending = make(map[int64]bool)
+	values, err := l.fetch(ids)
+	for _, id := range ids {
+		l.values[id] = values[id]
+		if err != nil {
+			l.errs[id] = err
+		}
+	}
+}
+
+// graphQLLoaders holds the database and the loaders of a GraphQL request.
+type graphQLLoaders struct {
+	db    database.OSBDatabase
+	users *loader // *database.UserExternal by id
+	specs *loader // *database.Specs by result id
+
+	mu      sync.Mutex
+	results map[graphQLPageArgs]*loader // []*database.Result by user id, by page
+}
+
+// graphQLPageArgs are the arguments of a page of a list field.
+type graphQLPageArgs struct {
+	limit int
+	after int64
+}
+
+// resultsPage returns the loader of the given page of the results of users,
+// fetching the page of all pending users with one query.
+func (l *graphQLLoaders) resultsPage(limit int, after int64) *loader {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	page := graphQLPageArgs{limit: limit, after: after}
+	if results, ok := l.results[page]; ok {
+		return results
+	}
+	results := newLoader(func(ids []int64) (map[int64]interface{}, error) {
+		values := make(map[int64]interface{})
+		results, err := l.db.ListResultsCreatedByUsersAfter(ids, after, limit)
+		byUser := make(map[int64][]*database.Result)
+		for _, res := range results {
+			byUser[res.UserID] = append(byUser[res.UserID], res)
+		}
+		for _, id := range ids {
+			values[id] = byUser[id]
+		}
+		return values, err
+	})
+	l.results[page] = results
+	return results
+}
+
+// graphQLLoadersKey is the context key of the graphQLLoaders of a request.
+type graphQLLoadersKey struct{}
+
+func loadersOf(p graphql.ResolveParams) *graphQLLoaders {
+	return p.Context.Value(graphQLLoadersKey{}).(*graphQLLoaders)
+}
+
+// newGraphQLLoaders returns the loaders of a request, each fetching its
+// pending ids with one query for all of their rows.
+func newGraphQLLoaders(db database.OSBDatabase) *graphQLLoaders {
+	return &graphQLLoaders{
+		db: db,
+		users: newLoader(func(ids []int64) (map[int64]interface{}, error) {
+			values := make(map[int64]interface{})
+			users, err := db.GetUsers(ids)
+			for _, u := range users {
+				values[u.ID] = u
+			}
+			return values, err
+		}),
+		specs: newLoader(func(ids []int64) (map[int64]interface{}, error) {
+			values := make(map[int64]interface{})
+			specs, err := db.ListSpecsWithResultIDs(ids)
+			for _, s := range specs {
+				if _, ok := values[s.ResultID]; !ok {
+					values[s.ResultID] = s
+				}
+			}
+			return values, err
+		}),
+		results: make(map[graphQLPageArgs]*loader),
+	}
+}
+
+// graphQLSchema is the GraphQL schema. Its resolvers get the database from
+// the graphQLLoaders in the context.
+var graphQLSchema = mustGraphQLSchema()
+
+func mustGraphQLSchema() graphql.Schema {
+	scoreType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Score",
+		Description: "A benchmark score.",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "benchmark name",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(database.Score).Name, nil
+				},
+			},
+			"score": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Float),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(database.Score).Score, nil
+				},
+			},
+			"timeMs": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Float),
+				Description: "elapsed time in milliseconds",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return float64(p.Source.(database.Score).Time.Duration) / float64(time.Millisecond), nil
+				},
+			},
+		},
+	})
+
+	specsField := func(t graphql.Output, description string, get func(s *database.Specs) interface{}) *graphql.Field {
+		return &graphql.Field{
+			Type:        t,
+			Description: description,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return get(p.Source.(*database.Specs)), nil
+			},
+		}
+	}
+	str, flt, boolean := graphql.NewNonNull(graphql.String), graphql.NewNonNull(graphql.Float), graphql.NewNonNull(graphql.Boolean)
+	sysInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "SysInfo",
+		Description: "The system information reported by the benchmark client.",
+		Fields: graphql.Fields{
+			"vendor":      specsField(str, "CPU vendor", func(s *database.Specs) interface{} { return s.Vendor }),
+			"model":       specsField(str, "CPU model", func(s *database.Specs) interface{} { return s.Model }),
+			"clockSpeed":  specsField(str, "CPU clock speed", func(s *database.Specs) interface{} { return s.ClockSpeed }),
+			"threads":     specsField(str, "number of CPU threads", func(s *database.Specs) interface{} { return s.Threads }),
+			"overclocked": specsField(boolean, "", func(s *database.Specs) interface{} { return s.Overclocked }),
+			"byteOrder":   specsField(str, "CPU byte order", func(s *database.Specs) interface{} { return s.ByteOrder }),
+			"physicalMem": specsField(str, "physical memory", func(s *database.Specs) interface{} { return s.PhysicalMem }),
+			"virtualMem":  specsField(str, "virtual memory", func(s *database.Specs) interface{} { return s.VirtualMem }),
+			"swapMem":     specsField(str, "swap memory", func(s *database.Specs) interface{} { return s.SwapMem }),
+		},
+	})
+	// The sizes are floats, as they may exceed the 32 bit GraphQL Int.
+	normalizedType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NormalizedSysInfo",
+		Description: "The typed values parsed from the system information.",
+		Fields: graphql.Fields{
+			"model":            specsField(str, "canonical CPU model", func(s *database.Specs) interface{} { return s.Normalized.Model }),
+			"clockSpeedHz":     specsField(flt, "", func(s *database.Specs) interface{} { return float64(s.Normalized.ClockSpeedHz) }),
+			"threads":          specsField(graphql.NewNonNull(graphql.Int), "", func(s *database.Specs) interface{} { return s.Normalized.Threads }),
+			"overclocked":      specsField(boolean, "", func(s *database.Specs) interface{} { return s.Normalized.Overclocked }),
+			"physicalMemBytes": specsField(flt, "", func(s *database.Specs) interface{} { return float64(s.Normalized.PhysicalMemBytes) }),
+			"virtualMemBytes":  specsField(flt, "", func(s *database.Specs) interface{} { return float64(s.Normalized.VirtualMemBytes) }),
+			"swapMemBytes":     specsField(flt, "", func(s *database.Specs) interface{} { return float64(s.Normalized.SwapMemBytes) }),
+		},
+	})
+	id := graphql.NewNonNull(graphql.ID)
+	specsType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Specs",
+		Description: "The system a result was run on.",
+		Fields: graphql.Fields{
+			"id":         specsField(id, "", func(s *database.Specs) interface{} { return s.ID }),
+			"resultId":   specsField(id, "", func(s *database.Specs) interface{} { return s.ResultID }),
+			"system":     specsField(graphql.NewNonNull(sysInfoType), "", func(s *database.Specs) interface{} { return s }),
+			"normalized": specsField(graphql.NewNonNull(normalizedType), "", func(s *database.Specs) interface{} { return s }),
+		},
+	})
+
+	var userType *graphql.Object
+	resultType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Result",
+		Description: "A benchmark result.",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": &graphql.Field{
+					Type: id,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*database.Result).ID, nil
+					},
+				},
+				"createdAt": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.DateTime),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source.(*database.Result).CreatedAt.UTC(), nil
+					},
+				},
+				"scores": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(scoreType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						scores := p.Source.(*database.Result).Scores
+						if scores == nil {
+							scores = database.Scores{}
+						}
+						return []database.Score(scores), nil
+					},
+				},
+				"user": &graphql.Field{
+					Type:        graphql.NewNonNull(userType),
+					Description: "user who submitted the result",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersOf(p).users.load(p.Source.(*database.Result).UserID), nil
+					},
+				},
+				"specs": &graphql.Field{
+					Type:        specsType,
+					Description: "system the result was run on, null if unknown",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return loadersOf(p).specs.load(p.Source.(*database.Result).ID), nil
+					},
+				},
+			}
+		}),
+	})
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "A user who submits results.",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: id,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*database.UserExternal).ID, nil
+				},
+			},
+			"name": &graphql.Field{
+				Type: str,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*database.UserExternal).Name, nil
+				},
+			},
+			"results": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(resultType))),
+				Description: "results the user submitted, ordered by id",
+				Args:        pageArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, after, err := graphQLPage(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					load := loadersOf(p).resultsPage(limit, after).load(p.Source.(*database.UserExternal).ID)
+					return func() (interface{}, error) {
+						v, err := load()
+						if err != nil {
+							return nil, err
+						}
+						results, _ := v.([]*database.Result)
+						if results == nil {
+							results = []*database.Result{}
+						}
+						return results, nil
+					}, nil
+				},
+			},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Description: "users, ordered by id",
+				Args:        pageArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, after, err := graphQLPage(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return loadersOf(p).db.ListUsersAfter(after, limit)
+				},
+			},
+			"user": &graphql.Field{
+				Type:        userType,
+				Description: "user with the given id, null if there is none",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: id},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArg(p.Args, "id")
+					if err != nil {
+						return nil, err
+					}
+					return loadersOf(p).users.load(id), nil
+				},
+			},
+			"results": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(resultType))),
+				Description: "results, ordered by id",
+				Args:        pageArgs(),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					limit, after, err := graphQLPage(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					return loadersOf(p).db.ListResultsAfter(after, limit)
+				},
+			},
+			"result": &graphql.Field{
+				Type:        resultType,
+				Description: "result with the given id, null if there is none",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: id},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := idArg(p.Args, "id")
+					if err != nil {
+						return nil, err
+					}
+					res, err := loadersOf(p).db.GetResult(id)
+					if errors.Is(err, database.ErrNotFound) {
+						return nil, nil
+					}
+					return res, err
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
@@ -0,0 +1,193 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// countingDB counts the calls to the methods the GraphQL loaders batch.
+type countingDB struct {
+	*dbtest.DB
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (db *countingDB) count(method string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls[method]++
+}
+
+func (db *countingDB) GetUsers(ids []int64) ([]*database.UserExternal, error) {
+	db.count("GetUsers")
+	return db.DB.GetUsers(ids)
+}
+
+func (db *countingDB) ListUsers() ([]*database.UserExternal, error) {
+	db.count("ListUsers")
+	return db.DB.ListUsers()
+}
+
+func (db *countingDB) ListSpecs() ([]*database.Specs, error) {
+	db.count("ListSpecs")
+	return db.DB.ListSpecs()
+}
+
+func (db *countingDB) ListSpecsWithResultIDs(ids []int64) ([]*database.Specs, error) {
+	db.count("ListSpecsWithResultIDs")
+	return db.DB.ListSpecsWithResultIDs(ids)
+}
+
+func (db *countingDB) ListResults() ([]*database.Result, error) {
+	db.count("ListResults")
+	return db.DB.ListResults()
+}
+
+func (db *countingDB) ListResultsCreatedByUsersAfter(ids []int64, after int64, limit int) ([]*database.Result, error) {
+	db.count("ListResultsCreatedByUsersAfter")
+	return db.DB.ListResultsCreatedByUsersAfter(ids, after, limit)
+}
+
+// graphQLResult is the response to a GraphQL request.
+type graphQLResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func postGraphQL(t *testing.T, h http.Handler, query string, variables map[string]interface{}) graphQLResult {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/api/graphql", strings.NewReader(string(body))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	var res graphQLResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestGraphQL(t *testing.T) {
+	db := &countingDB{DB: newFixtureDB(t, catalogFixture()), calls: make(map[string]int)}
+	h := handlers.Handler(db)
+
+	res := postGraphQL(t, h, `query Page($limit: Int) {
+		results(limit: $limit) { id user { name } specs { system { model } } scores { name } }
+	}`, map[string]interface{}{"limit": 2})
+	if len(res.Errors) > 0 {
+		t.Fatalf("results: unexpected errors %+v", res.Errors)
+	}
+	want := `{"results":[` +
+		`{"id":"3","scores":[],"specs":{"system":{"model":"Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz"}},"user":{"name":"test"}},` +
+		`{"id":"5","scores":[],"specs":{"system":{"model":"Intel Core i7-8750H"}},"user":{"name":"test"}}]}`
+	if string(res.Data) != want {
+		t.Errorf("results:\nwant %s\ngot  %s", want, res.Data)
+	}
+	// The user of both results is loaded once, and their specs together,
+	// without listing all users or specs.
+	if db.calls["GetUsers"] != 1 || db.calls["ListUsers"] != 0 || db.calls["ListSpecsWithResultIDs"] != 1 || db.calls["ListSpecs"] != 0 {
+		t.Errorf("results: unexpected database calls %v", db.calls)
+	}
+
+	db.calls = make(map[string]int)
+	res = postGraphQL(t, h, `{ users { name results(after: "3") { id } } }`, nil)
+	if len(res.Errors) > 0 {
+		t.Errorf("users: unexpected errors %+v", res.Errors)
+	}
+	if want := `{"users":[{"name":"admin","results":[]},{"name":"test","results":[{"id":"5"},{"id":"7"}]}]}`; string(res.Data) != want {
+		t.Errorf("users:\nwant %s\ngot  %s", want, res.Data)
+	}
+	if db.calls["ListResultsCreatedByUsersAfter"] != 1 || db.calls["ListResults"] != 0 || db.calls["ListUsers"] != 0 {
+		t.Errorf("users: results are not loaded together a page at a time %v", db.calls)
+	}
+
+	db.calls = make(map[string]int)
+	res = postGraphQL(t, h, `{ users(after: "1", limit: 1) { name first: results(limit: 1) { id } rest: results(after: "5") { id } } }`, nil)
+	if want := `{"users":[{"first":[{"id":"3"}],"name":"test","rest":[{"id":"7"}]}]}`; len(res.Errors) > 0 || string(res.Data) != want {
+		t.Errorf("pages:\nwant %s\ngot  %s %+v", want, res.Data, res.Errors)
+	}
+	if db.calls["ListResultsCreatedByUsersAfter"] != 2 || db.calls["ListUsers"] != 0 {
+		t.Errorf("pages: want a query per page, got %v", db.calls)
+	}
+
+	res = postGraphQL(t, h, `{ results(after: "7") { id } }`, nil)
+	if want := `{"results":[]}`; string(res.Data) != want {
+		t.Errorf("last page:\nwant %s\ngot  %s", want, res.Data)
+	}
+
+	res = postGraphQL(t, h, `{ user(id: 9) { name } result(id: "3") { user { id } } }`, nil)
+	if want := `{"result":{"user":{"id":"2"}},"user":null}`; string(res.Data) != want {
+		t.Errorf("by id:\nwant %s\ngot  %s", want, res.Data)
+	}
+
+	q := url.Values{"query": {`query($id: ID!) { result(id: $id) { id } }`}, "variables": {`{"id": "7"}`}}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/graphql?"+q.Encode(), nil))
+	if want := `{"data":{"result":{"id":"7"}}}` + "\n"; rec.Body.String() != want {
+		t.Errorf("GET: want %s, got %s", want, rec.Body)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, catalogFixture()))
+
+	for name, test := range map[string]struct {
+		query     string
+		variables map[string]interface{}
+		err       string
+	}{
+		"depth": {
+			query: `{ users { results { user { results { user { results { user { name } } } } } } } }`,
+			err:   "query depth 8 exceeds the limit of 7",
+		},
+		"complexity": {
+			query: `{ users(limit: 1000) { results(limit: 1000) { id } } }`,
+			err:   "query complexity exceeds the limit of 10000",
+		},
+		"complexity with variables": {
+			query:     `query($n: Int) { users(limit: $n) { results(limit: $n) { id } } }`,
+			variables: map[string]interface{}{"n": 200},
+			err:       "query complexity exceeds the limit of 10000",
+		},
+		"complexity through fragments": {
+			query: `{ users(limit: 200) { ...R } } fragment R on User { results(limit: 200) { id } }`,
+			err:   "query complexity exceeds the limit of 10000",
+		},
+		"limit": {
+			query: `{ results(limit: 0) { id } }`,
+			err:   "limit: want 1 to 1000",
+		},
+		"validation": {
+			query: `{ results { password } }`,
+			err:   `Cannot query field "password" on type "Result".`,
+		},
+	} {
+		res := postGraphQL(t, h, test.query, test.variables)
+		if len(res.Errors) != 1 || res.Errors[0].Message != test.err {
+			t.Errorf("%s: want error %q, got %+v", name, test.err, res.Errors)
+		}
+	}
+
+	// Introspection is not limited by depth.
+	res := postGraphQL(t, h, `{ __schema { types { name fields { name type { name ofType { name ofType { name ofType { name } } } } } } } }`, nil)
+	if len(res.Errors) > 0 {
+		t.Errorf("introspection: unexpected errors %+v", res.Errors)
+	}
+}
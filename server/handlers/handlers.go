@@ -2,26 +2,87 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
 	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/dataset"
+	"github.com/mguid65/osb-website/server/events"
+	"github.com/mguid65/osb-website/server/webhooks"
 )
 
+// Option configures optional features of the route handler.
+type Option func(*options)
+
+type options struct {
+	datasets *dataset.Store
+	events   *events.Bus
+	siteURL  *url.URL
+	webhooks *webhooks.Dispatcher
+}
+
+// defaultSiteURL is the site URL unless WithSiteURL sets it.
+var defaultSiteURL = &url.URL{Scheme: "https", Host: "localhost"}
+
+// WithSiteURL sets the URL the site is served at, which feeds link to and
+// identify their entries by. It must not change once feeds are published.
+func WithSiteURL(u *url.URL) Option {
+	return func(o *options) { o.siteURL = u }
+}
+
+// WithDatasets serves the open-data snapshots in store under /api/datasets.
+func WithDatasets(store *dataset.Store) Option {
+	return func(o *options) { o.datasets = store }
+}
+
 // Handler returns the OSB website route handler.
-func Handler(db database.OSBDatabase) *mux.Router {
+func Handler(db database.OSBDatabase, opts ...Option) *mux.Router {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.events == nil {
+		o.events = events.NewBus(defaultEventReplay)
+	}
+	if o.webhooks == nil {
+		o.webhooks = webhooks.NewDispatcher(db, nil)
+	}
+	if o.siteURL == nil {
+		o.siteURL = defaultSiteURL
+	}
+
 	r := mux.NewRouter()
+	r.Use(withRequestID)
 	api := r.PathPrefix("/api/").Subrouter()
+	v1 := api.PathPrefix("/v1/").Subrouter()
+	addV1Handlers(v1, db, o.events)
+	addWebhookHandlers(v1, db, o.webhooks)
+	addEventHandlers(api, o.events)
+	addGraphQLHandlers(api, db)
+	// The remaining /api routes are the legacy API used by the website.
+	// Their responses are pinned by the contract tests and must not change.
+	addBadgeHandlers(r, db)
+	addFeedHandlers(r, db, o.siteURL)
 	addRootHandler(r)
 	addUserHandlers(api, db)
-	addResultHandlers(api, db)
+	addResultHandlers(api, db, o.events)
 	addSpecsHandlers(api, db)
+	addCPUHandlers(api, db)
+	addStatsHandlers(api, db)
+	addChartHandlers(api, db)
+	addDatasetHandlers(api, o.datasets)
+	addDocsHandlers(api)
 	return r
 }
 
 func addRootHandler(r *mux.Router) {
-        r.PathPrefix("/downloads/").Handler(http.StripPrefix("/downloads/", http.FileServer(http.Dir("./build/release"))))
+	r.PathPrefix("/downloads/").Handler(http.StripPrefix("/downloads/", http.FileServer(http.Dir("./build/release"))))
 	r.PathPrefix("/static/css/").Handler(http.StripPrefix("/static/css/", http.FileServer(http.Dir("./build/static/css"))))
 	r.PathPrefix("/static/js/").Handler(http.StripPrefix("/static/js/", http.FileServer(http.Dir("./build/static/js"))))
 	r.PathPrefix("/service-worker.js").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -41,19 +102,27 @@ func addRootHandler(r *mux.Router) {
 	})
 }
 
+func addBadgeHandlers(r *mux.Router, db database.OSBDatabase) {
+	r.HandleFunc("/badge/result/{id:[0-9]+}.svg", GetResultBadge(db)).Methods(http.MethodGet)
+	r.HandleFunc("/badge/user/{id:[0-9]+}/best.svg", GetUserBestBadge(db)).Methods(http.MethodGet)
+}
+
 func addUserHandlers(r *mux.Router, db database.OSBDatabase) {
 	r.HandleFunc("/users", ListUsers(db)).Methods(http.MethodGet)
 	r.HandleFunc("/users/{id:[0-9]+}", GetUser(db)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{id:[0-9]+}/trends", GetUserTrends(db)).Methods(http.MethodGet)
 	r.HandleFunc("/users/register", AddUser(db)).Methods(http.MethodPost)
 	//r.HandleFunc("/users/delete/{id:[0-9]+}", DeleteUser(db)).Methods(http.MethodPost)
 	//r.HandleFunc("/users/update/{id:[0-9]+}", UpdateUser(db)).Methods(http.MethodPost)
 }
 
-func addResultHandlers(r *mux.Router, db database.OSBDatabase) {
+func addResultHandlers(r *mux.Router, db database.OSBDatabase, bus *events.Bus) {
 	r.HandleFunc("/results", ListResults(db)).Methods(http.MethodGet)
 	r.HandleFunc("/results/user/{id:[0-9]+}", ListResultsCreatedBy(db)).Methods(http.MethodGet)
 	r.HandleFunc("/results/{id:[0-9]+}", GetResult(db)).Methods(http.MethodGet)
-	r.HandleFunc("/results/submit", AddResult(db)).Methods(http.MethodPost)
+	r.HandleFunc("/results/submit", AddResult(db, bus)).Methods(http.MethodPost)
+	r.HandleFunc("/compare", CompareResults(db)).Methods(http.MethodGet)
+	r.HandleFunc("/leaderboard", GetLeaderboard(db)).Methods(http.MethodGet)
 	//r.HandleFunc("/results/delete/{id:[0-9]+}", DeleteResult(db)).Methods(http.MethodPost)
 	//r.HandleFunc("/results/update/{id:[0-9]+}", UpdateResult(db)).Methods(http.MethodPost)
 }
@@ -67,13 +136,136 @@ func addSpecsHandlers(r *mux.Router, db database.OSBDatabase) {
 	//r.HandleFunc("/specs/update/{id:[0-9]+}", UpdateSpecs(db)).Methods(http.MethodPost)
 }
 
+func addCPUHandlers(r *mux.Router, db database.OSBDatabase) {
+	r.HandleFunc("/cpus", ListCPUs(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/{id:[0-9]+}", GetCPU(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/{id:[0-9]+}/results", ListResultsByCPU(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/{id:[0-9]+}/aliases", ListCPUAliases(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/add", AddCPU(db)).Methods(http.MethodPost)
+	r.HandleFunc("/cpus/delete/{id:[0-9]+}", DeleteCPU(db)).Methods(http.MethodPost)
+	r.HandleFunc("/cpus/{id:[0-9]+}/aliases/add", AddCPUAlias(db)).Methods(http.MethodPost)
+	r.HandleFunc("/cpus/aliases/delete/{id:[0-9]+}", DeleteCPUAlias(db)).Methods(http.MethodPost)
+}
+
+func addStatsHandlers(r *mux.Router, db database.OSBDatabase) {
+	r.HandleFunc("/stats", GetStats(db)).Methods(http.MethodGet)
+}
+
+func addChartHandlers(r *mux.Router, db database.OSBDatabase) {
+	r.HandleFunc("/charts/histogram", GetHistogramChart(db)).Methods(http.MethodGet)
+	r.HandleFunc("/charts/compare", GetCompareChart(db)).Methods(http.MethodGet)
+	r.HandleFunc("/charts/users/{id:[0-9]+}/trend", GetTrendChart(db)).Methods(http.MethodGet)
+}
+
+func addDatasetHandlers(r *mux.Router, store *dataset.Store) {
+	r.HandleFunc("/datasets", ListDatasets(store)).Methods(http.MethodGet)
+	r.HandleFunc("/datasets/latest", GetDataset(store)).Methods(http.MethodGet)
+	r.HandleFunc("/datasets/latest/manifest", GetDatasetManifest(store)).Methods(http.MethodGet)
+	r.HandleFunc("/datasets/{id}", GetDataset(store)).Methods(http.MethodGet)
+	r.HandleFunc("/datasets/{id}/manifest", GetDatasetManifest(store)).Methods(http.MethodGet)
+}
+
+func addDocsHandlers(r *mux.Router) {
+	r.HandleFunc("/openapi.json", GetOpenAPI()).Methods(http.MethodGet)
+	r.HandleFunc("/docs", GetDocs()).Methods(http.MethodGet)
+}
+
+// routeID returns the "id" route variable. An id too large to be stored
+// cannot match a row, so it is reported as not found.
+func routeID(r *http.Request) (int64, error) {
+	idStr, ok := mux.Vars(r)["id"]
+	if !ok {
+		return 0, errors.New(`router: no "id" key`)
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("id %s %w", idStr, database.ErrNotFound)
+	}
+	return id, nil
+}
+
+// authDatabase looks up the users requests authenticate as.
+type authDatabase interface {
+	database.UserDatabase
+	database.TokenDatabase
+}
+
+// bearerToken returns the token of a bearer Authorization header, or "".
+func bearerToken(r *http.Request) string {
+	return parseBearer(r.Header.Get("Authorization"))
+}
+
+// parseBearer returns the token of a bearer Authorization value, or "".
+func parseBearer(auth string) string {
+	const prefix = "Bearer "
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+	return ""
+}
+
+// authenticate returns the user identified by the request's API token, sent
+// as a bearer token, or by its basic auth credentials. If there is none, it
+// responds with 401 and returns false.
+func authenticate(w http.ResponseWriter, r *http.Request, db authDatabase) (*database.User, bool) {
+	var (
+		user *database.User
+		err  error
+	)
+	if secret := bearerToken(r); secret != "" {
+		user, err = db.GetUserByToken(database.HashTokenSecret(secret))
+	} else if username, password, ok := r.BasicAuth(); ok {
+		user, err = db.GetUserByCredentials(username, password)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Basic realm="OSB"`)
+		sendErrorStatus(w, r, http.StatusUnauthorized, "credentials required")
+		return nil, false
+	}
+
+	if errors.Is(err, database.ErrNotFound) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="OSB"`)
+		sendErrorStatus(w, r, http.StatusUnauthorized, "invalid credentials")
+		return nil, false
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+// authenticateAdmin is like authenticate but also requires the user to be an
+// admin, responding with 403 otherwise.
+func authenticateAdmin(w http.ResponseWriter, r *http.Request, db authDatabase) (*database.User, bool) {
+	user, ok := authenticate(w, r, db)
+	if !ok {
+		return nil, false
+	}
+	if !user.Admin {
+		sendErrorStatus(w, r, http.StatusForbidden, "admin access required")
+		return nil, false
+	}
+	return user, true
+}
+
+// sendJSONResponse responds with data encoded as JSON. It only fails if data
+// cannot be encoded, in which case nothing has been written yet.
 func sendJSONResponse(w http.ResponseWriter, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	setJSONHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+	return nil
+}
+
+// setJSONHeaders sets the headers of a JSON response.
+func setJSONHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
 	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	enc := json.NewEncoder(w)
-	return enc.Encode(data)
 }
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/events"
+	"github.com/mguid65/osb-website/server/ingestpb"
+)
+
+// maxBatchSize is the number of results a SubmitBatch call may submit.
+const maxBatchSize = 1000
+
+// NewIngestServer returns a gRPC server of the ingestion service, see
+// ingestpb. Calls are authenticated with API tokens, and results are
+// validated and saved like those submitted to /api/results/submit, then
+// published on the event bus of WithEvents, if given. The server uses TLS
+// with creds, unless they are nil.
+func NewIngestServer(db database.OSBDatabase, creds credentials.TransportCredentials, opts ...Option) *grpc.Server {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &ingestServer{db: db, bus: o.events}
+	serverOpts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.authenticateUnary),
+		grpc.StreamInterceptor(s.authenticateStream),
+	}
+	if creds != nil {
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(serverOpts...)
+	ingestpb.RegisterIngestServer(srv, s)
+	return srv
+}
+
+// ingestServer implements ingestpb.IngestServer.
+type ingestServer struct {
+	ingestpb.UnimplementedIngestServer
+
+	db  database.OSBDatabase
+	bus *events.Bus
+}
+
+// ingestUserKey is the context key of the user a call authenticated as.
+type ingestUserKey struct{}
+
+// authenticate returns ctx with the user identified by the API token in the
+// authorization metadata of the call.
+func (s *ingestServer) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var secret string
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		secret = parseBearer(auth[0])
+	}
+	if secret == "" {
+		return nil, status.Error(codes.Unauthenticated, "API token required")
+	}
+	user, err := s.db.GetUserByToken(database.HashTokenSecret(secret))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "invalid API token")
+	}
+	if err != nil {
+		return nil, ingestStatus(err)
+	}
+	return context.WithValue(ctx, ingestUserKey{}, user), nil
+}
+
+func (s *ingestServer) authenticateUnary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *ingestServer) authenticateStream(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, authenticatedStream{ss, ctx})
+}
+
+// authenticatedStream is a server stream with the context of authenticate.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// Submit submits a result.
+func (s *ingestServer) Submit(ctx context.Context, req *ingestpb.SubmitRequest) (*ingestpb.SubmitResponse, error) {
+	resultID, replayed, err := s.submit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &ingestpb.SubmitResponse{ResultId: resultID, Replayed: replayed}, nil
+}
+
+// SubmitBatch submits the results of a stream, each independently of the
+// others, and responds with the outcome of each. A request past the first
+// maxBatchSize is rejected with ResourceExhausted and ends the batch, so the
+// response still reports the results already saved.
+func (s *ingestServer) SubmitBatch(stream ingestpb.Ingest_SubmitBatchServer) error {
+	resp := &ingestpb.SubmitBatchResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+		if len(resp.Items) == maxBatchSize {
+			resp.Items = append(resp.Items, &ingestpb.BatchItem{
+				Code:  int32(codes.ResourceExhausted),
+				Error: fmt.Sprintf("at most %d results can be submitted per batch", maxBatchSize),
+			})
+			return stream.SendAndClose(resp)
+		}
+
+		item := &ingestpb.BatchItem{}
+		resultID, replayed, err := s.submit(stream.Context(), req)
+		if err != nil {
+			st := status.Convert(err)
+			item.Code, item.Error = int32(st.Code()), st.Message()
+		} else {
+			item.ResultId, item.Replayed = resultID, replayed
+			if !replayed {
+				resp.Submitted++
+			}
+		}
+		resp.Items = append(resp.Items, item)
+	}
+}
+
+// submit submits the result of req, see submitResult, and returns a status
+// error if it fails.
+func (s *ingestServer) submit(ctx context.Context, req *ingestpb.SubmitRequest) (resultID int64, replayed bool, err error) {
+	user := ctx.Value(ingestUserKey{}).(*database.User)
+	sub, err := newIngestSubmission(req)
+	if err != nil {
+		return 0, false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	submitted, replayed, err := submitResult(s.db, s.bus, user, sub, req.GetIdempotencyKey())
+	if err != nil {
+		return 0, false, ingestStatus(err)
+	}
+	return submitted.ResultID, replayed, nil
+}
+
+// newIngestSubmission returns the submission of req. It is the same as if
+// the request was sent to /api/results/submit as JSON, so that identical
+// submissions are recognized whichever way they are sent.
+func newIngestSubmission(req *ingestpb.SubmitRequest) (*submission, error) {
+	sub := &submission{}
+	for _, score := range req.GetScores() {
+		if score.GetTime() != nil {
+			if err := score.GetTime().CheckValid(); err != nil {
+				return nil, err
+			}
+		}
+		sub.Scores = append(sub.Scores, database.Score{
+			Name:  score.GetName(),
+			Time:  database.Duration{Duration: score.GetTime().AsDuration()},
+			Score: score.GetScore(),
+		})
+	}
+	if info := req.GetSysInfo(); info != nil {
+		sub.SysInfo = database.SysInfo{
+			Vendor:      info.GetVendor(),
+			Model:       info.GetModel(),
+			ClockSpeed:  info.GetClockSpeed(),
+			Threads:     info.GetThreads(),
+			Overclocked: info.GetOverclocked(),
+			ByteOrder:   info.GetByteOrder(),
+			PhysicalMem: info.GetPhysicalMem(),
+			VirtualMem:  info.GetVirtualMem(),
+			SwapMem:     info.GetSwapMem(),
+		}
+	}
+	if req.GetCreatedAt() != nil {
+		if err := req.GetCreatedAt().CheckValid(); err != nil {
+			return nil, err
+		}
+		t := req.GetCreatedAt().AsTime()
+		sub.CreatedAt = &t
+	}
+	return sub, nil
+}
+
+// ingestStatus returns the status error of an error of submitResult, with
+// the code matching the HTTP status /api/results/submit responds with. Like
+// that of sendError, the message of any other error is logged rather than sent.
+func ingestStatus(err error) error {
+	var rejected *rejectedError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &rejected) && rejected.status == http.StatusConflict:
+		return status.Error(codes.AlreadyExists, rejected.msg)
+	case errors.As(err, &rejected):
+		return status.Error(codes.InvalidArgument, rejected.msg)
+	case errors.Is(err, database.ErrConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, database.ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	log.Printf("ingest: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,202 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/events"
+	"github.com/mguid65/osb-website/server/handlers"
+	"github.com/mguid65/osb-website/server/ingestpb"
+)
+
+// newIngestClient serves the ingestion service over an in-memory connection
+// and returns a client of it.
+func newIngestClient(t *testing.T, db database.OSBDatabase, opts ...handlers.Option) ingestpb.IngestClient {
+	lis := bufconn.Listen(1 << 20)
+	srv := handlers.NewIngestServer(db, nil, opts...)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ingestpb.NewIngestClient(conn)
+}
+
+func ingestRequest(total float64) *ingestpb.SubmitRequest {
+	return &ingestpb.SubmitRequest{
+		Scores: []*ingestpb.Score{
+			{Name: "Total", Time: durationpb.New(1500 * time.Millisecond), Score: total},
+		},
+		SysInfo: &ingestpb.SysInfo{Vendor: "GenuineIntel", Model: "Intel Core i7-8750H", ClockSpeed: "2.2GHz", Threads: "12"},
+	}
+}
+
+func TestIngest(t *testing.T) {
+	db := newFixtureDB(t, catalogFixture())
+	secret, hash, err := database.NewTokenSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddToken(&database.Token{UserID: 2, Name: "fleet", Hash: hash, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus(10)
+	sub, _ := bus.Subscribe(0, 10)
+	defer sub.Close()
+	client := newIngestClient(t, db, handlers.WithEvents(bus))
+
+	ctx := context.Background()
+	if _, err := client.Submit(ctx, ingestRequest(100)); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: want Unauthenticated, got %v", err)
+	}
+	bad := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer osb_wrong")
+	if _, err := client.Submit(bad, ingestRequest(100)); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong token: want Unauthenticated, got %v", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+secret)
+	req := ingestRequest(100)
+	req.IdempotencyKey = "run-1"
+	resp, err := client.Submit(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.GetResult(resp.ResultId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.UserID != 2 || len(res.Scores) != 1 || res.Scores[0].Time.Duration != 1500*time.Millisecond {
+		t.Errorf("unexpected result %+v", res)
+	}
+	specs, err := db.ListSpecsWithResultID(resp.ResultId)
+	if err != nil || len(specs) != 1 || specs[0].Normalized.Threads != 12 {
+		t.Errorf("unexpected specs %+v, %v", specs, err)
+	}
+	select {
+	case e := <-sub.C:
+		if e.Type != events.ResultCreated {
+			t.Errorf("want %s event, got %s", events.ResultCreated, e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Error("submission was not published")
+	}
+
+	replay, err := client.Submit(ctx, req)
+	if err != nil || !replay.Replayed || replay.ResultId != resp.ResultId {
+		t.Errorf("replay: want result %d replayed, got %+v, %v", resp.ResultId, replay, err)
+	}
+	if _, err := client.Submit(ctx, ingestRequest(100)); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("duplicate: want AlreadyExists, got %v", err)
+	}
+
+	stream, err := client.SubmitBatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := ingestRequest(300)
+	future.CreatedAt = timestamppb.New(time.Now().Add(time.Hour))
+	for _, req := range []*ingestpb.SubmitRequest{ingestRequest(200), future, req, ingestRequest(400)} {
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Submitted != 2 || len(batch.Items) != 4 {
+		t.Fatalf("batch: want 2 of 4 submitted, got %+v", batch)
+	}
+	if item := batch.Items[1]; item.ResultId != 0 || codes.Code(item.Code) != codes.InvalidArgument || item.Error != "created_at is in the future" {
+		t.Errorf("batch: want the future run rejected, got %+v", item)
+	}
+	if item := batch.Items[2]; !item.Replayed || item.ResultId != resp.ResultId {
+		t.Errorf("batch: want the first result replayed, got %+v", item)
+	}
+	for _, i := range []int{0, 3} {
+		if _, err := db.GetResult(batch.Items[i].ResultId); err != nil {
+			t.Errorf("batch: item %d: %v", i, err)
+		}
+	}
+}
+
+func TestIngestBatchOverflow(t *testing.T) {
+	db := newFixtureDB(t, catalogFixture())
+	secret, hash, err := database.NewTokenSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddToken(&database.Token{UserID: 2, Name: "fleet", Hash: hash, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	client := newIngestClient(t, db)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+secret)
+	before, err := db.ListResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const sent = 1002 // one past the limit and one more
+	stream, err := client.SubmitBatch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < sent; i++ {
+		if err := stream.Send(ingestRequest(float64(1000 + i))); err == io.EOF {
+			break // the server ended the batch
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("overflow: want the outcomes of the saved results, got %v", err)
+	}
+	if batch.Submitted != 1000 || len(batch.Items) != 1001 {
+		t.Fatalf("overflow: want 1000 submitted and 1 rejected, got %d submitted of %d", batch.Submitted, len(batch.Items))
+	}
+	if item := batch.Items[1000]; item.ResultId != 0 || codes.Code(item.Code) != codes.ResourceExhausted {
+		t.Errorf("overflow: want the 1001st result rejected, got %+v", item)
+	}
+	if after, _ := db.ListResults(); len(after)-len(before) != 1000 {
+		t.Errorf("overflow: want 1000 results saved, got %d", len(after)-len(before))
+	}
+}
+
+// failingTokenDB fails to look up tokens with an error detailing the database.
+type failingTokenDB struct {
+	*dbtest.DB
+}
+
+func (db failingTokenDB) GetUserByToken(hash string) (*database.User, error) {
+	return nil, errors.New("dial tcp 10.0.0.5:3306: connection refused")
+}
+
+func TestIngestInternalError(t *testing.T) {
+	client := newIngestClient(t, failingTokenDB{newFixtureDB(t, catalogFixture())})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer osb_secret")
+	_, err := client.Submit(ctx, ingestRequest(100))
+	if s := status.Convert(err); s.Code() != codes.Internal || s.Message() != "internal error" {
+		t.Errorf("got %v, want Internal without details", err)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// leaderboardEntry is a ranked result on the leaderboard.
+type leaderboardEntry struct {
+	Rank       int               `json:"rank"`
+	ResultID   int64             `json:"result_id"`
+	UserID     int64             `json:"user_id"`
+	User       string            `json:"user"`
+	CreatedAt  time.Time         `json:"created_at"`
+	TotalScore float64           `json:"total_score"`
+	TotalTime  database.Duration `json:"total_time"`
+	Scores     database.Scores   `json:"scores"`
+	SysInfo    *database.SysInfo `json:"specs"` // nil if the result has no specs
+}
+
+// GetLeaderboard returns all results with a Total score ranked by it, best
+// first and by ID among equal scores, along with their users and specs. The
+// entries are streamed a page at a time. Requested as CSV or NDJSON, each
+// entry is flattened into a row like in ListResults.
+func GetLeaderboard(db database.OSBDatabase) http.HandlerFunc {
+	return leaderboardHandler(db, func(e *leaderboardEntry) interface{} { return e })
+}
+
+// leaderboardHandler serves the leaderboard, encoding each entry in JSON as
+// item returns it.
+func leaderboardHandler(db database.OSBDatabase, item func(*leaderboardEntry) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := negotiateFormat(r)
+		if err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var benchmarks, columns []string
+		if format != formatJSON {
+			if benchmarks, err = db.ListBenchmarks(); err != nil {
+				sendError(w, r, err)
+				return
+			}
+			columns = append(append([]string{"rank", "result_id", "user_id", "user", "created_at"}, sysInfoColumns...), scoreColumns(benchmarks)...)
+		}
+
+		sendList(w, r, format, "leaderboard", columns, "[]", func(emit func(interface{}, func() []interface{}) error) error {
+			rank := 0
+			score, after := math.MaxFloat64, int64(0)
+			for {
+				entries, err := leaderboardPage(db, score, after)
+				if err != nil {
+					return err
+				}
+				for _, e := range entries {
+					e := e
+					rank++
+					e.Rank = rank
+					err := emit(item(e), func() []interface{} {
+						return concat(
+							[]interface{}{e.Rank, e.ResultID, e.UserID, e.User, e.CreatedAt},
+							sysInfoValues(e.SysInfo),
+							scoreValues(e.Scores, benchmarks),
+						)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				if len(entries) < streamPageSize {
+					return nil
+				}
+				last := entries[len(entries)-1]
+				score, after = last.TotalScore, last.ResultID
+			}
+		})
+	}
+}
+
+// leaderboardPage returns the unranked leaderboard entries of up to
+// streamPageSize results ranked after the result with the given Total score
+// and ID, with the users and specs of just these results.
+func leaderboardPage(db database.OSBDatabase, score float64, after int64) ([]*leaderboardEntry, error) {
+	results, err := db.ListRankedResultsAfter(score, after, streamPageSize)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := specsOfResults(db, results)
+	if err != nil {
+		return nil, err
+	}
+	var userIDs []int64
+	for _, res := range results {
+		userIDs = append(userIDs, res.UserID)
+	}
+	names, err := userNames(db, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*leaderboardEntry, 0, len(results))
+	for _, res := range results {
+		for _, score := range res.Scores {
+			if score.Name != "Total" {
+				continue
+			}
+			entries = append(entries, &leaderboardEntry{
+				ResultID:   res.ID,
+				UserID:     res.UserID,
+				User:       names[res.UserID],
+				CreatedAt:  res.CreatedAt,
+				TotalScore: score.Score,
+				TotalTime:  score.Time,
+				Scores:     res.Scores,
+				SysInfo:    sysInfoOf(specs[res.ID]),
+			})
+			break
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mguid65/osb-website/server/events"
+)
+
+const (
+	// maxLiveConnsPerIP is the number of live result feeds a client address
+	// may have open at once.
+	maxLiveConnsPerIP = 8
+	// liveBuffer is the number of results a live feed may fall behind by
+	// before it is disconnected.
+	liveBuffer = 32
+	// livePingPeriod is the interval of the pings keeping a live feed open.
+	// A feed whose client does not answer within livePongWait is closed.
+	livePingPeriod = 30 * time.Second
+	livePongWait   = 2 * livePingPeriod
+	// liveWriteWait is the time allowed to write a message to a live feed.
+	liveWriteWait = 10 * time.Second
+	// maxLiveMessage is the size limit of messages from clients.
+	maxLiveMessage = 4096
+)
+
+// liveFilter selects the results a live feed sends. Empty fields match all
+// results; vendor and model match case-insensitive substrings, so "intel"
+// matches GenuineIntel, and benchmark matches the name of a score.
+type liveFilter struct {
+	Vendor    string `json:"vendor"`
+	Model     string `json:"model"`
+	Benchmark string `json:"benchmark"`
+}
+
+// match reports whether the result of e matches f.
+func (f *liveFilter) match(e *resultEventV1) bool {
+	if f.Vendor != "" || f.Model != "" {
+		if e.Specs == nil {
+			return false
+		}
+		if !containsFold(e.Specs.System.Vendor, f.Vendor) {
+			return false
+		}
+		if !containsFold(e.Specs.System.Model, f.Model) && !containsFold(e.Specs.Normalized.Model, f.Model) {
+			return false
+		}
+	}
+	if f.Benchmark != "" {
+		for _, s := range e.Result.Scores {
+			if strings.EqualFold(s.Name, f.Benchmark) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// liveMessage is a message sent on a live feed.
+type liveMessage struct {
+	Type    string      `json:"type"` // "subscribed", "result" or "error"
+	Filter  *liveFilter `json:"filter,omitempty"`
+	Message string      `json:"message,omitempty"`
+	*resultEventV1
+}
+
+// connLimiter caps the concurrent connections per client address.
+type connLimiter struct {
+	mu    sync.Mutex
+	max   int
+	conns map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	return &connLimiter{max: max, conns: make(map[string]int)}
+}
+
+// acquire counts a connection from addr, unless it has the maximum open
+// already.
+func (l *connLimiter) acquire(addr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[addr] >= l.max {
+		return false
+	}
+	l.conns[addr]++
+	return true
+}
+
+// release uncounts a connection from addr.
+func (l *connLimiter) release(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[addr]--; l.conns[addr] <= 0 {
+		delete(l.conns, addr)
+	}
+}
+
+// clientIP returns the IP address of the client of r. The server is not run
+// behind a proxy, so it is the address of the connection.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+var liveUpgrader = websocket.Upgrader{
+	// The feed only serves public results, and the API allows requests
+	// from any origin.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// LiveResults is a WebSocket feed of the results published on bus as they
+// are submitted. The client sends a filter as a JSON object, such as
+// {"vendor": "intel", "benchmark": "Total"}, and then receives the matching
+// results with their specs. Sending another filter replaces it.
+//
+// The server pings the client to keep the connection open and closes it
+// when the client stops answering. A client that falls behind the submitted
+// results is disconnected with close code 1013 (try again later).
+func LiveResults(bus *events.Bus) http.HandlerFunc {
+	limiter := newConnLimiter(maxLiveConnsPerIP)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !limiter.acquire(ip) {
+			sendErrorStatus(w, r, http.StatusTooManyRequests, "too many live connections")
+			return
+		}
+		defer limiter.release(ip)
+
+		conn, err := liveUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has responded with an error.
+			return
+		}
+		defer conn.Close()
+
+		sub, _ := bus.Subscribe(0, liveBuffer)
+		defer sub.Close()
+
+		filters := make(chan *liveFilter)
+		done, stop := make(chan struct{}), make(chan struct{})
+		defer close(stop)
+		go readLiveFilters(conn, filters, done, stop)
+
+		ping := time.NewTicker(livePingPeriod)
+		defer ping.Stop()
+		var filter *liveFilter // nil until the client subscribes
+		for {
+			var msg *liveMessage
+			select {
+			case <-done:
+				return
+			case f := <-filters:
+				if f == nil {
+					msg = &liveMessage{Type: "error", Message: "invalid filter, want an object with vendor, model or benchmark"}
+				} else {
+					filter = f
+					msg = &liveMessage{Type: "subscribed", Filter: f}
+				}
+			case e, ok := <-sub.C:
+				if !ok {
+					if sub.Lagged() {
+						log.Printf("disconnected live feed of %s, which fell behind", ip)
+						closeLive(conn, websocket.CloseTryAgainLater, "fell behind")
+					}
+					return
+				}
+				v, ok := e.Data.(resultEventV1)
+				if e.Type != events.ResultCreated || !ok || filter == nil || !filter.match(&v) {
+					continue
+				}
+				msg = &liveMessage{Type: "result", resultEventV1: &v}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+					return
+				}
+				continue
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readLiveFilters reads the filters sent on conn until it fails or stop is
+// closed, sending them to filters, or nil for invalid ones. It closes done
+// when it returns.
+func readLiveFilters(conn *websocket.Conn, filters chan<- *liveFilter, done, stop chan struct{}) {
+	defer close(done)
+	conn.SetReadLimit(maxLiveMessage)
+	conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(livePongWait))
+		f := new(liveFilter)
+		if err := json.Unmarshal(data, f); err != nil {
+			f = nil
+		}
+		select {
+		case filters <- f:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// closeLive sends a close message to conn.
+func closeLive(conn *websocket.Conn, code int, text string) {
+	msg := websocket.FormatCloseMessage(code, text)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(liveWriteWait))
+}
@@ -0,0 +1,115 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestLiveResults(t *testing.T) {
+	srv := httptest.NewServer(handlers.Handler(newFixtureDB(t, catalogFixture())))
+	t.Cleanup(srv.Close)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/results/live"
+
+	dial := func() (*websocket.Conn, *http.Response, error) {
+		conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, resp, err
+	}
+	type message struct {
+		Type   string `json:"type"`
+		Result *struct {
+			ID int64 `json:"id"`
+		} `json:"result"`
+		Specs *struct {
+			System struct {
+				Model string `json:"model"`
+			} `json:"system"`
+		} `json:"specs"`
+	}
+	read := func(conn *websocket.Conn) message {
+		t.Helper()
+		var msg message
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	subscribe := func(filter string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(filter)); err != nil {
+			t.Fatal(err)
+		}
+		if msg := read(conn); msg.Type != "subscribed" {
+			t.Fatalf("%s: want subscribed message, got %+v", filter, msg)
+		}
+		return conn
+	}
+	amd := subscribe(`{"vendor": "amd"}`)
+	i7 := subscribe(`{"vendor": "intel", "model": "I7-8750H", "benchmark": "total"}`)
+
+	for _, body := range []string{
+		`{"scores": [{"name": "Total", "score": 1000}], "specs": {"vendor": "GenuineIntel", "model": "Intel(R) Core(TM) i5-8250U CPU"}}`,
+		`{"scores": [{"name": "Total", "score": 2000}], "specs": {"vendor": "AuthenticAMD", "model": "AMD Ryzen 7 3700X"}}`,
+		`{"scores": [{"name": "Total", "score": 3000}], "specs": {"vendor": "GenuineIntel", "model": "Intel(R) Core(TM) i7-8750H CPU @ 2.20GHz"}}`,
+	} {
+		req, err := http.NewRequest("POST", srv.URL+"/api/v1/results", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("test", "password")
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("submit: status code: want %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	if msg := read(amd); msg.Type != "result" || msg.Specs == nil || msg.Specs.System.Model != "AMD Ryzen 7 3700X" {
+		t.Errorf("amd: want the Ryzen result, got %+v", msg)
+	}
+	if msg := read(i7); msg.Type != "result" || msg.Specs == nil || !strings.Contains(msg.Specs.System.Model, "i7-8750H") {
+		t.Errorf("i7: want the i7 result, got %+v", msg)
+	}
+
+	if err := i7.WriteMessage(websocket.TextMessage, []byte("intel")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := read(i7); msg.Type != "error" {
+		t.Errorf("invalid filter: want error message, got %+v", msg)
+	}
+
+	// Two feeds are open already, the rest of the cap is used up next.
+	for i := 2; ; i++ {
+		_, resp, err := dial()
+		if err == nil {
+			if i > 8 {
+				t.Fatal("connections are not capped")
+			}
+			continue
+		}
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("over the cap: want status code %d, got %v", http.StatusTooManyRequests, err)
+		}
+		if i != 8 {
+			t.Errorf("capped after %d connections, want 8", i)
+		}
+		break
+	}
+}
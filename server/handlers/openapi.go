@@ -0,0 +1,571 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/dataset"
+)
+
+// apiParam is a query, header or form parameter of a documented route.
+type apiParam struct {
+	Name        string
+	Description string
+	Type        string   // JSON schema type, string if empty
+	Enum        []string // allowed values, any if empty
+	Required    bool
+}
+
+// apiRoute documents a route in the OpenAPI document. Path variables are
+// taken from the path, and error responses are derived from the other fields.
+type apiRoute struct {
+	Method   string
+	Path     string // mux path template without variable patterns
+	Tag      string
+	Summary  string
+	Auth     string      // "user" or "admin" if authentication is required
+	TextID   bool        // the {id} path variable is not a number
+	Query    []apiParam  // query parameters
+	Headers  []apiParam  // request headers
+	Form     []apiParam  // form encoded request body
+	Formats  bool        // the response can be CSV or NDJSON, see negotiateFormat
+	Request  interface{} // value of the JSON request body type, nil if none
+	Response interface{} // value of the JSON response body type, nil if none
+	Content  string      // content type of a non-JSON response
+}
+
+// Query parameters shared by several routes.
+var (
+	benchmarkParam = apiParam{Name: "benchmark", Description: "benchmark name, Total if empty"}
+	formatParam    = apiParam{Name: "format", Description: "response format, overrides the Accept header", Enum: []string{"json", "csv", "ndjson"}}
+	chartParams    = []apiParam{
+		{Name: "title", Description: "chart title"},
+		{Name: "width", Type: "integer", Description: "width in pixels, 100 to 2000"},
+		{Name: "height", Type: "integer", Description: "height in pixels, 100 to 2000"},
+	}
+	badgeParams = []apiParam{
+		{Name: "label", Description: "left hand text, " + defaultBadgeLabel + " by default"},
+		{Name: "color", Description: "right hand color, a name or hex code"},
+		{Name: "label_color", Description: "left hand color, a name or hex code"},
+	}
+	compareParams = []apiParam{
+		{Name: "ids", Description: "comma separated result ids", Required: true},
+		{Name: "baseline", Type: "integer", Description: "result id the deltas are relative to, the first id by default"},
+	}
+	statsParams = []apiParam{
+		{Name: "group_by", Description: "specs field results are grouped by", Enum: []string{"model", "vendor", "threads"}},
+		{Name: "benchmark", Description: "limit the statistics to one benchmark"},
+	}
+	trendParams = []apiParam{
+		benchmarkParam,
+		{Name: "window", Type: "integer", Description: "number of runs in the rolling average"},
+		{Name: "threshold", Type: "number", Description: "drop in percent flagged as a regression, no detection if absent"},
+	}
+	cpuParams = []apiParam{
+		{Name: "model", Description: "raw CPU model to resolve to a catalogued CPU, as in SysInfo"},
+		{Name: "vendor", Description: "CPU vendor the resolved CPU must have, as in SysInfo"},
+	}
+	pageParams = []apiParam{
+		{Name: "limit", Type: "integer", Description: "page size, 1 to 1000, all results if empty; the Link header points to the next page"},
+		{Name: "after", Type: "integer", Description: "id of the last result of the previous page"},
+	}
+)
+
+// apiRoutes documents every route registered by Handler. TestOpenAPIRoutes
+// fails if a route is missing.
+var apiRoutes = []apiRoute{
+	{Method: "GET", Path: "/api/users", Tag: "users", Summary: "List all users", Response: []*database.UserExternal{}},
+	{Method: "GET", Path: "/api/users/{id}", Tag: "users", Summary: "Get a user", Response: database.UserExternal{}},
+	{Method: "GET", Path: "/api/users/{id}/trends", Tag: "users", Summary: "Get the score trends of a user's machines", Query: trendParams, Response: trendsResponse{}},
+	{Method: "POST", Path: "/api/users/register", Tag: "users", Summary: "Register a user", Form: []apiParam{
+		{Name: "username", Required: true},
+		{Name: "email", Required: true},
+		{Name: "password", Required: true},
+	}, Content: "text/html"},
+
+	{Method: "GET", Path: "/api/results", Tag: "results", Summary: "List all results", Formats: true, Response: []*database.Result{}},
+	{Method: "GET", Path: "/api/results/user/{id}", Tag: "results", Summary: "List the results of a user", Response: []*database.Result{}},
+	{Method: "GET", Path: "/api/results/{id}", Tag: "results", Summary: "Get a result and the percentile ranks of its scores", Response: resultResponse{}},
+	{Method: "POST", Path: "/api/results/submit", Tag: "results", Summary: "Submit a result", Auth: "user", Headers: []apiParam{
+		{Name: "Idempotency-Key", Description: "replaying a key returns the original response instead of adding the result again"},
+	}, Request: submission{}, Response: submitResponse{}},
+	{Method: "GET", Path: "/api/compare", Tag: "results", Summary: "Compare results by benchmark", Query: compareParams, Response: comparison{}},
+	{Method: "GET", Path: "/api/leaderboard", Tag: "results", Summary: "Rank results by their Total score", Formats: true, Response: []*leaderboardEntry{}},
+
+	{Method: "GET", Path: "/api/specs", Tag: "specs", Summary: "List all specs", Formats: true, Response: []*database.Specs{}},
+	{Method: "GET", Path: "/api/specs/result/{id}", Tag: "specs", Summary: "List the specs of a result", Response: []*database.Specs{}},
+	{Method: "GET", Path: "/api/specs/{id}", Tag: "specs", Summary: "Get specs", Response: database.Specs{}},
+	{Method: "POST", Path: "/api/specs/add/result/{id}", Tag: "specs", Summary: "Add specs to a result", Request: database.Specs{}},
+
+	{Method: "GET", Path: "/api/cpus", Tag: "cpus", Summary: "List the catalogued CPUs", Query: cpuParams, Response: []*database.CPU{}},
+	{Method: "GET", Path: "/api/cpus/{id}", Tag: "cpus", Summary: "Get a CPU", Response: database.CPU{}},
+	{Method: "GET", Path: "/api/cpus/{id}/results", Tag: "cpus", Summary: "List the results of a CPU", Response: []*database.Result{}},
+	{Method: "GET", Path: "/api/cpus/{id}/aliases", Tag: "cpus", Summary: "List the aliases of a CPU", Response: []*database.CPUAlias{}},
+	{Method: "POST", Path: "/api/cpus/add", Tag: "cpus", Summary: "Add a CPU", Auth: "admin", Request: database.CPU{}, Response: database.CPU{}},
+	{Method: "POST", Path: "/api/cpus/delete/{id}", Tag: "cpus", Summary: "Delete a CPU and its aliases", Auth: "admin"},
+	{Method: "POST", Path: "/api/cpus/{id}/aliases/add", Tag: "cpus", Summary: "Add an alias to a CPU", Auth: "admin", Request: database.CPUAlias{}, Response: database.CPUAlias{}},
+	{Method: "POST", Path: "/api/cpus/aliases/delete/{id}", Tag: "cpus", Summary: "Delete a CPU alias", Auth: "admin"},
+
+	{Method: "GET", Path: "/api/stats", Tag: "stats", Summary: "Get score statistics by group", Query: statsParams, Response: []*database.Stats{}},
+
+	{Method: "GET", Path: "/api/charts/histogram", Tag: "charts", Summary: "Histogram of a benchmark's scores", Query: append([]apiParam{benchmarkParam, {Name: "bins", Type: "integer", Description: "number of bins, 1 to 100"}}, chartParams...), Content: "image/svg+xml"},
+	{Method: "GET", Path: "/api/charts/compare", Tag: "charts", Summary: "Bar chart comparing results", Query: append([]apiParam{compareParams[0], benchmarkParam}, chartParams...), Content: "image/svg+xml"},
+	{Method: "GET", Path: "/api/charts/users/{id}/trend", Tag: "charts", Summary: "Line chart of a user's score trends", Query: append([]apiParam{benchmarkParam}, chartParams...), Content: "image/svg+xml"},
+	{Method: "GET", Path: "/badge/result/{id}.svg", Tag: "charts", Summary: "Badge showing a result's Total score", Query: badgeParams, Content: "image/svg+xml"},
+	{Method: "GET", Path: "/badge/user/{id}/best.svg", Tag: "charts", Summary: "Badge showing a user's best Total score", Query: badgeParams, Content: "image/svg+xml"},
+
+	{Method: "GET", Path: "/feeds/results.atom", Tag: "feeds", Summary: "Atom feed of the latest results", Content: "application/atom+xml"},
+	{Method: "GET", Path: "/feeds/records.atom", Tag: "feeds", Summary: "Atom feed of the latest new top scores for a benchmark", Content: "application/atom+xml"},
+	{Method: "GET", Path: "/feeds/users/{id}.atom", Tag: "feeds", Summary: "Atom feed of a user's latest results", Content: "application/atom+xml"},
+
+	{Method: "GET", Path: "/api/datasets", Tag: "datasets", Summary: "List the open-data snapshots", Response: []*dataset.Manifest{}},
+	{Method: "GET", Path: "/api/datasets/latest", Tag: "datasets", Summary: "Download the latest snapshot", Content: "application/gzip"},
+	{Method: "GET", Path: "/api/datasets/latest/manifest", Tag: "datasets", Summary: "Get the manifest of the latest snapshot", Response: dataset.Manifest{}},
+	{Method: "GET", Path: "/api/datasets/{id}", Tag: "datasets", Summary: "Download a snapshot", TextID: true, Content: "application/gzip"},
+	{Method: "GET", Path: "/api/datasets/{id}/manifest", Tag: "datasets", Summary: "Get the manifest of a snapshot", TextID: true, Response: dataset.Manifest{}},
+
+	{Method: "GET", Path: "/api/v1/users", Tag: "v1", Summary: "List all users", Response: []userV1{}},
+	{Method: "GET", Path: "/api/v1/users/{id}", Tag: "v1", Summary: "Get a user", Response: userV1{}},
+	{Method: "GET", Path: "/api/v1/users/{id}/results", Tag: "v1", Summary: "List the results of a user", Query: pageParams, Response: []resultV1{}},
+	{Method: "GET", Path: "/api/v1/users/{id}/trends", Tag: "v1", Summary: "Get the score trends of a user's machines", Query: trendParams, Response: trendsResponse{}},
+	{Method: "GET", Path: "/api/v1/results", Tag: "v1", Summary: "List all results", Query: pageParams, Formats: true, Response: []resultV1{}},
+	{Method: "POST", Path: "/api/v1/results", Tag: "v1", Summary: "Submit a result", Auth: "user", Headers: []apiParam{
+		{Name: "Idempotency-Key", Description: "replaying a key returns the original response instead of adding the result again"},
+	}, Request: submission{}, Response: submitResponse{}},
+	{Method: "GET", Path: "/api/v1/results/live", Tag: "v1", Summary: "WebSocket feed of submitted results and their specs, filtered by the vendor, model and benchmark the client sends", Headers: []apiParam{
+		{Name: "Upgrade", Required: true, Description: "websocket"},
+	}},
+	{Method: "GET", Path: "/api/v1/results/{id}", Tag: "v1", Summary: "Get a result and the percentile ranks of its scores", Response: resultDetailV1{}},
+	{Method: "GET", Path: "/api/v1/results/{id}/specs", Tag: "v1", Summary: "List the specs of a result", Response: []specsV1{}},
+	{Method: "POST", Path: "/api/v1/results/{id}/hide", Tag: "v1", Summary: "Hide a result from every listing, as moderation", Auth: "admin"},
+	{Method: "GET", Path: "/api/v1/specs/{id}", Tag: "v1", Summary: "Get specs", Response: specsV1{}},
+	{Method: "GET", Path: "/api/v1/cpus", Tag: "v1", Summary: "List the catalogued CPUs", Query: cpuParams, Response: []cpuV1{}},
+	{Method: "GET", Path: "/api/v1/cpus/{id}", Tag: "v1", Summary: "Get a CPU", Response: cpuV1{}},
+	{Method: "GET", Path: "/api/v1/cpus/{id}/results", Tag: "v1", Summary: "List the results of a CPU", Response: []resultV1{}},
+	{Method: "GET", Path: "/api/v1/cpus/{id}/aliases", Tag: "v1", Summary: "List the aliases of a CPU", Response: []cpuAliasV1{}},
+	{Method: "GET", Path: "/api/v1/compare", Tag: "v1", Summary: "Compare results by benchmark", Query: compareParams, Response: comparisonV1{}},
+	{Method: "GET", Path: "/api/v1/leaderboard", Tag: "v1", Summary: "Rank results by their Total score", Formats: true, Response: []leaderboardEntryV1{}},
+	{Method: "GET", Path: "/api/v1/stats", Tag: "v1", Summary: "Get score statistics by group", Query: statsParams, Response: []statsV1{}},
+	{Method: "GET", Path: "/api/v1/me", Tag: "v1", Summary: "Get the authenticated user", Auth: "user", Response: accountV1{}},
+	{Method: "GET", Path: "/api/v1/tokens", Tag: "v1", Summary: "List your API tokens", Auth: "user", Response: []tokenV1{}},
+	{Method: "POST", Path: "/api/v1/tokens", Tag: "v1", Summary: "Create an API token, whose secret is only shown once", Auth: "user", Request: tokenRequest{}, Response: tokenV1{}},
+	{Method: "DELETE", Path: "/api/v1/tokens/{id}", Tag: "v1", Summary: "Delete one of your API tokens", Auth: "user"},
+	{Method: "GET", Path: "/api/v1/webhooks", Tag: "webhooks", Summary: "List your webhooks", Auth: "user", Response: []webhookV1{}},
+	{Method: "POST", Path: "/api/v1/webhooks", Tag: "webhooks", Summary: "Register a webhook, whose signing secret is only shown once", Auth: "user", Request: webhookRequest{}, Response: webhookV1{}},
+	{Method: "GET", Path: "/api/v1/webhooks/{id}", Tag: "webhooks", Summary: "Get one of your webhooks", Auth: "user", Response: webhookV1{}},
+	{Method: "DELETE", Path: "/api/v1/webhooks/{id}", Tag: "webhooks", Summary: "Delete one of your webhooks and its delivery log", Auth: "user"},
+	{Method: "GET", Path: "/api/v1/webhooks/{id}/deliveries", Tag: "webhooks", Summary: "List the latest deliveries of one of your webhooks", Auth: "user", Response: []deliveryV1{}},
+	{Method: "POST", Path: "/api/v1/webhooks/{id}/test", Tag: "webhooks", Summary: "Deliver a webhook.test event to one of your webhooks right away", Auth: "user", Response: deliveryV1{}},
+
+	{Method: "GET", Path: "/api/events", Tag: "events", Summary: "Stream result.created, result.hidden, rank.changed and record.set events as Server-Sent Events", Query: []apiParam{
+		{Name: "types", Description: "comma separated event types to stream, all if empty"},
+		{Name: "last_event_id", Type: "integer", Description: "like the Last-Event-ID header, for clients that cannot set it"},
+	}, Headers: []apiParam{
+		{Name: "Last-Event-ID", Description: "id of the last event received, to first receive the buffered events since, or a reset event if they were dropped"},
+	}, Content: "text/event-stream"},
+
+	{Method: "GET", Path: "/api/graphql", Tag: "graphql", Summary: "Execute a GraphQL query over the users, results and specs", Query: []apiParam{
+		{Name: "query", Description: "GraphQL query", Required: true},
+		{Name: "variables", Description: "JSON object of the query variables"},
+		{Name: "operationName", Description: "operation to execute if the query has several"},
+	}, Response: graphQLResponse{}},
+	{Method: "POST", Path: "/api/graphql", Tag: "graphql", Summary: "Execute a GraphQL query over the users, results and specs", Request: graphQLRequest{}, Response: graphQLResponse{}},
+
+	{Method: "GET", Path: "/api/openapi.json", Tag: "docs", Summary: "This OpenAPI document", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/api/docs", Tag: "docs", Summary: "API documentation page", Content: "text/html"},
+}
+
+var (
+	// pathVarRe matches the path variables of apiRoute paths.
+	pathVarRe = regexp.MustCompile(`\{(\w+)\}`)
+
+	// nonWordRe matches the runs of characters replaced in operation IDs.
+	nonWordRe = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+// openAPI builds the OpenAPI document of routes.
+func openAPI(routes []apiRoute) map[string]interface{} {
+	g := &schemaGen{schemas: map[string]interface{}{
+		"Error": (&schemaGen{}).schema(reflect.TypeOf(apiError{})),
+	}}
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": ref("Error")},
+			},
+		}
+	}
+
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		var params []interface{}
+		for _, m := range pathVarRe.FindAllStringSubmatch(route.Path, -1) {
+			typ := "integer"
+			if route.TextID {
+				typ = "string"
+			}
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": typ},
+			})
+		}
+		query := route.Query
+		if route.Formats {
+			query = append(query[:len(query):len(query)], formatParam)
+		}
+		for _, p := range query {
+			params = append(params, p.openAPI("query"))
+		}
+		for _, p := range route.Headers {
+			params = append(params, p.openAPI("header"))
+		}
+
+		responses := map[string]interface{}{
+			"500": errorResponse("Internal error, details are logged with the request ID"),
+		}
+		ok := map[string]interface{}{"description": "OK"}
+		content := map[string]interface{}{}
+		if route.Response != nil {
+			content["application/json"] = map[string]interface{}{"schema": g.schema(reflect.TypeOf(route.Response))}
+		}
+		if route.Formats {
+			content["text/csv"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			content["application/x-ndjson"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		if route.Content != "" {
+			content[route.Content] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		if len(content) > 0 {
+			ok["content"] = content
+		}
+		responses["200"] = ok
+		if len(params) > len(pathVarRe.FindAllString(route.Path, -1)) || route.Request != nil || route.Form != nil {
+			responses["400"] = errorResponse("Malformed request")
+		}
+		if len(pathVarRe.FindAllString(route.Path, -1)) > 0 {
+			responses["404"] = errorResponse("Not found")
+		}
+		if route.Request != nil {
+			responses["409"] = errorResponse("Conflicts with existing data")
+			responses["422"] = errorResponse("Invalid values")
+		}
+
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+			"tags":        []string{route.Tag},
+			"responses":   responses,
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.Auth != "" {
+			op["security"] = []interface{}{
+				map[string]interface{}{"basic": []string{}},
+				map[string]interface{}{"bearer": []string{}},
+			}
+			responses["401"] = errorResponse("Missing or invalid credentials")
+			if route.Auth == "admin" {
+				responses["403"] = errorResponse("Admin access required")
+			}
+		}
+		if route.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+		if route.Form != nil {
+			props := make(map[string]interface{})
+			var required []string
+			for _, p := range route.Form {
+				props[p.Name] = p.schema()
+				if p.Required {
+					required = append(required, p.Name)
+				}
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/x-www-form-urlencoded": map[string]interface{}{
+						"schema": map[string]interface{}{"type": "object", "properties": props, "required": required},
+					},
+				},
+			}
+		}
+
+		if paths[route.Path] == nil {
+			paths[route.Path] = make(map[string]interface{})
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "OpenSystemBench API",
+			"version":     "1",
+			"description": "The /api/v1 routes are the stable public API. The other /api routes serve the website and keep their legacy shape.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "API token created at /api/v1/tokens"},
+			},
+		},
+	}
+}
+
+// operationID returns a unique name for a route, e.g. get_api_users_id.
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.Method) + route.Path
+	return strings.Trim(nonWordRe.ReplaceAllString(id, "_"), "_")
+}
+
+func (p apiParam) schema() map[string]interface{} {
+	s := map[string]interface{}{"type": "string"}
+	if p.Type != "" {
+		s["type"] = p.Type
+	}
+	if len(p.Enum) > 0 {
+		s["enum"] = p.Enum
+	}
+	return s
+}
+
+func (p apiParam) openAPI(in string) map[string]interface{} {
+	param := map[string]interface{}{"name": p.Name, "in": in, "schema": p.schema()}
+	if p.Description != "" {
+		param["description"] = p.Description
+	}
+	if p.Required {
+		param["required"] = true
+	}
+	return param
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+var (
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(database.Duration{})
+)
+
+// schemaGen derives JSON schemas from Go types the way encoding/json
+// serializes them. Named struct types become shared component schemas.
+type schemaGen struct {
+	schemas map[string]interface{}
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "string", "description": "Go duration, e.g. 1.5s"}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" || g.schemas == nil {
+			return g.object(t)
+		}
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // reserve the name for recursive types
+			g.schemas[name] = g.object(t)
+		}
+		return ref(name)
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct type.
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	g.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// fields adds the schemas of the JSON fields of struct type t to props,
+// inlining embedded structs without a JSON name like encoding/json.
+func (g *schemaGen) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+	openAPIErr  error
+)
+
+// GetOpenAPI returns the OpenAPI document of the API.
+func GetOpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		openAPIOnce.Do(func() {
+			openAPIDoc, openAPIErr = json.Marshal(openAPI(apiRoutes))
+		})
+		if openAPIErr != nil {
+			sendError(w, r, openAPIErr)
+			return
+		}
+		if err := sendJSONResponse(w, json.RawMessage(openAPIDoc)); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// GetDocs returns a page rendering the OpenAPI document.
+func GetDocs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(docsPage))
+	}
+}
+
+// docsPage renders /api/openapi.json without any external scripts or styles.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>OpenSystemBench API</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; padding: 0 1em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; text-transform: capitalize; }
+details { margin: .5em 0; border: 1px solid #ddd; border-radius: 4px; padding: .5em; }
+summary { cursor: pointer; }
+.method { display: inline-block; width: 4em; font-weight: bold; font-family: monospace; }
+.get { color: #0a6; } .post { color: #06c; }
+code, pre { font-family: monospace; background: #f6f6f6; }
+pre { padding: .5em; overflow: auto; }
+table { border-collapse: collapse; } td, th { text-align: left; padding: .2em .6em; border-bottom: 1px solid #eee; }
+</style>
+</head>
+<body>
+<h1>OpenSystemBench API</h1>
+<p id="description"></p>
+<p>The machine-readable document is at <a href="/api/openapi.json">/api/openapi.json</a>.</p>
+<div id="routes">Loading&hellip;</div>
+<script>
+function el(tag, attrs, children) {
+  var e = document.createElement(tag);
+  for (var k in attrs || {}) e.setAttribute(k, attrs[k]);
+  (children || []).forEach(function (c) { e.appendChild(typeof c === "string" ? document.createTextNode(c) : c); });
+  return e;
+}
+function resolve(doc, schema, depth) {
+  if (!schema || depth > 6) return schema;
+  if (schema.$ref) return resolve(doc, doc.components.schemas[schema.$ref.split("/").pop()], depth + 1);
+  var out = {};
+  for (var k in schema) {
+    var v = schema[k];
+    if (k === "properties") { out[k] = {}; for (var p in v) out[k][p] = resolve(doc, v[p], depth + 1); }
+    else if (k === "items") out[k] = resolve(doc, v, depth + 1);
+    else if (k === "allOf") out[k] = v.map(function (s) { return resolve(doc, s, depth + 1); });
+    else out[k] = v;
+  }
+  return out;
+}
+function schemaBlock(doc, title, content) {
+  var d = el("div", {}, [el("strong", {}, [title])]);
+  for (var type in content) {
+    d.appendChild(el("div", {}, [el("code", {}, [type])]));
+    if (content[type].schema && content[type].schema.type !== "string")
+      d.appendChild(el("pre", {}, [JSON.stringify(resolve(doc, content[type].schema, 0), null, 2)]));
+  }
+  return d;
+}
+fetch("/api/openapi.json").then(function (r) { return r.json(); }).then(function (doc) {
+  document.getElementById("description").textContent = doc.info.description;
+  var byTag = {};
+  Object.keys(doc.paths).sort().forEach(function (path) {
+    for (var method in doc.paths[path]) {
+      var op = doc.paths[path][method];
+      (byTag[op.tags[0]] = byTag[op.tags[0]] || []).push({ path: path, method: method, op: op });
+    }
+  });
+  var root = document.getElementById("routes");
+  root.textContent = "";
+  Object.keys(byTag).forEach(function (tag) {
+    root.appendChild(el("h2", {}, [tag]));
+    byTag[tag].forEach(function (r) {
+      var body = [el("summary", {}, [el("span", { "class": "method " + r.method }, [r.method.toUpperCase()]), el("code", {}, [r.path]), " — " + r.op.summary])];
+      if (r.op.security) body.push(el("p", {}, ["Requires basic auth or an API token."]));
+      if (r.op.parameters) {
+        var rows = r.op.parameters.map(function (p) {
+          return el("tr", {}, [el("td", {}, [el("code", {}, [p.name])]), el("td", {}, [p.in]), el("td", {}, [(p.schema.enum || [p.schema.type]).join(" | ")]), el("td", {}, [(p.required ? "required. " : "") + (p.description || "")])]);
+        });
+        body.push(el("table", {}, rows));
+      }
+      if (r.op.requestBody) body.push(schemaBlock(doc, "Request", r.op.requestBody.content));
+      if (r.op.responses["200"].content) body.push(schemaBlock(doc, "Response", r.op.responses["200"].content));
+      body.push(el("p", {}, ["Errors: " + Object.keys(r.op.responses).filter(function (c) { return c !== "200"; }).join(", ")]));
+      root.appendChild(el("details", {}, body));
+    });
+  });
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// openAPIDoc is the part of the OpenAPI document the tests look at.
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+func getOpenAPI(t *testing.T, h http.Handler) *openAPIDoc {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	var doc openAPIDoc
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+// routeVarRe matches the patterns of mux path variables.
+var routeVarRe = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// TestOpenAPIRoutes fails if a route registered by Handler is missing from
+// the OpenAPI document, or if the document lists a route that does not exist.
+func TestOpenAPIRoutes(t *testing.T) {
+	h := handlers.Handler(dbtest.New())
+	doc := getOpenAPI(t, h)
+
+	routes := make(map[string]bool)
+	err := h.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // prefixes and static files
+		}
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		path := routeVarRe.ReplaceAllString(tpl, "{$1}")
+		for _, method := range methods {
+			method = strings.ToLower(method)
+			routes[method+" "+path] = true
+			if _, ok := doc.Paths[path][method]; !ok {
+				t.Errorf("%s %s has no OpenAPI entry", strings.ToUpper(method), path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if !routes[method+" "+path] {
+				t.Errorf("OpenAPI entry %s %s has no route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := getOpenAPI(t, handlers.Handler(dbtest.New()))
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("openapi: want 3.0.3, got %q", doc.OpenAPI)
+	}
+
+	tt := []struct {
+		Schema string
+		Want   []string // property names
+	}{
+		{Schema: "Result", Want: []string{"ID", "UserID", "scores", "CreatedAt"}},
+		{Schema: "Specs", Want: []string{"ID", "ResultID", "specs", "normalized"}},
+		{Schema: "SysInfo", Want: []string{"vendor", "model", "speed", "threads", "overclocked", "byte_order", "physical", "virtual", "swap"}},
+		{Schema: "ResultResponse", Want: []string{"ID", "UserID", "scores", "CreatedAt", "ranks"}},
+		{Schema: "ResultV1", Want: []string{"id", "user_id", "created_at", "scores"}},
+		{Schema: "SpecsV1", Want: []string{"id", "result_id", "system", "normalized", "raw"}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Schema, func(t *testing.T) {
+			raw, ok := doc.Components.Schemas[tc.Schema]
+			if !ok {
+				t.Fatalf("no %s schema", tc.Schema)
+			}
+			var schema struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			}
+			if err := json.Unmarshal(raw, &schema); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(schema.Properties), len(tc.Want); got != want {
+				t.Errorf("want %d properties, got %d: %s", want, got, raw)
+			}
+			for _, name := range tc.Want {
+				if _, ok := schema.Properties[name]; !ok {
+					t.Errorf("missing property %q: %s", name, raw)
+				}
+			}
+		})
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlers.Handler(dbtest.New()).ServeHTTP(rec, httptest.NewRequest("GET", "/api/docs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: want %d, got %d", http.StatusOK, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "/api/openapi.json") {
+		t.Error("docs page does not load the OpenAPI document")
+	}
+}
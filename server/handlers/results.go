@@ -2,150 +2,377 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strconv"
-
-	"github.com/gorilla/mux"
+	"time"
 
 	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/events"
 )
 
-// ListResults lists all results.
-func ListResults(db database.ResultDatabase) http.HandlerFunc {
+// ListResults lists all results, streamed a page at a time. Requested as CSV
+// or NDJSON, each result is flattened into a row with its SysInfo fields and
+// a score and time column per benchmark.
+func ListResults(db database.OSBDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		results, err := db.ListResults()
+		format, err := negotiateFormat(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		if err := sendJSONResponse(w, results); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		var benchmarks, columns []string
+		if format != formatJSON {
+			if benchmarks, err = db.ListBenchmarks(); err != nil {
+				sendError(w, r, err)
+				return
+			}
+			columns = append(append([]string{"result_id", "user_id", "created_at"}, sysInfoColumns...), scoreColumns(benchmarks)...)
 		}
+
+		// Without results, the JSON response is null, as it always was.
+		sendList(w, r, format, "results", columns, "null", func(emit func(interface{}, func() []interface{}) error) error {
+			var after int64
+			for {
+				results, err := db.ListResultsAfter(after, streamPageSize)
+				if err != nil {
+					return err
+				}
+				var specs map[int64]*database.Specs
+				if format != formatJSON {
+					if specs, err = specsOfResults(db, results); err != nil {
+						return err
+					}
+				}
+				for _, res := range results {
+					res := res
+					err := emit(res, func() []interface{} {
+						return concat(
+							[]interface{}{res.ID, res.UserID, res.CreatedAt},
+							sysInfoValues(sysInfoOf(specs[res.ID])),
+							scoreValues(res.Scores, benchmarks),
+						)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				if len(results) < streamPageSize {
+					return nil
+				}
+				after = results[len(results)-1].ID
+			}
+		})
 	}
 }
 
 // ListResultsCreatedBy returns all results created by the user with the given user ID.
 func ListResultsCreatedBy(db database.ResultDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key in router`, http.StatusInternalServerError)
-			return
-		}
-
-		userID, err := strconv.ParseInt(idStr, 10, 64)
+		userID, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		results, err := db.ListResultsCreatedBy(userID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := sendJSONResponse(w, results); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 		}
 	}
 }
 
-// GetResult returns the result row with the matching result id.
-func GetResult(db database.ResultDatabase) http.HandlerFunc {
+// resultResponse is a result along with its percentile ranks.
+type resultResponse struct {
+	*database.Result
+	Ranks []*database.BenchmarkRanks `json:"ranks"`
+}
+
+// GetResult returns the result row with the matching result id along with
+// the percentile ranks of its scores.
+func GetResult(db database.OSBDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key`, http.StatusInternalServerError)
+		resultID, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
 			return
 		}
 
-		resultID, err := strconv.ParseInt(idStr, 10, 64)
+		result, err := db.GetResult(resultID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
-		result, err := db.GetResult(resultID)
+		ranks, err := db.ResultRanks(resultID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
+			return
 		}
 
-		if err := sendJSONResponse(w, result); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := sendJSONResponse(w, resultResponse{Result: result, Ranks: ranks}); err != nil {
+			sendError(w, r, err)
 		}
 	}
 }
 
-// AddResult inserts a new result row.
-func AddResult(db database.OSBDatabase) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			w.WriteHeader(http.StatusForbidden)
-			return
+const (
+	// duplicateWindow is how long an identical submission by the same user is rejected.
+	duplicateWindow = 10 * time.Minute
+
+	// maxIdempotencyKeyLen is the longest accepted Idempotency-Key header.
+	maxIdempotencyKeyLen = 255
+
+	// maxRunAge is how long after a run it can be submitted, so runs queued
+	// on machines without network access keep the time they were run.
+	maxRunAge = 90 * 24 * time.Hour
+
+	// maxClockSkew is how far in the future a run's time may be.
+	maxClockSkew = 5 * time.Minute
+)
+
+// submission is the body of a result submission.
+type submission struct {
+	Scores     database.Scores  `json:"scores"`
+	SysInfo    database.SysInfo `json:"specs"`
+	RawSysInfo json.RawMessage  `json:"-"`                    // specs object as sent, stored along with SysInfo
+	CreatedAt  *time.Time       `json:"created_at,omitempty"` // time of the run, the time of submission if nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The benchmark client sends the
+// scores under "results", which is accepted as well as "scores".
+func (s *submission) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		Scores    database.Scores `json:"scores"`
+		Results   database.Scores `json:"results"`
+		SysInfo   json.RawMessage `json:"specs"`
+		CreatedAt *time.Time      `json:"created_at"`
+	}{}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	s.Scores = aux.Scores
+	if s.Scores == nil {
+		s.Scores = aux.Results
+	}
+	if len(aux.SysInfo) > 0 && string(aux.SysInfo) != "null" {
+		if err := json.Unmarshal(aux.SysInfo, &s.SysInfo); err != nil {
+			return err
 		}
+		s.RawSysInfo = aux.SysInfo
+	}
+	s.CreatedAt = aux.CreatedAt
+	return nil
+}
 
-		user, err := db.GetUserByCredentials(username, password)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
+// runTime returns the time the submitted run was made, which is now unless
+// the submission says otherwise.
+func (s *submission) runTime(now time.Time) (time.Time, error) {
+	if s.CreatedAt == nil {
+		return now, nil
+	}
+	t := s.CreatedAt.UTC()
+	if t.After(now.Add(maxClockSkew)) {
+		return time.Time{}, errors.New("created_at is in the future")
+	}
+	if t.Before(now.Add(-maxRunAge)) {
+		return time.Time{}, fmt.Errorf("created_at is more than %d days ago", maxRunAge/(24*time.Hour))
+	}
+	return t, nil
+}
+
+// submitResponse is the body returned for a successful submission.
+type submitResponse struct {
+	ResultID int64                      `json:"result_id"`
+	Ranks    []*database.BenchmarkRanks `json:"ranks,omitempty"` // omitted if the ranks could not be computed
+}
+
+// newSubmitResponse returns the response for a submission that created the
+// result with the given id. Failing to rank the result does not fail the
+// submission, so errors are only logged.
+func newSubmitResponse(db database.StatsDatabase, resultID int64) submitResponse {
+	ranks, err := db.ResultRanks(resultID)
+	if err != nil {
+		log.Printf("could not rank result id %d: %v", resultID, err)
+	}
+	return submitResponse{ResultID: resultID, Ranks: ranks}
+}
+
+// AddResult inserts a new result row. The result is dated by the submission's
+// created_at if given, such as for runs queued offline, and otherwise now.
+//
+// A client may set an Idempotency-Key header to safely retry a submission.
+// Replaying a key returns the original response instead of inserting the
+// result again, however long after, so that runs queued offline can be
+// retried. Submissions identical to one the same user made recently are
+// rejected regardless of the key.
+//
+// The new result is published on bus, which may be nil, along with its rank
+// if it has a Total score.
+func AddResult(db database.OSBDatabase, bus *events.Bus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
 			return
 		}
 
-		submission := struct {
-			Scores  database.Scores  `json:"scores"`
-			SysInfo database.SysInfo `json:"specs"`
-		}{}
+		var submission submission
 		if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
-		result := &database.Result{
-			UserID: user.ID,
-			Scores: submission.Scores,
+		sub, replayed, err := submitResult(db, bus, user, &submission, r.Header.Get("Idempotency-Key"))
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			sendErrorStatus(w, r, rejected.status, rejected.msg)
+			return
 		}
-		id, err := db.AddResult(result)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
-		log.Println("successfully added result id", id)
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
+		}
 
-		specs := &database.Specs{
-			ResultID: id,
-			SysInfo:  submission.SysInfo,
+		// The response to a replay is the saved one, unless the original
+		// submission is still in flight or was made over gRPC.
+		body := sub.Response
+		if body == nil {
+			if body, err = json.Marshal(newSubmitResponse(db, sub.ResultID)); err != nil {
+				sendError(w, r, err)
+				return
+			}
+			if !replayed && sub.Key != "" {
+				if err := db.SetSubmissionResponse(sub.ID, body); err != nil {
+					log.Printf("could not save the response to submission id %d: %v", sub.ID, err)
+				}
+			}
 		}
-		id, err = db.AddSpecs(specs)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := sendJSONResponse(w, json.RawMessage(body)); err != nil {
+			sendError(w, r, err)
 		}
-		log.Println("successfully added specs id", id)
+	}
+}
 
-		w.WriteHeader(http.StatusOK)
+// rejectedError is a rejected submission, with the HTTP status to respond
+// with.
+type rejectedError struct {
+	status int
+	msg    string
+}
+
+func (e *rejectedError) Error() string {
+	return e.msg
+}
+
+// submitResult validates a submission by user and saves the result, its
+// specs and the submission together, as /api/results/submit and the gRPC
+// ingestion service do. It returns the submission, and whether it was made
+// before with the idempotency key, which may be empty. Invalid submissions
+// are rejected with a *rejectedError.
+//
+// The new result is published on bus, which may be nil.
+func submitResult(db database.OSBDatabase, bus *events.Bus, user *database.User, submission *submission, key string) (sub *database.Submission, replayed bool, err error) {
+	if len(key) > maxIdempotencyKeyLen {
+		return nil, false, &rejectedError{http.StatusBadRequest, "Idempotency-Key is too long"}
+	}
+
+	normalized, err := submission.SysInfo.Normalize()
+	if err != nil {
+		return nil, false, &rejectedError{http.StatusUnprocessableEntity, err.Error()}
+	}
+
+	fingerprint, err := database.Fingerprint(submission.Scores, submission.SysInfo)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now().UTC()
+	runTime, err := submission.runTime(now)
+	if err != nil {
+		return nil, false, &rejectedError{http.StatusUnprocessableEntity, err.Error()}
 	}
+
+	if key != "" {
+		if prev, err := replaySubmission(db, user, key, fingerprint); prev != nil || err != nil {
+			return prev, prev != nil, err
+		}
+	}
+
+	dup, err := db.GetSubmissionByFingerprint(user.ID, fingerprint, now.Add(-duplicateWindow))
+	if err != nil {
+		return nil, false, err
+	}
+	if dup != nil {
+		return nil, false, &rejectedError{http.StatusConflict, fmt.Sprintf("duplicate of result %d", dup.ResultID)}
+	}
+
+	result := &database.Result{
+		UserID:    user.ID,
+		Scores:    submission.Scores,
+		CreatedAt: runTime,
+	}
+	specs := &database.Specs{
+		SysInfo:    submission.SysInfo,
+		Normalized: normalized,
+		Raw:        submission.RawSysInfo,
+	}
+	sub = &database.Submission{
+		UserID:      user.ID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+	}
+	if err := db.AddSubmittedResult(result, specs, sub); err != nil {
+		// A concurrent retry with the same key saved its submission first.
+		if key != "" && errors.Is(err, database.ErrConflict) {
+			if prev, err := replaySubmission(db, user, key, fingerprint); prev != nil || err != nil {
+				return prev, prev != nil, err
+			}
+		}
+		return nil, false, err
+	}
+	log.Println("successfully added result id", result.ID)
+
+	publishResultCreated(bus, db, result, specs)
+	return sub, false, nil
+}
+
+// replaySubmission returns the submission user made with key, or nil if there
+// is none. It is rejected if it was not identical to the one with
+// fingerprint.
+func replaySubmission(db database.SubmissionDatabase, user *database.User, key, fingerprint string) (*database.Submission, error) {
+	prev, err := db.GetSubmissionByKey(user.ID, key)
+	if err != nil || prev == nil {
+		return nil, err
+	}
+	if prev.Fingerprint != fingerprint {
+		return nil, &rejectedError{http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different submission"}
+	}
+	log.Println("replayed submission of result id", prev.ResultID)
+	return prev, nil
 }
 
 // DeleteResult deletes the result row with the matching result id.
 func DeleteResult(db database.ResultDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key`, http.StatusInternalServerError)
-			return
-		}
-
-		resultID, err := strconv.ParseInt(idStr, 10, 64)
+		resultID, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := db.DeleteResult(resultID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -160,7 +387,7 @@ func UpdateResult(db database.ResultDatabase) http.HandlerFunc {
 		var result database.Result
 
 		if err := db.UpdateResult(&result); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -2,15 +2,19 @@ package handlers_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
 	"github.com/mguid65/osb-website/server/handlers"
 )
 
@@ -21,7 +25,11 @@ type resultHandlerTest struct {
 	StatusCode int
 }
 
-type mockResultsDB struct{}
+// mockResultsDB implements the result methods used by the tests; calling any
+// other database method panics.
+type mockResultsDB struct {
+	database.OSBDatabase
+}
 
 func (db *mockResultsDB) ListResults() ([]*database.Result, error) {
 	return []*database.Result{
@@ -31,10 +39,22 @@ func (db *mockResultsDB) ListResults() ([]*database.Result, error) {
 			Scores: database.Scores{
 				{Name: "Total", Time: database.Duration{Duration: 123456789 * time.Nanosecond}, Score: 1000},
 			},
+			CreatedAt: time.Date(2018, time.November, 7, 21, 43, 49, 0, time.UTC),
 		},
 	}, nil
 }
 
+func (db *mockResultsDB) ListResultsAfter(after int64, limit int) ([]*database.Result, error) {
+	all, _ := db.ListResults()
+	var results []*database.Result
+	for _, res := range all {
+		if res.ID > after && len(results) < limit {
+			results = append(results, res)
+		}
+	}
+	return results, nil
+}
+
 func (db *mockResultsDB) ListResultsCreatedBy(id int64) ([]*database.Result, error) {
 	return nil, nil
 }
@@ -55,11 +75,15 @@ func (db *mockResultsDB) UpdateResult(res *database.Result) error {
 	return nil
 }
 
+func (db *mockResultsDB) HideResult(id int64) error {
+	return nil
+}
+
 func TestListResults(t *testing.T) {
 	tt := []resultHandlerTest{
 		{
 			Name:       "List Existing results",
-			Body:       `[{"ID":1,"UserID":1,"scores":[{"name":"Total","time":"123.456789ms","score":1000}]}]`,
+			Body:       `[{"ID":1,"UserID":1,"scores":[{"name":"Total","time":"123.456789ms","score":1000}],"CreatedAt":"2018-11-07T21:43:49Z"}]`,
 			StatusCode: http.StatusOK,
 		},
 	}
@@ -100,12 +124,355 @@ func TestListResultsCreatedBy(t *testing.T) {
 
 }
 
-func GetResult(t *testing.T) {
+func TestGetResult(t *testing.T) {
+	db := dbtest.New()
+	created := time.Date(2018, time.November, 7, 21, 43, 49, 0, time.UTC)
+	for _, total := range []float64{100, 200, 300} {
+		res := &database.Result{UserID: 1, Scores: database.Scores{{Name: "Total", Score: total}}, CreatedAt: created}
+		if _, err := db.AddResult(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest("GET", "/results/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/results/{id:[0-9]+}", handlers.GetResult(db)).Methods("GET")
+	r.ServeHTTP(rec, req)
+
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Fatalf("status code: want %d, got %d", want, got)
+	}
+	want := `{"ID":2,"UserID":1,"scores":[{"name":"Total","time":"0s","score":200}],"CreatedAt":"2018-11-07T21:43:49Z",` +
+		`"ranks":[{"benchmark":"Total","all":{"percentile":50,"count":3},"model":null,"threads":null}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("contents: got %q, want %q", got, want)
+	}
+}
+
+func TestGetResultRanksByCatalogCPU(t *testing.T) {
+	f := catalogFixture()
+	f.Results = append(f.Results,
+		fixtureResult{UserID: 2, Specs: &database.SysInfo{Vendor: "GenuineIntel", Model: "i7-8750H"}},
+		fixtureResult{UserID: 2, Specs: &database.SysInfo{Vendor: "AuthenticAMD", Model: "Intel Core i7-8750H"}},
+	)
+	for i, total := range []float64{10, 20, 30, 40, 5} {
+		f.Results[i].Scores = database.Scores{{Name: "Total", Score: total}}
+	}
+	f.CPUs = []fixtureCPU{{
+		CPU:     database.CPU{Vendor: "GenuineIntel", Model: "Intel Core i7-8750H"},
+		Aliases: []string{"i7-8750H"},
+	}}
+	db := newFixtureDB(t, f)
+	// A second specs row of result 3 must not count it twice.
+	if _, err := db.AddSpecs(&database.Specs{ResultID: 3, SysInfo: database.SysInfo{Model: "Intel Core i7-8750H"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handlers.Handler(db).ServeHTTP(rec, httptest.NewRequest("GET", "/api/results/5", nil))
+	var res struct{ Ranks []*database.BenchmarkRanks }
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Ranks) != 1 {
+		t.Fatalf("got %d benchmark ranks, want 1", len(res.Ranks))
+	}
+	// Results 3, 5 and the alias 9 ran on the CPU; 11 names its model but
+	// not its vendor.
+	if want := (database.Rank{Percentile: 50, Count: 3}); res.Ranks[0].Model == nil || *res.Ranks[0].Model != want {
+		t.Errorf("model: got %+v, want %+v", res.Ranks[0].Model, want)
+	}
+}
+
+const testSubmission = `{
+	"scores": [{"name": "Total", "time": 1000, "score": 1000}],
+	"specs": {"vendor": "GenuineIntel", "model": "Intel(R) Core(TM) i7-8750H CPU"}
+}`
 
+func newSubmitRequest(t *testing.T, body, key string) *http.Request {
+	req, err := http.NewRequest("POST", "/results/submit", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("test", "password")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return req
 }
 
+// submitFixture holds the user who submits results.
+var submitFixture = fixture{Users: []database.User{{Name: "test"}}}
+
 func TestAddResult(t *testing.T) {
+	tt := []struct {
+		Name        string
+		Requests    []*http.Request
+		StatusCodes []int
+		NumResults  int
+	}{
+		{
+			Name:        "Single submission",
+			Requests:    []*http.Request{newSubmitRequest(t, testSubmission, "")},
+			StatusCodes: []int{http.StatusOK},
+			NumResults:  1,
+		},
+		{
+			Name: "Replay idempotency key",
+			Requests: []*http.Request{
+				newSubmitRequest(t, testSubmission, "run-1"),
+				newSubmitRequest(t, testSubmission, "run-1"),
+			},
+			StatusCodes: []int{http.StatusOK, http.StatusOK},
+			NumResults:  1,
+		},
+		{
+			Name: "Reuse idempotency key with different payload",
+			Requests: []*http.Request{
+				newSubmitRequest(t, testSubmission, "run-1"),
+				newSubmitRequest(t, `{"scores": [{"name": "Total", "time": 1000, "score": 2000}]}`, "run-1"),
+			},
+			StatusCodes: []int{http.StatusOK, http.StatusUnprocessableEntity},
+			NumResults:  1,
+		},
+		{
+			Name: "Duplicate submission without key",
+			Requests: []*http.Request{
+				newSubmitRequest(t, testSubmission, ""),
+				newSubmitRequest(t, testSubmission, ""),
+			},
+			StatusCodes: []int{http.StatusOK, http.StatusConflict},
+			NumResults:  1,
+		},
+		{
+			Name: "Duplicate submission with new key",
+			Requests: []*http.Request{
+				newSubmitRequest(t, testSubmission, "run-1"),
+				newSubmitRequest(t, testSubmission, "run-2"),
+			},
+			StatusCodes: []int{http.StatusOK, http.StatusConflict},
+			NumResults:  1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			db := newFixtureDB(t, submitFixture)
+			r := mux.NewRouter()
+			r.HandleFunc("/results/submit", handlers.AddResult(db, nil)).Methods("POST")
+
+			var bodies []string
+			for i, req := range tc.Requests {
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, req)
+
+				if got, want := rec.Code, tc.StatusCodes[i]; got != want {
+					t.Errorf("request %d status code: want %d, got %d", i, want, got)
+				}
+				if rec.Code == http.StatusOK {
+					body := strings.TrimSpace(rec.Body.String())
+					if !strings.Contains(body, `"ranks":[{"benchmark":"Total"`) {
+						t.Errorf("request %d: response %q has no ranks", i, body)
+					}
+					bodies = append(bodies, body)
+				}
+			}
+
+			for _, body := range bodies[1:] {
+				if body != bodies[0] {
+					t.Errorf("replayed response: got %q, want %q", body, bodies[0])
+				}
+			}
+
+			results, err := db.ListResults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(results), tc.NumResults; got != want {
+				t.Errorf("stored results: got %d, want %d", got, want)
+			}
+		})
+	}
+}
 
+// racingSubmitDB misses the first idempotency key lookup and duplicate
+// check, as if a concurrent retry saved its submission right after them.
+type racingSubmitDB struct {
+	*dbtest.DB
+	missed bool
+}
+
+func (db *racingSubmitDB) GetSubmissionByFingerprint(userID int64, fingerprint string, since time.Time) (*database.Submission, error) {
+	return nil, nil
+}
+
+func (db *racingSubmitDB) GetSubmissionByKey(userID int64, key string) (*database.Submission, error) {
+	if !db.missed {
+		db.missed = true
+		return nil, nil
+	}
+	return db.DB.GetSubmissionByKey(userID, key)
+}
+
+func TestAddResultReplay(t *testing.T) {
+	db := newFixtureDB(t, submitFixture)
+	r := mux.NewRouter()
+	r.HandleFunc("/results/submit", handlers.AddResult(db, nil)).Methods("POST")
+
+	submit := func(body, key string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, newSubmitRequest(t, body, key))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	first := submit(testSubmission, "run-1")
+	// A better run changes the rank of the first, but not its replayed response.
+	submit(strings.Replace(testSubmission, `"score": 1000`, `"score": 2000`, 1), "")
+	replay := submit(testSubmission, "run-1")
+	if replay.Header().Get("Idempotent-Replayed") != "true" || replay.Body.String() != first.Body.String() {
+		t.Errorf("replay: want %q, got %q", first.Body, replay.Body)
+	}
+
+	// Keys do not expire, so a run queued for long can be retried.
+	sub, err := db.GetSubmissionByKey(1, "run-1")
+	if err != nil || sub == nil {
+		t.Fatalf("submission: %+v, %v", sub, err)
+	}
+	stale := *sub
+	stale.Key, stale.CreatedAt = "run-0", time.Now().Add(-30*24*time.Hour)
+	if _, err := db.AddSubmission(&stale); err != nil {
+		t.Fatal(err)
+	}
+	if rec := submit(testSubmission, "run-0"); !strings.Contains(rec.Body.String(), fmt.Sprintf(`"result_id":%d`, sub.ResultID)) {
+		t.Errorf("stale key: want result %d replayed, got %s", sub.ResultID, rec.Body)
+	}
+
+	racing := &racingSubmitDB{DB: db}
+	r = mux.NewRouter()
+	r.HandleFunc("/results/submit", handlers.AddResult(racing, nil)).Methods("POST")
+	if rec := submit(testSubmission, "run-1"); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("concurrent retry: want replayed, got %s", rec.Body)
+	}
+
+	results, err := db.ListResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Errorf("stored results: want 2, got %d", len(results))
+	}
+}
+
+// rankCountingDB counts the calls ranking results for events.
+type rankCountingDB struct {
+	*dbtest.DB
+	calls int
+}
+
+func (db *rankCountingDB) ListResults() ([]*database.Result, error) {
+	db.calls++
+	return db.DB.ListResults()
+}
+
+func (db *rankCountingDB) TotalRank(resultID int64) (int, error) {
+	db.calls++
+	return db.DB.TotalRank(resultID)
+}
+
+func TestAddResultWithoutEvents(t *testing.T) {
+	db := &rankCountingDB{DB: newFixtureDB(t, submitFixture)}
+	r := mux.NewRouter()
+	r.HandleFunc("/results/submit", handlers.AddResult(db, nil)).Methods("POST")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, newSubmitRequest(t, testSubmission, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if db.calls != 0 {
+		t.Errorf("ranked the result %d times for events without a bus", db.calls)
+	}
+}
+
+func TestAddResultRunTime(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	tt := []struct {
+		Name       string
+		CreatedAt  time.Time
+		StatusCode int
+	}{
+		{Name: "Queued run", CreatedAt: now.Add(-48 * time.Hour), StatusCode: http.StatusOK},
+		{Name: "Future run", CreatedAt: now.Add(time.Hour), StatusCode: http.StatusUnprocessableEntity},
+		{Name: "Stale run", CreatedAt: now.Add(-100 * 24 * time.Hour), StatusCode: http.StatusUnprocessableEntity},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			db := newFixtureDB(t, submitFixture)
+			r := mux.NewRouter()
+			r.HandleFunc("/results/submit", handlers.AddResult(db, nil)).Methods("POST")
+
+			body := strings.Replace(testSubmission, "{", fmt.Sprintf(`{"created_at": %q,`, tc.CreatedAt.Format(time.RFC3339)), 1)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newSubmitRequest(t, body, ""))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d: %s", want, got, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			results, err := db.ListResults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := results[0].CreatedAt; !got.Equal(tc.CreatedAt) {
+				t.Errorf("created at: want %v, got %v", tc.CreatedAt, got)
+			}
+		})
+	}
+}
+
+func TestAddResultKeepsRawSpecs(t *testing.T) {
+	const specs = `{"vendor": "GenuineIntel", "speed": 2200.00, "threads": 8, "overclocked": "yes", "physical_mem": "15.513 Gb"}`
+	db := newFixtureDB(t, submitFixture)
+	h := handlers.Handler(db)
+	req := newSubmitRequest(t, `{"scores": [{"name": "Total", "time": 1000, "score": 1000}], "specs": `+specs+`}`, "")
+	req.URL.Path = "/api/results/submit"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+
+	stored, err := db.ListSpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || string(stored[0].Raw) != specs {
+		t.Fatalf("got stored specs %+v, want the raw specs %s", stored, specs)
+	}
+	if s := stored[0]; !s.Overclocked || s.ClockSpeed != "2200" || s.Normalized.ClockSpeedHz != 2200000000 {
+		t.Errorf("got specs %+v, want them parsed as well", s)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/api/v1/specs/%d", stored[0].ID), nil))
+	var v1 struct {
+		Raw map[string]interface{} `json:"raw"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&v1); err != nil {
+		t.Fatal(err)
+	}
+	if v1.Raw["overclocked"] != "yes" || v1.Raw["speed"] != 2200.0 || v1.Raw["physical_mem"] != "15.513 Gb" {
+		t.Errorf("got raw specs %v in /api/v1, want them as submitted", v1.Raw)
+	}
 }
 
 func TestDeleteResult(t *testing.T) {
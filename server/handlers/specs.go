@@ -4,30 +4,56 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
-
-	"github.com/gorilla/mux"
 
 	"github.com/mguid65/osb-website/server/database"
 )
 
-// ListSpecs returns a list of all specs.
+// ListSpecs returns a list of all specs, streamed a page at a time.
+// Requested as CSV or NDJSON, each specs is flattened into a row with its
+// SysInfo and normalized fields.
 func ListSpecs(db database.SpecsDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		specs, err := db.ListSpecs()
+		format, err := negotiateFormat(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if err := sendJSONResponse(w, specs); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		columns := append(append([]string{"specs_id", "result_id"}, sysInfoColumns...),
+			"cpu_model", "clock_hz", "cpu_threads", "physical_mem_bytes", "virtual_mem_bytes", "swap_mem_bytes")
+		// Without specs, the JSON response is null, as it always was.
+		sendList(w, r, format, "specs", columns, "null", func(emit func(interface{}, func() []interface{}) error) error {
+			var after int64
+			for {
+				specs, err := db.ListSpecsAfter(after, streamPageSize)
+				if err != nil {
+					return err
+				}
+				for _, s := range specs {
+					s := s
+					err := emit(s, func() []interface{} {
+						n := s.Normalized
+						return concat(
+							[]interface{}{s.ID, s.ResultID},
+							sysInfoValues(&s.SysInfo),
+							[]interface{}{n.Model, n.ClockSpeedHz, n.Threads, n.PhysicalMemBytes, n.VirtualMemBytes, n.SwapMemBytes},
+						)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				if len(specs) < streamPageSize {
+					return nil
+				}
+				after = specs[len(specs)-1].ID
+			}
+		})
 	}
 }
 
@@ -35,30 +61,24 @@ func ListSpecs(db database.SpecsDatabase) http.HandlerFunc {
 func ListSpecsWithResultID(db database.SpecsDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key in router`, http.StatusInternalServerError)
-			return
-		}
-
-		resultID, err := strconv.ParseInt(idStr, 10, 64)
+		resultID, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		specs, err := db.ListSpecsWithResultID(resultID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := sendJSONResponse(w, specs); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 		}
 	}
 }
@@ -67,30 +87,24 @@ func ListSpecsWithResultID(db database.SpecsDatabase) http.HandlerFunc {
 func GetSpecs(db database.SpecsDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key`, http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		specsID, err := strconv.ParseInt(idStr, 10, 64)
+		specsID, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		specs, err := db.GetSpecs(specsID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := sendJSONResponse(w, specs); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 		}
 	}
 }
@@ -99,19 +113,13 @@ func GetSpecs(db database.SpecsDatabase) http.HandlerFunc {
 func AddSpecs(db database.SpecsDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key`, http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		resultID, err := strconv.ParseInt(idStr, 10, 64)
+		resultID, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -119,13 +127,17 @@ func AddSpecs(db database.SpecsDatabase) http.HandlerFunc {
 			ResultID: resultID,
 		}
 		if err := json.NewDecoder(r.Body).Decode(&specs); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := specs.SysInfo.Normalize(); err != nil {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, err.Error())
 			return
 		}
 
 		id, err := db.AddSpecs(&specs)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 		log.Println("successfully inserted specs id", id)
@@ -138,24 +150,18 @@ func AddSpecs(db database.SpecsDatabase) http.HandlerFunc {
 func DeleteSpecs(db database.SpecsDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key`, http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		specsID, err := strconv.ParseInt(idStr, 10, 64)
+		specsID, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := db.DeleteSpecs(specsID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -167,7 +173,7 @@ func DeleteSpecs(db database.SpecsDatabase) http.HandlerFunc {
 func UpdateSpecs(db database.SpecsDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
@@ -175,7 +181,7 @@ func UpdateSpecs(db database.SpecsDatabase) http.HandlerFunc {
 		var specs database.Specs
 
 		if err := db.UpdateSpecs(&specs); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// GetStats returns score statistics grouped by a specs field. The group_by
+// query parameter selects the field and defaults to model; the benchmark
+// parameter limits the statistics to a single benchmark.
+func GetStats(db database.StatsDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := queryStats(db, r)
+		var rejected *rejectedError
+		if errors.As(err, &rejected) {
+			sendErrorStatus(w, r, rejected.status, rejected.msg)
+			return
+		}
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", statsCacheControl)
+		if err := sendJSONResponse(w, stats); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// statsCacheControl is the Cache-Control header of statistics.
+const statsCacheControl = "public, max-age=60"
+
+// queryStats returns the statistics requested by the group_by and benchmark
+// query parameters. An invalid group_by is rejected with a *rejectedError.
+func queryStats(db database.StatsDatabase, r *http.Request) ([]*database.Stats, error) {
+	query := r.URL.Query()
+	groupBy := database.GroupByModel
+	if g := query.Get("group_by"); g != "" {
+		var err error
+		if groupBy, err = database.ParseGroupBy(g); err != nil {
+			return nil, &rejectedError{http.StatusBadRequest, err.Error()}
+		}
+	}
+	return db.BenchmarkStats(groupBy, query.Get("benchmark"))
+}
@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestGetStats(t *testing.T) {
+	f := catalogFixture()
+	for _, score := range []float64{10, 30} {
+		f.Results = append(f.Results, fixtureResult{
+			UserID: 2,
+			Scores: database.Scores{{Name: "Mandelbrot", Score: score}},
+			Specs:  &database.SysInfo{Vendor: "GenuineIntel", Threads: "8"},
+		})
+	}
+	h := handlers.Handler(newFixtureDB(t, f))
+
+	tt := []struct {
+		Name       string
+		Query      string
+		StatusCode int
+	}{
+		{Name: "Default group", Query: "", StatusCode: http.StatusOK},
+		{Name: "By vendor", Query: "?group_by=vendor", StatusCode: http.StatusOK},
+		{Name: "Invalid group", Query: "?group_by=user", StatusCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/stats"+tc.Query, nil))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d", want, got)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/stats?group_by=threads&benchmark=Mandelbrot", nil))
+	var stats []*database.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("got %d groups, want 1", len(stats))
+	}
+	if got := *stats[0]; got.Group != "8" || got.Count != 2 || got.Mean != 20 || got.P90 != 28 {
+		t.Errorf("got %+v, want group 8 with 2 scores, mean 20 and p90 28", got)
+	}
+}
+
+func TestGetStatsByCatalogCPU(t *testing.T) {
+	f := catalogFixture()
+	for i := range f.Results {
+		f.Results[i].Scores = database.Scores{{Name: "Mandelbrot", Score: float64(10 * (i + 1))}}
+	}
+	f.CPUs = []fixtureCPU{{CPU: database.CPU{Vendor: "GenuineIntel", Model: "Intel Core i7-8750H"}}}
+	db := newFixtureDB(t, f)
+	// A second specs row of result 3 must not count it twice.
+	if _, err := db.AddSpecs(&database.Specs{ResultID: 3, SysInfo: database.SysInfo{Model: "Intel Core i7-8750H"}}); err != nil {
+		t.Fatal(err)
+	}
+	const cpu = 9
+
+	rec := httptest.NewRecorder()
+	handlers.Handler(db).ServeHTTP(rec, httptest.NewRequest("GET", "/api/stats?benchmark=Mandelbrot", nil))
+	var stats []*database.Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %d groups, want 2: %+v", len(stats), stats)
+	}
+	if got := *stats[0]; got.Group != "Intel Core i5-8250U" || got.CPUID != 0 || got.Count != 1 {
+		t.Errorf("got %+v, want the uncatalogued i5-8250U with 1 score", got)
+	}
+	if got := *stats[1]; got.Group != "Intel Core i7-8750H" || got.CPUID != cpu || got.Count != 2 || got.Mean != 15 {
+		t.Errorf("got %+v, want CPU %d with 2 scores and mean 15", got, cpu)
+	}
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// responseFormat is the representation of a list endpoint's response.
+type responseFormat string
+
+// Supported response formats.
+const (
+	formatJSON   responseFormat = "json"
+	formatCSV    responseFormat = "csv"
+	formatNDJSON responseFormat = "ndjson"
+)
+
+// formatMediaTypes maps the media types accepted in the Accept header to formats.
+var formatMediaTypes = map[string]responseFormat{
+	"application/json":     formatJSON,
+	"text/csv":             formatCSV,
+	"application/x-ndjson": formatNDJSON,
+	"application/ndjson":   formatNDJSON,
+}
+
+// flushEvery is the number of items written between flushes of a streamed
+// response.
+const flushEvery = 100
+
+// streamPageSize is the number of items read from the database at a time
+// while streaming a listing.
+const streamPageSize = 500
+
+// negotiateFormat returns the response format requested by the format query
+// parameter or, in its absence, by the first supported media type in the
+// Accept header. It defaults to JSON.
+func negotiateFormat(r *http.Request) (responseFormat, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		switch format := responseFormat(strings.ToLower(f)); format {
+		case formatJSON, formatCSV, formatNDJSON:
+			return format, nil
+		}
+		return "", fmt.Errorf("unsupported format %q: want json, csv or ndjson", f)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if format, ok := formatMediaTypes[mediaType]; ok {
+			return format, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// tableWriter streams rows of a flattened table in a tabular format.
+type tableWriter interface {
+	// WriteRow writes a row with a value for each column.
+	WriteRow(values []interface{}) error
+
+	// Flush writes any buffered rows to the response.
+	Flush() error
+}
+
+// sendList streams a listing in format as read produces it, so neither the
+// listing nor the encoded response is held in memory. read calls emit with
+// each item in order and a function returning its row of the given columns.
+// JSON responses are an array of the items, or empty if there are none, and
+// CSV and NDJSON responses are tables of the rows, named name when
+// downloaded. An error is sent as the response if nothing was written yet,
+// and logged otherwise.
+func sendList(w http.ResponseWriter, r *http.Request, format responseFormat, name string, columns []string, empty string,
+	read func(emit func(item interface{}, row func() []interface{}) error) error) {
+	var (
+		write   func(item interface{}, row func() []interface{}) error
+		flush   func() error
+		end     func() error
+		started bool
+	)
+	start := func() error {
+		started = true
+		w.Header().Set("Vary", "Accept")
+		if format == formatJSON {
+			setJSONHeaders(w)
+			w.WriteHeader(http.StatusOK)
+			jw := &jsonArrayWriter{w: w, empty: empty}
+			write = func(item interface{}, _ func() []interface{}) error { return jw.WriteItem(item) }
+			flush, end = jw.Flush, jw.Close
+			return nil
+		}
+
+		var tw tableWriter
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		switch format {
+		case formatCSV:
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+			w.WriteHeader(http.StatusOK)
+			cw := csv.NewWriter(w)
+			header := make([]string, len(columns))
+			for i, c := range columns {
+				header[i] = escapeFormula(c)
+			}
+			if err := cw.Write(header); err != nil {
+				return err
+			}
+			tw = &csvTableWriter{w: cw}
+		case formatNDJSON:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			tw = &ndjsonTableWriter{w: w, columns: columns}
+		default:
+			return fmt.Errorf("unsupported list format %q", format)
+		}
+		write = func(_ interface{}, row func() []interface{}) error { return tw.WriteRow(row()) }
+		flush, end = tw.Flush, tw.Flush
+		return nil
+	}
+
+	flusher, _ := w.(http.Flusher)
+	var n int
+	emit := func(item interface{}, row func() []interface{}) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := write(item, row); err != nil {
+			return err
+		}
+		if n++; n%flushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	}
+
+	err := read(emit)
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = end()
+	}
+	if err != nil {
+		if !started {
+			sendError(w, r, err)
+			return
+		}
+		log.Printf("could not stream %s: %v", name, err)
+	}
+}
+
+// csvTableWriter writes a table as CSV.
+type csvTableWriter struct {
+	w *csv.Writer
+}
+
+func (t *csvTableWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatCell(v)
+	}
+	return t.w.Write(record)
+}
+
+func (t *csvTableWriter) Flush() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// ndjsonTableWriter writes a table as one JSON object per line, keeping the
+// column order.
+type ndjsonTableWriter struct {
+	w       http.ResponseWriter
+	columns []string
+	buf     bytes.Buffer
+}
+
+func (t *ndjsonTableWriter) WriteRow(values []interface{}) error {
+	t.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			t.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(t.columns[i])
+		t.buf.Write(key)
+		t.buf.WriteByte(':')
+		if ts, ok := v.(time.Time); ok {
+			v = ts.UTC().Format(time.RFC3339)
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		t.buf.Write(value)
+	}
+	t.buf.WriteString("}\n")
+	return nil
+}
+
+func (t *ndjsonTableWriter) Flush() error {
+	_, err := t.buf.WriteTo(t.w)
+	return err
+}
+
+// jsonArrayWriter writes the items of a listing as a JSON array.
+type jsonArrayWriter struct {
+	w     http.ResponseWriter
+	empty string // written instead of an array without items
+	buf   bytes.Buffer
+	n     int
+}
+
+func (t *jsonArrayWriter) WriteItem(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if t.n == 0 {
+		t.buf.WriteByte('[')
+	} else {
+		t.buf.WriteByte(',')
+	}
+	t.n++
+	t.buf.Write(body)
+	return nil
+}
+
+func (t *jsonArrayWriter) Flush() error {
+	_, err := t.buf.WriteTo(t.w)
+	return err
+}
+
+// Close writes the rest of the array.
+func (t *jsonArrayWriter) Close() error {
+	if t.n == 0 {
+		t.buf.WriteString(t.empty)
+	} else {
+		t.buf.WriteByte(']')
+	}
+	t.buf.WriteByte('\n')
+	return t.Flush()
+}
+
+// formatCell formats a table value as CSV text. Missing values are empty.
+// Strings are escaped by escapeFormula.
+func formatCell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
+
+// escapeFormula prefixes s with a quote if it starts with a character that
+// makes spreadsheets evaluate a cell as a formula, so that submitted strings
+// such as "=HYPERLINK(...)" are shown as text when a CSV export is opened.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// scoreColumns returns a score and a time column for each benchmark.
+func scoreColumns(benchmarks []string) []string {
+	columns := make([]string, 0, 2*len(benchmarks))
+	for _, name := range benchmarks {
+		columns = append(columns, name+"_score", name+"_time_ms")
+	}
+	return columns
+}
+
+// scoreValues returns the values of the scoreColumns of benchmarks, nil where
+// scores lacks a benchmark.
+func scoreValues(scores database.Scores, benchmarks []string) []interface{} {
+	values := make([]interface{}, 2*len(benchmarks))
+	for i, name := range benchmarks {
+		for _, score := range scores {
+			if score.Name == name {
+				values[2*i] = score.Score
+				values[2*i+1] = float64(score.Time.Duration) / float64(time.Millisecond)
+				break
+			}
+		}
+	}
+	return values
+}
+
+// sysInfoColumns are the columns of the SysInfo fields.
+var sysInfoColumns = []string{
+	"vendor", "model", "speed", "threads", "overclocked", "byte_order",
+	"physical_mem", "virtual_mem", "swap_mem",
+}
+
+// sysInfoValues returns the values of the sysInfoColumns, all nil if s is nil.
+func sysInfoValues(s *database.SysInfo) []interface{} {
+	if s == nil {
+		return make([]interface{}, len(sysInfoColumns))
+	}
+	return []interface{}{
+		s.Vendor, s.Model, s.ClockSpeed, s.Threads, s.Overclocked, s.ByteOrder,
+		s.PhysicalMem, s.VirtualMem, s.SwapMem,
+	}
+}
+
+// sysInfoOf returns the SysInfo of s, nil if s is nil.
+func sysInfoOf(s *database.Specs) *database.SysInfo {
+	if s == nil {
+		return nil
+	}
+	return &s.SysInfo
+}
+
+// concat returns the concatenation of the given row parts.
+func concat(parts ...[]interface{}) []interface{} {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+	all := make([]interface{}, 0, n)
+	for _, p := range parts {
+		all = append(all, p...)
+	}
+	return all
+}
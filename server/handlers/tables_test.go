@@ -0,0 +1,255 @@
+package handlers_test
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+// tableFixture holds three results, with IDs 2, 4 and 6, whose specs have
+// characters CSV must quote.
+func tableFixture() fixture {
+	f := fixture{Users: []database.User{{Name: "test"}}}
+	created := time.Date(2018, time.November, 7, 21, 43, 49, 0, time.UTC)
+	for _, scores := range []database.Scores{
+		{{Name: "Mandelbrot", Score: 50, Time: database.Duration{Duration: 1500 * time.Microsecond}}, {Name: "Total", Score: 100}},
+		{{Name: "Total", Score: 300}, {Name: "Stream", Score: 7}},
+		{{Name: "Stream", Score: 3}},
+	} {
+		f.Results = append(f.Results, fixtureResult{
+			UserID:    1,
+			Scores:    scores,
+			CreatedAt: created,
+			Specs:     &database.SysInfo{Vendor: "GenuineIntel", Model: "Intel, \"fast\" CPU", Threads: "8"},
+		})
+	}
+	return f
+}
+
+func TestResponseFormats(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, tableFixture()))
+
+	tt := []struct {
+		Name        string
+		Path        string
+		Accept      string
+		StatusCode  int
+		ContentType string
+	}{
+		{Name: "Default", Path: "/api/results", StatusCode: http.StatusOK, ContentType: "application/json"},
+		{Name: "Accept CSV", Path: "/api/results", Accept: "text/csv", StatusCode: http.StatusOK, ContentType: "text/csv; charset=utf-8"},
+		{Name: "Accept list", Path: "/api/specs", Accept: "text/html, application/x-ndjson;q=0.9", StatusCode: http.StatusOK, ContentType: "application/x-ndjson"},
+		{Name: "Query overrides Accept", Path: "/api/leaderboard?format=csv", Accept: "application/json", StatusCode: http.StatusOK, ContentType: "text/csv; charset=utf-8"},
+		{Name: "Unsupported format", Path: "/api/results?format=xlsx", StatusCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.Path, nil)
+			if tc.Accept != "" {
+				req.Header.Set("Accept", tc.Accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d: %s", want, got, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); tc.ContentType != "" && got != tc.ContentType {
+				t.Errorf("content type: want %q, got %q", tc.ContentType, got)
+			}
+		})
+	}
+}
+
+func TestResultsCSV(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, tableFixture()))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/results?format=csv", nil))
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"result_id", "user_id", "created_at", "vendor", "model", "speed", "threads", "overclocked", "byte_order", "physical_mem", "virtual_mem", "swap_mem",
+			"Mandelbrot_score", "Mandelbrot_time_ms", "Total_score", "Total_time_ms", "Stream_score", "Stream_time_ms"},
+		{"2", "1", "2018-11-07T21:43:49Z", "GenuineIntel", `Intel, "fast" CPU`, "", "8", "false", "", "", "", "", "50", "1.5", "100", "0", "", ""},
+		{"4", "1", "2018-11-07T21:43:49Z", "GenuineIntel", `Intel, "fast" CPU`, "", "8", "false", "", "", "", "", "", "", "300", "0", "7", "0"},
+		{"6", "1", "2018-11-07T21:43:49Z", "GenuineIntel", `Intel, "fast" CPU`, "", "8", "false", "", "", "", "", "", "", "", "", "3", "0"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d:\n%s", len(records), len(want), rec.Body)
+	}
+	for i := range want {
+		if got, want := strings.Join(records[i], "|"), strings.Join(want[i], "|"); got != want {
+			t.Errorf("record %d:\ngot  %s\nwant %s", i, got, want)
+		}
+	}
+}
+
+func TestCSVFormulaEscaping(t *testing.T) {
+	db := newFixtureDB(t, fixture{Results: []fixtureResult{{
+		UserID: 1,
+		Scores: database.Scores{{Name: "+Total", Score: -5}},
+		Specs:  &database.SysInfo{Vendor: "@SUM(1)", Model: `=HYPERLINK("http://example.com")`},
+	}}})
+
+	rec := httptest.NewRecorder()
+	handlers.Handler(db).ServeHTTP(rec, httptest.NewRequest("GET", "/api/results?format=csv", nil))
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	header, row := strings.Join(records[0], "|"), strings.Join(records[1], "|")
+	if !strings.HasSuffix(header, "|'+Total_score|'+Total_time_ms") {
+		t.Errorf("header: benchmark columns are not escaped: %s", header)
+	}
+	if want := `|'@SUM(1)|'=HYPERLINK("http://example.com")|`; !strings.Contains(row, want) {
+		t.Errorf("row: want %s, got %s", want, row)
+	}
+	if !strings.HasSuffix(row, "|-5|0") {
+		t.Errorf("row: numbers must not be escaped: %s", row)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, tableFixture()))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/leaderboard", nil))
+	var entries []struct {
+		Rank       int     `json:"rank"`
+		ResultID   int64   `json:"result_id"`
+		User       string  `json:"user"`
+		TotalScore float64 `json:"total_score"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want the 2 results with a Total score", len(entries))
+	}
+	if e := entries[0]; e.Rank != 1 || e.ResultID != 4 || e.User != "test" || e.TotalScore != 300 {
+		t.Errorf("got first entry %+v, want result 4 by test with 300", e)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/leaderboard", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	h.ServeHTTP(rec, req)
+	var lines []string
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	if !strings.HasPrefix(lines[0], `{"rank":1,"result_id":4,"user_id":1,"user":"test","created_at":"2018-11-07T21:43:49Z","vendor":"GenuineIntel"`) {
+		t.Errorf("got first line %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], `"Total_score":100,"Total_time_ms":0,"Stream_score":null,"Stream_time_ms":null}`) {
+		t.Errorf("got second line %s", lines[1])
+	}
+}
+
+// pagedDB fails the test if every result, specs or user is read at once
+// instead of a page at a time.
+type pagedDB struct {
+	*dbtest.DB
+	t *testing.T
+}
+
+func (db *pagedDB) ListResults() ([]*database.Result, error) {
+	db.t.Error("ListResults: listings must be streamed a page at a time")
+	return db.DB.ListResults()
+}
+
+func (db *pagedDB) ListSpecs() ([]*database.Specs, error) {
+	db.t.Error("ListSpecs: listings must be streamed a page at a time")
+	return db.DB.ListSpecs()
+}
+
+func (db *pagedDB) ListUsers() ([]*database.UserExternal, error) {
+	db.t.Error("ListUsers: listings must be streamed a page at a time")
+	return db.DB.ListUsers()
+}
+
+func TestListingsStreamPages(t *testing.T) {
+	const n = 1201 // results across several pages
+	f := fixture{Users: []database.User{{Name: "test"}}}
+	for i := 0; i < n; i++ {
+		f.Results = append(f.Results, fixtureResult{
+			UserID: 1,
+			Scores: database.Scores{{Name: "Total", Score: float64(i % 10)}},
+			Specs:  &database.SysInfo{Threads: "8"},
+		})
+	}
+	h := handlers.Handler(&pagedDB{newFixtureDB(t, f), t})
+
+	for _, path := range []string{"/api/results", "/api/specs", "/api/leaderboard"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var items []json.RawMessage
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if len(items) != n {
+			t.Errorf("%s: got %d items, want %d", path, len(items), n)
+		}
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path+"?format=csv", nil))
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("%s as CSV: %v", path, err)
+		}
+		if len(records) != n+1 {
+			t.Errorf("%s as CSV: got %d records, want %d", path, len(records), n+1)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/leaderboard", nil))
+	var entries []struct {
+		Rank       int     `json:"rank"`
+		ResultID   int64   `json:"result_id"`
+		TotalScore float64 `json:"total_score"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(entries); i++ {
+		prev, e := entries[i-1], entries[i]
+		if e.Rank != i+1 || e.TotalScore > prev.TotalScore || e.TotalScore == prev.TotalScore && e.ResultID < prev.ResultID {
+			t.Fatalf("entry %d %+v follows %+v: want ranks by score, then by result ID", i, e, prev)
+		}
+	}
+}
+
+func TestEmptyListings(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, fixture{}))
+	for path, want := range map[string]string{
+		"/api/results":     "null",
+		"/api/specs":       "null",
+		"/api/leaderboard": "[]",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if got := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || got != want {
+			t.Errorf("%s: got %d %q, want %d %q", path, rec.Code, got, http.StatusOK, want)
+		}
+	}
+}
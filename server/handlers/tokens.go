@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// maxTokenNameLen is the longest accepted token name.
+const maxTokenNameLen = 64
+
+// accountV1 is the authenticated user in /api/v1.
+type accountV1 struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Admin bool   `json:"admin"`
+}
+
+// tokenV1 is an API token in /api/v1. Its secret is only returned once, when
+// it is created.
+type tokenV1 struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Token     string    `json:"token,omitempty"`
+}
+
+// tokenRequest is the body of a token creation request.
+type tokenRequest struct {
+	Name string `json:"name"`
+}
+
+func newTokenV1(t *database.Token) tokenV1 {
+	return tokenV1{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt.UTC()}
+}
+
+// GetMe returns the authenticated user.
+func GetMe(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		sendV1(w, r, accountV1{ID: user.ID, Name: user.Name, Email: user.Email, Admin: user.Admin}, nil)
+	}
+}
+
+// ListTokens returns the API tokens of the authenticated user without their
+// secrets.
+func ListTokens(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		tokens, err := db.ListTokens(user.ID)
+		v := make([]tokenV1, len(tokens))
+		for i, t := range tokens {
+			v[i] = newTokenV1(t)
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// CreateToken creates an API token for the authenticated user and returns it
+// along with its secret, which cannot be retrieved later.
+func CreateToken(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+
+		var req tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > maxTokenNameLen {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, "token name must be 1 to 64 characters")
+			return
+		}
+
+		secret, hash, err := database.NewTokenSecret()
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		token := &database.Token{
+			UserID:    user.ID,
+			Name:      req.Name,
+			Hash:      hash,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if token.ID, err = db.AddToken(token); err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		v := newTokenV1(token)
+		v.Token = secret
+		sendV1(w, r, v, nil)
+	}
+}
+
+// DeleteToken deletes an API token of the authenticated user.
+func DeleteToken(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if err := db.DeleteToken(user.ID, id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestTokens(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, catalogFixture()))
+	do := func(method, path, body string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if auth != nil {
+			auth(req)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	basic := func(req *http.Request) { req.SetBasicAuth("test", "password") }
+
+	rec := do("POST", "/api/v1/tokens", `{"name": "laptop"}`, basic)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	var created struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "laptop" || !strings.HasPrefix(created.Token, "osb_") {
+		t.Fatalf("create: unexpected token %+v", created)
+	}
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+created.Token) }
+
+	rec = do("GET", "/api/v1/me", "", bearer)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("me: status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	var me struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&me); err != nil {
+		t.Fatal(err)
+	}
+	if me.ID != 2 || me.Name != "test" {
+		t.Errorf("me: want user 2 test, got %+v", me)
+	}
+
+	rec = do("GET", "/api/v1/tokens", "", bearer)
+	if strings.Contains(rec.Body.String(), created.Token) {
+		t.Error("list: token secret is listed")
+	}
+	if !strings.Contains(rec.Body.String(), `"name":"laptop"`) {
+		t.Errorf("list: token missing: %s", rec.Body)
+	}
+
+	if rec := do("POST", "/api/v1/tokens", `{"name": ""}`, basic); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("empty name: status code: want %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+	admin := func(req *http.Request) { req.SetBasicAuth("admin", "password") }
+	path := fmt.Sprintf("/api/v1/tokens/%d", created.ID)
+	if rec := do("DELETE", path, "", admin); rec.Code != http.StatusNotFound {
+		t.Errorf("delete other's token: status code: want %d, got %d", http.StatusNotFound, rec.Code)
+	}
+	if rec := do("DELETE", path, "", bearer); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if rec := do("GET", "/api/v1/me", "", bearer); rec.Code != http.StatusUnauthorized {
+		t.Errorf("deleted token: status code: want %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+// listingDB counts the calls listing every result.
+type listingDB struct {
+	*dbtest.DB
+	calls int
+}
+
+func (db *listingDB) ListResults() ([]*database.Result, error) {
+	db.calls++
+	return db.DB.ListResults()
+}
+
+func (db *listingDB) ListResultsCreatedBy(id int64) ([]*database.Result, error) {
+	db.calls++
+	return db.DB.ListResultsCreatedBy(id)
+}
+
+func TestPagination(t *testing.T) {
+	db := &listingDB{DB: newFixtureDB(t, catalogFixture())}
+	h := handlers.Handler(db)
+
+	var ids []int64
+	path := "/api/v1/users/2/results?limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status code: want %d, got %d: %s", path, http.StatusOK, rec.Code, rec.Body)
+		}
+		var page []struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range page {
+			ids = append(ids, r.ID)
+		}
+		path = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			path = link[strings.Index(link, "<")+1 : strings.Index(link, ">")]
+		}
+	}
+	if got, want := fmt.Sprint(ids), "[3 5 7]"; got != want {
+		t.Errorf("ids: want %s, got %s", want, got)
+	}
+	if db.calls != 0 {
+		t.Errorf("listed all results %d times to page through them", db.calls)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/results?limit=2&after=7", nil))
+	if got := strings.TrimSpace(rec.Body.String()); rec.Code != http.StatusOK || got != "[]" || rec.Header().Get("Link") != "" {
+		t.Errorf("last page: got %d %s, want an empty page without a next link", rec.Code, got)
+	}
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=x", "limit=1&after=x"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/results?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status code: want %d, got %d", query, http.StatusBadRequest, rec.Code)
+		}
+	}
+}
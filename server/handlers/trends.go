@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mguid65/osb-website/server/database"
+)
+
+// trendsResponse is the response of GetUserTrends.
+type trendsResponse struct {
+	UserID    int64             `json:"user_id"`
+	Benchmark string            `json:"benchmark"`
+	Machines  []*database.Trend `json:"machines"`
+}
+
+// GetUserTrends returns the time series of a user's scores for a benchmark,
+// grouped by machine. The benchmark query parameter defaults to Total, window
+// enables a rolling average over that many runs, and threshold enables
+// regression detection, flagging drops of at least that percentage.
+func GetUserTrends(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		query := r.URL.Query()
+		opts := database.TrendOptions{Benchmark: query.Get("benchmark")}
+		if opts.Benchmark == "" {
+			opts.Benchmark = "Total"
+		}
+		if s := query.Get("window"); s != "" {
+			if opts.Window, err = strconv.Atoi(s); err != nil || opts.Window < 0 {
+				sendErrorStatus(w, r, http.StatusBadRequest, "window: want a non-negative number of runs")
+				return
+			}
+		}
+		if s := query.Get("threshold"); s != "" {
+			if opts.Threshold, err = strconv.ParseFloat(s, 64); err != nil || opts.Threshold < 0 {
+				sendErrorStatus(w, r, http.StatusBadRequest, "threshold: want a non-negative percentage")
+				return
+			}
+		}
+
+		if _, err := db.GetUser(userID); err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		trends, err := userTrends(db, userID, opts)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		resp := trendsResponse{
+			UserID:    userID,
+			Benchmark: opts.Benchmark,
+			Machines:  trends,
+		}
+		if err := sendJSONResponse(w, resp); err != nil {
+			sendError(w, r, err)
+		}
+	}
+}
+
+// userTrends returns the trends of the user's scores on each machine.
+func userTrends(db database.OSBDatabase, userID int64, opts database.TrendOptions) ([]*database.Trend, error) {
+	results, err := db.ListResultsCreatedBy(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	specs, err := specsOfResults(db, results)
+	if err != nil {
+		return nil, err
+	}
+	return database.ComputeTrends(results, specs, opts), nil
+}
+
+// specsOfResults returns the first specs of each of results by result ID.
+func specsOfResults(db database.SpecsDatabase, results []*database.Result) (map[int64]*database.Specs, error) {
+	ids := make([]int64, len(results))
+	for i, res := range results {
+		ids[i] = res.ID
+	}
+	list, err := db.ListSpecsWithResultIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	specs := make(map[int64]*database.Specs, len(list))
+	for _, s := range list {
+		if _, ok := specs[s.ResultID]; !ok {
+			specs[s.ResultID] = s
+		}
+	}
+	return specs, nil
+}
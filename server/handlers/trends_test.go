@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/handlers"
+)
+
+func TestGetUserTrends(t *testing.T) {
+	f := catalogFixture()
+	for _, score := range []float64{100, 80} {
+		f.Results = append(f.Results, fixtureResult{
+			UserID: 2,
+			Scores: database.Scores{{Name: "Total", Score: score}},
+			Specs:  &database.SysInfo{Model: "AMD Ryzen 7 2700X", Threads: "16"},
+		})
+	}
+	h := handlers.Handler(newFixtureDB(t, f))
+
+	tt := []struct {
+		Name       string
+		Query      string
+		StatusCode int
+	}{
+		{Name: "Defaults", Query: "", StatusCode: http.StatusOK},
+		{Name: "Rolling average", Query: "?benchmark=Total&window=3&threshold=5", StatusCode: http.StatusOK},
+		{Name: "Invalid window", Query: "?window=-1", StatusCode: http.StatusBadRequest},
+		{Name: "Invalid threshold", Query: "?threshold=ten", StatusCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/users/2/trends"+tc.Query, nil))
+			if got, want := rec.Code, tc.StatusCode; got != want {
+				t.Fatalf("status code: want %d, got %d", want, got)
+			}
+		})
+	}
+
+	trends := func(query string) []*database.TrendPoint {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/users/2/trends"+query, nil))
+		var resp struct {
+			Benchmark string            `json:"benchmark"`
+			Machines  []*database.Trend `json:"machines"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Benchmark != "Total" || len(resp.Machines) != 1 {
+			t.Fatalf("%s: got benchmark %q with %d machines, want Total with 1", query, resp.Benchmark, len(resp.Machines))
+		}
+		return resp.Machines[0].Points
+	}
+
+	if points := trends("?threshold=10"); len(points) != 2 || !points[1].Regression {
+		t.Errorf("got %d points, want 2 with the second flagged as a regression", len(points))
+	}
+	// Regression detection is off unless a threshold is given.
+	if points := trends(""); len(points) != 2 || points[1].Regression || points[1].ChangePercent == nil {
+		t.Errorf("got %d points, want 2 with a change but no regression", len(points))
+	}
+}
@@ -6,10 +6,8 @@ import (
 	"html/template"
 	"io"
 	"net/http"
-	"strconv"
 	"strings"
 
-	"github.com/gorilla/mux"
 	"github.com/mguid65/osb-website/server/database"
 )
 
@@ -17,18 +15,18 @@ import (
 func ListUsers(db database.UserDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
 		users, err := db.ListUsers()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := sendJSONResponse(w, users); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 		}
 	}
 }
@@ -37,30 +35,24 @@ func ListUsers(db database.UserDatabase) http.HandlerFunc {
 func GetUser(db database.UserDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `route: no key "id"`, http.StatusInternalServerError)
-			return
-		}
-
-		id, err := strconv.ParseInt(idStr, 10, 64)
+		id, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		user, err := db.GetUser(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := sendJSONResponse(w, user); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 		}
 	}
 }
@@ -69,12 +61,12 @@ func GetUser(db database.UserDatabase) http.HandlerFunc {
 func AddUser(db database.UserDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
 		if err := r.ParseForm(); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
 
@@ -88,7 +80,7 @@ func AddUser(db database.UserDatabase) http.HandlerFunc {
 			case "password":
 				hash := sha512.New()
 				if _, err := io.Copy(hash, strings.NewReader(v[0])); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					sendError(w, r, err)
 					return
 				}
 				user.Password = hex.EncodeToString(hash.Sum(nil))
@@ -96,7 +88,7 @@ func AddUser(db database.UserDatabase) http.HandlerFunc {
 		}
 
 		if _, err := db.AddUser(&user); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -118,12 +110,12 @@ func AddUser(db database.UserDatabase) http.HandlerFunc {
 			</html>
 		`)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := tmpl.Execute(w, user); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 		}
 	}
 }
@@ -132,24 +124,18 @@ func AddUser(db database.UserDatabase) http.HandlerFunc {
 func DeleteUser(db database.UserDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
-
-		idStr, ok := mux.Vars(r)["id"]
-		if !ok {
-			http.Error(w, `router: no "id" key`, http.StatusInternalServerError)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
-		id, err := strconv.ParseInt(idStr, 10, 64)
+		id, err := routeID(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
 		if err := db.DeleteUser(id); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
@@ -161,7 +147,7 @@ func DeleteUser(db database.UserDatabase) http.HandlerFunc {
 func UpdateUser(db database.UserDatabase) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
+			sendErrorStatus(w, r, http.StatusMethodNotAllowed, r.Method+" is not allowed")
 			return
 		}
 
@@ -169,7 +155,7 @@ func UpdateUser(db database.UserDatabase) http.HandlerFunc {
 		var user database.User
 
 		if err := db.UpdateUser(&user); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			sendError(w, r, err)
 			return
 		}
 
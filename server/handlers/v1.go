@@ -0,0 +1,606 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/events"
+)
+
+// The /api/v1 routes serve the types below instead of the database types, so
+// their JSON shape only changes deliberately. All fields are snake_case and
+// every object has an "id". The legacy /api routes keep serializing the
+// database types as they always have, since the website depends on them.
+
+// userV1 is a user in /api/v1.
+type userV1 struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// scoreV1 is a benchmark score in /api/v1.
+type scoreV1 struct {
+	Name   string  `json:"name"`
+	Score  float64 `json:"score"`
+	TimeMS float64 `json:"time_ms"` // elapsed time in milliseconds
+}
+
+// resultV1 is a result in /api/v1.
+type resultV1 struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Scores    []scoreV1 `json:"scores"`
+}
+
+// resultDetailV1 is a result along with the percentile ranks of its scores.
+type resultDetailV1 struct {
+	resultV1
+	Ranks []*database.BenchmarkRanks `json:"ranks"`
+}
+
+// sysInfoV1 is the system information reported by the benchmark client.
+type sysInfoV1 struct {
+	Vendor      string `json:"vendor"`
+	Model       string `json:"model"`
+	ClockSpeed  string `json:"clock_speed"`
+	Threads     string `json:"threads"`
+	Overclocked bool   `json:"overclocked"`
+	ByteOrder   string `json:"byte_order"`
+	PhysicalMem string `json:"physical_mem"`
+	VirtualMem  string `json:"virtual_mem"`
+	SwapMem     string `json:"swap_mem"`
+}
+
+// normalizedV1 holds the typed values parsed from sysInfoV1.
+type normalizedV1 struct {
+	Model            string `json:"model"`
+	ClockSpeedHz     int64  `json:"clock_speed_hz"`
+	Threads          int    `json:"threads"`
+	Overclocked      bool   `json:"overclocked"`
+	PhysicalMemBytes int64  `json:"physical_mem_bytes"`
+	VirtualMemBytes  int64  `json:"virtual_mem_bytes"`
+	SwapMemBytes     int64  `json:"swap_mem_bytes"`
+}
+
+// specsV1 is the specs of a result in /api/v1.
+type specsV1 struct {
+	ID         int64           `json:"id"`
+	ResultID   int64           `json:"result_id"`
+	System     sysInfoV1       `json:"system"`
+	Normalized normalizedV1    `json:"normalized"`
+	Raw        json.RawMessage `json:"raw,omitempty"` // specs object exactly as the client sent it
+}
+
+// cpuV1 is a catalogued CPU in /api/v1.
+type cpuV1 struct {
+	ID          int64  `json:"id"`
+	Vendor      string `json:"vendor"`
+	Family      string `json:"family"`
+	Model       string `json:"model"`
+	Cores       int    `json:"cores"`
+	Threads     int    `json:"threads"`
+	BaseClockHz int64  `json:"base_clock_hz"`
+}
+
+// cpuAliasV1 is a CPU alias in /api/v1.
+type cpuAliasV1 struct {
+	ID    int64  `json:"id"`
+	CPUID int64  `json:"cpu_id"`
+	Model string `json:"model"`
+}
+
+// comparisonV1 is the response of /api/v1/compare.
+type comparisonV1 struct {
+	Baseline   int64                   `json:"baseline"`   // baseline result ID
+	Results    []comparedResultV1      `json:"results"`    // compared results in request order
+	Benchmarks []benchmarkComparisonV1 `json:"benchmarks"` // benchmarks in order of first appearance
+}
+
+// comparedResultV1 describes one of the compared results.
+type comparedResultV1 struct {
+	ID     int64      `json:"id"`
+	UserID int64      `json:"user_id"`
+	System *sysInfoV1 `json:"system"` // nil if the result has no specs
+}
+
+// benchmarkComparisonV1 aligns the scores of one benchmark across results.
+type benchmarkComparisonV1 struct {
+	Name   string             `json:"name"`
+	Scores []*comparedScoreV1 `json:"scores"` // aligned with comparisonV1.Results, nil where missing
+}
+
+// comparedScoreV1 is a benchmark score relative to the baseline's score.
+type comparedScoreV1 struct {
+	Score        float64  `json:"score"`
+	TimeMS       float64  `json:"time_ms"`       // elapsed time in milliseconds
+	Delta        *float64 `json:"delta"`         // nil if the baseline lacks the benchmark
+	DeltaPercent *float64 `json:"delta_percent"` // nil if the baseline lacks the benchmark or scored 0
+}
+
+// leaderboardEntryV1 is a ranked result on the /api/v1 leaderboard.
+type leaderboardEntryV1 struct {
+	Rank        int        `json:"rank"`
+	ResultID    int64      `json:"result_id"`
+	UserID      int64      `json:"user_id"`
+	User        string     `json:"user"`
+	CreatedAt   time.Time  `json:"created_at"`
+	TotalScore  float64    `json:"total_score"`
+	TotalTimeMS float64    `json:"total_time_ms"` // elapsed time of the Total benchmark in milliseconds
+	Scores      []scoreV1  `json:"scores"`
+	System      *sysInfoV1 `json:"system"` // nil if the result has no specs
+}
+
+// statsV1 holds score statistics of a benchmark within a group of results.
+type statsV1 struct {
+	Group     string  `json:"group"`            // value of the grouped field
+	CPUID     int64   `json:"cpu_id,omitempty"` // catalog CPU of a model group, 0 if the model is not catalogued
+	Benchmark string  `json:"benchmark"`
+	Count     int     `json:"count"`
+	Mean      float64 `json:"mean"`
+	Median    float64 `json:"median"`
+	P10       float64 `json:"p10"`
+	P50       float64 `json:"p50"`
+	P90       float64 `json:"p90"`
+	StdDev    float64 `json:"stddev"`
+}
+
+func newUserV1(u *database.UserExternal) userV1 {
+	return userV1{ID: u.ID, Name: u.Name}
+}
+
+func newResultV1(res *database.Result) resultV1 {
+	return resultV1{ID: res.ID, UserID: res.UserID, CreatedAt: res.CreatedAt.UTC(), Scores: newScoresV1(res.Scores)}
+}
+
+func newScoresV1(scores database.Scores) []scoreV1 {
+	v := []scoreV1{}
+	for _, s := range scores {
+		v = append(v, scoreV1{Name: s.Name, Score: s.Score, TimeMS: durationMS(s.Time)})
+	}
+	return v
+}
+
+// durationMS returns d in milliseconds.
+func durationMS(d database.Duration) float64 {
+	return float64(d.Duration) / float64(time.Millisecond)
+}
+
+func newResultsV1(results []*database.Result) []resultV1 {
+	v := make([]resultV1, len(results))
+	for i, res := range results {
+		v[i] = newResultV1(res)
+	}
+	return v
+}
+
+func newSpecsV1(s *database.Specs) specsV1 {
+	n := s.Normalized
+	return specsV1{
+		ID:       s.ID,
+		ResultID: s.ResultID,
+		System:   *newSysInfoV1(&s.SysInfo),
+		Normalized: normalizedV1{
+			Model:            n.Model,
+			ClockSpeedHz:     n.ClockSpeedHz,
+			Threads:          n.Threads,
+			Overclocked:      n.Overclocked,
+			PhysicalMemBytes: n.PhysicalMemBytes,
+			VirtualMemBytes:  n.VirtualMemBytes,
+			SwapMemBytes:     n.SwapMemBytes,
+		},
+		Raw: s.Raw,
+	}
+}
+
+// newSysInfoV1 returns s in /api/v1, nil if s is nil.
+func newSysInfoV1(s *database.SysInfo) *sysInfoV1 {
+	if s == nil {
+		return nil
+	}
+	return &sysInfoV1{
+		Vendor:      s.Vendor,
+		Model:       s.Model,
+		ClockSpeed:  s.ClockSpeed,
+		Threads:     s.Threads,
+		Overclocked: s.Overclocked,
+		ByteOrder:   s.ByteOrder,
+		PhysicalMem: s.PhysicalMem,
+		VirtualMem:  s.VirtualMem,
+		SwapMem:     s.SwapMem,
+	}
+}
+
+func newCPUV1(c *database.CPU) cpuV1 {
+	return cpuV1{
+		ID:          c.ID,
+		Vendor:      c.Vendor,
+		Family:      c.Family,
+		Model:       c.Model,
+		Cores:       c.Cores,
+		Threads:     c.Threads,
+		BaseClockHz: c.BaseClockHz,
+	}
+}
+
+func newComparisonV1(cmp *comparison) comparisonV1 {
+	v := comparisonV1{Baseline: cmp.Baseline, Results: []comparedResultV1{}, Benchmarks: []benchmarkComparisonV1{}}
+	for _, res := range cmp.Results {
+		v.Results = append(v.Results, comparedResultV1{ID: res.ID, UserID: res.UserID, System: newSysInfoV1(res.SysInfo)})
+	}
+	for _, b := range cmp.Benchmarks {
+		scores := make([]*comparedScoreV1, len(b.Scores))
+		for i, s := range b.Scores {
+			if s != nil {
+				scores[i] = &comparedScoreV1{Score: s.Score, TimeMS: durationMS(s.Time), Delta: s.Delta, DeltaPercent: s.DeltaPercent}
+			}
+		}
+		v.Benchmarks = append(v.Benchmarks, benchmarkComparisonV1{Name: b.Name, Scores: scores})
+	}
+	return v
+}
+
+func newLeaderboardEntryV1(e *leaderboardEntry) leaderboardEntryV1 {
+	return leaderboardEntryV1{
+		Rank:        e.Rank,
+		ResultID:    e.ResultID,
+		UserID:      e.UserID,
+		User:        e.User,
+		CreatedAt:   e.CreatedAt.UTC(),
+		TotalScore:  e.TotalScore,
+		TotalTimeMS: durationMS(e.TotalTime),
+		Scores:      newScoresV1(e.Scores),
+		System:      newSysInfoV1(e.SysInfo),
+	}
+}
+
+func newStatsV1(s *database.Stats) statsV1 {
+	return statsV1{
+		Group:     s.Group,
+		CPUID:     s.CPUID,
+		Benchmark: s.Benchmark,
+		Count:     s.Count,
+		Mean:      s.Mean,
+		Median:    s.Median,
+		P10:       s.P10,
+		P50:       s.P50,
+		P90:       s.P90,
+		StdDev:    s.StdDev,
+	}
+}
+
+func addV1Handlers(r *mux.Router, db database.OSBDatabase, bus *events.Bus) {
+	r.HandleFunc("/users", ListUsersV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{id:[0-9]+}", GetUserV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{id:[0-9]+}/results", ListUserResultsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/users/{id:[0-9]+}/trends", GetUserTrends(db)).Methods(http.MethodGet)
+	r.HandleFunc("/results", ListResultsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/results", AddResult(db, bus)).Methods(http.MethodPost)
+	r.HandleFunc("/results/live", LiveResults(bus)).Methods(http.MethodGet)
+	r.HandleFunc("/results/{id:[0-9]+}", GetResultV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/results/{id:[0-9]+}/specs", ListResultSpecsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/results/{id:[0-9]+}/hide", HideResult(db, bus)).Methods(http.MethodPost)
+	r.HandleFunc("/specs/{id:[0-9]+}", GetSpecsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus", ListCPUsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/{id:[0-9]+}", GetCPUV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/{id:[0-9]+}/results", ListCPUResultsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/cpus/{id:[0-9]+}/aliases", ListCPUAliasesV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/me", GetMe(db)).Methods(http.MethodGet)
+	r.HandleFunc("/tokens", ListTokens(db)).Methods(http.MethodGet)
+	r.HandleFunc("/tokens", CreateToken(db)).Methods(http.MethodPost)
+	r.HandleFunc("/tokens/{id:[0-9]+}", DeleteToken(db)).Methods(http.MethodDelete)
+	r.HandleFunc("/compare", CompareResultsV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/leaderboard", GetLeaderboardV1(db)).Methods(http.MethodGet)
+	r.HandleFunc("/stats", GetStatsV1(db)).Methods(http.MethodGet)
+}
+
+// maxPageSize is the largest accepted limit query parameter.
+const maxPageSize = 1000
+
+// parsePage returns the limit and after query parameters, which select up
+// to limit results with ids after the given one. The limit is 0 if not given.
+func parsePage(r *http.Request) (limit int, after int64, err error) {
+	query := r.URL.Query()
+	if query.Get("limit") == "" {
+		return 0, 0, nil
+	}
+	limit, err = strconv.Atoi(query.Get("limit"))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, 0, fmt.Errorf("limit: want 1 to %d", maxPageSize)
+	}
+	if s := query.Get("after"); s != "" {
+		if after, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, errors.New("after: want a result id")
+		}
+	}
+	return limit, after, nil
+}
+
+// paginate returns the page of results selected by the limit and after query
+// parameters, ordered by id, which list fetches with one more result than the
+// limit. Without a limit, all returns all results. If more results follow
+// the page, a Link header points to the next page.
+func paginate(w http.ResponseWriter, r *http.Request, all func() ([]*database.Result, error), list func(after int64, limit int) ([]*database.Result, error)) ([]*database.Result, error) {
+	limit, after, err := parsePage(r)
+	if err != nil {
+		return nil, &rejectedError{http.StatusBadRequest, err.Error()}
+	}
+	if limit == 0 {
+		return all()
+	}
+
+	page, err := list(after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(page) > limit {
+		page = page[:limit]
+		query := r.URL.Query()
+		query.Set("after", strconv.FormatInt(page[limit-1].ID, 10))
+		next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		w.Header().Set("Link", "<"+next.String()+`>; rel="next"`)
+	}
+	return page, nil
+}
+
+// sendV1 responds with v, or with err if it is not nil, such as the
+// *rejectedError of invalid query parameters.
+func sendV1(w http.ResponseWriter, r *http.Request, v interface{}, err error) {
+	var rejected *rejectedError
+	if errors.As(err, &rejected) {
+		sendErrorStatus(w, r, rejected.status, rejected.msg)
+		return
+	}
+	if err == nil {
+		err = sendJSONResponse(w, v)
+	}
+	if err != nil {
+		sendError(w, r, err)
+	}
+}
+
+// sendPageV1 responds with a page of results, or with err if it is not nil.
+func sendPageV1(w http.ResponseWriter, r *http.Request, page []*database.Result, err error) {
+	sendV1(w, r, newResultsV1(page), err)
+}
+
+// ListUsersV1 returns all users.
+func ListUsersV1(db database.UserDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := db.ListUsers()
+		v := make([]userV1, len(users))
+		for i, u := range users {
+			v[i] = newUserV1(u)
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// GetUserV1 returns the user with the given id.
+func GetUserV1(db database.UserDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		user, err := db.GetUser(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendV1(w, r, newUserV1(user), nil)
+	}
+}
+
+// ListUserResultsV1 returns the results of the user with the given id, or a
+// page of them, see paginate.
+func ListUserResultsV1(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if _, err := db.GetUser(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		page, err := paginate(w, r,
+			func() ([]*database.Result, error) { return db.ListResultsCreatedBy(id) },
+			func(after int64, limit int) ([]*database.Result, error) {
+				return db.ListResultsCreatedByAfter(id, after, limit)
+			})
+		sendPageV1(w, r, page, err)
+	}
+}
+
+// ListResultsV1 returns all results, or a page of them, see paginate.
+// Requested as CSV or NDJSON, it responds like ListResults, whose rows are
+// already snake_case.
+func ListResultsV1(db database.OSBDatabase) http.HandlerFunc {
+	legacy := ListResults(db)
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, err := negotiateFormat(r)
+		if err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if format != formatJSON {
+			legacy(w, r)
+			return
+		}
+		page, err := paginate(w, r, db.ListResults, db.ListResultsAfter)
+		sendPageV1(w, r, page, err)
+	}
+}
+
+// GetResultV1 returns the result with the given id along with the percentile
+// ranks of its scores.
+func GetResultV1(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		res, err := db.GetResult(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		ranks, err := db.ResultRanks(id)
+		sendV1(w, r, resultDetailV1{resultV1: newResultV1(res), Ranks: ranks}, err)
+	}
+}
+
+// ListResultSpecsV1 returns the specs of the result with the given id.
+func ListResultSpecsV1(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if _, err := db.GetResult(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		specs, err := db.ListSpecsWithResultID(id)
+		v := make([]specsV1, len(specs))
+		for i, s := range specs {
+			v[i] = newSpecsV1(s)
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// GetSpecsV1 returns the specs with the given id.
+func GetSpecsV1(db database.SpecsDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		specs, err := db.GetSpecs(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendV1(w, r, newSpecsV1(specs), nil)
+	}
+}
+
+// ListCPUsV1 returns all catalogued CPUs, or the one a model resolves to,
+// see listCPUs.
+func ListCPUsV1(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cpus, err := listCPUs(db, r)
+		v := make([]cpuV1, len(cpus))
+		for i, c := range cpus {
+			v[i] = newCPUV1(c)
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// GetCPUV1 returns the CPU with the given id.
+func GetCPUV1(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		cpu, err := db.GetCPU(id)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendV1(w, r, newCPUV1(cpu), nil)
+	}
+}
+
+// ListCPUResultsV1 returns the results whose specs resolve to the CPU with
+// the given id.
+func ListCPUResultsV1(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if _, err := db.GetCPU(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		results, err := db.ListResultsByCPU(id)
+		sendV1(w, r, newResultsV1(results), err)
+	}
+}
+
+// ListCPUAliasesV1 returns the aliases of the CPU with the given id.
+func ListCPUAliasesV1(db database.CatalogDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := routeID(r)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if _, err := db.GetCPU(id); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		aliases, err := db.ListCPUAliases(id)
+		v := make([]cpuAliasV1, len(aliases))
+		for i, a := range aliases {
+			v[i] = cpuAliasV1{ID: a.ID, CPUID: a.CPUID, Model: a.Model}
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// CompareResultsV1 compares results like CompareResults.
+func CompareResultsV1(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cmp, err := queryComparison(db, r)
+		if err != nil {
+			sendV1(w, r, nil, err)
+			return
+		}
+		sendV1(w, r, newComparisonV1(cmp), nil)
+	}
+}
+
+// GetLeaderboardV1 returns the leaderboard like GetLeaderboard. Requested as
+// CSV or NDJSON, it responds like GetLeaderboard, whose rows are already
+// snake_case.
+func GetLeaderboardV1(db database.OSBDatabase) http.HandlerFunc {
+	return leaderboardHandler(db, func(e *leaderboardEntry) interface{} { return newLeaderboardEntryV1(e) })
+}
+
+// GetStatsV1 returns score statistics like GetStats.
+func GetStatsV1(db database.StatsDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := queryStats(db, r)
+		if err != nil {
+			sendV1(w, r, nil, err)
+			return
+		}
+		v := make([]statsV1, len(stats))
+		for i, s := range stats {
+			v[i] = newStatsV1(s)
+		}
+		w.Header().Set("Cache-Control", statsCacheControl)
+		sendV1(w, r, v, nil)
+	}
+}
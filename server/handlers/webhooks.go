@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/events"
+	"github.com/mguid65/osb-website/server/webhooks"
+)
+
+const (
+	// maxWebhooksPerUser is the number of webhooks a user may register.
+	maxWebhooksPerUser = 10
+	// maxWebhookURLLen is the longest accepted webhook URL.
+	maxWebhookURLLen = 2048
+	// deliveryLogSize is the number of latest deliveries listed per webhook.
+	deliveryLogSize = 100
+)
+
+// webhookEvents are the event types webhooks can be delivered.
+var webhookEvents = []string{events.ResultCreated, events.ResultHidden, events.RankChanged, events.RecordSet}
+
+// webhookV1 is a webhook in /api/v1. Its secret is only returned once, when
+// it is created.
+type webhookV1 struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"` // all if empty
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// webhookRequest is the body of a webhook creation request.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // all if empty
+}
+
+// deliveryV1 is a logged webhook delivery in /api/v1.
+type deliveryV1 struct {
+	ID            int64           `json:"id"`
+	WebhookID     int64           `json:"webhook_id"`
+	EventType     string          `json:"event_type"`
+	Status        string          `json:"status"` // pending, delivered or failed
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code"` // 0 if there was no response
+	Error         string          `json:"error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	LastAttemptAt *time.Time      `json:"last_attempt_at"` // nil if there was no attempt
+	NextAttemptAt *time.Time      `json:"next_attempt_at"` // nil unless pending
+	Payload       json.RawMessage `json:"payload"`
+}
+
+func newWebhookV1(h *database.Webhook) webhookV1 {
+	v := webhookV1{ID: h.ID, UserID: h.UserID, URL: h.URL, Events: h.Events, CreatedAt: h.CreatedAt.UTC()}
+	if v.Events == nil {
+		v.Events = []string{}
+	}
+	return v
+}
+
+func newDeliveryV1(d *database.Delivery) deliveryV1 {
+	v := deliveryV1{
+		ID:           d.ID,
+		WebhookID:    d.WebhookID,
+		EventType:    d.EventType,
+		Status:       d.Status,
+		Attempts:     d.Attempts,
+		ResponseCode: d.ResponseCode,
+		Error:        d.Error,
+		CreatedAt:    d.CreatedAt.UTC(),
+		Payload:      json.RawMessage(d.Payload),
+	}
+	if !d.LastAttemptAt.IsZero() {
+		t := d.LastAttemptAt.UTC()
+		v.LastAttemptAt = &t
+	}
+	if d.Status == database.DeliveryPending {
+		t := d.NextAttemptAt.UTC()
+		v.NextAttemptAt = &t
+	}
+	return v
+}
+
+// WithWebhooks uses dispatcher to check webhook URLs and send test
+// deliveries. Without it, the handler uses a dispatcher of its own. Either
+// way, the handler only queues deliveries through the event bus: the
+// dispatcher must be run to deliver them.
+func WithWebhooks(dispatcher *webhooks.Dispatcher) Option {
+	return func(o *options) { o.webhooks = dispatcher }
+}
+
+func addWebhookHandlers(r *mux.Router, db database.OSBDatabase, dispatcher *webhooks.Dispatcher) {
+	r.HandleFunc("/webhooks", ListWebhooks(db)).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks", CreateWebhook(db, dispatcher)).Methods(http.MethodPost)
+	r.HandleFunc("/webhooks/{id:[0-9]+}", GetWebhook(db)).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{id:[0-9]+}", DeleteWebhook(db)).Methods(http.MethodDelete)
+	r.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", ListWebhookDeliveries(db)).Methods(http.MethodGet)
+	r.HandleFunc("/webhooks/{id:[0-9]+}/test", TestWebhook(db, dispatcher)).Methods(http.MethodPost)
+}
+
+// webhookOf returns the webhook with the id of the request if the user may
+// manage it: it is theirs, or they are an admin. Otherwise it responds with
+// an error, not found for other users' webhooks, and returns false.
+func webhookOf(w http.ResponseWriter, r *http.Request, db database.WebhookDatabase, user *database.User) (*database.Webhook, bool) {
+	id, err := routeID(r)
+	if err != nil {
+		sendError(w, r, err)
+		return nil, false
+	}
+	hook, err := db.GetWebhook(id)
+	if err == nil && hook.UserID != user.ID && !user.Admin {
+		err = fmt.Errorf("webhook %d %w", id, database.ErrNotFound)
+	}
+	if err != nil {
+		sendError(w, r, err)
+		return nil, false
+	}
+	return hook, true
+}
+
+// ListWebhooks returns the webhooks of the authenticated user without their
+// secrets.
+func ListWebhooks(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		hooks, err := db.ListWebhooks(user.ID)
+		v := make([]webhookV1, len(hooks))
+		for i, h := range hooks {
+			v[i] = newWebhookV1(h)
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// CreateWebhook registers a webhook for the authenticated user and returns
+// it along with its secret, which cannot be retrieved later. Deliveries are
+// signed with the secret, see webhooks.Sign. URLs whose host resolves to an
+// address the dispatcher does not deliver to, such as a loopback or private
+// one, are refused.
+func CreateWebhook(db database.OSBDatabase, dispatcher *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorStatus(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(req.URL) > maxWebhookURLLen {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, "url must be an absolute http or https URL")
+			return
+		}
+		for _, typ := range req.Events {
+			if !contains(webhookEvents, typ) {
+				sendErrorStatus(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("unknown event type %q, want one of %v", typ, webhookEvents))
+				return
+			}
+		}
+		if err := dispatcher.CheckURL(r.Context(), u); err != nil {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+
+		hooks, err := db.ListWebhooks(user.ID)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		if len(hooks) >= maxWebhooksPerUser {
+			sendErrorStatus(w, r, http.StatusUnprocessableEntity, fmt.Sprintf("at most %d webhooks can be registered", maxWebhooksPerUser))
+			return
+		}
+
+		secret, err := database.NewWebhookSecret()
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		hook := &database.Webhook{
+			UserID:    user.ID,
+			URL:       req.URL,
+			Secret:    secret,
+			Events:    req.Events,
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		if hook.ID, err = db.AddWebhook(hook); err != nil {
+			sendError(w, r, err)
+			return
+		}
+
+		v := newWebhookV1(hook)
+		v.Secret = secret
+		sendV1(w, r, v, nil)
+	}
+}
+
+// contains reports whether s is in list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWebhook returns a webhook of the authenticated user without its secret.
+func GetWebhook(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		if hook, ok := webhookOf(w, r, db, user); ok {
+			sendV1(w, r, newWebhookV1(hook), nil)
+		}
+	}
+}
+
+// DeleteWebhook deletes a webhook of the authenticated user along with its
+// delivery log.
+func DeleteWebhook(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		hook, ok := webhookOf(w, r, db, user)
+		if !ok {
+			return
+		}
+		if err := db.DeleteWebhook(hook.ID); err != nil {
+			sendError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// ListWebhookDeliveries returns the latest deliveries of a webhook of the
+// authenticated user, newest first.
+func ListWebhookDeliveries(db database.OSBDatabase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		hook, ok := webhookOf(w, r, db, user)
+		if !ok {
+			return
+		}
+		deliveries, err := db.ListDeliveries(hook.ID, deliveryLogSize)
+		v := make([]deliveryV1, len(deliveries))
+		for i, d := range deliveries {
+			v[i] = newDeliveryV1(d)
+		}
+		sendV1(w, r, v, err)
+	}
+}
+
+// TestWebhook delivers a webhook.test event to a webhook of the
+// authenticated user right away and returns the delivery. A failed test
+// delivery is not retried.
+func TestWebhook(db database.OSBDatabase, dispatcher *webhooks.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(w, r, db)
+		if !ok {
+			return
+		}
+		hook, ok := webhookOf(w, r, db, user)
+		if !ok {
+			return
+		}
+		delivery, err := dispatcher.Test(r.Context(), hook)
+		if err != nil {
+			sendError(w, r, err)
+			return
+		}
+		sendV1(w, r, newDeliveryV1(delivery), nil)
+	}
+}
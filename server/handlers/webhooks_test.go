@@ -0,0 +1,143 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mguid65/osb-website/server/handlers"
+	"github.com/mguid65/osb-website/server/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	var secret string
+	signed := make(chan bool, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signed <- r.Header.Get(webhooks.EventHeader) == webhooks.TestEvent &&
+			webhooks.Verify(secret, body, r.Header.Get(webhooks.SignatureHeader))
+	}))
+	defer receiver.Close()
+
+	db := newFixtureDB(t, catalogFixture())
+	dispatcher := webhooks.NewDispatcher(db, nil)
+	dispatcher.AllowIP = func(net.IP) bool { return true } // the receiver is on loopback
+	h := handlers.Handler(db, handlers.WithWebhooks(dispatcher))
+	do := func(method, path, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth(user, "password")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{"url": "ftp://example.com/hook"}`,
+		`{"url": "/hook"}`,
+		`{"url": "https://example.com/hook", "events": ["result.deleted"]}`,
+	} {
+		if rec := do("POST", "/api/v1/webhooks", "test", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status code: want %d, got %d", body, http.StatusUnprocessableEntity, rec.Code)
+		}
+	}
+
+	rec := do("POST", "/api/v1/webhooks", "test", fmt.Sprintf(`{"url": %q, "events": ["result.created", "record.set"]}`, receiver.URL))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create: status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	var created struct {
+		ID     int64    `json:"id"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Secret, "whsec_") || len(created.Events) != 2 {
+		t.Fatalf("create: unexpected webhook %+v", created)
+	}
+	secret = created.Secret
+	path := fmt.Sprintf("/api/v1/webhooks/%d", created.ID)
+
+	if rec := do("GET", "/api/v1/webhooks", "test", ""); strings.Contains(rec.Body.String(), secret) || !strings.Contains(rec.Body.String(), receiver.URL) {
+		t.Errorf("list: want the webhook without its secret, got %s", rec.Body)
+	}
+	if rec := do("GET", "/api/v1/webhooks", "admin", ""); rec.Body.String() != "[]\n" {
+		t.Errorf("list as admin: want only their own webhooks, got %s", rec.Body)
+	}
+	if rec := do("GET", path, "admin", ""); rec.Code != http.StatusOK {
+		t.Errorf("get as admin: status code: want %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	rec = do("POST", path+"/test", "test", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("test: status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if !<-signed {
+		t.Error("test: receiver got an unsigned delivery")
+	}
+	var delivery struct {
+		Status       string `json:"status"`
+		ResponseCode int    `json:"response_code"`
+		Payload      struct {
+			Type string `json:"type"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&delivery); err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != "delivered" || delivery.ResponseCode != http.StatusOK || delivery.Payload.Type != webhooks.TestEvent {
+		t.Errorf("test: unexpected delivery %+v", delivery)
+	}
+	if rec := do("GET", path+"/deliveries", "test", ""); !strings.Contains(rec.Body.String(), `"event_type":"webhook.test"`) {
+		t.Errorf("deliveries: test delivery is not logged: %s", rec.Body)
+	}
+
+	// Admin webhooks are not visible to other users.
+	rec = do("POST", "/api/v1/webhooks", "admin", fmt.Sprintf(`{"url": %q}`, receiver.URL))
+	var adminHook struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&adminHook); err != nil {
+		t.Fatal(err)
+	}
+	adminPath := fmt.Sprintf("/api/v1/webhooks/%d", adminHook.ID)
+	for _, method := range []string{"GET", "DELETE"} {
+		if rec := do(method, adminPath, "test", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("%s other's webhook: status code: want %d, got %d", method, http.StatusNotFound, rec.Code)
+		}
+	}
+
+	if rec := do("DELETE", path, "test", ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status code: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body)
+	}
+	if rec := do("GET", path+"/deliveries", "test", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted: status code: want %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestWebhookInternalURL(t *testing.T) {
+	h := handlers.Handler(newFixtureDB(t, catalogFixture()))
+	for _, u := range []string{
+		"http://127.0.0.1/hook",
+		"http://localhost:8080/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+	} {
+		req := httptest.NewRequest("POST", "/api/v1/webhooks", strings.NewReader(fmt.Sprintf(`{"url": %q}`, u)))
+		req.SetBasicAuth("test", "password")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status code: want %d, got %d", u, http.StatusUnprocessableEntity, rec.Code)
+		}
+	}
+}
@@ -1,24 +1,53 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"golang.org/x/crypto/ssh/terminal"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/mguid65/osb-website/server/archive"
 	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/dataset"
+	"github.com/mguid65/osb-website/server/events"
 	"github.com/mguid65/osb-website/server/handlers"
+	"github.com/mguid65/osb-website/server/webhooks"
 )
 
+const usage = `usage: server [flags] [command]
+
+With no command, server serves the website. The commands are:
+
+	export [-passwords] [-o file]  write users, results and specs to an archive
+	import -i file                 load an archive into the database
+
+Flags:
+`
+
 func main() {
 	user := flag.String("dbuser", "osbadmin", "the database user")
 	host := flag.String("dbhost", "127.0.0.1", "the database address")
 	port := flag.String("dbport", "3306", "the database port")
 	name := flag.String("dbname", "osb_db", "the database name")
+	datasets := flag.String("datasets", "./datasets", "the directory of open-data snapshots, empty to disable them")
+	datasetInterval := flag.Duration("dataset-interval", 24*time.Hour, "the interval between open-data snapshots")
+	datasetKeep := flag.Int("dataset-keep", 7, "the number of open-data snapshots to keep, 0 for no limit")
+	datasetMaxAge := flag.Duration("dataset-max-age", 0, "the age after which open-data snapshots are deleted, 0 for no limit")
+	grpcPort := flag.String("grpc-port", "8443", "the port of the gRPC ingestion service, empty to disable it")
+	siteURL := flag.String("site-url", "https://localhost", "the URL the website is served at, which feeds link to")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	fmt.Fprint(os.Stderr, "DB Password: ")
@@ -34,13 +63,120 @@ func main() {
 	}
 	defer db.Close()
 
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		// Result events are streamed under /api/events and delivered to
+		// the registered webhooks.
+		bus := events.NewBus(1024)
+		dispatcher := webhooks.NewDispatcher(db, nil)
+		go dispatcher.Run(context.Background(), bus)
+		site, err := url.Parse(*siteURL)
+		if err != nil || site.Scheme == "" || site.Host == "" {
+			log.Fatalf("site-url: want an absolute URL, got %q", *siteURL)
+		}
+		opts := []handlers.Option{handlers.WithEvents(bus), handlers.WithWebhooks(dispatcher), handlers.WithSiteURL(site)}
+		if *datasets != "" {
+			// Users are hashed with OSB_DATASET_KEY, or dropped if it is unset.
+			retention := dataset.Retention{Keep: *datasetKeep, MaxAge: *datasetMaxAge}
+			store, err := dataset.NewStore(*datasets, []byte(os.Getenv("OSB_DATASET_KEY")), retention)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			go store.Run(context.Background(), db, *datasetInterval)
+			opts = append(opts, handlers.WithDatasets(store))
+		}
+		serve(db, *grpcPort, opts...)
+	case "export":
+		if err := exportArchive(db, flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	case "import":
+		if err := importArchive(db, flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// serve serves the website, and the gRPC ingestion service on grpcPort
+// unless it is empty.
+func serve(db database.OSBDatabase, grpcPort string, opts ...handlers.Option) {
 	var (
 		addr     = ":443"
 		certFile = "/home/osbadmin/cert/key.pem"
 		keyFile  = "/home/osbadmin/cert/key.key"
-		handler  = handlers.Handler(db)
+		handler  = handlers.Handler(db, opts...)
 	)
 
+	if grpcPort != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		lis, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		srv := handlers.NewIngestServer(db, creds, opts...)
+		go func() { log.Fatal(srv.Serve(lis)) }()
+		fmt.Printf("Listening for gRPC ingestion on localhost:%s\n", grpcPort)
+	}
+
 	fmt.Println("Listening on https://localhost:443/")
 	log.Fatal(http.ListenAndServeTLS(addr, certFile, keyFile, handler))
 }
+
+// exportArchive writes the database to an archive file or standard output.
+func exportArchive(db database.OSBDatabase, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	passwords := fs.Bool("passwords", false, "include password hashes")
+	out := fs.String("o", "", "the archive file, standard output if empty")
+	fs.Parse(args)
+
+	f := os.Stdout
+	if *out != "" {
+		var err error
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := archive.Export(f, db, archive.ExportOptions{Passwords: *passwords})
+	if *out != "" {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"users", "results", "specs"} {
+		log.Printf("exported %d %s", manifest.Files[name+".ndjson"].Records, name)
+	}
+	return nil
+}
+
+// importArchive loads an archive file into the database. Standard input is
+// not supported since it is used to read the database password.
+func importArchive(db database.OSBDatabase, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("i", "", "the archive file")
+	fs.Parse(args)
+	if *in == "" {
+		return errors.New("import: missing archive file, use -i")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stats, err := archive.Import(f, db)
+	if stats != nil {
+		log.Printf("imported %d users, %d results and %d specs", stats.Users, stats.Results, stats.Specs)
+	}
+	return err
+}
@@ -0,0 +1,374 @@
+// Package webhooks posts the events published on an events.Bus to the URLs
+// users register, signed with each webhook's secret.
+//
+// Deliveries are queued in the database before they are attempted, so they
+// survive restarts, and failed attempts are retried with exponential backoff
+// up to MaxAttempts times. A receiver may get a delivery more than once, and
+// can tell by its X-OSB-Delivery header.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/events"
+)
+
+// Request headers of deliveries.
+const (
+	SignatureHeader = "X-OSB-Signature-256" // "sha256=" and the hex encoded HMAC-SHA256 of the body
+	EventHeader     = "X-OSB-Event"         // event type
+	DeliveryHeader  = "X-OSB-Delivery"      // delivery ID, the same for every attempt
+)
+
+// TestEvent is the type of the events sent by Dispatcher.Test.
+const TestEvent = "webhook.test"
+
+// MaxAttempts is the number of times a delivery is attempted before it is
+// given up.
+const MaxAttempts = 8
+
+const (
+	// pollInterval is the interval of the checks for due retries.
+	pollInterval = 15 * time.Second
+	// eventBuffer is the number of events the dispatcher may fall behind by
+	// before resubscribing.
+	eventBuffer = 256
+	// batchSize is the number of due deliveries loaded at once.
+	batchSize = 100
+	// maxErrorLen is the longest delivery error stored.
+	maxErrorLen = 255
+)
+
+// Sign returns the signature of body with secret, as sent in the
+// SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body with secret.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// payload is the JSON body of a delivery.
+type payload struct {
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Backoff returns the delay before the next attempt of a delivery that
+// failed the given number of times: a minute, doubling up to 6 hours.
+func Backoff(attempts int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempts && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 6*time.Hour {
+		d = 6 * time.Hour
+	}
+	return d
+}
+
+// Dispatcher queues and delivers events to webhooks.
+type Dispatcher struct {
+	// Backoff returns the delay before the next attempt of a delivery that
+	// failed the given number of times. It is the Backoff function unless
+	// set.
+	Backoff func(attempts int) time.Duration
+
+	// AllowIP reports whether deliveries may be posted to ip. It is the
+	// PublicIP function unless set.
+	AllowIP func(ip net.IP) bool
+
+	db     database.WebhookDatabase
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewDispatcher returns a dispatcher of the webhooks in db, which posts with
+// client. If client is nil, a client with a 10 second timeout that does not
+// follow redirects or use proxies is used, and it refuses to connect to
+// addresses AllowIP rejects, whatever the host resolved to when the webhook
+// was created.
+func NewDispatcher(db database.WebhookDatabase, client *http.Client) *Dispatcher {
+	d := &Dispatcher{
+		Backoff: Backoff,
+		AllowIP: PublicIP,
+		db:      db,
+		client:  client,
+		wake:    make(chan struct{}, 1),
+	}
+	if d.client == nil {
+		dialer := &net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !d.AllowIP(ip) {
+					return fmt.Errorf("webhooks: address %s is not allowed", host)
+				}
+				return nil
+			},
+		}
+		d.client = &http.Client{
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			Timeout:   10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	return d
+}
+
+// PublicIP reports whether ip is a public unicast address: not loopback,
+// private, link-local, multicast or unspecified.
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// CheckURL resolves the host of u and returns an error unless AllowIP allows
+// every address it resolves to.
+func (d *Dispatcher) CheckURL(ctx context.Context, u *url.URL) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("webhooks: could not resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !d.AllowIP(addr.IP) {
+			return fmt.Errorf("webhooks: %s resolves to %s, which is not allowed", u.Hostname(), addr.IP)
+		}
+	}
+	return nil
+}
+
+// Run queues the events published on bus for the webhooks wanting them, and
+// delivers the queued deliveries as they become due, until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, bus *events.Bus) {
+	go d.queueEvents(ctx, bus)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-d.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		timer.Reset(d.deliverDue(ctx))
+	}
+}
+
+// queueEvents queues the events published on bus until ctx is done. If the
+// subscription falls behind, it resumes after the last event it queued.
+func (d *Dispatcher) queueEvents(ctx context.Context, bus *events.Bus) {
+	var lastID uint64
+	for {
+		sub, complete := bus.Subscribe(lastID, eventBuffer)
+		if !complete {
+			log.Printf("webhooks: missed the events after %d", lastID)
+		}
+	subscribed:
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					break subscribed
+				}
+				if err := d.Queue(e); err != nil {
+					log.Printf("webhooks: could not queue event %d: %v", e.ID, err)
+				}
+				lastID = e.ID
+			}
+		}
+	}
+}
+
+// Queue queues deliveries of e to the webhooks wanting it.
+func (d *Dispatcher) Queue(e *events.Event) error {
+	hooks, err := d.db.ListWebhooks(0)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	for _, hook := range hooks {
+		if !hook.Wants(e.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(payload{Type: e.Type, CreatedAt: e.Time, Data: e.Data}); err != nil {
+				return err
+			}
+		}
+		delivery := &database.Delivery{
+			WebhookID:     hook.ID,
+			EventType:     e.Type,
+			Payload:       body,
+			Status:        database.DeliveryPending,
+			CreatedAt:     e.Time,
+			NextAttemptAt: e.Time,
+		}
+		if _, err := d.db.AddDelivery(delivery); err != nil {
+			return err
+		}
+	}
+	if body != nil {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// deliverDue attempts the deliveries that are due, and returns the time
+// until the next check: the poll interval, or less if a retry is due sooner.
+func (d *Dispatcher) deliverDue(ctx context.Context) time.Duration {
+	wait := pollInterval
+	for ctx.Err() == nil {
+		due, err := d.db.ListDueDeliveries(time.Now().UTC(), batchSize)
+		if err != nil {
+			log.Printf("webhooks: could not list due deliveries: %v", err)
+			return wait
+		}
+		for _, delivery := range due {
+			hook, err := d.db.GetWebhook(delivery.WebhookID)
+			if errors.Is(err, database.ErrNotFound) {
+				continue // deleted along with its deliveries since
+			}
+			if err != nil {
+				log.Printf("webhooks: could not get webhook %d: %v", delivery.WebhookID, err)
+				return wait
+			}
+			d.attempt(ctx, hook, delivery, MaxAttempts)
+			if delivery.Status == database.DeliveryPending {
+				if w := time.Until(delivery.NextAttemptAt); w < wait {
+					wait = w
+				}
+			}
+		}
+		if len(due) < batchSize {
+			break
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// attempt posts delivery to hook and saves the outcome. It is given up after
+// maxAttempts attempts.
+func (d *Dispatcher) attempt(ctx context.Context, hook *database.Webhook, delivery *database.Delivery, maxAttempts int) {
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = now
+	code, err := d.post(ctx, hook, delivery)
+	delivery.ResponseCode = code
+	switch {
+	case err == nil:
+		delivery.Status = database.DeliveryDelivered
+		delivery.Error = ""
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = database.DeliveryFailed
+	default:
+		delivery.NextAttemptAt = now.Add(d.Backoff(delivery.Attempts))
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+		if len(delivery.Error) > maxErrorLen {
+			delivery.Error = delivery.Error[:maxErrorLen]
+		}
+	}
+	if err := d.db.UpdateDelivery(delivery); err != nil {
+		log.Printf("webhooks: could not save delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// post posts delivery to hook, returning the response status code, if any,
+// and an error unless the receiver responded with a 2xx status.
+func (d *Dispatcher) post(ctx context.Context, hook *database.Webhook, delivery *database.Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OSB-Webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Test delivers a TestEvent to hook right away, once, and returns the
+// delivery, which is logged like the others.
+func (d *Dispatcher) Test(ctx context.Context, hook *database.Webhook) (*database.Delivery, error) {
+	now := time.Now().UTC()
+	body, err := json.Marshal(payload{
+		Type:      TestEvent,
+		CreatedAt: now,
+		Data:      map[string]int64{"webhook_id": hook.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery := &database.Delivery{
+		WebhookID: hook.ID,
+		EventType: TestEvent,
+		Payload:   body,
+		// Saved as given up, so the poller never picks it up before it
+		// is attempted below.
+		Status:        database.DeliveryFailed,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	if delivery.ID, err = d.db.AddDelivery(delivery); err != nil {
+		return nil, err
+	}
+	d.attempt(ctx, hook, delivery, 1)
+	return delivery, nil
+}
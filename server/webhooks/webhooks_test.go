@@ -0,0 +1,298 @@
+package webhooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mguid65/osb-website/server/database"
+	"github.com/mguid65/osb-website/server/database/dbtest"
+	"github.com/mguid65/osb-website/server/events"
+	"github.com/mguid65/osb-website/server/webhooks"
+)
+
+// delivery is a request received by a receiver.
+type delivery struct {
+	Event, ID string
+	Body      []byte
+	Signed    bool
+}
+
+// receiver is a webhook receiver that responds with the status codes in
+// statuses, then 200.
+type receiver struct {
+	*httptest.Server
+	secret string
+
+	mu        sync.Mutex
+	statuses  []int
+	delivered chan delivery
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+	rec := &receiver{secret: secret, statuses: statuses, delivered: make(chan delivery, 100)}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rec.delivered <- delivery{
+			Event:  r.Header.Get(webhooks.EventHeader),
+			ID:     r.Header.Get(webhooks.DeliveryHeader),
+			Body:   body,
+			Signed: webhooks.Verify(rec.secret, body, r.Header.Get(webhooks.SignatureHeader)),
+		}
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if len(rec.statuses) > 0 {
+			w.WriteHeader(rec.statuses[0])
+			rec.statuses = rec.statuses[1:]
+		}
+	}))
+	t.Cleanup(rec.Close)
+	return rec
+}
+
+// next returns the next delivery the receiver got.
+func (rec *receiver) next(t *testing.T) delivery {
+	t.Helper()
+	select {
+	case d := <-rec.delivered:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+		return delivery{}
+	}
+}
+
+func newDB(t *testing.T) *dbtest.DB {
+	db := dbtest.New()
+	if _, err := db.AddUser(&database.User{Name: "bot", Password: dbtest.HashPassword("password")}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func addWebhook(t *testing.T, db *dbtest.DB, url string, events ...string) *database.Webhook {
+	t.Helper()
+	hook := &database.Webhook{UserID: 1, URL: url, Secret: "whsec_test", Events: events, CreatedAt: time.Now()}
+	var err error
+	if hook.ID, err = db.AddWebhook(hook); err != nil {
+		t.Fatal(err)
+	}
+	return hook
+}
+
+// newDispatcher returns a dispatcher of the webhooks in db that delivers to
+// the receivers, which listen on loopback.
+func newDispatcher(db *dbtest.DB) *webhooks.Dispatcher {
+	d := webhooks.NewDispatcher(db, nil)
+	d.AllowIP = func(net.IP) bool { return true }
+	return d
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"result.created"}`)
+	sig := webhooks.Sign("whsec_test", body)
+	if want := "sha256="; sig[:len(want)] != want || len(sig) != len(want)+64 {
+		t.Errorf("signature %q is not a hex SHA-256 HMAC", sig)
+	}
+	if !webhooks.Verify("whsec_test", body, sig) {
+		t.Error("signature does not verify")
+	}
+	if webhooks.Verify("whsec_other", body, sig) || webhooks.Verify("whsec_test", append(body, ' '), sig) {
+		t.Error("signature verifies with another secret or body")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 20: 6 * time.Hour} {
+		if got := webhooks.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d): want %v, got %v", attempts, want, got)
+		}
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	db := newDB(t)
+	rec := newReceiver(t, "whsec_test", http.StatusInternalServerError, http.StatusBadGateway)
+	hook := addWebhook(t, db, rec.URL, events.ResultCreated)
+
+	bus := events.NewBus(10)
+	d := newDispatcher(db)
+	d.Backoff = func(int) time.Duration { return 10 * time.Millisecond }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, bus)
+	time.Sleep(50 * time.Millisecond) // let Run subscribe
+
+	bus.Publish(events.ResultHidden, map[string]int{"result_id": 1})
+	bus.Publish(events.ResultCreated, map[string]int{"id": 2})
+
+	var id string
+	for i := 0; i < 3; i++ {
+		got := rec.next(t)
+		if got.Event != events.ResultCreated || !got.Signed {
+			t.Fatalf("attempt %d: want signed result.created delivery, got %+v", i+1, got)
+		}
+		if id != "" && got.ID != id {
+			t.Errorf("attempt %d: delivery ID changed from %s to %s", i+1, id, got.ID)
+		}
+		id = got.ID
+		var body struct {
+			Type string `json:"type"`
+			Data struct {
+				ID int `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(got.Body, &body); err != nil || body.Type != events.ResultCreated || body.Data.ID != 2 {
+			t.Errorf("attempt %d: unexpected body %s", i+1, got.Body)
+		}
+	}
+
+	deliveries := waitStatus(t, db, hook.ID, database.DeliveryDelivered)
+	if len(deliveries) != 1 {
+		t.Fatalf("want 1 delivery of result.created only, got %d", len(deliveries))
+	}
+	if d := deliveries[0]; strconv.FormatInt(d.ID, 10) != id || d.Attempts != 3 || d.ResponseCode != http.StatusOK || d.Error != "" {
+		t.Errorf("unexpected delivery log %+v", d)
+	}
+}
+
+// waitStatus waits for the latest delivery to the webhook with the given id
+// to have the given status, and returns the deliveries.
+func waitStatus(t *testing.T, db *dbtest.DB, webhookID int64, status string) []*database.Delivery {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(5 * time.Millisecond) {
+		deliveries, err := db.ListDeliveries(webhookID, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) > 0 && deliveries[0].Status == status {
+			return deliveries
+		}
+	}
+	t.Fatalf("no delivery became %s", status)
+	return nil
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	db := newDB(t)
+	statuses := make([]int, webhooks.MaxAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	rec := newReceiver(t, "whsec_test", statuses...)
+	hook := addWebhook(t, db, rec.URL)
+
+	// Deliveries queued before a restart are delivered after it.
+	if err := newDispatcher(db).Queue(&events.Event{ID: 1, Type: events.RecordSet, Time: time.Now(), Data: 1}); err != nil {
+		t.Fatal(err)
+	}
+	d := newDispatcher(db)
+	d.Backoff = func(int) time.Duration { return time.Millisecond }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, events.NewBus(1))
+
+	deliveries := waitStatus(t, db, hook.ID, database.DeliveryFailed)
+	if d := deliveries[0]; d.Attempts != webhooks.MaxAttempts || d.ResponseCode != http.StatusServiceUnavailable || d.Error == "" {
+		t.Errorf("unexpected delivery log %+v", d)
+	}
+	if n := len(rec.delivered); n != webhooks.MaxAttempts {
+		t.Errorf("want %d attempts, got %d", webhooks.MaxAttempts, n)
+	}
+}
+
+func TestDispatcherTest(t *testing.T) {
+	db := newDB(t)
+	rec := newReceiver(t, "whsec_test", http.StatusNotFound)
+	hook := addWebhook(t, db, rec.URL, events.RecordSet)
+	d := newDispatcher(db)
+
+	failed, err := d.Test(context.Background(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != database.DeliveryFailed || failed.ResponseCode != http.StatusNotFound || failed.Attempts != 1 {
+		t.Errorf("want failed test delivery, got %+v", failed)
+	}
+	delivered, err := d.Test(context.Background(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered.Status != database.DeliveryDelivered {
+		t.Errorf("want delivered test delivery, got %+v", delivered)
+	}
+	for i := 0; i < 2; i++ {
+		if got := rec.next(t); got.Event != webhooks.TestEvent || !got.Signed {
+			t.Errorf("want signed webhook.test delivery, got %+v", got)
+		}
+	}
+
+	logged, err := db.ListDeliveries(hook.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 2 || logged[0].ID != delivered.ID || logged[1].Status != database.DeliveryFailed {
+		t.Errorf("unexpected delivery log %+v", logged)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800:220::":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.0.1":      false,
+		"fd00::1":          false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"0.0.0.0":          false,
+		"::":               false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := webhooks.PublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("PublicIP(%s): want %v, got %v", ip, want, got)
+		}
+	}
+}
+
+func TestInternalAddress(t *testing.T) {
+	db := newDB(t)
+	rec := newReceiver(t, "whsec_test")
+	hook := addWebhook(t, db, rec.URL, events.RecordSet)
+	d := webhooks.NewDispatcher(db, nil)
+
+	u, err := url.Parse(rec.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CheckURL(context.Background(), u); err == nil {
+		t.Errorf("CheckURL(%s): want an error for a loopback address", u)
+	}
+
+	// The default client refuses to connect to the receiver even though the
+	// webhook was registered, as when its host is rebound to a loopback
+	// address after the check.
+	failed, err := d.Test(context.Background(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != database.DeliveryFailed || failed.ResponseCode != 0 || failed.Error == "" {
+		t.Errorf("want failed test delivery without a response, got %+v", failed)
+	}
+	select {
+	case got := <-rec.delivered:
+		t.Errorf("receiver on loopback got a delivery %+v", got)
+	default:
+	}
+}
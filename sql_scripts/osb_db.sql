@@ -15,6 +15,88 @@
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
+--
+-- Table structure for table `BenchmarkScores`
+--
+
+DROP TABLE IF EXISTS `BenchmarkScores`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `BenchmarkScores` (
+  `result_id` int(11) NOT NULL,
+  `benchmark` varchar(64) NOT NULL,
+  `score` double NOT NULL,
+  PRIMARY KEY (`result_id`,`benchmark`),
+  KEY `benchmark_score` (`benchmark`,`score`),
+  CONSTRAINT `BenchmarkScores_ibfk_1` FOREIGN KEY (`result_id`) REFERENCES `Results` (`result_id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `BenchmarkScores`
+--
+
+LOCK TABLES `BenchmarkScores` WRITE;
+/*!40000 ALTER TABLE `BenchmarkScores` DISABLE KEYS */;
+/*!40000 ALTER TABLE `BenchmarkScores` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `CPUAliases`
+--
+
+DROP TABLE IF EXISTS `CPUAliases`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `CPUAliases` (
+  `alias_id` int(11) NOT NULL AUTO_INCREMENT,
+  `cpu_id` int(11) NOT NULL,
+  `model` varchar(255) NOT NULL,
+  PRIMARY KEY (`alias_id`),
+  UNIQUE KEY `model` (`model`),
+  KEY `cpu_id` (`cpu_id`),
+  CONSTRAINT `CPUAliases_ibfk_1` FOREIGN KEY (`cpu_id`) REFERENCES `CPUs` (`cpu_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `CPUAliases`
+--
+
+LOCK TABLES `CPUAliases` WRITE;
+/*!40000 ALTER TABLE `CPUAliases` DISABLE KEYS */;
+/*!40000 ALTER TABLE `CPUAliases` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `CPUs`
+--
+
+DROP TABLE IF EXISTS `CPUs`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `CPUs` (
+  `cpu_id` int(11) NOT NULL AUTO_INCREMENT,
+  `vendor` varchar(64) NOT NULL,
+  `family` varchar(64) NOT NULL,
+  `model` varchar(255) NOT NULL,
+  `cores` int(11) NOT NULL DEFAULT '0',
+  `threads` int(11) NOT NULL DEFAULT '0',
+  `base_clock_hz` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`cpu_id`),
+  UNIQUE KEY `model` (`model`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `CPUs`
+--
+
+LOCK TABLES `CPUs` WRITE;
+/*!40000 ALTER TABLE `CPUs` DISABLE KEYS */;
+/*!40000 ALTER TABLE `CPUs` ENABLE KEYS */;
+UNLOCK TABLES;
+
 --
 -- Table structure for table `Results`
 --
@@ -26,8 +108,10 @@ CREATE TABLE `Results` (
   `result_id` int(11) NOT NULL AUTO_INCREMENT,
   `user_id` int(11) NOT NULL,
   `scores` json NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `hidden` tinyint(1) NOT NULL DEFAULT 0,
   PRIMARY KEY (`result_id`),
-  KEY `user_id` (`user_id`),
+  KEY `user_id` (`user_id`,`created_at`),
   CONSTRAINT `Results_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `Users` (`user_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 /*!40101 SET character_set_client = @saved_cs_client */;
@@ -52,8 +136,19 @@ CREATE TABLE `Specs` (
   `specs_id` int(11) NOT NULL AUTO_INCREMENT,
   `result_id` int(11) NOT NULL,
   `sys_info` json NOT NULL,
+  `clock_hz` bigint(20) DEFAULT NULL,
+  `threads` int(11) DEFAULT NULL,
+  `physical_mem_bytes` bigint(20) DEFAULT NULL,
+  `virtual_mem_bytes` bigint(20) DEFAULT NULL,
+  `swap_mem_bytes` bigint(20) DEFAULT NULL,
+  `overclocked` tinyint(1) NOT NULL DEFAULT '0',
+  `cpu_model` varchar(255) DEFAULT NULL,
+  `raw_sys_info` json DEFAULT NULL,
   PRIMARY KEY (`specs_id`),
   KEY `result_id` (`result_id`),
+  KEY `threads` (`threads`),
+  KEY `clock_hz` (`clock_hz`),
+  KEY `cpu_model` (`cpu_model`),
   CONSTRAINT `Specs_ibfk_1` FOREIGN KEY (`result_id`) REFERENCES `Results` (`result_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 /*!40101 SET character_set_client = @saved_cs_client */;
@@ -67,6 +162,68 @@ LOCK TABLES `Specs` WRITE;
 /*!40000 ALTER TABLE `Specs` ENABLE KEYS */;
 UNLOCK TABLES;
 
+--
+-- Table structure for table `Submissions`
+--
+
+DROP TABLE IF EXISTS `Submissions`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `Submissions` (
+  `submission_id` int(11) NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `result_id` int(11) NOT NULL,
+  `idem_key` varchar(255) DEFAULT NULL,
+  `fingerprint` char(64) NOT NULL,
+  `created_at` datetime NOT NULL,
+  `response` mediumblob DEFAULT NULL,
+  PRIMARY KEY (`submission_id`),
+  UNIQUE KEY `user_idem_key` (`user_id`,`idem_key`),
+  KEY `user_fingerprint` (`user_id`,`fingerprint`,`created_at`),
+  KEY `result_id` (`result_id`),
+  CONSTRAINT `Submissions_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `Users` (`user_id`),
+  CONSTRAINT `Submissions_ibfk_2` FOREIGN KEY (`result_id`) REFERENCES `Results` (`result_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `Submissions`
+--
+
+LOCK TABLES `Submissions` WRITE;
+/*!40000 ALTER TABLE `Submissions` DISABLE KEYS */;
+/*!40000 ALTER TABLE `Submissions` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `Tokens`
+--
+
+DROP TABLE IF EXISTS `Tokens`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `Tokens` (
+  `token_id` int(11) NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `hash` char(64) NOT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`token_id`),
+  UNIQUE KEY `hash` (`hash`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `Tokens_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `Users` (`user_id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `Tokens`
+--
+
+LOCK TABLES `Tokens` WRITE;
+/*!40000 ALTER TABLE `Tokens` DISABLE KEYS */;
+/*!40000 ALTER TABLE `Tokens` ENABLE KEYS */;
+UNLOCK TABLES;
+
 --
 -- Table structure for table `Users`
 --
@@ -79,7 +236,9 @@ CREATE TABLE `Users` (
   `username` varchar(20) NOT NULL,
   `email` varchar(255) NOT NULL,
   `passwd` varchar(255) NOT NULL,
-  PRIMARY KEY (`user_id`)
+  `is_admin` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`user_id`),
+  UNIQUE KEY `username` (`username`)
 ) ENGINE=InnoDB DEFAULT CHARSET=latin1;
 /*!40101 SET character_set_client = @saved_cs_client */;
 
@@ -91,6 +250,70 @@ LOCK TABLES `Users` WRITE;
 /*!40000 ALTER TABLE `Users` DISABLE KEYS */;
 /*!40000 ALTER TABLE `Users` ENABLE KEYS */;
 UNLOCK TABLES;
+
+--
+-- Table structure for table `WebhookDeliveries`
+--
+
+DROP TABLE IF EXISTS `WebhookDeliveries`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `WebhookDeliveries` (
+  `delivery_id` int(11) NOT NULL AUTO_INCREMENT,
+  `webhook_id` int(11) NOT NULL,
+  `event_type` varchar(64) NOT NULL,
+  `payload` mediumblob NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `attempts` int(11) NOT NULL DEFAULT '0',
+  `response_code` int(11) NOT NULL DEFAULT '0',
+  `error` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `last_attempt_at` datetime DEFAULT NULL,
+  `next_attempt_at` datetime NOT NULL,
+  PRIMARY KEY (`delivery_id`),
+  KEY `webhook_id` (`webhook_id`),
+  KEY `status_next_attempt_at` (`status`,`next_attempt_at`),
+  CONSTRAINT `WebhookDeliveries_ibfk_1` FOREIGN KEY (`webhook_id`) REFERENCES `Webhooks` (`webhook_id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `WebhookDeliveries`
+--
+
+LOCK TABLES `WebhookDeliveries` WRITE;
+/*!40000 ALTER TABLE `WebhookDeliveries` DISABLE KEYS */;
+/*!40000 ALTER TABLE `WebhookDeliveries` ENABLE KEYS */;
+UNLOCK TABLES;
+
+--
+-- Table structure for table `Webhooks`
+--
+
+DROP TABLE IF EXISTS `Webhooks`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `Webhooks` (
+  `webhook_id` int(11) NOT NULL AUTO_INCREMENT,
+  `user_id` int(11) NOT NULL,
+  `url` varchar(2048) NOT NULL,
+  `secret` varchar(128) NOT NULL,
+  `events` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`webhook_id`),
+  KEY `user_id` (`user_id`),
+  CONSTRAINT `Webhooks_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `Users` (`user_id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=latin1;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping data for table `Webhooks`
+--
+
+LOCK TABLES `Webhooks` WRITE;
+/*!40000 ALTER TABLE `Webhooks` DISABLE KEYS */;
+/*!40000 ALTER TABLE `Webhooks` ENABLE KEYS */;
+UNLOCK TABLES;
 /*!40103 SET TIME_ZONE=@OLD_TIME_ZONE */;
 
 /*!40101 SET SQL_MODE=@OLD_SQL_MODE */;